@@ -60,18 +60,25 @@ func (b *BlockChain) maybeAcceptBlock(block *pinutil.Block, flags BehaviorFlags)
 		return false, err
 	}
 
-	// Create a new block node for the block and add it to the node index. Even
+	// Create a new block node for the block and add it to the node index
+	// unless the header was already added ahead of the block data.  Even
 	// if the block ultimately gets connected to the main chain, it starts out
 	// on a side chain.
-	blockHeader := &block.MsgBlock().Header
-	newNode := newBlockNode(blockHeader, prevNode)
-	newNode.status = statusDataStored
-
-	b.index.AddNode(newNode)
+	newNode := b.index.LookupNode(block.Hash())
+	if newNode == nil {
+		blockHeader := &block.MsgBlock().Header
+		newNode = newBlockNode(blockHeader, prevNode)
+		newNode.status = statusDataStored
+		b.index.AddNode(newNode)
+	} else {
+		b.index.SetStatusFlags(newNode, statusDataStored)
+		b.index.releasePowHash(newNode)
+	}
 	err = b.index.flushToDB()
 	if err != nil {
 		return false, err
 	}
+	b.maybeUpdateBestHeader(newNode)
 
 	// Connect the passed block to the chain while respecting proper chain
 	// selection according to the chain with the most proof of work.  This
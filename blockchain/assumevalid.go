@@ -0,0 +1,77 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/nyodeco/pind/chaincfg/chainhash"
+)
+
+// assumeValidMinBurialTime is the minimum amount of time it would take, at the
+// difficulty of the best known header, to produce the work that has been built
+// on top of a block before its scripts are assumed to be valid.  This ensures
+// an attacker can't trick a node into skipping script verification by merely
+// providing a low-work chain containing the assumed valid block.
+const assumeValidMinBurialTime = time.Hour * 24 * 7 * 2
+
+// maybeUpdateBestHeader sets the passed block node as the tip of the best known
+// header chain when it has more work than the current one.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) maybeUpdateBestHeader(node *blockNode) {
+	if b.index.NodeStatus(node).KnownInvalid() {
+		return
+	}
+	if node.workSum.Cmp(b.bestHeader.Tip().workSum) > 0 {
+		b.bestHeader.SetTip(node)
+	}
+}
+
+// BestHeader returns the hash and height of the tip of the chain with the most
+// work known to the block index, which includes the headers for which the
+// block data is not available yet.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) BestHeader() (chainhash.Hash, int32) {
+	b.chainLock.RLock()
+	tip := b.bestHeader.Tip()
+	b.chainLock.RUnlock()
+	return tip.hash, tip.height
+}
+
+// isAssumedValid returns whether or not the scripts of the transactions in the
+// block represented by the passed node can be assumed to be valid.  This is the
+// case when the node is an ancestor of (or is) the configured assumed valid
+// block, that block is part of the best known header chain, and the best known
+// header has enough work built on top of the node.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) isAssumedValid(node *blockNode) bool {
+	if b.assumeValid == nil {
+		return false
+	}
+
+	// Since all ancestors of the assumed valid block are part of the best
+	// header chain when it is, the node is an ancestor when it is in that
+	// chain as well and not after it.
+	assumeValidNode := b.index.LookupNode(b.assumeValid)
+	if assumeValidNode == nil || node.height > assumeValidNode.height ||
+		!b.bestHeader.Contains(assumeValidNode) ||
+		!b.bestHeader.Contains(node) {
+
+		return false
+	}
+
+	// Convert the work built on top of the node into the equivalent amount
+	// of time it would take to produce at the difficulty of the best known
+	// header.
+	bestHeader := b.bestHeader.Tip()
+	work := new(big.Int).Sub(bestHeader.workSum, node.workSum)
+	work.Mul(work, big.NewInt(int64(b.chainParams.TargetTimePerBlock/time.Second)))
+	work.Div(work, CalcWork(bestHeader.bits))
+	return work.Cmp(big.NewInt(int64(assumeValidMinBurialTime/time.Second))) >= 0
+}
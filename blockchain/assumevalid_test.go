@@ -0,0 +1,166 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/nyodeco/pind/chaincfg"
+	"github.com/nyodeco/pind/txscript"
+	"github.com/nyodeco/pind/wire"
+	"github.com/nyodeco/pinutil"
+)
+
+// TestIsAssumedValid ensures scripts are only assumed valid for ancestors of the
+// assumed valid block when it is part of the best header chain and enough work
+// has been built on top of them.
+func TestIsAssumedValid(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	chain := newFakeChain(params)
+
+	nodes := extendFakeChain(chain, chain.bestChain.Tip(), 100, statusNone)
+	sideNodes := extendFakeChain(chain, nodes[10], 5, statusNone)
+	assumeValidNode := nodes[49]
+	chain.assumeValid = &assumeValidNode.hash
+
+	// Not enough work has been built on top of the assumed valid block.
+	if chain.isAssumedValid(nodes[10]) {
+		t.Fatalf("isAssumedValid: unexpected assumed valid block with " +
+			"insufficient work on top")
+	}
+
+	// Bury the assumed valid block deeply enough.
+	burialBlocks := int(assumeValidMinBurialTime / params.TargetTimePerBlock)
+	nodes = append(nodes, extendFakeChain(chain, nodes[len(nodes)-1],
+		burialBlocks, statusNone)...)
+
+	tests := []struct {
+		name string
+		node *blockNode
+		want bool
+	}{
+		{"ancestor", nodes[10], true},
+		{"assumed valid block", assumeValidNode, true},
+		{"descendant", nodes[50], false},
+		{"side chain", sideNodes[4], false},
+	}
+	for _, test := range tests {
+		if got := chain.isAssumedValid(test.node); got != test.want {
+			t.Errorf("isAssumedValid (%s): got %v, want %v", test.name,
+				got, test.want)
+		}
+	}
+
+	// Nothing is assumed valid when disabled.
+	chain.assumeValid = nil
+	if chain.isAssumedValid(nodes[10]) {
+		t.Fatalf("isAssumedValid: unexpected assumed valid block when " +
+			"disabled")
+	}
+}
+
+// TestAssumeValidProcessBlock ensures the scripts of blocks processed by the
+// chain are only skipped once the headers up to the assumed valid block, and
+// enough work on top of it, are known.
+func TestAssumeValidProcessBlock(t *testing.T) {
+	// Shorten the target time per block so only a few blocks are needed to
+	// bury the assumed valid block deeply enough.
+	params := chaincfg.RegressionNetParams
+	params.TargetTimePerBlock = assumeValidMinBurialTime / 10
+
+	// Create a chain of blocks where the block after the coinbase maturity
+	// spends the first coinbase with a script which fails to execute,
+	// followed by enough blocks to bury the assumed valid block.
+	//
+	// genesis -> 1 -> ... -> 101 (bad script) -> 102 (assumed valid) ->
+	// ... -> 113
+	prev := params.GenesisBlock
+	blocks := make([]*pinutil.Block, 0, 113)
+	for height := int32(1); height <= 113; height++ {
+		block, err := newTestBlock(&params, prev, height, 0)
+		if err != nil {
+			t.Fatalf("unable to create block: %v", err)
+		}
+		if height == int32(params.CoinbaseMaturity)+1 {
+			coinbase := blocks[0].MsgBlock().Transactions[0]
+			spend := wire.NewMsgTx(1)
+			spend.AddTxIn(&wire.TxIn{
+				PreviousOutPoint: wire.OutPoint{
+					Hash:  coinbase.TxHash(),
+					Index: 0,
+				},
+				SignatureScript: []byte{txscript.OP_RETURN},
+				Sequence:        wire.MaxTxInSequenceNum,
+			})
+			spend.AddTxOut(wire.NewTxOut(coinbase.TxOut[0].Value,
+				[]byte{txscript.OP_TRUE}))
+			msgBlock := block.MsgBlock()
+			msgBlock.AddTransaction(spend)
+			block = pinutil.NewBlock(msgBlock)
+			merkles := BuildMerkleTreeStore(block.Transactions(), false)
+			msgBlock.Header.MerkleRoot = *merkles[len(merkles)-1]
+		}
+		block.SetHeight(height)
+		blocks = append(blocks, block)
+		prev = block.MsgBlock()
+	}
+	badBlock := blocks[params.CoinbaseMaturity]
+	assumeValidHash := blocks[params.CoinbaseMaturity+1].Hash()
+
+	// processBlocks processes the blocks up to and including the one with
+	// the bad script and returns the error for it.
+	processBlocks := func(chain *BlockChain) error {
+		t.Helper()
+		for _, block := range blocks[:params.CoinbaseMaturity] {
+			_, _, err := chain.ProcessBlock(block, BFNoPoWCheck)
+			if err != nil {
+				t.Fatalf("ProcessBlock at height %d: unexpected "+
+					"error: %v", block.Height(), err)
+			}
+		}
+		_, _, err := chain.ProcessBlock(badBlock, BFNoPoWCheck)
+		return err
+	}
+
+	// The scripts are verified while the assumed valid block is not known.
+	chain, teardownFunc, err := chainSetup("assumevalidunknown", &params)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	chain.assumeValid = assumeValidHash
+
+	err = processBlocks(chain)
+	teardownFunc()
+	if rerr, ok := err.(RuleError); !ok || rerr.ErrorCode != ErrScriptValidation {
+		t.Fatalf("ProcessBlock: unexpected error for block with bad "+
+			"script: got %v, want %v", err, ErrScriptValidation)
+	}
+
+	// The scripts are skipped once the headers up to the assumed valid
+	// block and the ones burying it are known.
+	chain, teardownFunc, err = chainSetup("assumevalidknown", &params)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+	chain.assumeValid = assumeValidHash
+
+	for _, block := range blocks {
+		err := chain.ProcessBlockHeader(&block.MsgBlock().Header,
+			BFNoPoWCheck)
+		if err != nil {
+			t.Fatalf("ProcessBlockHeader at height %d: unexpected "+
+				"error: %v", block.Height(), err)
+		}
+	}
+	if err := processBlocks(chain); err != nil {
+		t.Fatalf("ProcessBlock: unexpected error for assumed valid "+
+			"block: %v", err)
+	}
+	if best := chain.BestSnapshot(); best.Hash != *badBlock.Hash() {
+		t.Fatalf("unexpected best block: got %v, want %v", best.Hash,
+			badBlock.Hash())
+	}
+}
@@ -81,6 +81,12 @@ type blockNode struct {
 	// this node.
 	workSum *big.Int
 
+	// powHash is the proof of work hash of a header which was accepted
+	// ahead of its block data, so it doesn't need to be calculated again
+	// once the block data arrives.  It is released once the block data is
+	// stored and is nil for nodes loaded from the database.
+	powHash *chainhash.Hash
+
 	// height is the position in the block chain.
 	height int32
 
@@ -232,6 +238,16 @@ type blockIndex struct {
 	sync.RWMutex
 	index map[chainhash.Hash]*blockNode
 	dirty map[*blockNode]struct{}
+
+	// tips houses the nodes which don't have any children, which are the
+	// tips of the best chain and all of the side chains.
+	tips map[*blockNode]struct{}
+
+	// checkedPowHashes houses the proof of work hashes of the most recent
+	// batch of headers which passed CheckHeadersProofOfWork keyed by their
+	// block hash, so the batch can be processed afterwards without
+	// calculating them again.  It is replaced by each batch.
+	checkedPowHashes map[chainhash.Hash]chainhash.Hash
 }
 
 // newBlockIndex returns a new empty instance of a block index.  The index will
@@ -243,15 +259,19 @@ func newBlockIndex(db database.DB, chainParams *chaincfg.Params) *blockIndex {
 		chainParams: chainParams,
 		index:       make(map[chainhash.Hash]*blockNode),
 		dirty:       make(map[*blockNode]struct{}),
+		tips:        make(map[*blockNode]struct{}),
 	}
 }
 
-// HaveBlock returns whether or not the block index contains the provided hash.
+// HaveBlock returns whether or not the block index contains the provided hash
+// along with the full block data.  Nodes for which only the header is known
+// are not considered.
 //
 // This function is safe for concurrent access.
 func (bi *blockIndex) HaveBlock(hash *chainhash.Hash) bool {
 	bi.RLock()
-	_, hasBlock := bi.index[*hash]
+	node, hasBlock := bi.index[*hash]
+	hasBlock = hasBlock && node.status.HaveData()
 	bi.RUnlock()
 	return hasBlock
 }
@@ -284,6 +304,69 @@ func (bi *blockIndex) AddNode(node *blockNode) {
 // This function is NOT safe for concurrent access.
 func (bi *blockIndex) addNode(node *blockNode) {
 	bi.index[node.hash] = node
+
+	// Nodes are always added after their parent, so the new node is a tip
+	// and its parent no longer is.
+	if node.parent != nil {
+		delete(bi.tips, node.parent)
+	}
+	bi.tips[node] = struct{}{}
+}
+
+// PowHash returns the proof of work hash of the passed block header.  The hash
+// is only calculated when it is not already known from a header which was
+// accepted ahead of its block data or which is part of the most recent batch
+// of headers that passed CheckHeadersProofOfWork.
+//
+// This function is safe for concurrent access.
+func (bi *blockIndex) PowHash(header *wire.BlockHeader) chainhash.Hash {
+	blockHash := header.BlockHash()
+	bi.RLock()
+	if node := bi.index[blockHash]; node != nil && node.powHash != nil {
+		powHash := *node.powHash
+		bi.RUnlock()
+		return powHash
+	}
+	powHash, ok := bi.checkedPowHashes[blockHash]
+	bi.RUnlock()
+	if ok {
+		return powHash
+	}
+
+	return header.PowHash()
+}
+
+// setCheckedPowHashes replaces the proof of work hashes of the most recent
+// batch of headers which passed CheckHeadersProofOfWork.
+//
+// This function is safe for concurrent access.
+func (bi *blockIndex) setCheckedPowHashes(powHashes map[chainhash.Hash]chainhash.Hash) {
+	bi.Lock()
+	bi.checkedPowHashes = powHashes
+	bi.Unlock()
+}
+
+// releasePowHash releases the proof of work hash of the provided node once it
+// is no longer needed.
+//
+// This function is safe for concurrent access.
+func (bi *blockIndex) releasePowHash(node *blockNode) {
+	bi.Lock()
+	node.powHash = nil
+	bi.Unlock()
+}
+
+// Tips returns the nodes of the index which don't have any children.
+//
+// This function is safe for concurrent access.
+func (bi *blockIndex) Tips() []*blockNode {
+	bi.RLock()
+	tips := make([]*blockNode, 0, len(bi.tips))
+	for node := range bi.tips {
+		tips = append(tips, node)
+	}
+	bi.RUnlock()
+	return tips
 }
 
 // NodeStatus provides concurrent-safe access to the status field of a node.
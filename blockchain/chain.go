@@ -7,7 +7,10 @@ package blockchain
 
 import (
 	"container/list"
+	"errors"
 	"fmt"
+	"math"
+	"math/big"
 	"sync"
 	"time"
 
@@ -67,6 +70,7 @@ type BestState struct {
 	NumTxns     uint64         // The number of txns in the block.
 	TotalTxns   uint64         // The total number of txns in the chain.
 	MedianTime  time.Time      // Median time as per CalcPastMedianTime.
+	ChainWork   *big.Int       // The total work of the chain up to the block.
 }
 
 // newBestState returns a new best stats instance for the given parameters.
@@ -82,6 +86,7 @@ func newBestState(node *blockNode, blockSize, blockWeight, numTxns,
 		NumTxns:     numTxns,
 		TotalTxns:   totalTxns,
 		MedianTime:  medianTime,
+		ChainWork:   new(big.Int).Set(node.workSum),
 	}
 }
 
@@ -101,6 +106,11 @@ type BlockChain struct {
 	sigCache            *txscript.SigCache
 	indexManager        IndexManager
 	hashCache           *txscript.HashCache
+	pruneTarget         uint64
+	utxoCache           *utxoCache
+	assumeValid         *chainhash.Hash
+	minimumChainWork    *big.Int
+	maxReorgDepth       int32
 
 	// The following fields are calculated based upon the provided chain
 	// parameters.  They are also set when the instance is created and
@@ -108,8 +118,6 @@ type BlockChain struct {
 	// a separate mutex.
 	minRetargetTimespan int64 // target timespan / adjustment factor
 	maxRetargetTimespan int64 // target timespan * adjustment factor
-	blocksPerRetarget   int32 // 6
-	retargetInterval    int32 // 1
 
 
 	// chainLock protects concurrent access to the vast majority of the
@@ -125,8 +133,13 @@ type BlockChain struct {
 	//
 	// bestChain tracks the current active chain by making use of an
 	// efficient chain view into the block index.
-	index     *blockIndex
-	bestChain *chainView
+	//
+	// bestHeader tracks the chain with the most work known to the block
+	// index, including the headers for which no block data is available
+	// yet.
+	index      *blockIndex
+	bestChain  *chainView
+	bestHeader *chainView
 
 	// These fields are related to handling of orphan blocks.  They are
 	// protected by a combination of the chain lock and the orphan lock.
@@ -140,6 +153,20 @@ type BlockChain struct {
 	nextCheckpoint *chaincfg.Checkpoint
 	checkpointNode *blockNode
 
+	// utxoSnapshot houses the state of a loaded utxo set snapshot while the
+	// blocks before it are validated in the background.  It is protected by
+	// the chain lock.
+	utxoSnapshot *utxoSnapshot
+
+	// utxoStats houses the statistics of the utxo set as of the best chain
+	// tip.  It is protected by the chain lock.
+	utxoStats *utxoStats
+
+	// lastRejectedReorg houses the most recent reorganization which was
+	// refused for exceeding the maximum reorganization depth.  It is
+	// protected by the chain lock.
+	lastRejectedReorg *ReorgRejected
+
 	// The state is used as a fairly efficient way to cache information
 	// about the current best chain state that is returned to callers when
 	// requested.  It operates on the principle of MVCC such that any time a
@@ -598,7 +625,20 @@ func (b *BlockChain) connectBlock(node *blockNode, block *pinutil.Block,
 	state := newBestState(node, blockSize, blockWeight, numTxns,
 		curTotalTxns+numTxns, node.CalcPastMedianTime())
 
+	// Update the statistics of the utxo set for the outputs spent and
+	// created by the block.
+	stats := b.utxoStats.clone()
+	err = b.db.View(func(dbTx database.Tx) error {
+		return stats.applyBlock(dbTx, b.utxoCache, block, node.height,
+			stxos, true)
+	})
+	if err != nil {
+		return err
+	}
+
 	// Atomically insert info into the database.
+	var pruned bool
+	var pruneKeepHeight int32
 	err = b.db.Update(func(dbTx database.Tx) error {
 		// Update best block state.
 		err := dbPutBestState(dbTx, state, node.workSum)
@@ -606,17 +646,15 @@ func (b *BlockChain) connectBlock(node *blockNode, block *pinutil.Block,
 			return err
 		}
 
-		// Add the block hash and height to the block index which tracks
-		// the main chain.
-		err = dbPutBlockIndex(dbTx, block.Hash(), node.height)
+		// Update the utxo set statistics to match the best block.
+		err = dbPutUtxoStats(dbTx, stats)
 		if err != nil {
 			return err
 		}
 
-		// Update the utxo set using the state of the utxo view.  This
-		// entails removing all of the utxos spent and adding the new
-		// ones created by the block.
-		err = dbPutUtxoView(dbTx, view)
+		// Add the block hash and height to the block index which tracks
+		// the main chain.
+		err = dbPutBlockIndex(dbTx, block.Hash(), node.height)
 		if err != nil {
 			return err
 		}
@@ -638,18 +676,49 @@ func (b *BlockChain) connectBlock(node *blockNode, block *pinutil.Block,
 			}
 		}
 
+		// Delete the oldest block data when it exceeds the configured
+		// prune target while always keeping the most recent blocks.
+		// The blocks connected since the last utxo cache flush are kept
+		// as well since they are needed to recover the utxo set after
+		// an unclean shutdown.  There is nothing to check when blocks
+		// are only pruned manually.
+		if b.pruneTarget != 0 && b.pruneTarget != math.MaxUint64 {
+			pruneKeepHeight = node.height - MinBlocksToKeep + 1
+			flushedHash := b.utxoCache.flushedHash()
+			flushedNode := b.index.LookupNode(&flushedHash)
+			if flushedNode != nil && flushedNode.height < pruneKeepHeight {
+				pruneKeepHeight = flushedNode.height + 1
+			}
+			pruned, err = dbMaybePruneBlocks(dbTx, node,
+				pruneKeepHeight, b.pruneTarget)
+			if err != nil {
+				return err
+			}
+		}
+
 		return nil
 	})
 	if err != nil {
 		return err
 	}
 
-	// Prune fully spent entries and mark all entries in the view unmodified
-	// now that the modifications have been committed to the database.
+	// The data of the pruned blocks is no longer stored.
+	if pruned {
+		if err := b.unsetPrunedDataFlags(pruneKeepHeight); err != nil {
+			return err
+		}
+	}
+
+	// Update the utxo cache using the state of the utxo view.  This entails
+	// removing all of the utxos spent and adding the new ones created by
+	// the block.  Then prune fully spent entries and mark all entries in
+	// the view unmodified now that the modifications have been committed.
+	b.utxoCache.commit(view)
 	view.commit()
 
 	// This node is now the end of the best chain.
 	b.bestChain.SetTip(node)
+	b.utxoStats = stats
 
 	// Update the state for the best block.  Notice how this replaces the
 	// entire struct instead of updating the existing one.  This effectively
@@ -660,6 +729,11 @@ func (b *BlockChain) connectBlock(node *blockNode, block *pinutil.Block,
 	b.stateSnapshot = state
 	b.stateLock.Unlock()
 
+	// Write the utxo cache to the database as needed.
+	if err := b.maybeFlushUtxoCache(); err != nil {
+		return err
+	}
+
 	// Notify the caller that the block was connected to the main chain.
 	// The caller would typically want to react with actions such as
 	// updating wallets.
@@ -711,6 +785,7 @@ func (b *BlockChain) disconnectBlock(node *blockNode, block *pinutil.Block, view
 	state := newBestState(prevNode, blockSize, blockWeight, numTxns,
 		newTotalTxns, prevNode.CalcPastMedianTime())
 
+	var stats *utxoStats
 	err = b.db.Update(func(dbTx database.Tx) error {
 		// Update best block state.
 		err := dbPutBestState(dbTx, state, node.workSum)
@@ -725,17 +800,39 @@ func (b *BlockChain) disconnectBlock(node *blockNode, block *pinutil.Block, view
 			return err
 		}
 
-		// Update the utxo set using the state of the utxo view.  This
-		// entails restoring all of the utxos spent and removing the new
-		// ones created by the block.
-		err = dbPutUtxoView(dbTx, view)
+		// Before we delete the spend journal entry for this back,
+		// we'll fetch it as is so the indexers can utilize if needed.
+		stxos, err := dbFetchSpendJournalEntry(dbTx, block)
 		if err != nil {
 			return err
 		}
 
-		// Before we delete the spend journal entry for this back,
-		// we'll fetch it as is so the indexers can utilize if needed.
-		stxos, err := dbFetchSpendJournalEntry(dbTx, block)
+		// Update the utxo set statistics to match the previous block
+		// by restoring the outputs spent by the block and removing the
+		// ones it created.  This is done before the utxo set is updated
+		// below since the statistics are based on the current one.
+		stats = b.utxoStats.clone()
+		err = stats.applyBlock(dbTx, b.utxoCache, block, node.height,
+			stxos, false)
+		if err != nil {
+			return err
+		}
+		err = dbPutUtxoStats(dbTx, stats)
+		if err != nil {
+			return err
+		}
+
+		// Update the utxo set using the state of the utxo cache followed
+		// by the utxo view.  This entails restoring all of the utxos
+		// spent and removing the new ones created by the block.  The
+		// utxo set is always brought up to date when disconnecting
+		// since the spend journal entry needed to undo the block is
+		// removed below.
+		err = b.utxoCache.dbFlush(dbTx, &prevNode.hash)
+		if err != nil {
+			return err
+		}
+		err = dbPutUtxoView(dbTx, view)
 		if err != nil {
 			return err
 		}
@@ -763,12 +860,16 @@ func (b *BlockChain) disconnectBlock(node *blockNode, block *pinutil.Block, view
 		return err
 	}
 
-	// Prune fully spent entries and mark all entries in the view unmodified
-	// now that the modifications have been committed to the database.
+	// Update the utxo cache to match the database.  Then prune fully spent
+	// entries and mark all entries in the view unmodified now that the
+	// modifications have been committed to the database.
+	b.utxoCache.commit(view)
+	b.utxoCache.markFlushed(&prevNode.hash, false)
 	view.commit()
 
 	// This node's parent is now the end of the best chain.
 	b.bestChain.SetTip(node.parent)
+	b.utxoStats = stats
 
 	// Update the state for the best block.  Notice how this replaces the
 	// entire struct instead of updating the existing one.  This effectively
@@ -839,6 +940,15 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 		}
 	}
 
+	// Write the utxo cache to the database before disconnecting any blocks
+	// since resurrecting outputs spent by blocks with legacy spend journal
+	// entries relies on the utxo set in the database.
+	if detachNodes.Len() != 0 {
+		if err := b.flushUtxoCache(&tip.hash, false); err != nil {
+			return err
+		}
+	}
+
 	// Track the old and new best chains heads.
 	oldBest := tip
 	newBest := tip
@@ -877,7 +987,7 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 
 		// Load all of the utxos referenced by the block that aren't
 		// already in the view.
-		err = view.fetchInputUtxos(b.db, block)
+		err = view.fetchInputUtxos(b.utxoCache, block)
 		if err != nil {
 			return err
 		}
@@ -944,7 +1054,7 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 		// checkConnectBlock gets skipped, we still need to update the UTXO
 		// view.
 		if b.index.NodeStatus(n).KnownValid() {
-			err = view.fetchInputUtxos(b.db, block)
+			err = view.fetchInputUtxos(b.utxoCache, block)
 			if err != nil {
 				return err
 			}
@@ -965,7 +1075,7 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 		// In the case the block is determined to be invalid due to a
 		// rule violation, mark it as invalid and mark all of its
 		// descendants as having an invalid ancestor.
-		err = b.checkConnectBlock(n, block, view, nil)
+		err = b.checkConnectBlock(n, block, view, b.utxoCache, nil)
 		if err != nil {
 			if _, ok := err.(RuleError); ok {
 				b.index.SetStatusFlags(n, statusValidateFailed)
@@ -996,7 +1106,7 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 
 		// Load all of the utxos referenced by the block that aren't
 		// already in the view.
-		err := view.fetchInputUtxos(b.db, block)
+		err := view.fetchInputUtxos(b.utxoCache, block)
 		if err != nil {
 			return err
 		}
@@ -1023,7 +1133,7 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 
 		// Load all of the utxos referenced by the block that aren't
 		// already in the view.
-		err := view.fetchInputUtxos(b.db, block)
+		err := view.fetchInputUtxos(b.utxoCache, block)
 		if err != nil {
 			return err
 		}
@@ -1056,6 +1166,31 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 	log.Infof("REORGANIZE: New best chain head is %v (height %v)",
 		newBest.hash, newBest.height)
 
+	// Notify the caller that the main chain was reorganized.  The chain
+	// lock is released while the notification is sent so callers are
+	// able to access the chain.
+	if len(detachBlocks) != 0 {
+		fork := detachNodes.Back().Value.(*blockNode).parent
+		b.chainLock.Unlock()
+		b.sendNotification(NTChainReorganized, &ChainReorganized{
+			ForkHash:   fork.hash,
+			ForkHeight: fork.height,
+			Detached:   detachBlocks,
+			Attached:   attachBlocks,
+		})
+		b.chainLock.Lock()
+	}
+
+	// The previously rejected reorganization no longer applies once the
+	// main chain contains its tip, such as when it was performed
+	// manually.
+	if r := b.lastRejectedReorg; r != nil {
+		rejectedTip := b.index.LookupNode(&r.NewTipHash)
+		if rejectedTip != nil && b.bestChain.Contains(rejectedTip) {
+			b.lastRejectedReorg = nil
+		}
+	}
+
 	return nil
 }
 
@@ -1101,7 +1236,8 @@ func (b *BlockChain) connectBestChain(node *blockNode, block *pinutil.Block, fla
 		view.SetBestHash(parentHash)
 		stxos := make([]SpentTxOut, 0, countSpentOutputs(block))
 		if !fastAdd {
-			err := b.checkConnectBlock(node, block, view, &stxos)
+			err := b.checkConnectBlock(node, block, view, b.utxoCache,
+				&stxos)
 			if err == nil {
 				b.index.SetStatusFlags(node, statusValid)
 			} else if _, ok := err.(RuleError); ok {
@@ -1122,7 +1258,7 @@ func (b *BlockChain) connectBestChain(node *blockNode, block *pinutil.Block, fla
 		// utxos, spend them, and add the new utxos being created by
 		// this block.
 		if fastAdd {
-			err := view.fetchInputUtxos(b.db, block)
+			err := view.fetchInputUtxos(b.utxoCache, block)
 			if err != nil {
 				return false, err
 			}
@@ -1191,6 +1327,32 @@ func (b *BlockChain) connectBestChain(node *blockNode, block *pinutil.Block, fla
 	// common ancenstor (the point where the chain forked).
 	detachNodes, attachNodes := b.getReorganizeNodes(node)
 
+	// Refuse to reorganize the chain when more blocks than the maximum
+	// reorganization depth would be disconnected.  The block remains on a
+	// side chain, so the reorganization can still be performed manually.
+	if b.maxReorgDepth > 0 && int32(detachNodes.Len()) > b.maxReorgDepth {
+		tip := b.bestChain.Tip()
+		fork := b.bestChain.FindFork(node)
+		rejected := &ReorgRejected{
+			ForkHash:     fork.hash,
+			ForkHeight:   fork.height,
+			OldTipHash:   tip.hash,
+			OldTipHeight: tip.height,
+			NewTipHash:   node.hash,
+			NewTipHeight: node.height,
+		}
+		b.lastRejectedReorg = rejected
+		log.Errorf("REORGANIZE REJECTED: Block %v would disconnect %d "+
+			"blocks from the main chain which exceeds the maximum "+
+			"reorganization depth of %d", node.hash,
+			rejected.Depth(), b.maxReorgDepth)
+
+		b.chainLock.Unlock()
+		b.sendNotification(NTReorgRejected, rejected)
+		b.chainLock.Lock()
+		return false, nil
+	}
+
 	// Reorganize the chain.
 	log.Infof("REORGANIZE: Block %v is causing a reorganize.", node.hash)
 	err := b.reorganizeChain(detachNodes, attachNodes)
@@ -1256,6 +1418,17 @@ func (b *BlockChain) BestSnapshot() *BestState {
 	return snapshot
 }
 
+// LastRejectedReorg returns the most recent reorganization which was refused
+// for exceeding the maximum reorganization depth or nil when there is none.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) LastRejectedReorg() *ReorgRejected {
+	b.chainLock.RLock()
+	rejected := b.lastRejectedReorg
+	b.chainLock.RUnlock()
+	return rejected
+}
+
 // HeaderByHash returns the block header identified by the given hash or an
 // error if it doesn't exist. Note that this will return headers from both the
 // main and side chains.
@@ -1269,6 +1442,20 @@ func (b *BlockChain) HeaderByHash(hash *chainhash.Hash) (wire.BlockHeader, error
 	return node.Header(), nil
 }
 
+// HeightByHash returns the height of the block identified by the given hash or
+// an error if it doesn't exist.  Note that this will return heights of blocks
+// from both the main and side chains.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) HeightByHash(hash *chainhash.Hash) (int32, error) {
+	node := b.index.LookupNode(hash)
+	if node == nil {
+		return 0, fmt.Errorf("block %s is not known", hash)
+	}
+
+	return node.height, nil
+}
+
 // MainChainHasBlock returns whether or not the block with the given hash is in
 // the main chain.
 //
@@ -1702,6 +1889,54 @@ type Config struct {
 	// This field can be nil if the caller is not interested in using a
 	// signature cache.
 	HashCache *txscript.HashCache
+
+	// PruneTarget is the target maximum size in bytes of the stored block
+	// data.  The data for the oldest blocks is deleted as new blocks are
+	// connected once the target is exceeded, although the data for the
+	// last MinBlocksToKeep blocks is always kept.
+	//
+	// A target of math.MaxUint64 means block data is only deleted when
+	// requested via PruneBlocks.
+	//
+	// This field can be zero if the caller does not wish to prune any
+	// block data.  A database which has already been pruned can not be
+	// used without pruning enabled.
+	PruneTarget uint64
+
+	// UtxoCacheMaxSize is the maximum size in bytes of the in-memory cache
+	// of unspent transaction outputs.  The changes made to the utxo set by
+	// connected blocks are written to the database once the cache grows
+	// beyond this size.
+	//
+	// This field can be zero in which case the changes are written to the
+	// database as each block is connected.
+	UtxoCacheMaxSize uint64
+
+	// AssumeValid is the hash of a block for which the scripts of all of
+	// its ancestors are assumed to be valid.  Script verification is
+	// skipped for those ancestors as long as the block is part of the best
+	// known header chain and sufficient work has been built on top of them.
+	//
+	// This field can be nil if the caller wishes to verify the scripts of
+	// all blocks.
+	AssumeValid *chainhash.Hash
+
+	// MinimumChainWork is the least amount of work the best chain is known
+	// to have.  The headers of a peer are only stored once its chain has
+	// been verified to reach it.
+	//
+	// This field can be nil if the caller wishes to store the headers
+	// without verifying the chain work.
+	MinimumChainWork *big.Int
+
+	// MaxReorgDepth is the maximum number of blocks which may be
+	// disconnected from the main chain by a reorganization.  Deeper
+	// reorganizations are refused and reported with an NTReorgRejected
+	// notification.
+	//
+	// This field can be zero if the caller does not wish to limit the
+	// depth of reorganizations.
+	MaxReorgDepth int32
 }
 
 // New returns a BlockChain instance using the provided configuration details.
@@ -1735,7 +1970,24 @@ func New(config *Config) (*BlockChain, error) {
 		}
 	}
 
+	// Assert the heights of height based deployments are at the start of a
+	// confirmation window as required.
 	params := config.ChainParams
+	window := params.MinerConfirmationWindow
+	for i := range params.Deployments {
+		deployment := &params.Deployments[i]
+		if deployment.TimeoutHeight == 0 {
+			continue
+		}
+		if window == 0 || deployment.StartHeight%window != 0 ||
+			deployment.TimeoutHeight%window != 0 {
+
+			return nil, AssertError(fmt.Sprintf("blockchain.New "+
+				"deployment %d heights are not multiples of "+
+				"the miner confirmation window", i))
+		}
+	}
+
 	targetTimespan := int64(params.TargetTimespan / time.Second)
 	b := BlockChain{
 		checkpoints:         config.Checkpoints,
@@ -1747,11 +1999,15 @@ func New(config *Config) (*BlockChain, error) {
 		indexManager:        config.IndexManager,
 		minRetargetTimespan: targetTimespan * (100 - params.RetargetAdjustmentFactorUp) / 100,
 		maxRetargetTimespan: targetTimespan * (100 + params.RetargetAdjustmentFactorDown) / 100,
-		blocksPerRetarget:   6,
-		retargetInterval:    1,
 		index:               newBlockIndex(config.DB, params),
 		hashCache:           config.HashCache,
+		pruneTarget:         config.PruneTarget,
+		utxoCache:           newUtxoCache(config.DB, config.UtxoCacheMaxSize),
+		assumeValid:         config.AssumeValid,
+		minimumChainWork:    config.MinimumChainWork,
+		maxReorgDepth:       config.MaxReorgDepth,
 		bestChain:           newChainView(nil),
+		bestHeader:          newChainView(nil),
 		orphans:             make(map[chainhash.Hash]*orphanBlock),
 		prevOrphans:         make(map[chainhash.Hash][]*orphanBlock),
 		warningCaches:       newThresholdCaches(vbNumBits),
@@ -1770,6 +2026,49 @@ func New(config *Config) (*BlockChain, error) {
 		return nil, err
 	}
 
+	// The block data that was deleted from a pruned database can't be
+	// recovered, so refuse to use it without pruning enabled.
+	if config.PruneTarget == 0 {
+		var beenPruned bool
+		err := b.db.View(func(dbTx database.Tx) error {
+			var err error
+			beenPruned, err = dbTx.BeenPruned()
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		if beenPruned {
+			return nil, errors.New("the database contains pruned " +
+				"block data and can only be used with pruning " +
+				"enabled")
+		}
+	}
+
+	// Undo the load of a utxo set snapshot which was interrupted by the
+	// last shutdown.  The utxo set is rebuilt by initUtxoCache below.
+	if err := b.rollBackUtxoSnapshotLoad(); err != nil {
+		return nil, err
+	}
+
+	// Resume validating the blocks before a loaded utxo set snapshot.
+	// This is done before bringing the utxo set up to date since it is
+	// replaced when the snapshot turned out to be invalid.
+	if err := b.initUtxoSnapshot(); err != nil {
+		return nil, err
+	}
+
+	// Bring the utxo set up to date with the best chain when the utxo
+	// cache was not flushed before the last shutdown.
+	if err := b.initUtxoCache(config.Interrupt); err != nil {
+		return nil, err
+	}
+
+	// Load the statistics of the utxo set.
+	if err := b.initUtxoStats(); err != nil {
+		return nil, err
+	}
+
 	// Initialize and catch up all of the currently active optional indexes
 	// as needed.
 	if config.IndexManager != nil {
@@ -1788,6 +2087,10 @@ func New(config *Config) (*BlockChain, error) {
 	log.Infof("Chain state (height %d, hash %v, totaltx %d, work %v)",
 		bestNode.height, bestNode.hash, b.stateSnapshot.TotalTxns,
 		bestNode.workSum)
+	if b.assumeValid != nil {
+		log.Infof("Assuming ancestors of block %v have valid scripts",
+			b.assumeValid)
+	}
 
 	return &b, nil
 }
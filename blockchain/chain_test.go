@@ -964,3 +964,107 @@ func TestIntervalBlockHashes(t *testing.T) {
 		}
 	}
 }
+
+// TestMaxReorgDepth ensures reorganizations which would disconnect more blocks
+// than the maximum reorganization depth are refused and reported.
+func TestMaxReorgDepth(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	chain := newFakeChain(params)
+	chain.maxReorgDepth = 2
+
+	var rejections []*ReorgRejected
+	chain.Subscribe(func(n *Notification) {
+		if n.Type == NTReorgRejected {
+			rejections = append(rejections, n.Data.(*ReorgRejected))
+		}
+	})
+
+	// Create a best chain with a longer side chain forking off of the
+	// genesis block, so switching to it would disconnect three blocks.
+	//
+	// genesis -> 1 -> 2 -> 3
+	//        \-> 1a -> 2a -> 3a -> 4a
+	genesis := chain.bestChain.Tip()
+	nodes := extendFakeChain(chain, genesis, 3,
+		statusDataStored|statusValid)
+	sideNodes := extendFakeChain(chain, genesis, 4,
+		statusDataStored|statusValid)
+	chain.bestChain.SetTip(nodes[2])
+
+	tip := sideNodes[3]
+	header := tip.Header()
+	block := pinutil.NewBlock(&wire.MsgBlock{Header: header})
+	chain.chainLock.Lock()
+	isMainChain, err := chain.connectBestChain(tip, block, BFNone)
+	chain.chainLock.Unlock()
+	if err != nil || isMainChain {
+		t.Fatalf("connectBestChain: got main chain %v, error %v",
+			isMainChain, err)
+	}
+	if chain.bestChain.Tip() != nodes[2] {
+		t.Fatalf("connectBestChain: tip changed to %v", chain.bestChain.Tip())
+	}
+
+	want := &ReorgRejected{
+		ForkHash:     genesis.hash,
+		ForkHeight:   0,
+		OldTipHash:   nodes[2].hash,
+		OldTipHeight: 3,
+		NewTipHash:   tip.hash,
+		NewTipHeight: 4,
+	}
+	if len(rejections) != 1 || !reflect.DeepEqual(rejections[0], want) {
+		t.Fatalf("NTReorgRejected: got %+v, want %+v", rejections, want)
+	}
+	if got := chain.LastRejectedReorg(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("LastRejectedReorg: got %+v, want %+v", got, want)
+	}
+	if want.Depth() != 3 {
+		t.Fatalf("Depth: got %d, want 3", want.Depth())
+	}
+}
+
+// TestHeightByHash ensures the heights of both main and side chain blocks are
+// returned while unknown blocks are an error.
+func TestHeightByHash(t *testing.T) {
+	// Construct a synthetic block chain with a block index consisting of
+	// the following structure.
+	// 	genesis -> 1 -> 2 -> 3 -> 4
+	// 	                 \-> 3a -> 4a -> 5a
+	tip := tstTip
+	chain := newFakeChain(&chaincfg.MainNetParams)
+	branch0Nodes := chainedNodes(chain.bestChain.Genesis(), 4)
+	branch1Nodes := chainedNodes(branch0Nodes[1], 3)
+	for _, node := range branch0Nodes {
+		chain.index.AddNode(node)
+	}
+	for _, node := range branch1Nodes {
+		chain.index.AddNode(node)
+	}
+	chain.bestChain.SetTip(tip(branch0Nodes))
+
+	tests := []struct {
+		name   string
+		node   *blockNode
+		height int32
+	}{
+		{name: "main chain", node: branch0Nodes[2], height: 3},
+		{name: "main chain tip", node: tip(branch0Nodes), height: 4},
+		{name: "side chain", node: branch1Nodes[0], height: 3},
+		{name: "side chain tip", node: tip(branch1Nodes), height: 5},
+	}
+	for _, test := range tests {
+		height, err := chain.HeightByHash(&test.node.hash)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+		}
+		if height != test.height {
+			t.Fatalf("%s: got height %d, want %d", test.name, height,
+				test.height)
+		}
+	}
+
+	if _, err := chain.HeightByHash(&chainhash.Hash{0x01}); err == nil {
+		t.Fatal("HeightByHash: did not fail for unknown block")
+	}
+}
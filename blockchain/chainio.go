@@ -67,6 +67,10 @@ var (
 	// unspent transaction output set.
 	utxoSetBucketName = []byte("utxosetv2")
 
+	// utxoStateConsistencyKeyName is the name of the db key used to store
+	// the hash of the block the utxo set is consistent with.
+	utxoStateConsistencyKeyName = []byte("utxostateconsistency")
+
 	// byteOrder is the preferred byte order used for serializing numeric
 	// fields for storage in the database.
 	byteOrder = binary.LittleEndian
@@ -730,10 +734,19 @@ func dbFetchUtxoEntryByHash(dbTx database.Tx, hash *chainhash.Hash) (*UtxoEntry,
 // When there is no entry for the provided output, nil will be returned for both
 // the entry and the error.
 func dbFetchUtxoEntry(dbTx database.Tx, outpoint wire.OutPoint) (*UtxoEntry, error) {
+	utxoBucket := dbTx.Metadata().Bucket(utxoSetBucketName)
+	return dbFetchUtxoEntryFromBucket(utxoBucket, outpoint)
+}
+
+// dbFetchUtxoEntryFromBucket fetches the specified transaction output from the
+// provided utxo set bucket.
+//
+// When there is no entry for the provided output, nil will be returned for both
+// the entry and the error.
+func dbFetchUtxoEntryFromBucket(utxoBucket database.Bucket, outpoint wire.OutPoint) (*UtxoEntry, error) {
 	// Fetch the unspent transaction output information for the passed
 	// transaction output.  Return now when there is no entry.
 	key := outpointKey(outpoint)
-	utxoBucket := dbTx.Metadata().Bucket(utxoSetBucketName)
 	serializedUtxo := utxoBucket.Get(*key)
 	recycleOutpointKey(key)
 	if serializedUtxo == nil {
@@ -766,6 +779,29 @@ func dbFetchUtxoEntry(dbTx database.Tx, outpoint wire.OutPoint) (*UtxoEntry, err
 	return entry, nil
 }
 
+// dbPutUtxoEntry updates the entry for the given transaction output in the
+// provided utxo set bucket.  The entry is removed when it is spent.
+func dbPutUtxoEntry(utxoBucket database.Bucket, outpoint wire.OutPoint, entry *UtxoEntry) error {
+	// Remove the utxo entry if it is spent.
+	if entry.IsSpent() {
+		key := outpointKey(outpoint)
+		err := utxoBucket.Delete(*key)
+		recycleOutpointKey(key)
+		return err
+	}
+
+	// Serialize and store the utxo entry.
+	serialized, err := serializeUtxoEntry(entry)
+	if err != nil {
+		return err
+	}
+	key := outpointKey(outpoint)
+	// NOTE: The key is intentionally not recycled here since the database
+	// interface contract prohibits modifications.  It will be garbage
+	// collected normally when the database is done with it.
+	return utxoBucket.Put(*key, serialized)
+}
+
 // dbPutUtxoView uses an existing database transaction to update the utxo set
 // in the database based on the provided utxo view contents and state.  In
 // particular, only the entries that have been marked as modified are written
@@ -778,29 +814,7 @@ func dbPutUtxoView(dbTx database.Tx, view *UtxoViewpoint) error {
 			continue
 		}
 
-		// Remove the utxo entry if it is spent.
-		if entry.IsSpent() {
-			key := outpointKey(outpoint)
-			err := utxoBucket.Delete(*key)
-			recycleOutpointKey(key)
-			if err != nil {
-				return err
-			}
-
-			continue
-		}
-
-		// Serialize and store the utxo entry.
-		serialized, err := serializeUtxoEntry(entry)
-		if err != nil {
-			return err
-		}
-		key := outpointKey(outpoint)
-		err = utxoBucket.Put(*key, serialized)
-		// NOTE: The key is intentionally not recycled here since the
-		// database interface contract prohibits modifications.  It will
-		// be garbage collected normally when the database is done with
-		// it.
+		err := dbPutUtxoEntry(utxoBucket, outpoint, entry)
 		if err != nil {
 			return err
 		}
@@ -809,6 +823,26 @@ func dbPutUtxoView(dbTx database.Tx, view *UtxoViewpoint) error {
 	return nil
 }
 
+// dbPutUtxoStateConsistency uses an existing database transaction to store the
+// hash of the block the utxo set is consistent with.
+func dbPutUtxoStateConsistency(dbTx database.Tx, hash *chainhash.Hash) error {
+	return dbTx.Metadata().Put(utxoStateConsistencyKeyName, hash[:])
+}
+
+// dbFetchUtxoStateConsistency uses an existing database transaction to fetch
+// the hash of the block the utxo set is consistent with.  It returns nil when
+// the hash has never been stored.
+func dbFetchUtxoStateConsistency(dbTx database.Tx) *chainhash.Hash {
+	serialized := dbTx.Metadata().Get(utxoStateConsistencyKeyName)
+	if len(serialized) != chainhash.HashSize {
+		return nil
+	}
+
+	var hash chainhash.Hash
+	copy(hash[:], serialized)
+	return &hash
+}
+
 // -----------------------------------------------------------------------------
 // The block index consists of two buckets with an entry for every block in the
 // main chain.  One bucket is for the hash to height mapping and the other is
@@ -1010,6 +1044,7 @@ func (b *BlockChain) createChainState() error {
 	node := newBlockNode(header, nil)
 	node.status = statusDataStored | statusValid
 	b.bestChain.SetTip(node)
+	b.bestHeader.SetTip(node)
 
 	// Add the new node to the index which is used for faster lookups.
 	b.index.addNode(node)
@@ -1150,7 +1185,7 @@ func (b *BlockChain) initChainState() error {
 		blockIndexBucket := dbTx.Metadata().Bucket(blockIndexBucketName)
 
 		var i int32
-		var lastNode *blockNode
+		var lastNode, bestHeader *blockNode
 		cursor := blockIndexBucket.Cursor()
 		for ok := cursor.First(); ok; ok = cursor.Next() {
 			header, status, err := deserializeBlockRow(cursor.Value())
@@ -1189,6 +1224,13 @@ func (b *BlockChain) initChainState() error {
 			node.status = status
 			b.index.addNode(node)
 
+			// Keep track of the valid header with the most work.
+			if !status.KnownInvalid() && (bestHeader == nil ||
+				node.workSum.Cmp(bestHeader.workSum) > 0) {
+
+				bestHeader = node
+			}
+
 			lastNode = node
 			i++
 		}
@@ -1201,14 +1243,31 @@ func (b *BlockChain) initChainState() error {
 		}
 		b.bestChain.SetTip(tip)
 
-		// Load the raw block bytes for the best block.
-		blockBytes, err := dbTx.FetchBlock(&state.hash)
-		if err != nil {
-			return err
+		// Prefer the chain tip as the best header when both have the
+		// same amount of work.
+		if bestHeader == nil || tip.workSum.Cmp(bestHeader.workSum) >= 0 {
+			bestHeader = tip
 		}
+		b.bestHeader.SetTip(bestHeader)
+
+		// The blocks before the base of a loaded utxo snapshot are
+		// only valid once they have been validated in the background
+		// and the data for the base block itself might not have been
+		// downloaded yet.
+		snapshotBase, _ := dbFetchUtxoSnapshot(dbTx)
+		isSnapshotBase := snapshotBase != nil && *snapshotBase == tip.hash
+
+		// Load the raw block bytes for the best block.
 		var block wire.MsgBlock
-		err = block.Deserialize(bytes.NewReader(blockBytes))
-		if err != nil {
+		blockBytes, err := dbTx.FetchBlock(&state.hash)
+		switch {
+		case err == nil:
+			err = block.Deserialize(bytes.NewReader(blockBytes))
+			if err != nil {
+				return err
+			}
+
+		case !isSnapshotBase || !isDbBlockNotFoundErr(err):
 			return err
 		}
 
@@ -1218,6 +1277,10 @@ func (b *BlockChain) initChainState() error {
 		// is a safe assumption as all the block before the current tip
 		// are valid by definition.
 		for iterNode := tip; iterNode != nil; iterNode = iterNode.parent {
+			if snapshotBase != nil && iterNode.hash == *snapshotBase {
+				break
+			}
+
 			// If this isn't already marked as valid in the index, then
 			// we'll mark it as valid now to ensure consistency once
 			// we're up and running.
@@ -1232,9 +1295,12 @@ func (b *BlockChain) initChainState() error {
 		}
 
 		// Initialize the state related to the best block.
-		blockSize := uint64(len(blockBytes))
-		blockWeight := uint64(GetBlockWeight(pinutil.NewBlock(&block)))
-		numTxns := uint64(len(block.Transactions))
+		var blockSize, blockWeight, numTxns uint64
+		if blockBytes != nil {
+			blockSize = uint64(len(blockBytes))
+			blockWeight = uint64(GetBlockWeight(pinutil.NewBlock(&block)))
+			numTxns = uint64(len(block.Transactions))
+		}
 		b.stateSnapshot = newBestState(tip, blockSize, blockWeight,
 			numTxns, state.totalTxns, tip.CalcPastMedianTime())
 
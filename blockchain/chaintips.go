@@ -0,0 +1,128 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/nyodeco/pind/chaincfg/chainhash"
+)
+
+// ChainTipStatus describes the state of the branch ending at a chain tip.
+type ChainTipStatus byte
+
+// These constants are used to identify the state of a chain tip.
+const (
+	// ChainTipActive is the status of the tip of the best chain.
+	ChainTipActive ChainTipStatus = iota
+
+	// ChainTipValidFork is the status of a side chain tip for which all of
+	// the blocks of the branch have been fully validated.
+	ChainTipValidFork
+
+	// ChainTipValidHeaders is the status of a side chain tip for which the
+	// data of all of the blocks of the branch is available, but not all of
+	// them have been fully validated.
+	ChainTipValidHeaders
+
+	// ChainTipHeadersOnly is the status of a side chain tip for which the
+	// data of at least one of the blocks of the branch is not available.
+	ChainTipHeadersOnly
+
+	// ChainTipInvalid is the status of a side chain tip for which at least
+	// one of the blocks of the branch is known to be invalid.
+	ChainTipInvalid
+)
+
+// chainTipStatusStrings is a map of ChainTipStatus values back to the names
+// used by the getchaintips RPC.
+var chainTipStatusStrings = map[ChainTipStatus]string{
+	ChainTipActive:       "active",
+	ChainTipValidFork:    "valid-fork",
+	ChainTipValidHeaders: "valid-headers",
+	ChainTipHeadersOnly:  "headers-only",
+	ChainTipInvalid:      "invalid",
+}
+
+// String returns the ChainTipStatus as a human-readable name.
+func (s ChainTipStatus) String() string {
+	if str := chainTipStatusStrings[s]; str != "" {
+		return str
+	}
+	return fmt.Sprintf("Unknown ChainTipStatus (%d)", int(s))
+}
+
+// ChainTip houses information about the tip of a branch of the block tree.
+type ChainTip struct {
+	Height    int32          // Height of the tip
+	Hash      chainhash.Hash // Hash of the tip
+	BranchLen int32          // Number of blocks after the fork with the best chain
+	Status    ChainTipStatus // State of the branch
+}
+
+// chainTipStatus returns the status of the branch ending at the passed node
+// which forks off of the best chain at the provided fork node.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) chainTipStatus(tip, fork *blockNode) ChainTipStatus {
+	if tip == fork {
+		return ChainTipActive
+	}
+
+	status := ChainTipValidFork
+	for n := tip; n != fork; n = n.parent {
+		nodeStatus := b.index.NodeStatus(n)
+		switch {
+		case nodeStatus.KnownInvalid():
+			return ChainTipInvalid
+		case !nodeStatus.HaveData():
+			status = ChainTipHeadersOnly
+		case !nodeStatus.KnownValid() && status == ChainTipValidFork:
+			status = ChainTipValidHeaders
+		}
+	}
+	return status
+}
+
+// ChainTips returns information about the tips of all of the branches of the
+// block tree known to the block index, including the tip of the best chain,
+// ordered by descending height.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ChainTips() []ChainTip {
+	b.chainLock.RLock()
+	defer b.chainLock.RUnlock()
+
+	// The tip of the best chain is not a tip of the block index when only
+	// the headers of some of its children are known.
+	bestTip := b.bestChain.Tip()
+	tips := b.index.Tips()
+	haveBestTip := false
+	for _, tip := range tips {
+		if tip == bestTip {
+			haveBestTip = true
+			break
+		}
+	}
+	if !haveBestTip {
+		tips = append(tips, bestTip)
+	}
+
+	chainTips := make([]ChainTip, 0, len(tips))
+	for _, tip := range tips {
+		fork := b.bestChain.FindFork(tip)
+		chainTips = append(chainTips, ChainTip{
+			Height:    tip.height,
+			Hash:      tip.hash,
+			BranchLen: tip.height - fork.height,
+			Status:    b.chainTipStatus(tip, fork),
+		})
+	}
+	sort.Slice(chainTips, func(i, j int) bool {
+		return chainTips[i].Height > chainTips[j].Height
+	})
+	return chainTips
+}
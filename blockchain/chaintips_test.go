@@ -0,0 +1,82 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/nyodeco/pind/chaincfg"
+)
+
+// TestChainTips ensures the tips of all of the branches of the block index are
+// reported along with the length and the status of their branches.
+func TestChainTips(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	chain := newFakeChain(params)
+
+	// The active tip is reported even though it has a child for which only
+	// the header is known.
+	//
+	// genesis -> 1 -> 2 -> 3 -> 4 -> 5 (active) -> 6 (header only)
+	//             \         \-> 4a -> 5a (valid fork)
+	//              \-> 2b -> 3b (only the data of 2b is stored)
+	//                    \-> 3c -> 4c (3c is invalid)
+	valid := statusDataStored | statusValid
+	nodes := extendFakeChain(chain, chain.bestChain.Tip(), 5, valid)
+	chain.bestChain.SetTip(nodes[4])
+	headerOnly := extendFakeChain(chain, nodes[4], 1, statusNone)
+	validFork := extendFakeChain(chain, nodes[2], 2, valid)
+	nodeB := extendFakeChain(chain, nodes[0], 1, statusDataStored)
+	headersOnlyFork := extendFakeChain(chain, nodeB[0], 1, statusNone)
+	invalidFork := extendFakeChain(chain, nodeB[0], 1,
+		statusDataStored|statusValidateFailed)
+	invalidFork = append(invalidFork, extendFakeChain(chain, invalidFork[0],
+		1, statusDataStored|statusInvalidAncestor)...)
+
+	tests := []struct {
+		tip       *blockNode
+		branchLen int32
+		status    ChainTipStatus
+	}{
+		{headerOnly[0], 1, ChainTipHeadersOnly},
+		{nodes[4], 0, ChainTipActive},
+		{validFork[1], 2, ChainTipValidFork},
+		{invalidFork[1], 3, ChainTipInvalid},
+		{headersOnlyFork[0], 2, ChainTipHeadersOnly},
+	}
+	chainTips := chain.ChainTips()
+	if len(chainTips) != len(tests) {
+		t.Fatalf("ChainTips: got %d tips, want %d", len(chainTips),
+			len(tests))
+	}
+	for i := 1; i < len(chainTips); i++ {
+		if chainTips[i].Height > chainTips[i-1].Height {
+			t.Fatalf("ChainTips: tips not ordered by height: %+v",
+				chainTips)
+		}
+	}
+	for _, test := range tests {
+		var found bool
+		for _, chainTip := range chainTips {
+			if chainTip.Hash != test.tip.hash {
+				continue
+			}
+			found = true
+			if chainTip.Height != test.tip.height ||
+				chainTip.BranchLen != test.branchLen ||
+				chainTip.Status != test.status {
+
+				t.Errorf("ChainTips: got %+v for tip at height "+
+					"%d, want branch length %d and status %v",
+					chainTip, test.tip.height, test.branchLen,
+					test.status)
+			}
+		}
+		if !found {
+			t.Errorf("ChainTips: tip at height %d not found",
+				test.tip.height)
+		}
+	}
+}
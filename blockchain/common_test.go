@@ -355,15 +355,15 @@ func newFakeChain(params *chaincfg.Params) *BlockChain {
 	index.AddNode(node)
 
 	targetTimespan := int64(params.TargetTimespan / time.Second)
-	targetTimePerBlock := int64(params.TargetTimePerBlock / time.Second)
 	return &BlockChain{
 		chainParams:         params,
 		timeSource:          NewMedianTime(),
 		minRetargetTimespan: targetTimespan * (100 - params.RetargetAdjustmentFactorUp) / 100,
 		maxRetargetTimespan: targetTimespan * (100 + params.RetargetAdjustmentFactorDown) / 100,
-		blocksPerRetarget:   int32(targetTimespan / targetTimePerBlock),
 		index:               index,
 		bestChain:           newChainView(node),
+		bestHeader:          newChainView(node),
+		minimumChainWork:    params.MinimumChainWork,
 		warningCaches:       newThresholdCaches(vbNumBits),
 		deploymentCaches:    newThresholdCaches(chaincfg.DefinedDeployments),
 	}
@@ -381,3 +381,63 @@ func newFakeNode(parent *blockNode, blockVersion int32, bits uint32, timestamp t
 	}
 	return newBlockNode(header, parent)
 }
+
+// newTestBlock returns a block at the passed height building on the passed
+// block which only contains a coinbase paying the block subsidy to an output
+// anyone can spend.  Blocks with different extra nonces have different hashes,
+// so several of them can build on the same parent.  The proof of work is not
+// solved, so the block must be processed with BFNoPoWCheck.
+func newTestBlock(params *chaincfg.Params, prev *wire.MsgBlock, height int32, extraNonce int64) (*pinutil.Block, error) {
+	coinbaseScript, err := txscript.NewScriptBuilder().
+		AddInt64(int64(height)).AddInt64(extraNonce).Script()
+	if err != nil {
+		return nil, err
+	}
+	coinbase := wire.NewMsgTx(1)
+	coinbase.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: wire.OutPoint{
+			Index: wire.MaxPrevOutIndex,
+		},
+		SignatureScript: coinbaseScript,
+		Sequence:        wire.MaxTxInSequenceNum,
+	})
+	coinbase.AddTxOut(wire.NewTxOut(CalcBlockSubsidy(height, params),
+		[]byte{txscript.OP_TRUE}))
+
+	block := pinutil.NewBlock(&wire.MsgBlock{
+		Header: wire.BlockHeader{
+			Version:   1,
+			PrevBlock: prev.BlockHash(),
+			Timestamp: prev.Header.Timestamp.Add(time.Minute),
+			Bits:      params.PowLimitBits,
+		},
+		Transactions: []*wire.MsgTx{coinbase},
+	})
+	merkles := BuildMerkleTreeStore(block.Transactions(), false)
+	block.MsgBlock().Header.MerkleRoot = *merkles[len(merkles)-1]
+	return block, nil
+}
+
+// extendFakeChain adds the requested number of fake nodes with the provided
+// status on top of the passed one to the block index of the passed chain,
+// updates the best header with them, and returns them.  Every node gets a
+// random nonce so forks from the same parent never share a hash.
+func extendFakeChain(chain *BlockChain, tip *blockNode, numNodes int, status blockStatus) []*blockNode {
+	params := chain.chainParams
+	nodes := make([]*blockNode, 0, numNodes)
+	for i := 0; i < numNodes; i++ {
+		header := &wire.BlockHeader{
+			Version:   1,
+			PrevBlock: tip.hash,
+			Bits:      params.PowLimitBits,
+			Timestamp: tip.Header().Timestamp.Add(params.TargetTimePerBlock),
+			Nonce:     testNoncePrng.Uint32(),
+		}
+		tip = newBlockNode(header, tip)
+		tip.status = status
+		chain.index.AddNode(tip)
+		chain.maybeUpdateBestHeader(tip)
+		nodes = append(nodes, tip)
+	}
+	return nodes
+}
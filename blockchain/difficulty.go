@@ -8,6 +8,7 @@ import (
 	"math/big"
 	"time"
 
+	"github.com/nyodeco/pind/chaincfg"
 	"github.com/nyodeco/pind/chaincfg/chainhash"
 )
 
@@ -193,102 +194,96 @@ func (b *BlockChain) calcEasiestDifficulty(bits uint32, duration time.Duration)
 	return BigToCompact(newTarget)
 }
 
-// findPrevTestNetDifficulty returns the difficulty of the previous block which
-// did not have the special testnet minimum difficulty rule applied.
+// difficultyNode adapts a block node to the chaincfg.DifficultyBlock interface
+// so the difficulty algorithms of the chain parameters can walk the chain.
+type difficultyNode struct {
+	node *blockNode
+}
+
+// Ensure difficultyNode implements the chaincfg.DifficultyBlock interface.
+var _ chaincfg.DifficultyBlock = difficultyNode{}
+
+// Height returns the height of the block.
 //
-// This function MUST be called with the chain state lock held (for writes).
-func (b *BlockChain) findPrevTestNetDifficulty(startNode *blockNode) uint32 {
-	// Search backwards through the chain for the last block without
-	// the special rule applied.
-	iterNode := startNode
-	for iterNode != nil && iterNode.height%b.blocksPerRetarget != 0 &&
-		iterNode.bits == b.chainParams.PowLimitBits {
-
-		iterNode = iterNode.parent
-	}
+// This is part of the chaincfg.DifficultyBlock interface implementation.
+func (n difficultyNode) Height() int32 {
+	return n.node.height
+}
+
+// Timestamp returns the timestamp of the block as a unix time.
+//
+// This is part of the chaincfg.DifficultyBlock interface implementation.
+func (n difficultyNode) Timestamp() int64 {
+	return n.node.timestamp
+}
 
-	// Return the found difficulty or the minimum difficulty if no
-	// appropriate block was found.
-	lastBits := b.chainParams.PowLimitBits
-	if iterNode != nil {
-		lastBits = iterNode.bits
+// Bits returns the difficulty target of the block in compact form.
+//
+// This is part of the chaincfg.DifficultyBlock interface implementation.
+func (n difficultyNode) Bits() uint32 {
+	return n.node.bits
+}
+
+// Target returns the difficulty target of the block.
+//
+// This is part of the chaincfg.DifficultyBlock interface implementation.
+func (n difficultyNode) Target() *big.Int {
+	return CompactToBig(n.node.bits)
+}
+
+// Parent returns the parent of the block or nil for the genesis block.
+//
+// This is part of the chaincfg.DifficultyBlock interface implementation.
+func (n difficultyNode) Parent() chaincfg.DifficultyBlock {
+	if n.node.parent == nil {
+		return nil
 	}
-	return lastBits
+	return difficultyNode{n.node.parent}
 }
 
 // calcNextRequiredDifficulty calculates the required difficulty for the block
-// after the passed previous block node based on the difficulty retarget rules.
-// This function differs from the exported CalcNextRequiredDifficulty in that
-// the exported version uses the current best chain as the previous block node
-// while this function accepts any block node.
+// after the passed previous block node based on the difficulty algorithm the
+// chain parameters define for its height.  This function differs from the
+// exported CalcNextRequiredDifficulty in that the exported version uses the
+// current best chain as the previous block node while this function accepts
+// any block node.
 func (b *BlockChain) calcNextRequiredDifficulty(lastNode *blockNode, newBlockTime time.Time) (uint32, error) {
 	// Genesis block.
 	if lastNode == nil {
 		return b.chainParams.PowLimitBits, nil
 	}
 
-	// If PowNoRetargeting is set to true (regtest), then return the last blocks bits
-	if b.chainParams.PowNoRetargeting {
-		return lastNode.bits, nil
-	}
-
-	// Return the previous block's difficulty requirements if this block
-	// is not at a difficulty retarget interval.
-	if (lastNode.height+1)%b.retargetInterval != 0 {
-		// For networks that support it, allow special reduction of the
-		// required difficulty once too much time has elapsed without
-		// mining a block.
-		if b.chainParams.ReduceMinDifficulty {
-			// Return minimum difficulty when more than the desired
-			// amount of time has elapsed without mining a block.
-			reductionTime := int64(b.chainParams.MinDiffReductionTime /
-				time.Second)
-			allowMinTime := lastNode.timestamp + reductionTime
-			if newBlockTime.Unix() > allowMinTime {
-				return b.chainParams.PowLimitBits, nil
-			}
-
-			// The block was mined within the desired timeframe, so
-			// return the difficulty for the last block which did
-			// not have the special minimum difficulty rule applied.
-			return b.findPrevTestNetDifficulty(lastNode), nil
-		}
+	return calcNextRequiredBits(b.chainParams, difficultyNode{lastNode},
+		newBlockTime)
+}
 
-		// For the main network (or any unrecognized networks), simply
-		// return the previous block's difficulty requirements.
-		return lastNode.bits, nil
+// calcNextRequiredBits calculates the required difficulty for the block after
+// the passed previous block based on the difficulty algorithm the chain
+// parameters define for its height.  The previous block can be any block which
+// provides access to enough of its ancestors for the algorithm, so it is also
+// used for headers which are not part of the block index.
+func calcNextRequiredBits(params *chaincfg.Params, lastBlock chaincfg.DifficultyBlock, newBlockTime time.Time) (uint32, error) {
+	// If PowNoRetargeting is set to true (regtest), then return the last blocks bits
+	if params.PowNoRetargeting {
+		return lastBlock.Bits(), nil
 	}
 
-	// Get the block node at the previous retarget (targetTimespan days
-	// worth of blocks).
-	firstNode := lastNode.RelativeAncestor(b.blocksPerRetarget)
-	if firstNode == nil {
-		return 0, AssertError("unable to obtain previous retarget block")
+	algorithm := params.DifficultyAlgorithm(lastBlock.Height() + 1)
+	newTarget, err := algorithm.NextTarget(params, lastBlock, newBlockTime)
+	if err != nil {
+		return 0, AssertError(err.Error())
 	}
 
-	// Limit the amount of adjustment that can occur to the previous
-	// difficulty.
-	actualTimespan := lastNode.timestamp - firstNode.timestamp
-	adjustedTimespan := actualTimespan
-	if actualTimespan < b.minRetargetTimespan {
-		adjustedTimespan = b.minRetargetTimespan
-	} else if actualTimespan > b.maxRetargetTimespan {
-		adjustedTimespan = b.maxRetargetTimespan
+	// Keep the exact encoding of the previous block's difficulty when it
+	// is unchanged.
+	oldTarget := lastBlock.Target()
+	if newTarget.Cmp(oldTarget) == 0 {
+		return lastBlock.Bits(), nil
 	}
 
-	// Calculate new target difficulty as:
-	//  currentDifficulty * (adjustedTimespan / targetTimespan)
-	// The result uses integer division which means it will be slightly
-	// rounded down.  Bitcoind also uses integer division to calculate this
-	// result.
-	oldTarget := CompactToBig(lastNode.bits)
-	newTarget := new(big.Int).Mul(oldTarget, big.NewInt(adjustedTimespan))
-	targetTimeSpan := int64(b.chainParams.TargetTimespan / time.Second)
-	newTarget.Div(newTarget, big.NewInt(targetTimeSpan))
-
 	// Limit new value to the proof of work limit.
-	if newTarget.Cmp(b.chainParams.PowLimit) > 0 {
-		newTarget.Set(b.chainParams.PowLimit)
+	if newTarget.Cmp(params.PowLimit) > 0 {
+		newTarget = params.PowLimit
 	}
 
 	// Log new target difficulty and return it.  The new target logging is
@@ -296,17 +291,47 @@ func (b *BlockChain) calcNextRequiredDifficulty(lastNode *blockNode, newBlockTim
 	// newTarget since conversion to the compact representation loses
 	// precision.
 	newTargetBits := BigToCompact(newTarget)
-	log.Debugf("Difficulty retarget at block height %d", lastNode.height+1)
-	log.Debugf("Old target %08x (%064x)", lastNode.bits, oldTarget)
+	log.Debugf("Difficulty retarget at block height %d", lastBlock.Height()+1)
+	log.Debugf("Old target %08x (%064x)", lastBlock.Bits(), oldTarget)
 	log.Debugf("New target %08x (%064x)", newTargetBits, CompactToBig(newTargetBits))
-	log.Debugf("Actual timespan %v, adjusted timespan %v, target timespan %v",
-		time.Duration(actualTimespan)*time.Second,
-		time.Duration(adjustedTimespan)*time.Second,
-		b.chainParams.TargetTimespan)
 
 	return newTargetBits, nil
 }
 
+// difficultyWindow returns the number of blocks, including the previous block,
+// the difficulty algorithms of the passed chain parameters look at to calculate
+// the difficulty of a block.  Zero is returned when the chain parameters use an
+// algorithm which is not known.
+func difficultyWindow(params *chaincfg.Params) int32 {
+	blocksPerRetarget := int32(params.TargetTimespan /
+		params.TargetTimePerBlock)
+	algorithms := []chaincfg.DifficultyAlgorithm{
+		params.DifficultyAlgorithm(0),
+	}
+	for _, period := range params.DifficultySchedule {
+		algorithms = append(algorithms, period.Algorithm)
+	}
+
+	var window int32 = 1
+	for _, algorithm := range algorithms {
+		var needed int32
+		switch a := algorithm.(type) {
+		case *chaincfg.RetargetDifficulty:
+			needed = blocksPerRetarget + 1
+		case *chaincfg.DigiShieldDifficulty:
+			needed = a.AveragingWindow + 1
+		case *chaincfg.LWMADifficulty:
+			needed = a.AveragingWindow + 1
+		default:
+			return 0
+		}
+		if needed > window {
+			window = needed
+		}
+	}
+	return window
+}
+
 // CalcNextRequiredDifficulty calculates the required difficulty for the block
 // after the end of the current best chain based on the difficulty retarget
 // rules.
@@ -6,7 +6,11 @@ package blockchain
 
 import (
 	"math/big"
+	"reflect"
 	"testing"
+	"time"
+
+	"github.com/nyodeco/pind/chaincfg"
 )
 
 // TestBigToCompact ensures BigToCompact converts big integers to the expected
@@ -73,3 +77,183 @@ func TestCalcWork(t *testing.T) {
 		}
 	}
 }
+
+// TestCalcNextRequiredDifficulty ensures the difficulty algorithms calculate
+// the expected difficulty for chains with various block times.
+func TestCalcNextRequiredDifficulty(t *testing.T) {
+	retarget := &chaincfg.RetargetDifficulty{Interval: 1}
+	digiShield := &chaincfg.DigiShieldDifficulty{
+		AveragingWindow: 17,
+		MaxAdjustUp:     16,
+		MaxAdjustDown:   32,
+	}
+	lwma := &chaincfg.LWMADifficulty{AveragingWindow: 45}
+
+	tests := []struct {
+		name      string
+		algorithm chaincfg.DifficultyAlgorithm
+		numBlocks int32 // number of blocks after the genesis block
+		blockTime int64 // seconds between the blocks
+		want      uint32
+	}{
+		{
+			name:      "retarget on time",
+			algorithm: retarget,
+			numBlocks: 10,
+			blockTime: 40,
+			want:      0x1d00ffff,
+		},
+		{
+			name:      "retarget fast blocks",
+			algorithm: retarget,
+			numBlocks: 10,
+			blockTime: 20,
+			want:      0x1d00faa9,
+		},
+		{
+			name:      "retarget slow blocks",
+			algorithm: retarget,
+			numBlocks: 10,
+			blockTime: 200,
+			want:      0x1d010776,
+		},
+		{
+			name:      "retarget interval not reached",
+			algorithm: &chaincfg.RetargetDifficulty{Interval: 6},
+			numBlocks: 10,
+			blockTime: 20,
+			want:      0x1d00ffff,
+		},
+		{
+			name:      "retarget interval reached",
+			algorithm: &chaincfg.RetargetDifficulty{Interval: 6},
+			numBlocks: 11,
+			blockTime: 20,
+			want:      0x1d00faa9,
+		},
+		{
+			name:      "digishield window not filled",
+			algorithm: digiShield,
+			numBlocks: 16,
+			blockTime: 40,
+			want:      0x1e0fffff,
+		},
+		{
+			name:      "digishield on time",
+			algorithm: digiShield,
+			numBlocks: 17,
+			blockTime: 40,
+			want:      0x1d00ffff,
+		},
+		{
+			name:      "digishield fast blocks",
+			algorithm: digiShield,
+			numBlocks: 30,
+			blockTime: 20,
+			want:      0x1d00dfff,
+		},
+		{
+			name:      "digishield slow blocks",
+			algorithm: digiShield,
+			numBlocks: 30,
+			blockTime: 200,
+			want:      0x1d0151b0,
+		},
+		{
+			name:      "lwma window not filled",
+			algorithm: lwma,
+			numBlocks: 44,
+			blockTime: 40,
+			want:      0x1e0fffff,
+		},
+		{
+			name:      "lwma on time",
+			algorithm: lwma,
+			numBlocks: 45,
+			blockTime: 40,
+			want:      0x1d00ffff,
+		},
+		{
+			name:      "lwma fast blocks",
+			algorithm: lwma,
+			numBlocks: 60,
+			blockTime: 20,
+			want:      0x1c7fff80,
+		},
+		{
+			name:      "lwma slow blocks limited solve time",
+			algorithm: lwma,
+			numBlocks: 60,
+			blockTime: 1000,
+			want:      0x1d05fffa,
+		},
+		{
+			name:      "lwma equal timestamps limited increase",
+			algorithm: lwma,
+			numBlocks: 60,
+			blockTime: 0,
+			want:      0x1c199980,
+		},
+	}
+
+	for _, test := range tests {
+		params := chaincfg.MainNetParams
+		params.DifficultySchedule = []chaincfg.DifficultyPeriod{
+			{Height: 0, Algorithm: test.algorithm},
+		}
+		chain := newFakeChain(&params)
+
+		node := chain.bestChain.Tip()
+		timestamp := time.Unix(node.timestamp, 0)
+		for i := int32(0); i < test.numBlocks; i++ {
+			timestamp = timestamp.Add(time.Duration(test.blockTime) *
+				time.Second)
+			node = newFakeNode(node, 1, 0x1d00ffff, timestamp)
+		}
+
+		got, err := chain.calcNextRequiredDifficulty(node, timestamp)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s: got bits %08x, want %08x", test.name, got,
+				test.want)
+		}
+	}
+}
+
+// TestDifficultySchedule ensures the difficulty algorithm of the chain
+// parameters is selected by the height of the block.
+func TestDifficultySchedule(t *testing.T) {
+	retarget := &chaincfg.RetargetDifficulty{Interval: 1}
+	digiShield := &chaincfg.DigiShieldDifficulty{AveragingWindow: 17}
+	lwma := &chaincfg.LWMADifficulty{AveragingWindow: 45}
+	params := chaincfg.Params{
+		DifficultySchedule: []chaincfg.DifficultyPeriod{
+			{Height: 100, Algorithm: retarget},
+			{Height: 200, Algorithm: digiShield},
+			{Height: 300, Algorithm: lwma},
+		},
+	}
+
+	tests := []struct {
+		height int32
+		want   chaincfg.DifficultyAlgorithm
+	}{
+		{0, &chaincfg.RetargetDifficulty{Interval: 1}},
+		{100, retarget},
+		{199, retarget},
+		{200, digiShield},
+		{299, digiShield},
+		{300, lwma},
+		{1000000, lwma},
+	}
+	for _, test := range tests {
+		got := params.DifficultyAlgorithm(test.height)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("DifficultyAlgorithm(%d): got %#v, want %#v",
+				test.height, got, test.want)
+		}
+	}
+}
@@ -220,6 +220,23 @@ const (
 	// current chain tip. This is not a block validation rule, but is required
 	// for block proposals submitted via getblocktemplate RPC.
 	ErrPrevBlockNotBest
+
+	// ErrMissingDeploymentSignal indicates a block doesn't signal for a
+	// height based deployment during the period in which signalling for it
+	// is required per BIP0008.
+	ErrMissingDeploymentSignal
+
+	// ErrInvalidateGenesis indicates an attempt to invalidate the genesis
+	// block.  This is not a block validation rule, but is required for
+	// the invalidateblock RPC.
+	ErrInvalidateGenesis
+
+	// ErrInvalidateSnapshotBlock indicates an attempt to invalidate a
+	// block of the main chain up to the base of a loaded utxo set snapshot
+	// while the blocks before the base are still being validated.  This is
+	// not a block validation rule, but is required for the invalidateblock
+	// RPC.
+	ErrInvalidateSnapshotBlock
 )
 
 // Map of ErrorCode values back to their constant names for pretty printing.
@@ -267,6 +284,9 @@ var errorCodeStrings = map[ErrorCode]string{
 	ErrPreviousBlockUnknown:      "ErrPreviousBlockUnknown",
 	ErrInvalidAncestorBlock:      "ErrInvalidAncestorBlock",
 	ErrPrevBlockNotBest:          "ErrPrevBlockNotBest",
+	ErrMissingDeploymentSignal:   "ErrMissingDeploymentSignal",
+	ErrInvalidateGenesis:         "ErrInvalidateGenesis",
+	ErrInvalidateSnapshotBlock:   "ErrInvalidateSnapshotBlock",
 }
 
 // String returns the ErrorCode as a human-readable name.
@@ -58,6 +58,9 @@ func TestErrorCodeStringer(t *testing.T) {
 		{ErrPreviousBlockUnknown, "ErrPreviousBlockUnknown"},
 		{ErrInvalidAncestorBlock, "ErrInvalidAncestorBlock"},
 		{ErrPrevBlockNotBest, "ErrPrevBlockNotBest"},
+		{ErrMissingDeploymentSignal, "ErrMissingDeploymentSignal"},
+		{ErrInvalidateGenesis, "ErrInvalidateGenesis"},
+		{ErrInvalidateSnapshotBlock, "ErrInvalidateSnapshotBlock"},
 		{0xffff, "Unknown ErrorCode (65535)"},
 	}
 
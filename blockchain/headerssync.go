@@ -0,0 +1,522 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/nyodeco/pind/chaincfg"
+	"github.com/nyodeco/pind/chaincfg/chainhash"
+	"github.com/nyodeco/pind/wire"
+)
+
+const (
+	// headersCommitmentPeriod is the number of headers between the
+	// commitments which are stored while presyncing the headers chain of a
+	// peer.
+	headersCommitmentPeriod = 600
+
+	// headersRedownloadBufferSize is the number of redownloaded headers
+	// which are held back before the oldest ones are released for storage.
+	// It covers 25 commitments, so a peer which serves a different chain
+	// during the redownload than during the presync is detected with a
+	// probability of 1 - 2^-25 before any of its headers are stored.
+	headersRedownloadBufferSize = headersCommitmentPeriod * 25
+
+	// maxHeadersPerSecond is the maximum rate at which a headers chain can
+	// advance in time.  It follows from the timestamp of every header
+	// being required to be after the median time of the headers before it
+	// and bounds the number of commitments stored during the presync.
+	maxHeadersPerSecond = 6
+)
+
+// headersSyncPhase identifies the phase of a low-work headers presync.
+type headersSyncPhase byte
+
+const (
+	// headersPresync is the phase during which the headers chain of the
+	// peer is verified to reach the minimum chain work without storing the
+	// headers.
+	headersPresync headersSyncPhase = iota
+
+	// headersRedownload is the phase during which the headers chain is
+	// downloaded again and verified against the commitments made during
+	// the presync before the headers are released.
+	headersRedownload
+
+	// headersSyncFinal is the phase after the headers sync has finished,
+	// either because all of the headers up to the minimum chain work have
+	// been released or because the chain of the peer does not reach it.
+	headersSyncFinal
+)
+
+// headersChainBlock houses the information about a header of a headers chain
+// which is needed to check the headers after it.
+type headersChainBlock struct {
+	height    int32
+	timestamp int64
+	bits      uint32
+}
+
+// headersChainTip tracks the tip of a headers chain which is being downloaded
+// without adding the headers to the block index.
+type headersChainTip struct {
+	params *chaincfg.Params
+	hash   chainhash.Hash
+	height int32
+	work   *big.Int
+
+	// blocks houses the last headers of the chain, newest last, which are
+	// needed to calculate the median time and the difficulty of the next
+	// header.  The difficulty is only checked when the number of headers
+	// the difficulty algorithms need is known.
+	blocks          []headersChainBlock
+	window          int
+	checkDifficulty bool
+}
+
+// newHeadersChainTip returns a headers chain tip for the passed block node.
+func newHeadersChainTip(params *chaincfg.Params, node *blockNode) *headersChainTip {
+	window := int(difficultyWindow(params))
+	checkDifficulty := window != 0
+	if window < medianTimeBlocks {
+		window = medianTimeBlocks
+	}
+
+	blocks := make([]headersChainBlock, 0, window)
+	for n := node; n != nil && len(blocks) < window; n = n.parent {
+		blocks = append(blocks, headersChainBlock{
+			height:    n.height,
+			timestamp: n.timestamp,
+			bits:      n.bits,
+		})
+	}
+	for i, j := 0, len(blocks)-1; i < j; i, j = i+1, j-1 {
+		blocks[i], blocks[j] = blocks[j], blocks[i]
+	}
+	return &headersChainTip{
+		params:          params,
+		hash:            node.hash,
+		height:          node.height,
+		work:            new(big.Int).Set(node.workSum),
+		blocks:          blocks,
+		window:          window,
+		checkDifficulty: checkDifficulty,
+	}
+}
+
+// clone returns a copy of the headers chain tip.
+func (t *headersChainTip) clone() *headersChainTip {
+	c := *t
+	c.work = new(big.Int).Set(t.work)
+	c.blocks = append([]headersChainBlock(nil), t.blocks...)
+	return &c
+}
+
+// connect extends the headers chain with the passed header after ensuring it
+// connects to the tip, its timestamp is after the median time of the headers
+// before it, and its difficulty is the one required by the difficulty rules.
+// The context free checks of the header, including its proof of work, must
+// have been performed by the caller.
+func (t *headersChainTip) connect(header *wire.BlockHeader) error {
+	if header.PrevBlock != t.hash {
+		str := fmt.Sprintf("header %v does not connect to the previous "+
+			"header %v", header.BlockHash(), t.hash)
+		return ruleError(ErrPreviousBlockUnknown, str)
+	}
+
+	if t.checkDifficulty {
+		last := headersChainBlockRef{t.blocks, len(t.blocks) - 1}
+		expectedBits, err := calcNextRequiredBits(t.params, last,
+			header.Timestamp)
+		if err != nil {
+			return err
+		}
+		if header.Bits != expectedBits {
+			str := fmt.Sprintf("header difficulty of %d is not the "+
+				"expected value of %d", header.Bits, expectedBits)
+			return ruleError(ErrUnexpectedDifficulty, str)
+		}
+	}
+
+	// See CalcPastMedianTime for details about the median calculation.
+	numTimestamps := len(t.blocks)
+	if numTimestamps > medianTimeBlocks {
+		numTimestamps = medianTimeBlocks
+	}
+	sorted := make([]int64, 0, numTimestamps)
+	for _, block := range t.blocks[len(t.blocks)-numTimestamps:] {
+		sorted = append(sorted, block.timestamp)
+	}
+	sort.Sort(timeSorter(sorted))
+	medianTime := sorted[len(sorted)/2]
+	if header.Timestamp.Unix() <= medianTime {
+		str := fmt.Sprintf("header timestamp of %v is not after the "+
+			"median time of the previous headers", header.Timestamp)
+		return ruleError(ErrTimeTooOld, str)
+	}
+
+	t.hash = header.BlockHash()
+	t.height++
+	t.work.Add(t.work, CalcWork(header.Bits))
+	if len(t.blocks) == t.window {
+		t.blocks = t.blocks[1:]
+	}
+	t.blocks = append(t.blocks, headersChainBlock{
+		height:    t.height,
+		timestamp: header.Timestamp.Unix(),
+		bits:      header.Bits,
+	})
+	return nil
+}
+
+// headersChainBlockRef adapts a header of a headers chain tip to the
+// chaincfg.DifficultyBlock interface so the difficulty algorithms of the chain
+// parameters can walk the headers before it.
+type headersChainBlockRef struct {
+	blocks []headersChainBlock
+	idx    int
+}
+
+// Ensure headersChainBlockRef implements the chaincfg.DifficultyBlock
+// interface.
+var _ chaincfg.DifficultyBlock = headersChainBlockRef{}
+
+// Height returns the height of the header.
+//
+// This is part of the chaincfg.DifficultyBlock interface implementation.
+func (r headersChainBlockRef) Height() int32 {
+	return r.blocks[r.idx].height
+}
+
+// Timestamp returns the timestamp of the header as a unix time.
+//
+// This is part of the chaincfg.DifficultyBlock interface implementation.
+func (r headersChainBlockRef) Timestamp() int64 {
+	return r.blocks[r.idx].timestamp
+}
+
+// Bits returns the difficulty target of the header in compact form.
+//
+// This is part of the chaincfg.DifficultyBlock interface implementation.
+func (r headersChainBlockRef) Bits() uint32 {
+	return r.blocks[r.idx].bits
+}
+
+// Target returns the difficulty target of the header.
+//
+// This is part of the chaincfg.DifficultyBlock interface implementation.
+func (r headersChainBlockRef) Target() *big.Int {
+	return CompactToBig(r.blocks[r.idx].bits)
+}
+
+// Parent returns the previous header or nil when it is not tracked, which is
+// only the case for the genesis block since enough headers are tracked for the
+// difficulty algorithms.
+//
+// This is part of the chaincfg.DifficultyBlock interface implementation.
+func (r headersChainBlockRef) Parent() chaincfg.DifficultyBlock {
+	if r.idx == 0 {
+		return nil
+	}
+	return headersChainBlockRef{r.blocks, r.idx - 1}
+}
+
+// HeadersSync verifies that the headers chain of a peer reaches the minimum
+// chain work of the network before any of its headers are stored, which
+// prevents peers from making a node store long chains of low-work headers.
+//
+// The headers are downloaded twice.  During the presync, only the chain work
+// of the headers and a commitment to one bit of a salted hash of every few
+// headers are kept.  Once the chain reaches the minimum chain work, the headers
+// are downloaded again from the start and verified against the commitments.
+// The redownloaded headers are released for storage once enough commitments
+// have been verified on top of them, and all of them once the redownloaded
+// chain reaches the minimum chain work.
+//
+// A HeadersSync is not safe for concurrent access.
+type HeadersSync struct {
+	chain       *BlockChain
+	minimumWork *big.Int
+	phase       headersSyncPhase
+
+	// These fields define which headers are committed to and how.  The
+	// salt and offset are random so a peer can't predict the commitments.
+	commitmentPeriod     int32
+	commitmentOffset     int32
+	redownloadBufferSize int
+	salt                 [32]byte
+
+	// commitments houses one bit per committed header of the presync.
+	commitments    []byte
+	numCommitments int64
+	maxCommitments int64
+
+	// These fields track the chain during the presync and the redownload.
+	start            *headersChainTip
+	presyncTip       *headersChainTip
+	redownloadTip    *headersChainTip
+	redownloadIdx    int64
+	redownloadBuffer []*wire.BlockHeader
+}
+
+// NewHeadersSync returns a new low-work headers presync for the headers chain
+// of a peer which builds on the block with the passed hash.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) NewHeadersSync(startHash *chainhash.Hash) (*HeadersSync, error) {
+	b.chainLock.RLock()
+	defer b.chainLock.RUnlock()
+
+	node := b.index.LookupNode(startHash)
+	if node == nil {
+		str := fmt.Sprintf("start block %s is unknown", startHash)
+		return nil, ruleError(ErrPreviousBlockUnknown, str)
+	}
+	if b.index.NodeStatus(node).KnownInvalid() {
+		str := fmt.Sprintf("start block %s is known to be invalid",
+			startHash)
+		return nil, ruleError(ErrInvalidAncestorBlock, str)
+	}
+
+	s := &HeadersSync{
+		chain:                b,
+		minimumWork:          b.minimumChainWork,
+		phase:                headersPresync,
+		commitmentPeriod:     headersCommitmentPeriod,
+		redownloadBufferSize: headersRedownloadBufferSize,
+		start:                newHeadersChainTip(b.chainParams, node),
+	}
+	if s.minimumWork == nil {
+		s.minimumWork = new(big.Int)
+	}
+	s.presyncTip = s.start.clone()
+
+	var offset [4]byte
+	if _, err := rand.Read(offset[:]); err != nil {
+		return nil, err
+	}
+	s.commitmentOffset = int32(binary.LittleEndian.Uint32(offset[:]) %
+		uint32(s.commitmentPeriod))
+	if _, err := rand.Read(s.salt[:]); err != nil {
+		return nil, err
+	}
+
+	// Bound the number of commitments by the number of headers which can
+	// be produced from the median time of the start block until the
+	// latest timestamp which is accepted.
+	maxTime := b.timeSource.AdjustedTime().Unix() + MaxTimeOffsetSeconds
+	elapsed := maxTime - node.CalcPastMedianTime().Unix()
+	s.maxCommitments = maxHeadersPerSecond * elapsed /
+		int64(s.commitmentPeriod)
+
+	return s, nil
+}
+
+// commitment returns the bit committed to for the passed header hash.
+func (s *HeadersSync) commitment(hash *chainhash.Hash) byte {
+	var buf [len(s.salt) + chainhash.HashSize]byte
+	copy(buf[:], s.salt[:])
+	copy(buf[len(s.salt):], hash[:])
+	digest := sha256.Sum256(buf[:])
+	return digest[0] & 1
+}
+
+// isCommitted returns whether the header at the passed height is committed to.
+func (s *HeadersSync) isCommitted(height int32) bool {
+	return height%s.commitmentPeriod == s.commitmentOffset
+}
+
+// checkHeader performs the context free checks of the passed header.
+func (s *HeadersSync) checkHeader(header *wire.BlockHeader) error {
+	b := s.chain
+	return checkBlockHeaderSanity(header, b.chainParams.PowLimit,
+		b.timeSource, b.index.PowHash, BFNone)
+}
+
+// processPresyncHeaders processes the passed headers during the presync.
+func (s *HeadersSync) processPresyncHeaders(headers []*wire.BlockHeader, fullMessage bool) error {
+	for _, header := range headers {
+		if err := s.checkHeader(header); err != nil {
+			return err
+		}
+		if err := s.presyncTip.connect(header); err != nil {
+			return err
+		}
+
+		if s.isCommitted(s.presyncTip.height) {
+			if s.numCommitments >= s.maxCommitments {
+				return fmt.Errorf("headers chain exceeds the "+
+					"maximum length of %d commitments",
+					s.maxCommitments)
+			}
+			if s.numCommitments%8 == 0 {
+				s.commitments = append(s.commitments, 0)
+			}
+			bit := s.commitment(&s.presyncTip.hash)
+			s.commitments[s.numCommitments/8] |= bit <<
+				uint(s.numCommitments%8)
+			s.numCommitments++
+		}
+
+		// Download the headers again from the start once the chain is
+		// known to reach the minimum chain work.  The remaining
+		// headers are simply ignored as they will be downloaded again.
+		if s.presyncTip.work.Cmp(s.minimumWork) >= 0 {
+			log.Debugf("Headers presync reached the minimum chain "+
+				"work at height %d", s.presyncTip.height)
+			s.phase = headersRedownload
+			s.redownloadTip = s.start.clone()
+			return nil
+		}
+	}
+
+	// The chain of the peer does not reach the minimum chain work when it
+	// has no more headers.
+	if !fullMessage {
+		log.Debugf("Headers presync ended at height %d without reaching "+
+			"the minimum chain work", s.presyncTip.height)
+		s.finish()
+	}
+	return nil
+}
+
+// processRedownloadHeaders processes the passed headers during the redownload
+// and returns the headers which are released for storage.
+func (s *HeadersSync) processRedownloadHeaders(headers []*wire.BlockHeader, fullMessage bool) ([]*wire.BlockHeader, error) {
+	releaseAll := false
+	for _, header := range headers {
+		if err := s.checkHeader(header); err != nil {
+			return nil, err
+		}
+		if err := s.redownloadTip.connect(header); err != nil {
+			return nil, err
+		}
+
+		// The redownloaded header must match the commitment made for
+		// it during the presync.
+		if s.isCommitted(s.redownloadTip.height) {
+			if s.redownloadIdx >= s.numCommitments {
+				return nil, fmt.Errorf("redownloaded headers chain " +
+					"exceeds the presynced chain")
+			}
+			bit := s.commitments[s.redownloadIdx/8] >>
+				uint(s.redownloadIdx%8) & 1
+			if s.commitment(&s.redownloadTip.hash) != bit {
+				return nil, fmt.Errorf("redownloaded header %v "+
+					"at height %d does not match the presynced "+
+					"chain", s.redownloadTip.hash,
+					s.redownloadTip.height)
+			}
+			s.redownloadIdx++
+		}
+
+		s.redownloadBuffer = append(s.redownloadBuffer, header)
+		if s.redownloadTip.work.Cmp(s.minimumWork) >= 0 {
+			releaseAll = true
+		}
+	}
+
+	// Release all of the buffered headers once the redownloaded chain
+	// reaches the minimum chain work and otherwise only the ones which
+	// are buried deep enough under verified commitments.
+	var released []*wire.BlockHeader
+	switch {
+	case releaseAll:
+		released = s.redownloadBuffer
+		s.redownloadBuffer = nil
+		s.finish()
+
+	case len(s.redownloadBuffer) > s.redownloadBufferSize:
+		numReleased := len(s.redownloadBuffer) - s.redownloadBufferSize
+		released = s.redownloadBuffer[:numReleased:numReleased]
+		s.redownloadBuffer = s.redownloadBuffer[numReleased:]
+	}
+
+	// The peer served a shorter chain during the redownload when it has
+	// no more headers before reaching the minimum chain work.
+	if !fullMessage && s.phase != headersSyncFinal {
+		log.Debugf("Headers redownload ended at height %d without "+
+			"reaching the minimum chain work",
+			s.redownloadTip.height)
+		s.finish()
+	}
+	return released, nil
+}
+
+// finish ends the headers sync and frees the memory used by it.
+func (s *HeadersSync) finish() {
+	s.phase = headersSyncFinal
+	s.commitments = nil
+	s.redownloadBuffer = nil
+}
+
+// ProcessHeaders processes the passed headers of the peer, which must connect
+// to the headers processed before or to the start block.  The full message
+// flag indicates whether the headers were received in a message with the
+// maximum number of headers, in which case the peer is assumed to have more.
+//
+// It returns the headers which are released for storage, such as with
+// ProcessBlockHeader, in the order they must be processed, and whether more
+// headers need to be requested from the peer with the locator returned by
+// Locator.  The headers sync is finished when no more headers are requested.
+// The chain of the peer does not reach the minimum chain work when it finishes
+// before the released headers reach it.
+//
+// An error is returned when the headers are invalid or don't match the headers
+// chain of the presync, in which case the headers sync must be abandoned.
+func (s *HeadersSync) ProcessHeaders(headers []*wire.BlockHeader, fullMessage bool) ([]*wire.BlockHeader, bool, error) {
+	var released []*wire.BlockHeader
+	var err error
+	switch s.phase {
+	case headersPresync:
+		err = s.processPresyncHeaders(headers, fullMessage)
+
+	case headersRedownload:
+		released, err = s.processRedownloadHeaders(headers, fullMessage)
+	}
+	if err != nil {
+		s.finish()
+		return nil, false, err
+	}
+	return released, s.phase != headersSyncFinal, nil
+}
+
+// Locator returns the block locator to request the next headers of the peer
+// with.
+func (s *HeadersSync) Locator() BlockLocator {
+	tip := s.presyncTip
+	if s.phase == headersRedownload {
+		tip = s.redownloadTip
+	}
+	hash := tip.hash
+	return BlockLocator([]*chainhash.Hash{&hash})
+}
+
+// PresyncHeight returns the height of the headers chain of the peer which has
+// been verified so far during the presync.
+func (s *HeadersSync) PresyncHeight() int32 {
+	return s.presyncTip.height
+}
+
+// HasMinimumChainWork returns whether the best known header chain has at least
+// the minimum chain work the chain was configured with.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) HasMinimumChainWork() bool {
+	if b.minimumChainWork == nil {
+		return true
+	}
+
+	b.chainLock.RLock()
+	tip := b.bestHeader.Tip()
+	b.chainLock.RUnlock()
+	return tip.workSum.Cmp(b.minimumChainWork) >= 0
+}
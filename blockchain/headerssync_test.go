@@ -0,0 +1,196 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nyodeco/pind/chaincfg"
+	"github.com/nyodeco/pind/wire"
+)
+
+// TestHeadersSync ensures the low-work headers presync only releases headers
+// of a chain with the minimum chain work and detects peers which serve a
+// different chain during the redownload.
+func TestHeadersSync(t *testing.T) {
+	params := chaincfg.RegressionNetParams
+	genesisHash := params.GenesisBlock.BlockHash()
+	target := CompactToBig(params.PowLimitBits)
+	work := CalcWork(params.PowLimitBits)
+	params.MinimumChainWork = new(big.Int).Mul(work, big.NewInt(31))
+	chain := newFakeChain(&params)
+
+	// solveHeader returns a header with a valid proof of work which builds
+	// on the passed header and has the provided timestamp.
+	solveHeader := func(prev *wire.BlockHeader, timestamp time.Time) *wire.BlockHeader {
+		header := &wire.BlockHeader{
+			Version:   1,
+			PrevBlock: prev.BlockHash(),
+			Timestamp: timestamp,
+			Bits:      params.PowLimitBits,
+		}
+		for {
+			powHash := header.PowHash()
+			if HashToBig(&powHash).Cmp(target) <= 0 {
+				return header
+			}
+			header.Nonce++
+		}
+	}
+
+	// Create a chain of 40 headers.  The minimum chain work is reached at
+	// height 30.
+	var headers []*wire.BlockHeader
+	prev := &params.GenesisBlock.Header
+	for i := 0; i < 40; i++ {
+		prev = solveHeader(prev, prev.Timestamp.Add(time.Minute))
+		headers = append(headers, prev)
+	}
+
+	// newHeadersSync returns a headers sync which commits to every third
+	// header and holds back six redownloaded headers.
+	newHeadersSync := func() *HeadersSync {
+		s, err := chain.NewHeadersSync(&genesisHash)
+		if err != nil {
+			t.Fatalf("NewHeadersSync: unexpected error: %v", err)
+		}
+		s.commitmentPeriod = 3
+		s.commitmentOffset = 1
+		s.redownloadBufferSize = 6
+		return s
+	}
+
+	// The presync doesn't release any headers and switches to the
+	// redownload from the start block once the minimum chain work is
+	// reached.
+	s := newHeadersSync()
+	released, more, err := s.ProcessHeaders(headers[:20], true)
+	if err != nil || len(released) != 0 || !more {
+		t.Fatalf("ProcessHeaders: got %d headers, more %v, error %v",
+			len(released), more, err)
+	}
+	if got, want := *s.Locator()[0], headers[19].BlockHash(); got != want {
+		t.Fatalf("Locator: got %v, want %v", got, want)
+	}
+	released, more, err = s.ProcessHeaders(headers[20:], true)
+	if err != nil || len(released) != 0 || !more {
+		t.Fatalf("ProcessHeaders: got %d headers, more %v, error %v",
+			len(released), more, err)
+	}
+	if s.PresyncHeight() != 30 {
+		t.Fatalf("PresyncHeight: got %d, want 30", s.PresyncHeight())
+	}
+	if got := *s.Locator()[0]; got != genesisHash {
+		t.Fatalf("Locator: got %v, want %v", got, genesisHash)
+	}
+
+	// The redownloaded headers are released once they are buried under
+	// the buffer and all of them once the minimum chain work is reached.
+	released, more, err = s.ProcessHeaders(headers[:20], true)
+	if err != nil || !more {
+		t.Fatalf("ProcessHeaders: got more %v, error %v", more, err)
+	}
+	if !reflect.DeepEqual(released, headers[:14]) {
+		t.Fatalf("ProcessHeaders: got %d released headers, want 14",
+			len(released))
+	}
+	released, more, err = s.ProcessHeaders(headers[20:30], true)
+	if err != nil || more {
+		t.Fatalf("ProcessHeaders: got more %v, error %v", more, err)
+	}
+	if !reflect.DeepEqual(released, headers[14:30]) {
+		t.Fatalf("ProcessHeaders: got %d released headers, want 16",
+			len(released))
+	}
+
+	// A chain which doesn't reach the minimum chain work is never
+	// released.
+	s = newHeadersSync()
+	released, more, err = s.ProcessHeaders(headers[:25], false)
+	if err != nil || len(released) != 0 || more {
+		t.Fatalf("ProcessHeaders: got %d headers, more %v, error %v",
+			len(released), more, err)
+	}
+
+	// Headers which don't connect are rejected.
+	s = newHeadersSync()
+	_, more, err = s.ProcessHeaders(headers[1:], true)
+	if rerr, ok := err.(RuleError); !ok || rerr.ErrorCode != ErrPreviousBlockUnknown {
+		t.Fatalf("ProcessHeaders: got error %v, want %v", err,
+			ErrPreviousBlockUnknown)
+	}
+	if more {
+		t.Fatal("ProcessHeaders: more headers requested after error")
+	}
+
+	// Headers which claim a difficulty other than the one required by the
+	// difficulty rules are rejected during the presync even though they
+	// have a valid proof of work for it.
+	forged := *headers[0]
+	forged.Bits = 0x2000ffff
+	forgedTarget := CompactToBig(forged.Bits)
+	for {
+		powHash := forged.PowHash()
+		if HashToBig(&powHash).Cmp(forgedTarget) <= 0 {
+			break
+		}
+		forged.Nonce++
+	}
+	s = newHeadersSync()
+	_, _, err = s.ProcessHeaders([]*wire.BlockHeader{&forged}, true)
+	if rerr, ok := err.(RuleError); !ok || rerr.ErrorCode != ErrUnexpectedDifficulty {
+		t.Fatalf("ProcessHeaders: got error %v, want %v", err,
+			ErrUnexpectedDifficulty)
+	}
+
+	// A redownloaded header which doesn't match the commitment made for
+	// the presynced chain is detected.  The alternative header is chosen
+	// so its commitment differs.
+	s = newHeadersSync()
+	s.commitmentPeriod = 1
+	s.commitmentOffset = 0
+	if _, _, err := s.ProcessHeaders(headers, true); err != nil {
+		t.Fatalf("ProcessHeaders: unexpected error: %v", err)
+	}
+	altHeader := solveHeader(headers[9], headers[10].Timestamp)
+	origHash := headers[10].BlockHash()
+	for {
+		altHash := altHeader.BlockHash()
+		if s.commitment(&altHash) != s.commitment(&origHash) {
+			break
+		}
+		altHeader = solveHeader(headers[9],
+			altHeader.Timestamp.Add(time.Second))
+	}
+	altHeaders := append(append([]*wire.BlockHeader(nil), headers[:10]...),
+		altHeader)
+	if _, more, err = s.ProcessHeaders(altHeaders, true); err == nil || more {
+		t.Fatalf("ProcessHeaders: got more %v, error %v, want error",
+			more, err)
+	}
+}
+
+// TestHasMinimumChainWork ensures the best header chain is compared against the
+// configured minimum chain work.
+func TestHasMinimumChainWork(t *testing.T) {
+	params := chaincfg.RegressionNetParams
+	chain := newFakeChain(&params)
+	if !chain.HasMinimumChainWork() {
+		t.Fatal("HasMinimumChainWork: got false without minimum work")
+	}
+
+	genesisWork := CalcWork(params.GenesisBlock.Header.Bits)
+	chain.minimumChainWork = new(big.Int).Add(genesisWork, big.NewInt(1))
+	if chain.HasMinimumChainWork() {
+		t.Fatal("HasMinimumChainWork: got true below minimum work")
+	}
+	chain.minimumChainWork = genesisWork
+	if !chain.HasMinimumChainWork() {
+		t.Fatal("HasMinimumChainWork: got false at minimum work")
+	}
+}
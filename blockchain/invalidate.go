@@ -0,0 +1,249 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"container/list"
+	"fmt"
+
+	"github.com/nyodeco/pind/chaincfg/chainhash"
+)
+
+// descendants returns all of the nodes in the block index which descend from
+// the passed node.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) descendants(node *blockNode) []*blockNode {
+	var descendants []*blockNode
+	seen := make(map[*blockNode]struct{})
+	for _, tip := range b.index.Tips() {
+		if tip.height <= node.height || tip.Ancestor(node.height) != node {
+			continue
+		}
+		for n := tip; n != node; n = n.parent {
+			if _, ok := seen[n]; ok {
+				break
+			}
+			seen[n] = struct{}{}
+			descendants = append(descendants, n)
+		}
+	}
+	return descendants
+}
+
+// lastConnectableNode returns the last node of the branch ending at the passed
+// node which the best chain can be reorganized to.  That is the case when the
+// data for it and all of its ancestors after the fork point with the best chain
+// is available and none of them are known to be invalid.  Nil is returned when
+// there is no such node.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) lastConnectableNode(node *blockNode) *blockNode {
+	var last *blockNode
+	fork := b.bestChain.FindFork(node)
+	for n := node; n != nil && n != fork; n = n.parent {
+		status := b.index.NodeStatus(n)
+		if !status.HaveData() || status.KnownInvalid() {
+			last = nil
+			continue
+		}
+		if last == nil {
+			last = n
+		}
+	}
+	return last
+}
+
+// activateBestChain reorganizes the chain to the connectable branch with the
+// most cumulative work when it has more work than the current best chain.
+// Branches which turn out to be invalid while doing so are marked as such and
+// the next best branch is tried.
+//
+// This function may modify node statuses in the block index without flushing.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) activateBestChain() error {
+	for {
+		var best *blockNode
+		bestWork := b.bestChain.Tip().workSum
+		for _, tip := range b.index.Tips() {
+			if tip.workSum.Cmp(bestWork) <= 0 {
+				continue
+			}
+			node := b.lastConnectableNode(tip)
+			if node != nil && node.workSum.Cmp(bestWork) > 0 {
+				best = node
+				bestWork = node.workSum
+			}
+		}
+		if best == nil {
+			return nil
+		}
+
+		detachNodes, attachNodes := b.getReorganizeNodes(best)
+		err := b.reorganizeChain(detachNodes, attachNodes)
+		if _, ok := err.(RuleError); !ok {
+			return err
+		}
+	}
+}
+
+// resetBestHeader sets the tip of the best known header chain to the header
+// with the most cumulative work which isn't known to be invalid.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) resetBestHeader() {
+	best := b.bestChain.Tip()
+	for _, tip := range b.index.Tips() {
+		n := tip
+		for n != nil && b.index.NodeStatus(n).KnownInvalid() {
+			n = n.parent
+		}
+		if n != nil && n.workSum.Cmp(best.workSum) > 0 {
+			best = n
+		}
+	}
+	b.bestHeader.SetTip(best)
+}
+
+// InvalidateBlock permanently marks the block with the provided hash as invalid
+// along with all of its descendants as having an invalid ancestor.  When the
+// block is part of the best chain, it is disconnected along with all of its
+// descendants and the chain is reorganized to the best remaining branch.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) InvalidateBlock(hash *chainhash.Hash) error {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	node := b.index.LookupNode(hash)
+	if node == nil {
+		return fmt.Errorf("block %v is not known", hash)
+	}
+	if node.parent == nil {
+		return ruleError(ErrInvalidateGenesis, "the genesis block can't "+
+			"be invalidated")
+	}
+	if s := b.utxoSnapshot; s != nil && node.height <= s.baseNode.height &&
+		b.bestChain.Contains(node) {
+
+		str := "the blocks before a loaded utxo snapshot can't be " +
+			"invalidated while they are being validated"
+		return ruleError(ErrInvalidateSnapshotBlock, str)
+	}
+
+	// Disconnect the block and all of its descendants from the best chain
+	// before marking them invalid, so they are left untouched when that
+	// fails.
+	inBestChain := b.bestChain.Contains(node)
+	if inBestChain {
+		log.Infof("Disconnecting invalidated block %v (height %d)",
+			node.hash, node.height)
+
+		detachNodes := list.New()
+		for n := b.bestChain.Tip(); n != node.parent; n = n.parent {
+			detachNodes.PushBack(n)
+		}
+		err := b.reorganizeChain(detachNodes, list.New())
+		if err != nil {
+			return err
+		}
+	}
+
+	b.index.SetStatusFlags(node, statusValidateFailed)
+	for _, n := range b.descendants(node) {
+		b.index.SetStatusFlags(n, statusInvalidAncestor)
+	}
+
+	// Switch to the best remaining branch.
+	var err error
+	if inBestChain {
+		err = b.activateBestChain()
+	}
+	b.resetBestHeader()
+
+	if writeErr := b.index.flushToDB(); writeErr != nil {
+		log.Warnf("Error flushing block index changes to disk: %v",
+			writeErr)
+	}
+	return err
+}
+
+// ReconsiderBlock removes the invalidity status of the block with the provided
+// hash along with that of its ancestors and descendants.  This reverses the
+// effects of InvalidateBlock, as well as any failed validation of the blocks,
+// so the chain reorganizes to them again when they form the best chain.  Blocks
+// which are still invalid are marked as such again while doing so.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ReconsiderBlock(hash *chainhash.Hash) error {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	node := b.index.LookupNode(hash)
+	if node == nil {
+		return fmt.Errorf("block %v is not known", hash)
+	}
+
+	const invalidFlags = statusValidateFailed | statusInvalidAncestor
+	for _, n := range append(b.descendants(node), node) {
+		if b.index.NodeStatus(n).KnownInvalid() {
+			b.index.UnsetStatusFlags(n, invalidFlags)
+		}
+	}
+
+	// Blocks of the best chain are never invalid, so there is no need to
+	// look any further than the fork point.
+	for n := node.parent; n != nil && !b.bestChain.Contains(n); n = n.parent {
+		if b.index.NodeStatus(n).KnownInvalid() {
+			b.index.UnsetStatusFlags(n, invalidFlags)
+		}
+	}
+
+	err := b.activateBestChain()
+	b.resetBestHeader()
+
+	if writeErr := b.index.flushToDB(); writeErr != nil {
+		log.Warnf("Error flushing block index changes to disk: %v",
+			writeErr)
+	}
+	return err
+}
+
+// PreciousBlock treats the block with the provided hash as if it was received
+// before any competing blocks with the same amount of cumulative work.  The
+// chain is reorganized to the block when it has as much work as the current
+// best chain.  Nothing is done when it has less work.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) PreciousBlock(hash *chainhash.Hash) error {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	node := b.index.LookupNode(hash)
+	if node == nil {
+		return fmt.Errorf("block %v is not known", hash)
+	}
+	if node.workSum.Cmp(b.bestChain.Tip().workSum) < 0 ||
+		b.bestChain.Contains(node) || b.lastConnectableNode(node) != node {
+
+		return nil
+	}
+
+	log.Infof("Switching to precious block %v (height %d)", node.hash,
+		node.height)
+
+	detachNodes, attachNodes := b.getReorganizeNodes(node)
+	err := b.reorganizeChain(detachNodes, attachNodes)
+	if _, ok := err.(RuleError); ok || err == nil {
+		err = b.activateBestChain()
+	}
+
+	if writeErr := b.index.flushToDB(); writeErr != nil {
+		log.Warnf("Error flushing block index changes to disk: %v",
+			writeErr)
+	}
+	return err
+}
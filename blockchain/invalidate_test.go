@@ -0,0 +1,248 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/nyodeco/pind/chaincfg"
+	"github.com/nyodeco/pind/chaincfg/chainhash"
+	"github.com/nyodeco/pind/txscript"
+	"github.com/nyodeco/pinutil"
+)
+
+// TestInvalidateHelpers ensures the descendants of a block are found across all
+// of the branches of the block index, only branches with block data and without
+// invalid blocks are considered for reorganizations, and the best header skips
+// invalid headers.
+func TestInvalidateHelpers(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	chain := newFakeChain(params)
+
+	// Create a best chain with a longer side chain forking off of it.
+	//
+	// genesis -> 1 -> 2 -> 3 -> 4 -> 5
+	//                  \-> 3a -> 4a -> 5a -> 6a
+	nodes := extendFakeChain(chain, chain.bestChain.Tip(), 5,
+		statusDataStored|statusValid)
+	sideNodes := extendFakeChain(chain, nodes[1], 4,
+		statusDataStored|statusValid)
+	chain.bestChain.SetTip(nodes[4])
+
+	descendants := chain.descendants(nodes[1])
+	if len(descendants) != 7 {
+		t.Fatalf("descendants: got %d nodes, want 7", len(descendants))
+	}
+	descendants = chain.descendants(sideNodes[1])
+	if len(descendants) != 2 {
+		t.Fatalf("descendants: got %d nodes, want 2", len(descendants))
+	}
+	if descendants := chain.descendants(nodes[4]); len(descendants) != 0 {
+		t.Fatalf("descendants: got %d nodes for tip, want 0",
+			len(descendants))
+	}
+
+	// The whole side chain can be connected at first.  Missing block data
+	// and invalid blocks cut it short.
+	if node := chain.lastConnectableNode(sideNodes[3]); node != sideNodes[3] {
+		t.Fatalf("lastConnectableNode: got %v, want %v", node,
+			sideNodes[3])
+	}
+	chain.index.UnsetStatusFlags(sideNodes[3], statusDataStored)
+	if node := chain.lastConnectableNode(sideNodes[3]); node != sideNodes[2] {
+		t.Fatalf("lastConnectableNode: got %v, want %v", node,
+			sideNodes[2])
+	}
+	chain.index.SetStatusFlags(sideNodes[1], statusValidateFailed)
+	if node := chain.lastConnectableNode(sideNodes[3]); node != sideNodes[0] {
+		t.Fatalf("lastConnectableNode: got %v, want %v", node,
+			sideNodes[0])
+	}
+	chain.index.SetStatusFlags(sideNodes[0], statusValidateFailed)
+	for _, n := range chain.descendants(sideNodes[0]) {
+		chain.index.SetStatusFlags(n, statusInvalidAncestor)
+	}
+	if node := chain.lastConnectableNode(sideNodes[3]); node != nil {
+		t.Fatalf("lastConnectableNode: got %v, want nil", node)
+	}
+
+	// The best header skips the invalid side chain and falls back to the
+	// tip of the best chain.
+	if tip := chain.bestHeader.Tip(); tip != sideNodes[3] {
+		t.Fatalf("bestHeader: got %v, want %v", tip.hash,
+			sideNodes[3].hash)
+	}
+	chain.resetBestHeader()
+	if tip := chain.bestHeader.Tip(); tip != nodes[4] {
+		t.Fatalf("resetBestHeader: got %v, want %v", tip.hash,
+			nodes[4].hash)
+	}
+
+	// Reconsidering the side chain makes its tip the best header again.
+	for _, n := range sideNodes {
+		chain.index.UnsetStatusFlags(n, statusValidateFailed|
+			statusInvalidAncestor)
+	}
+	chain.resetBestHeader()
+	if tip := chain.bestHeader.Tip(); tip != sideNodes[3] {
+		t.Fatalf("resetBestHeader: got %v, want %v", tip.hash,
+			sideNodes[3].hash)
+	}
+}
+
+// TestInvalidateReconsiderPrecious ensures invalidating, reconsidering and
+// preferring blocks processed by the chain reorganizes it as expected and that
+// the validity of the blocks is persisted.
+func TestInvalidateReconsiderPrecious(t *testing.T) {
+	chain, teardownFunc, err := chainSetup("invalidatereconsider",
+		&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+	params := chain.chainParams
+
+	// processBlocks processes the requested number of blocks building on
+	// the passed one with the passed extra nonce and returns them.
+	processBlocks := func(prev *pinutil.Block, numBlocks int, extraNonce int64) []*pinutil.Block {
+		t.Helper()
+		blocks := make([]*pinutil.Block, 0, numBlocks)
+		for i := 0; i < numBlocks; i++ {
+			height := prev.Height() + 1
+			block, err := newTestBlock(params, prev.MsgBlock(), height,
+				extraNonce)
+			if err != nil {
+				t.Fatalf("unable to create block: %v", err)
+			}
+			block.SetHeight(height)
+			_, _, err = chain.ProcessBlock(block, BFNoPoWCheck)
+			if err != nil {
+				t.Fatalf("ProcessBlock at height %d: unexpected "+
+					"error: %v", height, err)
+			}
+			blocks = append(blocks, block)
+			prev = block
+		}
+		return blocks
+	}
+
+	// assertTip ensures the tip of the best chain of the passed chain is
+	// the passed block.
+	assertTip := func(chain *BlockChain, block *pinutil.Block) {
+		t.Helper()
+		if best := chain.BestSnapshot(); best.Hash != *block.Hash() {
+			t.Fatalf("best chain tip is %v (height %d), want %v "+
+				"(height %d)", best.Hash, best.Height, block.Hash(),
+				block.Height())
+		}
+	}
+
+	// assertStatus ensures the passed blocks have the passed invalidity
+	// status in the block index of the passed chain.
+	assertStatus := func(chain *BlockChain, status blockStatus, blocks ...*pinutil.Block) {
+		t.Helper()
+		const invalidFlags = statusValidateFailed | statusInvalidAncestor
+		for _, block := range blocks {
+			node := chain.index.LookupNode(block.Hash())
+			got := chain.index.NodeStatus(node) & invalidFlags
+			if got != status {
+				t.Fatalf("block %v (height %d) has status %v, "+
+					"want %v", block.Hash(), block.Height(),
+					got, status)
+			}
+		}
+	}
+
+	// reload returns a new chain instance loaded from the database of the
+	// chain.
+	reload := func() *BlockChain {
+		t.Helper()
+		reloaded, err := New(&Config{
+			DB:          chain.db,
+			ChainParams: params,
+			TimeSource:  NewMedianTime(),
+			SigCache:    txscript.NewSigCache(1000),
+		})
+		if err != nil {
+			t.Fatalf("unable to reload chain: %v", err)
+		}
+		return reloaded
+	}
+
+	// Create a best chain with a shorter side chain forking off of it.
+	//
+	// genesis -> 1 -> 2 -> 3 -> 4
+	//             \-> 2a -> 3a
+	genesis := pinutil.NewBlock(params.GenesisBlock)
+	genesis.SetHeight(0)
+	blocks := processBlocks(genesis, 4, 0)
+	sideBlocks := processBlocks(blocks[0], 2, 1)
+	assertTip(chain, blocks[3])
+
+	// The genesis block can't be invalidated.
+	err = chain.InvalidateBlock(genesis.Hash())
+	if rerr, ok := err.(RuleError); !ok || rerr.ErrorCode != ErrInvalidateGenesis {
+		t.Fatalf("InvalidateBlock of genesis block: unexpected error %v",
+			err)
+	}
+
+	// Invalidating block 3 must switch to the side chain, which has more
+	// work than what remains of the best chain, and persist the status.
+	if err := chain.InvalidateBlock(blocks[2].Hash()); err != nil {
+		t.Fatalf("InvalidateBlock: unexpected error: %v", err)
+	}
+	assertTip(chain, sideBlocks[1])
+	assertStatus(chain, statusValidateFailed, blocks[2])
+	assertStatus(chain, statusInvalidAncestor, blocks[3])
+	assertStatus(chain, statusNone, blocks[1], sideBlocks[0],
+		sideBlocks[1])
+	reloaded := reload()
+	assertTip(reloaded, sideBlocks[1])
+	assertStatus(reloaded, statusValidateFailed, blocks[2])
+	assertStatus(reloaded, statusInvalidAncestor, blocks[3])
+
+	// Reconsidering block 4 must clear the status of it and its ancestors
+	// and switch back to it.
+	if err := chain.ReconsiderBlock(blocks[3].Hash()); err != nil {
+		t.Fatalf("ReconsiderBlock: unexpected error: %v", err)
+	}
+	assertTip(chain, blocks[3])
+	assertStatus(chain, statusNone, blocks[2], blocks[3])
+	reloaded = reload()
+	assertTip(reloaded, blocks[3])
+	assertStatus(reloaded, statusNone, blocks[2], blocks[3])
+
+	// Extending the side chain to the same work must not switch to it
+	// until its tip is preferred, and preferring the previous tip must
+	// switch back.  Preferring a block with less work must not do
+	// anything.
+	sideBlocks = append(sideBlocks, processBlocks(sideBlocks[1], 1, 1)...)
+	assertTip(chain, blocks[3])
+	for _, test := range []struct {
+		precious *pinutil.Block
+		tip      *pinutil.Block
+	}{
+		{precious: sideBlocks[2], tip: sideBlocks[2]},
+		{precious: blocks[3], tip: blocks[3]},
+		{precious: sideBlocks[1], tip: blocks[3]},
+	} {
+		if err := chain.PreciousBlock(test.precious.Hash()); err != nil {
+			t.Fatalf("PreciousBlock: unexpected error: %v", err)
+		}
+		assertTip(chain, test.tip)
+	}
+
+	// Unknown blocks are rejected.
+	unknown := &chainhash.Hash{0x01}
+	if err := chain.InvalidateBlock(unknown); err == nil {
+		t.Fatal("InvalidateBlock: invalidated unknown block")
+	}
+	if err := chain.ReconsiderBlock(unknown); err == nil {
+		t.Fatal("ReconsiderBlock: reconsidered unknown block")
+	}
+	if err := chain.PreciousBlock(unknown); err == nil {
+		t.Fatal("PreciousBlock: preferred unknown block")
+	}
+}
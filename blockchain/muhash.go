@@ -0,0 +1,133 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"crypto/sha256"
+	"math/big"
+
+	"github.com/nyodeco/pind/chaincfg/chainhash"
+	"golang.org/x/crypto/chacha20"
+)
+
+// muHashElementSize is the size in bytes of the elements of the MuHash3072
+// group.
+const muHashElementSize = 384
+
+// muHashPrime is the prime 2^3072 - 1103717 which defines the multiplicative
+// group used by MuHash3072.
+var muHashPrime = func() *big.Int {
+	prime := new(big.Int).Lsh(big.NewInt(1), 3072)
+	return prime.Sub(prime, big.NewInt(1103717))
+}()
+
+// muHash3072 is a rolling hash of a set of data items which supports adding
+// and removing items in any order.  It is the MuHash3072 construction which
+// maps every item to an element of the multiplicative group of integers modulo
+// a 3072-bit prime and multiplies them.  Removed items are tracked separately
+// as the denominator so no modular inverse is needed until the hash is
+// finalized.
+//
+// The zero value is not usable, use newMuHash3072 instead.
+type muHash3072 struct {
+	numerator   big.Int
+	denominator big.Int
+}
+
+// newMuHash3072 returns the MuHash3072 of an empty set.
+func newMuHash3072() *muHash3072 {
+	var h muHash3072
+	h.numerator.SetInt64(1)
+	h.denominator.SetInt64(1)
+	return &h
+}
+
+// muHashElement maps the passed data to an element of the MuHash3072 group.
+// The sha256 of the data is used as the key of a ChaCha20 keystream whose first
+// 384 bytes are interpreted as a little-endian integer.
+func muHashElement(data []byte) *big.Int {
+	key := sha256.Sum256(data)
+	var nonce [chacha20.NonceSize]byte
+	cipher, err := chacha20.NewUnauthenticatedCipher(key[:], nonce[:])
+	if err != nil {
+		// The key and nonce are always of the correct size.
+		panic(err)
+	}
+	var buf [muHashElementSize]byte
+	cipher.XORKeyStream(buf[:], buf[:])
+	return new(big.Int).SetBytes(reverseBytes(buf[:]))
+}
+
+// reverseBytes reverses the passed byte slice in place and returns it.
+func reverseBytes(b []byte) []byte {
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+	return b
+}
+
+// putMuHashElement stores the passed group element into the provided buffer as
+// a 384-byte little-endian integer.
+func putMuHashElement(buf []byte, element *big.Int) {
+	for i := range buf {
+		buf[i] = 0
+	}
+	copy(buf, reverseBytes(element.Bytes()))
+}
+
+// Insert adds the passed data item to the set.
+func (h *muHash3072) Insert(data []byte) {
+	h.numerator.Mul(&h.numerator, muHashElement(data))
+	h.numerator.Mod(&h.numerator, muHashPrime)
+}
+
+// Remove removes the passed data item from the set.
+func (h *muHash3072) Remove(data []byte) {
+	h.denominator.Mul(&h.denominator, muHashElement(data))
+	h.denominator.Mod(&h.denominator, muHashPrime)
+}
+
+// Clone returns a copy of the rolling hash.
+func (h *muHash3072) Clone() *muHash3072 {
+	var clone muHash3072
+	clone.numerator.Set(&h.numerator)
+	clone.denominator.Set(&h.denominator)
+	return &clone
+}
+
+// Finalize returns the hash of the set, which is the sha256 of the
+// little-endian serialization of the numerator divided by the denominator.
+func (h *muHash3072) Finalize() chainhash.Hash {
+	inverse := new(big.Int).ModInverse(&h.denominator, muHashPrime)
+	value := inverse.Mul(inverse, &h.numerator)
+	value.Mod(value, muHashPrime)
+
+	var buf [muHashElementSize]byte
+	putMuHashElement(buf[:], value)
+	return chainhash.Hash(sha256.Sum256(buf[:]))
+}
+
+// serialize returns the numerator followed by the denominator, both as
+// 384-byte little-endian integers.
+func (h *muHash3072) serialize() []byte {
+	serialized := make([]byte, muHashElementSize*2)
+	putMuHashElement(serialized[:muHashElementSize], &h.numerator)
+	putMuHashElement(serialized[muHashElementSize:], &h.denominator)
+	return serialized
+}
+
+// deserialize loads the numerator and the denominator from the passed data in
+// the format produced by serialize.
+func (h *muHash3072) deserialize(serialized []byte) error {
+	if len(serialized) != muHashElementSize*2 {
+		return errDeserialize("unexpected muhash state size")
+	}
+	buf := make([]byte, muHashElementSize)
+	copy(buf, serialized[:muHashElementSize])
+	h.numerator.SetBytes(reverseBytes(buf))
+	copy(buf, serialized[muHashElementSize:])
+	h.denominator.SetBytes(reverseBytes(buf))
+	return nil
+}
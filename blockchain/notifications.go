@@ -6,6 +6,9 @@ package blockchain
 
 import (
 	"fmt"
+
+	"github.com/nyodeco/pind/chaincfg/chainhash"
+	"github.com/nyodeco/pinutil"
 )
 
 // NotificationType represents the type of a notification message.
@@ -29,6 +32,15 @@ const (
 	// NTBlockDisconnected indicates the associated block was disconnected
 	// from the main chain.
 	NTBlockDisconnected
+
+	// NTReorgRejected indicates a reorganization of the main chain was
+	// refused because it is deeper than the maximum reorganization depth.
+	NTReorgRejected
+
+	// NTChainReorganized indicates the main chain was reorganized.  It is
+	// sent after the NTBlockDisconnected and NTBlockConnected
+	// notifications of the individual blocks.
+	NTChainReorganized
 )
 
 // notificationTypeStrings is a map of notification types back to their constant
@@ -37,6 +49,8 @@ var notificationTypeStrings = map[NotificationType]string{
 	NTBlockAccepted:     "NTBlockAccepted",
 	NTBlockConnected:    "NTBlockConnected",
 	NTBlockDisconnected: "NTBlockDisconnected",
+	NTReorgRejected:     "NTReorgRejected",
+	NTChainReorganized:  "NTChainReorganized",
 }
 
 // String returns the NotificationType in human-readable form.
@@ -53,11 +67,46 @@ func (n NotificationType) String() string {
 // 	- NTBlockAccepted:     *pinutil.Block
 // 	- NTBlockConnected:    *pinutil.Block
 // 	- NTBlockDisconnected: *pinutil.Block
+// 	- NTReorgRejected:     *ReorgRejected
+// 	- NTChainReorganized:  *ChainReorganized
 type Notification struct {
 	Type NotificationType
 	Data interface{}
 }
 
+// ReorgRejected describes a reorganization of the main chain which was refused
+// because more blocks than the maximum reorganization depth would have been
+// disconnected.
+type ReorgRejected struct {
+	ForkHash     chainhash.Hash // Hash of the last common block
+	ForkHeight   int32          // Height of the last common block
+	OldTipHash   chainhash.Hash // Hash of the main chain tip
+	OldTipHeight int32          // Height of the main chain tip
+	NewTipHash   chainhash.Hash // Hash of the rejected chain tip
+	NewTipHeight int32          // Height of the rejected chain tip
+}
+
+// Depth returns the number of blocks the rejected reorganization would have
+// disconnected from the main chain.
+func (r *ReorgRejected) Depth() int32 {
+	return r.OldTipHeight - r.ForkHeight
+}
+
+// ChainReorganized describes a reorganization of the main chain.
+type ChainReorganized struct {
+	ForkHash   chainhash.Hash // Hash of the last common block
+	ForkHeight int32          // Height of the last common block
+
+	// Detached houses the blocks disconnected from the main chain in the
+	// order they were disconnected, starting with the old tip.
+	Detached []*pinutil.Block
+
+	// Attached houses the blocks connected to the main chain in the order
+	// they were connected, ending with the new tip.  It is empty when
+	// blocks were only disconnected.
+	Attached []*pinutil.Block
+}
+
 // Subscribe to block chain notifications. Registers a callback to be executed
 // when various events take place. See the documentation on Notification and
 // NotificationType for details on the types and contents of notifications.
@@ -10,6 +10,7 @@ import (
 
 	"github.com/nyodeco/pind/chaincfg/chainhash"
 	"github.com/nyodeco/pind/database"
+	"github.com/nyodeco/pind/wire"
 	"github.com/nyodeco/pinutil"
 )
 
@@ -165,11 +166,20 @@ func (b *BlockChain) ProcessBlock(block *pinutil.Block, flags BehaviorFlags) (bo
 	}
 
 	// Perform preliminary sanity checks on the block and its transactions.
-	err = checkBlockSanity(block, b.chainParams.PowLimit, b.timeSource, flags)
+	err = checkBlockSanity(block, b.chainParams.PowLimit, b.timeSource,
+		b.index.PowHash, flags)
 	if err != nil {
 		return false, false, err
 	}
 
+	// Blocks of the main chain before the base of a loaded utxo snapshot
+	// are validated in the background.
+	if node := b.index.LookupNode(blockHash); node != nil &&
+		b.isHistoricalBlock(node) {
+
+		return false, false, b.acceptHistoricalBlock(node, block)
+	}
+
 	// Find the previous checkpoint and perform some additional checks based
 	// on the checkpoint.  This provides a few nice properties such as
 	// preventing old side chain blocks before the last checkpoint,
@@ -242,3 +252,68 @@ func (b *BlockChain) ProcessBlock(block *pinutil.Block, flags BehaviorFlags) (bo
 
 	return isMainChain, false, nil
 }
+
+// ProcessBlockHeader handles insertion of a new block header into the block
+// index ahead of the associated block data.  The header must pass the same
+// sanity and contextual checks as the header of a full block and connect to a
+// header which is already known.  Duplicate headers are ignored.
+//
+// Headers which are added this way are used to track the best known header
+// chain, but are not considered when determining whether or not a block
+// exists until the full block has been processed.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ProcessBlockHeader(header *wire.BlockHeader, flags BehaviorFlags) error {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	// Nothing more to do when the header is already known.
+	blockHash := header.BlockHash()
+	if b.index.LookupNode(&blockHash) != nil {
+		return nil
+	}
+
+	// Perform preliminary sanity checks on the header.  The proof of work
+	// hash is kept so it is available once the block data arrives.
+	var powHash *chainhash.Hash
+	err := checkBlockHeaderSanity(header, b.chainParams.PowLimit,
+		b.timeSource, func(header *wire.BlockHeader) chainhash.Hash {
+			hash := b.index.PowHash(header)
+			powHash = &hash
+			return hash
+		}, flags)
+	if err != nil {
+		return err
+	}
+
+	// The header must connect to a known header that is not invalid.
+	prevHash := &header.PrevBlock
+	prevNode := b.index.LookupNode(prevHash)
+	if prevNode == nil {
+		str := fmt.Sprintf("previous block %s is unknown", prevHash)
+		return ruleError(ErrPreviousBlockUnknown, str)
+	} else if b.index.NodeStatus(prevNode).KnownInvalid() {
+		str := fmt.Sprintf("previous block %s is known to be invalid", prevHash)
+		return ruleError(ErrInvalidAncestorBlock, str)
+	}
+
+	// The header must pass all of the validation rules which depend on its
+	// position within the block chain.
+	err = b.checkBlockHeaderContext(header, prevNode, flags)
+	if err != nil {
+		return err
+	}
+
+	// Add a node without any block data to the block index.  It is written
+	// to the database along with the next change to the index since the
+	// header can simply be downloaded again if it is lost.
+	node := newBlockNode(header, prevNode)
+	node.powHash = powHash
+	b.index.AddNode(node)
+	b.maybeUpdateBestHeader(node)
+
+	log.Tracef("Accepted block header %v (height %d)", blockHash,
+		node.height)
+
+	return nil
+}
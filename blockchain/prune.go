@@ -0,0 +1,211 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/nyodeco/pind/database"
+)
+
+// MinBlocksToKeep is the minimum number of blocks at the end of the best chain
+// for which the block data is always kept when pruning.  This matches the
+// number of blocks that nodes advertising the NODE_NETWORK_LIMITED service
+// (BIP0159) are required to serve and is also the maximum depth of a reorg
+// which can be handled by a pruned node.
+const MinBlocksToKeep = 288
+
+// ErrPruningDisabled is returned by PruneBlocks when the chain instance was not
+// configured to prune block data.
+var ErrPruningDisabled = errors.New("block pruning is not enabled")
+
+// isDbBlockNotFoundErr returns whether or not the passed error is a
+// database.Error with an error code of database.ErrBlockNotFound.
+func isDbBlockNotFoundErr(err error) bool {
+	dbErr, ok := err.(database.Error)
+	return ok && dbErr.ErrorCode == database.ErrBlockNotFound
+}
+
+// dbMaybePruneBlocks uses an existing database transaction to delete the
+// oldest block data until the total size of the stored blocks is no larger
+// than the provided target size.  The data for the block at the provided keep
+// height and all later blocks of the chain ending at the provided tip is kept
+// regardless of the target size.  It returns whether or not any block data was
+// deleted.
+//
+// Only the block data is deleted, the spend journal entries that are needed to
+// disconnect blocks during reorganizations are kept in the metadata.
+func dbMaybePruneBlocks(dbTx database.Tx, tip *blockNode, keepHeight int32,
+	targetSize uint64) (bool, error) {
+
+	if keepHeight <= 0 || keepHeight > tip.height {
+		return false, nil
+	}
+
+	keepNode := tip.Ancestor(keepHeight)
+	pruned, err := dbTx.PruneBlocks(targetSize, &keepNode.hash)
+	if err != nil {
+		// There is nothing left to prune when the block to keep has
+		// already been pruned itself.
+		if isDbBlockNotFoundErr(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	if pruned {
+		log.Debugf("Pruned blocks before height %d (hash %v)",
+			keepNode.height, keepNode.hash)
+	}
+	return pruned, nil
+}
+
+// unsetPrunedDataFlags marks the blocks before the provided height for which
+// the block data has been deleted by pruning as no longer having their data
+// stored.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) unsetPrunedDataFlags(height int32) error {
+	var prunedNodes []*blockNode
+	err := b.db.View(func(dbTx database.Tx) error {
+		b.index.RLock()
+		defer b.index.RUnlock()
+		for _, node := range b.index.index {
+			if node.height >= height || !node.status.HaveData() {
+				continue
+			}
+			hasBlock, err := dbTx.HasBlock(&node.hash)
+			if err != nil {
+				return err
+			}
+			if !hasBlock {
+				prunedNodes = append(prunedNodes, node)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, node := range prunedNodes {
+		b.index.UnsetStatusFlags(node, statusDataStored)
+	}
+	return b.index.flushToDB()
+}
+
+// IsPruned returns whether or not the chain instance was configured to prune
+// old block data.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) IsPruned() bool {
+	return b.pruneTarget != 0
+}
+
+// pruneHeight returns the height of the first block of the main chain for which
+// the block data is still available.  It is zero when no block data has been
+// pruned.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) pruneHeight() (int32, error) {
+	var height int32
+	err := b.db.View(func(dbTx database.Tx) error {
+		beenPruned, err := dbTx.BeenPruned()
+		if err != nil || !beenPruned {
+			return err
+		}
+
+		// Block data is pruned oldest first, so perform a binary search
+		// for the first block of the main chain that is still stored.
+		low, high := int32(0), b.bestChain.Height()
+		for low < high {
+			mid := low + (high-low)/2
+			node := b.bestChain.NodeByHeight(mid)
+			hasBlock, err := dbTx.HasBlock(&node.hash)
+			if err != nil {
+				return err
+			}
+			if hasBlock {
+				high = mid
+			} else {
+				low = mid + 1
+			}
+		}
+		height = low
+		return nil
+	})
+	return height, err
+}
+
+// PruneHeight returns the height of the first block of the main chain for which
+// the block data is still available.  It is zero when no block data has been
+// pruned.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) PruneHeight() (int32, error) {
+	b.chainLock.RLock()
+	defer b.chainLock.RUnlock()
+	return b.pruneHeight()
+}
+
+// PruneBlocks deletes the data for the main chain blocks up to and including
+// the provided height regardless of the configured prune target.  The data for
+// the last MinBlocksToKeep blocks of the main chain is always kept, so the
+// height is limited accordingly.  It returns the height of the last block for
+// which the data is no longer available, which is -1 when no blocks have been
+// pruned at all.
+//
+// ErrPruningDisabled is returned when the chain instance was not configured to
+// prune block data.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) PruneBlocks(height int32) (int32, error) {
+	if !b.IsPruned() {
+		return 0, ErrPruningDisabled
+	}
+
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	// Write the utxo cache to the database first since the blocks connected
+	// after the last flush are needed to recover the utxo set otherwise.
+	tip := b.bestChain.Tip()
+	if err := b.flushUtxoCache(&tip.hash, false); err != nil {
+		return 0, err
+	}
+
+	if height > tip.height {
+		str := fmt.Sprintf("prune height %d is higher than the best "+
+			"chain height %d", height, tip.height)
+		return 0, errors.New(str)
+	}
+
+	keepHeight := height + 1
+	if maxKeepHeight := tip.height - MinBlocksToKeep + 1; keepHeight > maxKeepHeight {
+		log.Infof("Limiting prune height to %d to keep the last %d "+
+			"blocks", maxKeepHeight-1, MinBlocksToKeep)
+		keepHeight = maxKeepHeight
+	}
+	var pruned bool
+	err := b.db.Update(func(dbTx database.Tx) error {
+		var err error
+		pruned, err = dbMaybePruneBlocks(dbTx, tip, keepHeight, 0)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	if pruned {
+		if err := b.unsetPrunedDataFlags(keepHeight); err != nil {
+			return 0, err
+		}
+	}
+
+	pruneHeight, err := b.pruneHeight()
+	if err != nil {
+		return 0, err
+	}
+	return pruneHeight - 1, nil
+}
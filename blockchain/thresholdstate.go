@@ -21,7 +21,7 @@ const (
 	ThresholdDefined ThresholdState = iota
 
 	// ThresholdStarted is the state for a deployment once its start time
-	// has been reached.
+	// or height has been reached.
 	ThresholdStarted
 
 	// ThresholdLockedIn is the state for a deployment during the retarget
@@ -36,10 +36,16 @@ const (
 	ThresholdActive
 
 	// ThresholdFailed is the state for a deployment once its expiration
-	// time has been reached and it did not reach the ThresholdLockedIn
-	// state.
+	// time or timeout height has been reached and it did not reach the
+	// ThresholdLockedIn state.
 	ThresholdFailed
 
+	// ThresholdMustSignal is the state for a height based deployment which
+	// locks in on timeout during the last retarget period before its
+	// timeout height.  All blocks in the period must signal for the
+	// deployment, which is locked in afterwards.
+	ThresholdMustSignal
+
 	// numThresholdsStates is the maximum number of threshold states used in
 	// tests.
 	numThresholdsStates
@@ -48,11 +54,12 @@ const (
 // thresholdStateStrings is a map of ThresholdState values back to their
 // constant names for pretty printing.
 var thresholdStateStrings = map[ThresholdState]string{
-	ThresholdDefined:  "ThresholdDefined",
-	ThresholdStarted:  "ThresholdStarted",
-	ThresholdLockedIn: "ThresholdLockedIn",
-	ThresholdActive:   "ThresholdActive",
-	ThresholdFailed:   "ThresholdFailed",
+	ThresholdDefined:    "ThresholdDefined",
+	ThresholdStarted:    "ThresholdStarted",
+	ThresholdLockedIn:   "ThresholdLockedIn",
+	ThresholdActive:     "ThresholdActive",
+	ThresholdFailed:     "ThresholdFailed",
+	ThresholdMustSignal: "ThresholdMustSignal",
 }
 
 // String returns the ThresholdState as a human-readable name.
@@ -75,6 +82,23 @@ type thresholdConditionChecker interface {
 	// locked in or activated.
 	EndTime() uint64
 
+	// BeginHeight returns the block height at which voting on a height
+	// based rule change starts.
+	BeginHeight() uint32
+
+	// EndHeight returns the block height at which an attempted height
+	// based rule change times out.  A zero value means the rule change is
+	// time based and BeginTime and EndTime apply instead.
+	EndHeight() uint32
+
+	// LockInOnTimeout returns whether a height based rule change locks in
+	// rather than fails once its timeout height is reached.
+	LockInOnTimeout() bool
+
+	// MinActivationHeight returns the minimum block height at which a
+	// locked in rule change becomes active.
+	MinActivationHeight() uint32
+
 	// RuleChangeActivationThreshold is the number of blocks for which the
 	// condition must be true in order to lock in a rule change.
 	RuleChangeActivationThreshold() uint32
@@ -121,6 +145,28 @@ func newThresholdCaches(numCaches uint32) []thresholdStateCache {
 	return caches
 }
 
+// thresholdStarted returns whether voting on the rule change of the passed
+// checker has started for the window after the given node, which is the last
+// block of a confirmation window.
+func thresholdStarted(checker thresholdConditionChecker, prevNode *blockNode) bool {
+	if checker.EndHeight() != 0 {
+		return uint32(prevNode.height+1) >= checker.BeginHeight()
+	}
+	medianTime := prevNode.CalcPastMedianTime()
+	return uint64(medianTime.Unix()) >= checker.BeginTime()
+}
+
+// thresholdTimedOut returns whether the rule change of the passed checker has
+// expired or timed out for the window after the given node, which is the last
+// block of a confirmation window.
+func thresholdTimedOut(checker thresholdConditionChecker, prevNode *blockNode) bool {
+	if checker.EndHeight() != 0 {
+		return uint32(prevNode.height+1) >= checker.EndHeight()
+	}
+	medianTime := prevNode.CalcPastMedianTime()
+	return uint64(medianTime.Unix()) >= checker.EndTime()
+}
+
 // thresholdState returns the current rule change threshold state for the block
 // AFTER the given node and deployment ID.  The cache is used to ensure the
 // threshold states for previous windows are only calculated once.
@@ -150,13 +196,9 @@ func (b *BlockChain) thresholdState(prevNode *blockNode, checker thresholdCondit
 			break
 		}
 
-		// The start and expiration times are based on the median block
-		// time, so calculate it now.
-		medianTime := prevNode.CalcPastMedianTime()
-
-		// The state is simply defined if the start time hasn't been
-		// been reached yet.
-		if uint64(medianTime.Unix()) < checker.BeginTime() {
+		// The state is simply defined if the start time or height
+		// hasn't been reached yet.
+		if !thresholdStarted(checker, prevNode) {
 			cache.Update(&prevNode.hash, ThresholdDefined)
 			break
 		}
@@ -191,26 +233,28 @@ func (b *BlockChain) thresholdState(prevNode *blockNode, checker thresholdCondit
 		switch state {
 		case ThresholdDefined:
 			// The deployment of the rule change fails if it expires
-			// before it is accepted and locked in.
-			medianTime := prevNode.CalcPastMedianTime()
-			medianTimeUnix := uint64(medianTime.Unix())
-			if medianTimeUnix >= checker.EndTime() {
+			// before it is accepted and locked in.  A rule change
+			// which locks in on timeout is started regardless so
+			// it goes through the must signal period.
+			if thresholdTimedOut(checker, prevNode) &&
+				!checker.LockInOnTimeout() {
+
 				state = ThresholdFailed
 				break
 			}
 
 			// The state for the rule moves to the started state
-			// once its start time has been reached (and it hasn't
-			// already expired per the above).
-			if medianTimeUnix >= checker.BeginTime() {
+			// once its start time or height has been reached (and
+			// it hasn't already expired per the above).
+			if thresholdStarted(checker, prevNode) {
 				state = ThresholdStarted
 			}
 
 		case ThresholdStarted:
-			// The deployment of the rule change fails if it expires
-			// before it is accepted and locked in.
-			medianTime := prevNode.CalcPastMedianTime()
-			if uint64(medianTime.Unix()) >= checker.EndTime() {
+			// The deployment of a time based rule change fails if
+			// it expires before it is accepted and locked in.
+			timedOut := thresholdTimedOut(checker, prevNode)
+			if timedOut && checker.EndHeight() == 0 {
 				state = ThresholdFailed
 				break
 			}
@@ -238,12 +282,36 @@ func (b *BlockChain) thresholdState(prevNode *blockNode, checker thresholdCondit
 			// activation threshold.
 			if count >= checker.RuleChangeActivationThreshold() {
 				state = ThresholdLockedIn
+				break
+			}
+
+			// A height based rule change which locks in on timeout
+			// must be signalled for during the last period before
+			// its timeout height, while any other one fails once
+			// the timeout height is reached.
+			nextHeight := uint32(prevNode.height + 1)
+			switch {
+			case checker.LockInOnTimeout() && nextHeight+
+				uint32(confirmationWindow) >= checker.EndHeight():
+
+				state = ThresholdMustSignal
+
+			case timedOut:
+				state = ThresholdFailed
 			}
 
+		case ThresholdMustSignal:
+			// The rule change is locked in after the period in
+			// which signalling for it was required.
+			state = ThresholdLockedIn
+
 		case ThresholdLockedIn:
 			// The new rule becomes active when its previous state
-			// was locked in.
-			state = ThresholdActive
+			// was locked in and the minimum activation height has
+			// been reached.
+			if uint32(prevNode.height+1) >= checker.MinActivationHeight() {
+				state = ThresholdActive
+			}
 
 		// Nothing to do if the previous state is active or failed since
 		// they are both terminal states.
@@ -286,6 +354,91 @@ func (b *BlockChain) IsDeploymentActive(deploymentID uint32) (bool, error) {
 	return state == ThresholdActive, nil
 }
 
+// DeploymentStats describes the threshold state of a deployment for a block
+// along with the signalling for the deployment within the confirmation window
+// which contains the block.
+type DeploymentStats struct {
+	// State is the threshold state of the deployment for the block.
+	State ThresholdState
+
+	// PeriodStart is the height of the first block of the confirmation
+	// window which contains the block.
+	PeriodStart int32
+
+	// Period is the number of blocks in each confirmation window.
+	Period uint32
+
+	// Threshold is the number of blocks in a confirmation window which
+	// must signal for the deployment in order to lock it in.
+	Threshold uint32
+
+	// Elapsed is the number of blocks of the confirmation window up to and
+	// including the block.
+	Elapsed uint32
+
+	// Count is the number of elapsed blocks which signal for the
+	// deployment.
+	Count uint32
+
+	// Possible reports whether enough of the remaining blocks of the
+	// confirmation window can signal for the deployment to reach the
+	// threshold.
+	Possible bool
+}
+
+// DeploymentStats returns the threshold state of the given deployment ID for
+// the block with the given hash along with the signalling for the deployment
+// within the confirmation window which contains the block.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) DeploymentStats(hash *chainhash.Hash, deploymentID uint32) (*DeploymentStats, error) {
+	if deploymentID >= uint32(len(b.chainParams.Deployments)) {
+		return nil, DeploymentError(deploymentID)
+	}
+
+	node := b.index.LookupNode(hash)
+	if node == nil {
+		return nil, fmt.Errorf("block %s is not known", hash)
+	}
+
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	state, err := b.deploymentState(node.parent, deploymentID)
+	if err != nil {
+		return nil, err
+	}
+
+	deployment := &b.chainParams.Deployments[deploymentID]
+	checker := deploymentChecker{deployment: deployment, chain: b}
+	window := checker.MinerConfirmationWindow()
+	periodStart := node.height - node.height%int32(window)
+	stats := &DeploymentStats{
+		State:       state,
+		PeriodStart: periodStart,
+		Period:      window,
+		Threshold:   checker.RuleChangeActivationThreshold(),
+		Elapsed:     uint32(node.height-periodStart) + 1,
+	}
+
+	// Count the blocks of the confirmation window up to and including the
+	// block which signal for the deployment.
+	for countNode := node; countNode != nil &&
+		countNode.height >= periodStart; countNode = countNode.parent {
+
+		condition, err := checker.Condition(countNode)
+		if err != nil {
+			return nil, err
+		}
+		if condition {
+			stats.Count++
+		}
+	}
+	stats.Possible = stats.Count+window-stats.Elapsed >= stats.Threshold
+
+	return stats, nil
+}
+
 // deploymentState returns the current rule change threshold for a given
 // deploymentID. The threshold is evaluated from the point of view of the block
 // node passed in as the first argument to this method.
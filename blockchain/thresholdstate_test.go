@@ -6,8 +6,11 @@ package blockchain
 
 import (
 	"testing"
+	"time"
 
+	"github.com/nyodeco/pind/chaincfg"
 	"github.com/nyodeco/pind/chaincfg/chainhash"
+	"github.com/nyodeco/pind/wire"
 )
 
 // TestThresholdStateStringer tests the stringized output for the
@@ -24,6 +27,7 @@ func TestThresholdStateStringer(t *testing.T) {
 		{ThresholdLockedIn, "ThresholdLockedIn"},
 		{ThresholdActive, "ThresholdActive"},
 		{ThresholdFailed, "ThresholdFailed"},
+		{ThresholdMustSignal, "ThresholdMustSignal"},
 		{0xff, "Unknown ThresholdState (255)"},
 	}
 
@@ -132,3 +136,280 @@ nextTest:
 		}
 	}
 }
+
+// TestThresholdStateDeployments ensures the threshold states of time and height
+// based deployments, including those which lock in on timeout or have a
+// minimum activation height, transition as intended.
+func TestThresholdStateDeployments(t *testing.T) {
+	t.Parallel()
+
+	// The tests use confirmation windows of 10 blocks with a threshold of 8
+	// blocks.  The states are those of each window, starting with the one
+	// at height 10.
+	tests := []struct {
+		name       string
+		deployment chaincfg.ConsensusDeployment
+		signalling map[int]bool
+		states     []ThresholdState
+	}{{
+		name: "height based timeout",
+		deployment: chaincfg.ConsensusDeployment{
+			StartHeight:   20,
+			TimeoutHeight: 60,
+		},
+		states: []ThresholdState{
+			ThresholdDefined, ThresholdStarted, ThresholdStarted,
+			ThresholdStarted, ThresholdStarted, ThresholdFailed,
+			ThresholdFailed,
+		},
+	}, {
+		name: "height based lock in on timeout",
+		deployment: chaincfg.ConsensusDeployment{
+			StartHeight:     20,
+			TimeoutHeight:   60,
+			LockInOnTimeout: true,
+		},
+		signalling: map[int]bool{5: true},
+		states: []ThresholdState{
+			ThresholdDefined, ThresholdStarted, ThresholdStarted,
+			ThresholdStarted, ThresholdMustSignal, ThresholdLockedIn,
+			ThresholdActive,
+		},
+	}, {
+		name: "height based lock in with minimum activation height",
+		deployment: chaincfg.ConsensusDeployment{
+			StartHeight:         20,
+			TimeoutHeight:       60,
+			MinActivationHeight: 70,
+		},
+		signalling: map[int]bool{2: true},
+		states: []ThresholdState{
+			ThresholdDefined, ThresholdStarted, ThresholdLockedIn,
+			ThresholdLockedIn, ThresholdLockedIn, ThresholdLockedIn,
+			ThresholdActive,
+		},
+	}, {
+		name: "time based lock in with minimum activation height",
+		deployment: chaincfg.ConsensusDeployment{
+			StartTime:           0,
+			ExpireTime:          ^uint64(0),
+			MinActivationHeight: 50,
+		},
+		signalling: map[int]bool{1: true},
+		states: []ThresholdState{
+			ThresholdStarted, ThresholdLockedIn, ThresholdLockedIn,
+			ThresholdLockedIn, ThresholdActive, ThresholdActive,
+			ThresholdActive,
+		},
+	}}
+
+	for _, test := range tests {
+		params := chaincfg.RegressionNetParams
+		params.RuleChangeActivationThreshold = 8
+		params.MinerConfirmationWindow = 10
+		chain := newFakeChain(&params)
+		deployment := test.deployment
+		deployment.BitNumber = 1
+		checker := deploymentChecker{deployment: &deployment, chain: chain}
+
+		// Create a chain which signals for the deployment during the
+		// windows marked as signalling.
+		node := chain.bestChain.Tip()
+		windowEnds := make([]*blockNode, 0, len(test.states))
+		for height := int32(1); height <= 10*int32(len(test.states)); height++ {
+			version := int32(vbTopBits)
+			if test.signalling[int(height/10)] {
+				version |= 1 << deployment.BitNumber
+			}
+			node = newFakeNode(node, version, params.PowLimitBits,
+				time.Unix(node.timestamp, 0).Add(time.Minute))
+			if (height+1)%10 == 0 {
+				windowEnds = append(windowEnds, node)
+			}
+		}
+
+		cache := &newThresholdCaches(1)[0]
+		for i, want := range test.states {
+			state, err := chain.thresholdState(windowEnds[i],
+				checker, cache)
+			if err != nil {
+				t.Fatalf("%s: thresholdState: unexpected error: "+
+					"%v", test.name, err)
+			}
+			if state != want {
+				t.Fatalf("%s: window %d: got state %v, want %v",
+					test.name, i+1, state, want)
+			}
+		}
+
+		// Ensure the state is the same when calculated from scratch.
+		cache = &newThresholdCaches(1)[0]
+		last := len(test.states) - 1
+		state, err := chain.thresholdState(windowEnds[last], checker, cache)
+		if err != nil {
+			t.Fatalf("%s: thresholdState: unexpected error: %v",
+				test.name, err)
+		}
+		if state != test.states[last] {
+			t.Fatalf("%s: got uncached state %v, want %v",
+				test.name, state, test.states[last])
+		}
+	}
+}
+
+// TestDeploymentHeightsAlignment ensures a chain instance is only created when
+// the heights of the height based deployments are multiples of the miner
+// confirmation window.
+func TestDeploymentHeightsAlignment(t *testing.T) {
+	tests := []struct {
+		name          string
+		startHeight   uint32
+		timeoutHeight uint32
+		valid         bool
+	}{
+		{name: "aligned", startHeight: 144, timeoutHeight: 432, valid: true},
+		{name: "time based", startHeight: 10, timeoutHeight: 0, valid: true},
+		{name: "unaligned start", startHeight: 150, timeoutHeight: 432},
+		{name: "unaligned timeout", startHeight: 144, timeoutHeight: 440},
+	}
+
+	for _, test := range tests {
+		params := chaincfg.RegressionNetParams
+		params.MinerConfirmationWindow = 144
+		deployment := &params.Deployments[chaincfg.DeploymentTestDummy]
+		deployment.StartHeight = test.startHeight
+		deployment.TimeoutHeight = test.timeoutHeight
+
+		chain, teardownFunc, err := chainSetup("deploymentheights",
+			&params)
+		if chain != nil {
+			teardownFunc()
+		}
+		if test.valid && err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+		}
+		if !test.valid && err == nil {
+			t.Fatalf("%s: chain created with unaligned deployment "+
+				"heights", test.name)
+		}
+	}
+}
+
+// TestMustSignalDeployment ensures blocks which don't signal for a height based
+// deployment in its must signal period are rejected.
+func TestMustSignalDeployment(t *testing.T) {
+	params := chaincfg.RegressionNetParams
+	params.RuleChangeActivationThreshold = 8
+	params.MinerConfirmationWindow = 10
+	params.Deployments[chaincfg.DeploymentTestDummy] = chaincfg.ConsensusDeployment{
+		BitNumber:       27,
+		StartHeight:     10,
+		TimeoutHeight:   30,
+		LockInOnTimeout: true,
+	}
+	chain := newFakeChain(&params)
+
+	// Create a chain up to the first block of the must signal period.
+	node := chain.bestChain.Tip()
+	for i := 0; i < 19; i++ {
+		node = newFakeNode(node, vbTopBits, params.PowLimitBits,
+			time.Unix(node.timestamp, 0).Add(time.Minute))
+	}
+
+	header := &wire.BlockHeader{
+		Version:   vbTopBits,
+		PrevBlock: node.hash,
+		Timestamp: time.Unix(node.timestamp, 0).Add(time.Minute),
+		Bits:      params.PowLimitBits,
+	}
+	err := chain.checkBlockHeaderContext(header, node, BFFastAdd)
+	if rerr, ok := err.(RuleError); !ok ||
+		rerr.ErrorCode != ErrMissingDeploymentSignal {
+
+		t.Fatalf("checkBlockHeaderContext: got error %v, want %v", err,
+			ErrMissingDeploymentSignal)
+	}
+
+	header.Version |= 1 << 27
+	if err := chain.checkBlockHeaderContext(header, node, BFFastAdd); err != nil {
+		t.Fatalf("checkBlockHeaderContext: unexpected error: %v", err)
+	}
+}
+
+// TestDeploymentStats ensures the signalling statistics of a deployment are
+// calculated over the confirmation window which contains the block.
+func TestDeploymentStats(t *testing.T) {
+	params := chaincfg.RegressionNetParams
+	params.RuleChangeActivationThreshold = 8
+	params.MinerConfirmationWindow = 10
+	chain := newFakeChain(&params)
+	deployment := &params.Deployments[chaincfg.DeploymentTestDummy]
+
+	// Create a chain of 25 blocks where the blocks from height 20 on, other
+	// than the one at height 22, signal for the deployment.
+	node := chain.bestChain.Tip()
+	nodes := []*blockNode{node}
+	for height := int32(1); height < 25; height++ {
+		version := int32(vbTopBits)
+		if height >= 20 && height != 22 {
+			version |= 1 << deployment.BitNumber
+		}
+		node = newFakeNode(node, version, params.PowLimitBits,
+			time.Unix(node.timestamp, 0).Add(time.Minute))
+		chain.index.AddNode(node)
+		nodes = append(nodes, node)
+	}
+
+	tests := []struct {
+		height int32
+		want   DeploymentStats
+	}{{
+		height: 14,
+		want: DeploymentStats{
+			State:       ThresholdStarted,
+			PeriodStart: 10,
+			Period:      10,
+			Threshold:   8,
+			Elapsed:     5,
+			Count:       0,
+			Possible:    false,
+		},
+	}, {
+		height: 24,
+		want: DeploymentStats{
+			State:       ThresholdStarted,
+			PeriodStart: 20,
+			Period:      10,
+			Threshold:   8,
+			Elapsed:     5,
+			Count:       4,
+			Possible:    true,
+		},
+	}}
+
+	for _, test := range tests {
+		stats, err := chain.DeploymentStats(&nodes[test.height].hash,
+			chaincfg.DeploymentTestDummy)
+		if err != nil {
+			t.Fatalf("DeploymentStats: unexpected error: %v", err)
+		}
+		if *stats != test.want {
+			t.Fatalf("DeploymentStats at height %d: got %+v, want "+
+				"%+v", test.height, *stats, test.want)
+		}
+	}
+
+	// Unknown blocks and deployments are rejected.
+	var unknownHash chainhash.Hash
+	if _, err := chain.DeploymentStats(&unknownHash,
+		chaincfg.DeploymentTestDummy); err == nil {
+
+		t.Fatal("DeploymentStats: no error for unknown block")
+	}
+	_, err := chain.DeploymentStats(&nodes[0].hash,
+		chaincfg.DefinedDeployments)
+	if _, ok := err.(DeploymentError); !ok {
+		t.Fatalf("DeploymentStats: got error %v, want DeploymentError",
+			err)
+	}
+}
@@ -0,0 +1,477 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nyodeco/pind/chaincfg/chainhash"
+	"github.com/nyodeco/pind/database"
+	"github.com/nyodeco/pind/wire"
+	"github.com/nyodeco/pinutil"
+)
+
+const (
+	// utxoCacheFlushInterval is the maximum amount of time the modified
+	// entries are kept in the utxo cache before they are written to the
+	// database.  It limits the number of blocks that need to be replayed
+	// after an unclean shutdown.
+	utxoCacheFlushInterval = time.Minute * 10
+
+	// cachedEntryOverhead is the approximate number of bytes used by each
+	// entry in the utxo cache excluding its public key script.  It accounts
+	// for the entry itself (40 bytes), the outpoint map key (36 bytes), the
+	// pointer to the entry (8 bytes) and the map bookkeeping.
+	cachedEntryOverhead = 100
+)
+
+// cachedEntrySize returns the approximate number of bytes used by the provided
+// entry in the utxo cache.
+func cachedEntrySize(entry *UtxoEntry) uint64 {
+	return cachedEntryOverhead + uint64(len(entry.pkScript))
+}
+
+// UtxoCacheStats houses statistics about the utxo cache.
+type UtxoCacheStats struct {
+	Entries       uint64         // Number of cached entries
+	Size          uint64         // Approximate size of the cache in bytes
+	MaxSize       uint64         // Maximum size of the cache in bytes
+	Hits          uint64         // Number of lookups served by the cache
+	Misses        uint64         // Number of lookups served by the database
+	LastFlushHash chainhash.Hash // Block the database utxo set is at
+	LastFlushTime time.Time      // Time of the last flush
+}
+
+// utxoCache is a write-back cache for the unspent transaction outputs of the
+// main chain which sits in front of the utxo set in the database.
+//
+// The entries loaded from the database are kept in memory and the changes made
+// by connected blocks are applied to the cache instead of being written to the
+// database right away.  The modified entries are written to the database once
+// the cache grows beyond its maximum size, the flush interval elapses, or the
+// cache is flushed explicitly such as on shutdown.  The hash of the block the
+// utxo set in the database is consistent with is stored along with each flush,
+// so the blocks connected since the last flush can be replayed on startup after
+// an unclean shutdown.
+type utxoCache struct {
+	db      database.DB
+	maxSize uint64
+
+	// bucketName and consistencyKeyName identify the utxo set in the
+	// database the cache sits in front of and the key the hash of the
+	// block it is consistent with is stored under.
+	bucketName         []byte
+	consistencyKeyName []byte
+
+	// The following fields are protected by the mutex since entries are
+	// loaded into the cache by callers that only hold the chain lock for
+	// reads.
+	mtx           sync.Mutex
+	entries       map[wire.OutPoint]*UtxoEntry
+	freshTxOuts   map[chainhash.Hash]int
+	size          uint64
+	hits          uint64
+	misses        uint64
+	lastFlushHash chainhash.Hash
+	lastFlushTime time.Time
+}
+
+// newUtxoCache returns a new utxo cache backed by the provided database which
+// is flushed once it grows beyond the provided maximum size in bytes.
+func newUtxoCache(db database.DB, maxSize uint64) *utxoCache {
+	return &utxoCache{
+		db:                 db,
+		maxSize:            maxSize,
+		bucketName:         utxoSetBucketName,
+		consistencyKeyName: utxoStateConsistencyKeyName,
+		entries:            make(map[wire.OutPoint]*UtxoEntry),
+		freshTxOuts:        make(map[chainhash.Hash]int),
+		lastFlushTime:      time.Now(),
+	}
+}
+
+// putEntry adds or replaces the cached entry for the provided outpoint while
+// keeping track of the cache size.
+//
+// This function MUST be called with the cache mutex held.
+func (c *utxoCache) putEntry(outpoint wire.OutPoint, entry *UtxoEntry) {
+	if cached := c.entries[outpoint]; cached != nil {
+		c.size -= cachedEntrySize(cached)
+		c.countFreshTxOut(outpoint, cached, -1)
+	}
+	c.entries[outpoint] = entry
+	c.size += cachedEntrySize(entry)
+	c.countFreshTxOut(outpoint, entry, 1)
+}
+
+// removeEntry removes the cached entry for the provided outpoint while keeping
+// track of the cache size.
+//
+// This function MUST be called with the cache mutex held.
+func (c *utxoCache) removeEntry(outpoint wire.OutPoint) {
+	if cached := c.entries[outpoint]; cached != nil {
+		c.size -= cachedEntrySize(cached)
+		c.countFreshTxOut(outpoint, cached, -1)
+		delete(c.entries, outpoint)
+	}
+}
+
+// countFreshTxOut adjusts the number of unspent outputs of the transaction of
+// the passed outpoint which have not been written to the database yet by the
+// provided delta when the passed entry is such an output.
+//
+// This function MUST be called with the cache mutex held.
+func (c *utxoCache) countFreshTxOut(outpoint wire.OutPoint, entry *UtxoEntry, delta int) {
+	if !entry.isFresh() || entry.IsSpent() {
+		return
+	}
+	c.freshTxOuts[outpoint.Hash] += delta
+	if c.freshTxOuts[outpoint.Hash] == 0 {
+		delete(c.freshTxOuts, outpoint.Hash)
+	}
+}
+
+// dbNumUnspentTxOuts uses an existing database transaction to return the number
+// of unspent outputs of the transaction with the passed hash in the utxo set
+// with the changes that have not been written to the database yet applied.
+func (c *utxoCache) dbNumUnspentTxOuts(dbTx database.Tx, hash *chainhash.Hash) (int, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	// The outputs of a transaction are adjacent in the database since the
+	// keys start with the transaction hash.  Outputs which have been
+	// spent since the last flush are still in the database until the next
+	// one.
+	numUnspent := c.freshTxOuts[*hash]
+	cursor := dbTx.Metadata().Bucket(c.bucketName).Cursor()
+	for ok := cursor.Seek(hash[:]); ok; ok = cursor.Next() {
+		key := cursor.Key()
+		if !bytes.HasPrefix(key, hash[:]) {
+			break
+		}
+		if len(key) <= chainhash.HashSize {
+			return 0, errDeserialize("malformed outpoint key")
+		}
+		index, _ := deserializeVLQ(key[chainhash.HashSize:])
+		outpoint := wire.OutPoint{Hash: *hash, Index: uint32(index)}
+		if cached := c.entries[outpoint]; cached != nil && cached.IsSpent() {
+			continue
+		}
+		numUnspent++
+	}
+	return numUnspent, nil
+}
+
+// fetchEntries loads the unspent transaction outputs for the provided set of
+// outpoints into the view.  The cache is consulted first and the entries that
+// are not cached are loaded from the database and added to the cache.
+//
+// Spent outputs, or those which otherwise don't exist, will result in a nil
+// entry in the view.  The view receives copies of the cached entries, so the
+// cache is not affected by changes made to the view until it is committed.
+func (c *utxoCache) fetchEntries(view *UtxoViewpoint, outpoints map[wire.OutPoint]struct{}) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	var missing []wire.OutPoint
+	for outpoint := range outpoints {
+		cached, ok := c.entries[outpoint]
+		if !ok {
+			missing = append(missing, outpoint)
+			continue
+		}
+
+		c.hits++
+		if cached.IsSpent() {
+			view.entries[outpoint] = nil
+			continue
+		}
+		entry := cached.Clone()
+		entry.packedFlags &^= tfModified | tfFresh
+		view.entries[outpoint] = entry
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	c.misses += uint64(len(missing))
+	return c.db.View(func(dbTx database.Tx) error {
+		utxoBucket := dbTx.Metadata().Bucket(c.bucketName)
+		for _, outpoint := range missing {
+			entry, err := dbFetchUtxoEntryFromBucket(utxoBucket, outpoint)
+			if err != nil {
+				return err
+			}
+
+			view.entries[outpoint] = entry
+			if entry != nil {
+				c.putEntry(outpoint, entry.Clone())
+			}
+		}
+
+		return nil
+	})
+}
+
+// commit applies the entries of the view which have been modified to the
+// cache.  The changes are only written to the database when the cache is
+// flushed.
+func (c *utxoCache) commit(view *UtxoViewpoint) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	for outpoint, entry := range view.entries {
+		if entry == nil || !entry.isModified() {
+			continue
+		}
+
+		cached := c.entries[outpoint]
+		if entry.IsSpent() {
+			// Outputs that have never been written to the database
+			// can simply be forgotten.  Otherwise, keep the spent
+			// entry around so it's removed on the next flush.
+			if cached != nil && cached.isFresh() {
+				c.removeEntry(outpoint)
+				continue
+			}
+			c.putEntry(outpoint, &UtxoEntry{
+				packedFlags: tfSpent | tfModified,
+			})
+			continue
+		}
+
+		// Outputs that are not already cached are new since the entries
+		// loaded from the database are always cached and BIP0030 rules
+		// out overwriting unspent outputs.  The script is copied so the
+		// cache doesn't keep the entire block that created it alive.
+		packedFlags := entry.packedFlags&tfCoinBase | tfModified
+		if cached == nil || cached.isFresh() {
+			packedFlags |= tfFresh
+		}
+		pkScript := make([]byte, len(entry.pkScript))
+		copy(pkScript, entry.pkScript)
+		c.putEntry(outpoint, &UtxoEntry{
+			amount:      entry.amount,
+			pkScript:    pkScript,
+			blockHeight: entry.blockHeight,
+			packedFlags: packedFlags,
+		})
+	}
+}
+
+// dbFlush uses an existing database transaction to write all modified entries
+// of the cache to the utxo set in the database along with the hash of the block
+// the resulting utxo set is consistent with.
+//
+// The cache itself is not changed so it remains intact when the database
+// transaction fails.  Callers must call markFlushed once the transaction has
+// been committed.
+func (c *utxoCache) dbFlush(dbTx database.Tx, bestHash *chainhash.Hash) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	utxoBucket := dbTx.Metadata().Bucket(c.bucketName)
+	for outpoint, entry := range c.entries {
+		if !entry.isModified() {
+			continue
+		}
+
+		// Entries which never made it to the database and are already
+		// spent were removed from the cache when they were spent, so
+		// fresh entries here are always unspent.
+		err := dbPutUtxoEntry(utxoBucket, outpoint, entry)
+		if err != nil {
+			return err
+		}
+	}
+
+	return dbTx.Metadata().Put(c.consistencyKeyName, bestHash[:])
+}
+
+// markFlushed updates the cache after its modified entries have been written
+// to the database by dbFlush.  All entries are evicted from the cache when the
+// evict flag is set.
+func (c *utxoCache) markFlushed(bestHash *chainhash.Hash, evict bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.freshTxOuts = make(map[chainhash.Hash]int)
+	if evict {
+		c.entries = make(map[wire.OutPoint]*UtxoEntry)
+		c.size = 0
+	} else {
+		for outpoint, entry := range c.entries {
+			if entry.IsSpent() {
+				c.removeEntry(outpoint)
+				continue
+			}
+			entry.packedFlags &^= tfModified | tfFresh
+		}
+	}
+
+	c.lastFlushHash = *bestHash
+	c.lastFlushTime = time.Now()
+}
+
+// flushedHash returns the hash of the block the utxo set in the database is
+// consistent with.
+func (c *utxoCache) flushedHash() chainhash.Hash {
+	c.mtx.Lock()
+	hash := c.lastFlushHash
+	c.mtx.Unlock()
+	return hash
+}
+
+// flushUtxoCache writes all modified entries of the utxo cache to the database
+// as being consistent with the provided block.  All entries are evicted from
+// the cache when the evict flag is set.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) flushUtxoCache(bestHash *chainhash.Hash, evict bool) error {
+	err := b.db.Update(func(dbTx database.Tx) error {
+		return b.utxoCache.dbFlush(dbTx, bestHash)
+	})
+	if err != nil {
+		return err
+	}
+
+	b.utxoCache.markFlushed(bestHash, evict)
+	return nil
+}
+
+// maybeFlushUtxoCache flushes the utxo cache when it has grown beyond its
+// maximum size, in which case all entries are evicted, or when the flush
+// interval has elapsed since the last flush.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) maybeFlushUtxoCache() error {
+	c := b.utxoCache
+	c.mtx.Lock()
+	size := c.size
+	due := time.Since(c.lastFlushTime) >= utxoCacheFlushInterval
+	c.mtx.Unlock()
+	overSize := size > c.maxSize
+	if !overSize && !due {
+		return nil
+	}
+
+	log.Debugf("Flushing utxo cache (%d bytes)", size)
+	return b.flushUtxoCache(&b.bestChain.Tip().hash, overSize)
+}
+
+// FlushUtxoCache writes all modified entries of the utxo cache to the
+// database.  It should be called on shutdown and before accessing the utxo set
+// in the database directly.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) FlushUtxoCache() error {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	if err := b.flushBackgroundUtxoSet(); err != nil {
+		return err
+	}
+	return b.flushUtxoCache(&b.bestChain.Tip().hash, false)
+}
+
+// UtxoCacheStats returns statistics about the utxo cache.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) UtxoCacheStats() UtxoCacheStats {
+	c := b.utxoCache
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	return UtxoCacheStats{
+		Entries:       uint64(len(c.entries)),
+		Size:          c.size,
+		MaxSize:       c.maxSize,
+		Hits:          c.hits,
+		Misses:        c.misses,
+		LastFlushHash: c.lastFlushHash,
+		LastFlushTime: c.lastFlushTime,
+	}
+}
+
+// initUtxoCache determines the block the utxo set in the database is consistent
+// with and, when it is behind the best chain due to an unclean shutdown,
+// replays the blocks connected since then to bring it up to date.
+//
+// This function MUST only be called during chain initialization.
+func (b *BlockChain) initUtxoCache(interrupt <-chan struct{}) error {
+	tip := b.bestChain.Tip()
+	var consistentHash *chainhash.Hash
+	err := b.db.View(func(dbTx database.Tx) error {
+		consistentHash = dbFetchUtxoStateConsistency(dbTx)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// The utxo set of databases created before the utxo cache existed is
+	// always consistent with the best chain.
+	if consistentHash == nil {
+		return b.flushUtxoCache(&tip.hash, false)
+	}
+	b.utxoCache.markFlushed(consistentHash, false)
+	if *consistentHash == tip.hash {
+		return nil
+	}
+
+	// The utxo set is only ever flushed for blocks of the main chain and
+	// blocks are only disconnected with the utxo set up to date, so it
+	// must be consistent with an ancestor of the best chain tip.
+	node := b.index.LookupNode(consistentHash)
+	if node == nil || !b.bestChain.Contains(node) {
+		return AssertError(fmt.Sprintf("utxo set is consistent with "+
+			"block %v which is not in the main chain",
+			consistentHash))
+	}
+
+	log.Infof("Recovering utxo set by replaying blocks %d through %d",
+		node.height+1, tip.height)
+	for n := b.bestChain.Next(node); n != nil; n = b.bestChain.Next(n) {
+		if interruptRequested(interrupt) {
+			return errInterruptRequested
+		}
+
+		var block *pinutil.Block
+		err := b.db.View(func(dbTx database.Tx) error {
+			var err error
+			block, err = dbFetchBlockByNode(dbTx, n)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		view := NewUtxoViewpoint()
+		err = view.fetchInputUtxos(b.utxoCache, block)
+		if err != nil {
+			return err
+		}
+		err = view.connectTransactions(block, nil)
+		if err != nil {
+			return err
+		}
+		b.utxoCache.commit(view)
+
+		b.utxoCache.mtx.Lock()
+		overSize := b.utxoCache.size > b.utxoCache.maxSize
+		b.utxoCache.mtx.Unlock()
+		if overSize {
+			err := b.flushUtxoCache(&n.hash, true)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return b.flushUtxoCache(&tip.hash, false)
+}
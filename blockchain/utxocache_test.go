@@ -0,0 +1,136 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/nyodeco/pind/chaincfg"
+	"github.com/nyodeco/pind/chaincfg/chainhash"
+	"github.com/nyodeco/pind/database"
+	"github.com/nyodeco/pind/wire"
+)
+
+// TestUtxoCache ensures the utxo cache serves lookups from memory once loaded,
+// only writes the modified entries to the database when flushed, and forgets
+// outputs that are spent before they ever reach the database.
+func TestUtxoCache(t *testing.T) {
+	chain, teardownFunc, err := chainSetup("utxocache",
+		&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+	cache := newUtxoCache(chain.db, 1<<20)
+	chain.utxoCache = cache
+
+	pkScript := []byte{0x51} // OP_TRUE
+	dbOut := wire.OutPoint{Hash: chainhash.Hash{0x01}, Index: 0}
+	newOut := wire.OutPoint{Hash: chainhash.Hash{0x02}, Index: 1}
+
+	// dbHasEntry returns whether or not the utxo set in the database has an
+	// entry for the provided outpoint.
+	dbHasEntry := func(outpoint wire.OutPoint) bool {
+		var entry *UtxoEntry
+		err := chain.db.View(func(dbTx database.Tx) error {
+			var err error
+			entry, err = dbFetchUtxoEntry(dbTx, outpoint)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("dbFetchUtxoEntry: unexpected error: %v", err)
+		}
+		return entry != nil
+	}
+
+	// Store an output directly in the database.
+	err = chain.db.Update(func(dbTx database.Tx) error {
+		utxoBucket := dbTx.Metadata().Bucket(utxoSetBucketName)
+		entry := NewUtxoEntry(wire.NewTxOut(5000, pkScript), 1, false)
+		return dbPutUtxoEntry(utxoBucket, dbOut, entry)
+	})
+	if err != nil {
+		t.Fatalf("dbPutUtxoEntry: unexpected error: %v", err)
+	}
+
+	// The first lookup is served by the database and the second one by the
+	// cache.
+	neededSet := map[wire.OutPoint]struct{}{dbOut: {}}
+	for i := 0; i < 2; i++ {
+		view := NewUtxoViewpoint()
+		if err := view.fetchUtxosMain(cache, neededSet); err != nil {
+			t.Fatalf("fetchUtxosMain: unexpected error: %v", err)
+		}
+		entry := view.LookupEntry(dbOut)
+		if entry == nil || entry.Amount() != 5000 {
+			t.Fatalf("fetchUtxosMain: unexpected entry %v", entry)
+		}
+	}
+	stats := chain.UtxoCacheStats()
+	if stats.Hits != 1 || stats.Misses != 1 || stats.Entries != 1 {
+		t.Fatalf("UtxoCacheStats: unexpected stats %+v", stats)
+	}
+
+	// Spend the output from the database and create a new one.  Neither
+	// change may reach the database until the cache is flushed.
+	view := NewUtxoViewpoint()
+	if err := view.fetchUtxosMain(cache, neededSet); err != nil {
+		t.Fatalf("fetchUtxosMain: unexpected error: %v", err)
+	}
+	view.LookupEntry(dbOut).Spend()
+	view.addTxOut(newOut, wire.NewTxOut(7000, pkScript), false, 2)
+	cache.commit(view)
+	view.commit()
+	if !dbHasEntry(dbOut) || dbHasEntry(newOut) {
+		t.Fatalf("commit: database modified before flush")
+	}
+	fetched := NewUtxoViewpoint()
+	err = fetched.fetchUtxosMain(cache, map[wire.OutPoint]struct{}{
+		dbOut:  {},
+		newOut: {},
+	})
+	if err != nil {
+		t.Fatalf("fetchUtxosMain: unexpected error: %v", err)
+	}
+	if fetched.LookupEntry(dbOut) != nil {
+		t.Fatalf("fetchUtxosMain: spent output still available")
+	}
+	if entry := fetched.LookupEntry(newOut); entry == nil ||
+		entry.Amount() != 7000 {
+
+		t.Fatalf("fetchUtxosMain: unexpected new entry %v", entry)
+	}
+
+	// Spending the new output before a flush removes it from the cache
+	// entirely since it never made it to the database.
+	fetched.LookupEntry(newOut).Spend()
+	cache.commit(fetched)
+	if _, ok := cache.entries[newOut]; ok {
+		t.Fatalf("commit: fresh spent output still cached")
+	}
+
+	// Flushing removes the spent output from the database and records the
+	// block the utxo set is consistent with.
+	bestHash := chainhash.Hash{0x03}
+	if err := chain.flushUtxoCache(&bestHash, false); err != nil {
+		t.Fatalf("flushUtxoCache: unexpected error: %v", err)
+	}
+	if dbHasEntry(dbOut) || dbHasEntry(newOut) {
+		t.Fatalf("flushUtxoCache: spent outputs still in database")
+	}
+	if len(cache.entries) != 0 || cache.size != 0 {
+		t.Fatalf("flushUtxoCache: unexpected cached entries %d (size %d)",
+			len(cache.entries), cache.size)
+	}
+	var consistentHash *chainhash.Hash
+	chain.db.View(func(dbTx database.Tx) error {
+		consistentHash = dbFetchUtxoStateConsistency(dbTx)
+		return nil
+	})
+	if consistentHash == nil || *consistentHash != bestHash {
+		t.Fatalf("flushUtxoCache: unexpected consistency hash %v",
+			consistentHash)
+	}
+}
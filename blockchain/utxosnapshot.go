@@ -0,0 +1,1145 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/nyodeco/pind/chaincfg"
+	"github.com/nyodeco/pind/chaincfg/chainhash"
+	"github.com/nyodeco/pind/database"
+	"github.com/nyodeco/pind/wire"
+	"github.com/nyodeco/pinutil"
+)
+
+const (
+	// utxoSnapshotVersion is the current version of the serialized utxo
+	// set snapshot format.
+	utxoSnapshotVersion = 1
+
+	// maxUtxoSnapshotKeySize is the maximum size of a serialized outpoint
+	// key in a utxo set snapshot.
+	maxUtxoSnapshotKeySize = chainhash.HashSize + 5
+
+	// maxUtxoSnapshotEntrySize is the maximum size of a serialized utxo
+	// entry in a utxo set snapshot.
+	maxUtxoSnapshotEntrySize = wire.MaxBlockPayload
+
+	// utxoSnapshotBatchSize is the number of database entries written per
+	// database transaction while loading a utxo set snapshot.
+	utxoSnapshotBatchSize = 50000
+)
+
+var (
+	// utxoSnapshotMagic identifies a serialized utxo set snapshot.
+	utxoSnapshotMagic = [5]byte{'u', 't', 'x', 'o', 0xff}
+
+	// utxoSnapshotKeyName is the name of the db key used to store the base
+	// block and utxo set hash of a loaded utxo set snapshot until the blocks
+	// before it have been validated in the background.
+	utxoSnapshotKeyName = []byte("utxosnapshot")
+
+	// utxoSnapshotLoadKeyName is the name of the db key used to store the
+	// base block of a utxo set snapshot while it is being loaded.  The utxo
+	// set is only partially replaced while the key exists.
+	utxoSnapshotLoadKeyName = []byte("utxosnapshotload")
+
+	// backgroundUtxoSetBucketName is the name of the db bucket used to
+	// house the utxo set built while validating the blocks before the base
+	// of a loaded utxo set snapshot.
+	backgroundUtxoSetBucketName = []byte("utxosetbackground")
+
+	// backgroundUtxoStateConsistencyKeyName is the name of the db key used
+	// to store the hash of the block the background utxo set is consistent
+	// with.
+	backgroundUtxoStateConsistencyKeyName = []byte("utxostatebackground")
+)
+
+// UtxoSnapshotInfo describes a serialized snapshot of the utxo set.
+type UtxoSnapshotInfo struct {
+	BlockHash    chainhash.Hash // Block the snapshot was taken at
+	Height       int32          // Height of the block
+	NumUtxos     uint64         // Number of unspent outputs
+	TxOutSetHash chainhash.Hash // Hash of the serialized unspent outputs
+	TotalTxns    uint64         // Total number of transactions up to the block
+}
+
+// -----------------------------------------------------------------------------
+// A utxo set snapshot consists of a header followed by a record for every
+// unspent transaction output in the order of the keys in the utxo set bucket.
+//
+// The serialized format of the header is:
+//
+//   <magic><version><block hash><num utxos><total txns>
+//
+//   Field          Type             Size
+//   magic          [5]byte          5
+//   version        uint16           2
+//   block hash     chainhash.Hash   chainhash.HashSize
+//   num utxos      uint64           8
+//   total txns     uint64           8
+//
+// The serialized format of each record is:
+//
+//   <key len><key><entry len><entry>
+//
+//   Field          Type     Size
+//   key len        VarInt   variable
+//   key            []byte   variable (outpoint key as stored in the database)
+//   entry len      VarInt   variable
+//   entry          []byte   variable (utxo entry as stored in the database)
+//
+// The hash of the utxo set is the double sha256 of all of the serialized
+// records.
+// -----------------------------------------------------------------------------
+
+// utxoSnapshotHeader houses the header of a serialized utxo set snapshot.
+type utxoSnapshotHeader struct {
+	blockHash chainhash.Hash
+	numUtxos  uint64
+	totalTxns uint64
+}
+
+// serialize writes the header to the passed writer.
+func (h *utxoSnapshotHeader) serialize(w io.Writer) error {
+	var buf [len(utxoSnapshotMagic) + 2 + chainhash.HashSize + 16]byte
+	offset := copy(buf[:], utxoSnapshotMagic[:])
+	byteOrder.PutUint16(buf[offset:], utxoSnapshotVersion)
+	offset += 2
+	offset += copy(buf[offset:], h.blockHash[:])
+	byteOrder.PutUint64(buf[offset:], h.numUtxos)
+	offset += 8
+	byteOrder.PutUint64(buf[offset:], h.totalTxns)
+	_, err := w.Write(buf[:])
+	return err
+}
+
+// deserialize reads the header from the passed reader.
+func (h *utxoSnapshotHeader) deserialize(r io.Reader) error {
+	var buf [len(utxoSnapshotMagic) + 2 + chainhash.HashSize + 16]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return err
+	}
+	if !bytes.Equal(buf[:len(utxoSnapshotMagic)], utxoSnapshotMagic[:]) {
+		return errors.New("the file is not a utxo set snapshot")
+	}
+	offset := len(utxoSnapshotMagic)
+	version := byteOrder.Uint16(buf[offset:])
+	if version != utxoSnapshotVersion {
+		return fmt.Errorf("unsupported utxo set snapshot version %d",
+			version)
+	}
+	offset += 2
+	offset += copy(h.blockHash[:], buf[offset:offset+chainhash.HashSize])
+	h.numUtxos = byteOrder.Uint64(buf[offset:])
+	offset += 8
+	h.totalTxns = byteOrder.Uint64(buf[offset:])
+	return nil
+}
+
+// dbWriteUtxoSet uses an existing database transaction to serialize all of the
+// entries of the utxo set in the provided bucket to the passed writer.  It
+// returns the number of entries along with the hash of the utxo set.
+func dbWriteUtxoSet(dbTx database.Tx, bucketName []byte, w io.Writer) (uint64, chainhash.Hash, error) {
+	hasher := sha256.New()
+	mw := io.MultiWriter(w, hasher)
+
+	var numUtxos uint64
+	cursor := dbTx.Metadata().Bucket(bucketName).Cursor()
+	for ok := cursor.First(); ok; ok = cursor.Next() {
+		if err := wire.WriteVarBytes(mw, 0, cursor.Key()); err != nil {
+			return 0, chainhash.Hash{}, err
+		}
+		if err := wire.WriteVarBytes(mw, 0, cursor.Value()); err != nil {
+			return 0, chainhash.Hash{}, err
+		}
+		numUtxos++
+	}
+
+	return numUtxos, chainhash.HashH(hasher.Sum(nil)), nil
+}
+
+// readUtxoSnapshotRecords reads the provided number of records of a serialized
+// utxo set snapshot from the passed reader, ensures they are well formed, and
+// returns the hash of the utxo set.  None of the entries may be from a block
+// after the provided height.
+//
+// The passed function, when not nil, is invoked with the outpoint key and the
+// serialized utxo entry of every record.
+func readUtxoSnapshotRecords(r io.Reader, numUtxos uint64, maxHeight int32, fn func(key, serializedEntry []byte) error) (chainhash.Hash, error) {
+	hasher := sha256.New()
+	tr := io.TeeReader(r, hasher)
+	for i := uint64(0); i < numUtxos; i++ {
+		key, err := wire.ReadVarBytes(tr, 0, maxUtxoSnapshotKeySize,
+			"outpoint key")
+		if err != nil {
+			return chainhash.Hash{}, err
+		}
+		serializedEntry, err := wire.ReadVarBytes(tr, 0,
+			maxUtxoSnapshotEntrySize, "utxo entry")
+		if err != nil {
+			return chainhash.Hash{}, err
+		}
+
+		// Ensure the key is a properly encoded outpoint and the entry
+		// is sane.
+		if len(key) <= chainhash.HashSize {
+			return chainhash.Hash{}, fmt.Errorf("utxo snapshot "+
+				"record %d has a malformed outpoint", i)
+		}
+		_, bytesRead := deserializeVLQ(key[chainhash.HashSize:])
+		if bytesRead != len(key)-chainhash.HashSize {
+			return chainhash.Hash{}, fmt.Errorf("utxo snapshot "+
+				"record %d has a malformed outpoint", i)
+		}
+		entry, err := deserializeUtxoEntry(serializedEntry)
+		if err != nil {
+			return chainhash.Hash{}, fmt.Errorf("utxo snapshot "+
+				"record %d has a malformed entry: %v", i, err)
+		}
+		if entry.BlockHeight() > maxHeight {
+			return chainhash.Hash{}, fmt.Errorf("utxo snapshot "+
+				"record %d is from block height %d after the "+
+				"snapshot block", i, entry.BlockHeight())
+		}
+
+		if fn != nil {
+			if err := fn(key, serializedEntry); err != nil {
+				return chainhash.Hash{}, err
+			}
+		}
+	}
+
+	return chainhash.HashH(hasher.Sum(nil)), nil
+}
+
+// dbPutUtxoSnapshot uses an existing database transaction to store the base
+// block and the utxo set hash of a loaded utxo set snapshot.
+func dbPutUtxoSnapshot(dbTx database.Tx, baseHash, txOutSetHash *chainhash.Hash) error {
+	serialized := make([]byte, chainhash.HashSize*2)
+	copy(serialized, baseHash[:])
+	copy(serialized[chainhash.HashSize:], txOutSetHash[:])
+	return dbTx.Metadata().Put(utxoSnapshotKeyName, serialized)
+}
+
+// dbFetchUtxoSnapshot uses an existing database transaction to fetch the base
+// block and the utxo set hash of a loaded utxo set snapshot.  Nil is returned
+// for both when there is no snapshot whose blocks still need to be validated.
+func dbFetchUtxoSnapshot(dbTx database.Tx) (*chainhash.Hash, *chainhash.Hash) {
+	serialized := dbTx.Metadata().Get(utxoSnapshotKeyName)
+	if len(serialized) != chainhash.HashSize*2 {
+		return nil, nil
+	}
+
+	var baseHash, txOutSetHash chainhash.Hash
+	copy(baseHash[:], serialized)
+	copy(txOutSetHash[:], serialized[chainhash.HashSize:])
+	return &baseHash, &txOutSetHash
+}
+
+// utxoSnapshot houses the state of a loaded utxo set snapshot for which the
+// blocks before its base are still being validated in the background.
+type utxoSnapshot struct {
+	baseNode     *blockNode
+	txOutSetHash chainhash.Hash
+
+	// validated is the last block before the base which has been validated
+	// and cache houses the utxo set as of that block.
+	validated *blockNode
+	cache     *utxoCache
+}
+
+// flush writes the modified entries of the background utxo cache to the
+// database as being consistent with the last validated block.
+func (s *utxoSnapshot) flush(db database.DB, evict bool) error {
+	err := db.Update(func(dbTx database.Tx) error {
+		return s.cache.dbFlush(dbTx, &s.validated.hash)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.cache.markFlushed(&s.validated.hash, evict)
+	return nil
+}
+
+// newUtxoSnapshot returns the state of a loaded utxo set snapshot for which the
+// blocks after the provided validated block up to and including the base block
+// are still to be validated in the background.
+func (b *BlockChain) newUtxoSnapshot(baseNode, validated *blockNode, txOutSetHash *chainhash.Hash) *utxoSnapshot {
+	cache := newUtxoCache(b.db, b.utxoCache.maxSize)
+	cache.bucketName = backgroundUtxoSetBucketName
+	cache.consistencyKeyName = backgroundUtxoStateConsistencyKeyName
+	cache.markFlushed(&validated.hash, false)
+	return &utxoSnapshot{
+		baseNode:     baseNode,
+		txOutSetHash: *txOutSetHash,
+		validated:    validated,
+		cache:        cache,
+	}
+}
+
+// findAssumeUtxo returns the known utxo set snapshot for the provided block or
+// nil when there is none.
+func (b *BlockChain) findAssumeUtxo(hash *chainhash.Hash) *chaincfg.AssumeUtxo {
+	for i := range b.chainParams.AssumeUtxo {
+		assumeUtxo := &b.chainParams.AssumeUtxo[i]
+		if assumeUtxo.BlockHash.IsEqual(hash) {
+			return assumeUtxo
+		}
+	}
+	return nil
+}
+
+// DumpUtxoSnapshot serializes the utxo set as of the current best chain tip to
+// the passed writer.  The resulting snapshot can be loaded with
+// LoadUtxoSnapshot once its hash has been added to the chain parameters.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) DumpUtxoSnapshot(w io.Writer) (*UtxoSnapshotInfo, error) {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	// The utxo set in the database must be up to date.
+	tip := b.bestChain.Tip()
+	if err := b.flushUtxoCache(&tip.hash, false); err != nil {
+		return nil, err
+	}
+
+	info := UtxoSnapshotInfo{
+		BlockHash: tip.hash,
+		Height:    tip.height,
+		TotalTxns: b.stateSnapshot.TotalTxns,
+	}
+	err := b.db.View(func(dbTx database.Tx) error {
+		header := utxoSnapshotHeader{
+			blockHash: tip.hash,
+			totalTxns: b.stateSnapshot.TotalTxns,
+		}
+		cursor := dbTx.Metadata().Bucket(utxoSetBucketName).Cursor()
+		for ok := cursor.First(); ok; ok = cursor.Next() {
+			header.numUtxos++
+		}
+
+		bw := bufio.NewWriter(w)
+		if err := header.serialize(bw); err != nil {
+			return err
+		}
+		var err error
+		info.NumUtxos, info.TxOutSetHash, err = dbWriteUtxoSet(dbTx,
+			utxoSetBucketName, bw)
+		if err != nil {
+			return err
+		}
+		return bw.Flush()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &info, nil
+}
+
+// LoadUtxoSnapshot replaces the utxo set with the serialized utxo set snapshot
+// read from the passed reader and makes the block it was taken at the tip of
+// the best chain.  Only snapshots known to the chain parameters are accepted
+// and the header of the snapshot block must already be known.
+//
+// The blocks before the snapshot block which are not validated yet are
+// requested via HistoricalBlocksToFetch and validated in the background as they
+// are processed.  Once the snapshot block has been reached, the resulting utxo
+// set is compared against the snapshot.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) LoadUtxoSnapshot(r io.ReadSeeker) (*UtxoSnapshotInfo, error) {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	if b.utxoSnapshot != nil {
+		return nil, errors.New("the blocks before a previously loaded " +
+			"utxo snapshot are still being validated")
+	}
+	if b.indexManager != nil {
+		return nil, errors.New("utxo snapshots can't be loaded with " +
+			"optional indexes enabled")
+	}
+	if b.IsPruned() {
+		return nil, errors.New("utxo snapshots can't be loaded with " +
+			"pruning enabled")
+	}
+
+	// Ensure the snapshot is known and can be applied to the best chain.
+	var header utxoSnapshotHeader
+	if err := header.deserialize(r); err != nil {
+		return nil, err
+	}
+	assumeUtxo := b.findAssumeUtxo(&header.blockHash)
+	if assumeUtxo == nil || assumeUtxo.NumUtxos != header.numUtxos ||
+		assumeUtxo.TotalTxns != header.totalTxns {
+
+		return nil, fmt.Errorf("the snapshot at block %v is not a known "+
+			"utxo set snapshot", header.blockHash)
+	}
+	baseNode := b.index.LookupNode(&header.blockHash)
+	if baseNode == nil {
+		return nil, fmt.Errorf("the header of snapshot block %v is not "+
+			"known yet", header.blockHash)
+	}
+	if b.index.NodeStatus(baseNode).KnownInvalid() {
+		return nil, fmt.Errorf("snapshot block %v is known to be invalid",
+			header.blockHash)
+	}
+	tip := b.bestChain.Tip()
+	if tip.height >= baseNode.height || baseNode.Ancestor(tip.height) != tip {
+		return nil, fmt.Errorf("the best chain tip %v (height %d) is "+
+			"not an ancestor of snapshot block %v (height %d)",
+			tip.hash, tip.height, baseNode.hash, baseNode.height)
+	}
+
+	// Verify the hash of the snapshot before touching the utxo set.
+	txOutSetHash, err := readUtxoSnapshotRecords(r, header.numUtxos,
+		baseNode.height, nil)
+	if err != nil {
+		return nil, err
+	}
+	if !txOutSetHash.IsEqual(assumeUtxo.TxOutSetHash) {
+		return nil, fmt.Errorf("the hash of the utxo set snapshot is %v "+
+			"instead of the expected %v", txOutSetHash,
+			assumeUtxo.TxOutSetHash)
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if err := header.deserialize(r); err != nil {
+		return nil, err
+	}
+
+	// Bring the utxo set in the database up to date so the utxo cache can
+	// be rebuilt from it should the load fail before the utxo set is
+	// touched.
+	if err := b.flushUtxoCache(&tip.hash, false); err != nil {
+		return nil, err
+	}
+
+	log.Infof("Loading utxo snapshot at block %v (height %d) with %d "+
+		"unspent outputs", baseNode.hash, baseNode.height,
+		header.numUtxos)
+
+	stats, state, err := b.replaceUtxoSet(r, &header, baseNode,
+		&txOutSetHash)
+	if err != nil {
+		// Go back to the utxo set of the previous best chain tip since
+		// it was partially replaced.
+		if rbErr := b.rollBackUtxoSnapshotLoad(); rbErr != nil {
+			log.Errorf("Unable to roll back the utxo snapshot "+
+				"load: %v", rbErr)
+		} else if rbErr := b.initUtxoCache(nil); rbErr != nil {
+			log.Errorf("Unable to rebuild the utxo set: %v", rbErr)
+		}
+		return nil, err
+	}
+	b.utxoStats = stats
+	b.utxoCache.markFlushed(&baseNode.hash, true)
+	b.bestChain.SetTip(baseNode)
+	b.checkpointNode = nil
+	b.nextCheckpoint = nil
+	b.stateLock.Lock()
+	b.stateSnapshot = state
+	b.stateLock.Unlock()
+
+	genesis := b.bestChain.Genesis()
+	b.utxoSnapshot = b.newUtxoSnapshot(baseNode, genesis, &txOutSetHash)
+
+	log.Infof("Loaded utxo snapshot at block %v (height %d) -- validating "+
+		"the blocks before it in the background", baseNode.hash,
+		baseNode.height)
+
+	return &UtxoSnapshotInfo{
+		BlockHash:    baseNode.hash,
+		Height:       baseNode.height,
+		NumUtxos:     header.numUtxos,
+		TxOutSetHash: txOutSetHash,
+		TotalTxns:    header.totalTxns,
+	}, nil
+}
+
+// replaceUtxoSet replaces the utxo set in the database with the entries of the
+// utxo set snapshot read from the passed reader, which must be positioned after
+// the header, and makes the snapshot block the tip of the best chain in the
+// database.  The statistics of the new utxo set and the new best state are
+// returned so the caller can update the chain state.
+//
+// The utxo set is written in batches, so the load is recorded in the database
+// until the best state is written along with the snapshot in the final
+// transaction.  Any load which does not complete is undone by
+// rollBackUtxoSnapshotLoad.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) replaceUtxoSet(r io.Reader, header *utxoSnapshotHeader, baseNode *blockNode, txOutSetHash *chainhash.Hash) (*utxoStats, *BestState, error) {
+	// Clear the utxo set.  The empty utxo set is consistent with the
+	// genesis block.
+	err := b.db.Update(func(dbTx database.Tx) error {
+		meta := dbTx.Metadata()
+		err := meta.DeleteBucket(utxoSetBucketName)
+		if err != nil && !isDbBucketNotFoundErr(err) {
+			return err
+		}
+		if _, err := meta.CreateBucket(utxoSetBucketName); err != nil {
+			return err
+		}
+		err = dbPutUtxoStateConsistency(dbTx, b.chainParams.GenesisHash)
+		if err != nil {
+			return err
+		}
+		return meta.Put(utxoSnapshotLoadKeyName, baseNode.hash[:])
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stats := newUtxoStats()
+	var keys, serializedEntries [][]byte
+	putBatch := func() error {
+		err := b.db.Update(func(dbTx database.Tx) error {
+			utxoBucket := dbTx.Metadata().Bucket(utxoSetBucketName)
+			for i, key := range keys {
+				err := utxoBucket.Put(key, serializedEntries[i])
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		keys, serializedEntries = keys[:0], serializedEntries[:0]
+		return err
+	}
+	_, err = readUtxoSnapshotRecords(r, header.numUtxos, baseNode.height,
+		func(key, serializedEntry []byte) error {
+			err := stats.addSerialized(key, serializedEntry)
+			if err != nil {
+				return err
+			}
+			keys = append(keys, key)
+			serializedEntries = append(serializedEntries, serializedEntry)
+			if len(keys) < utxoSnapshotBatchSize {
+				return nil
+			}
+			return putBatch()
+		})
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := putBatch(); err != nil {
+		return nil, nil, err
+	}
+
+	// Add the blocks up to the snapshot block to the main chain.
+	var nodes []*blockNode
+	for node := baseNode; node != b.bestChain.Tip(); node = node.parent {
+		nodes = append(nodes, node)
+	}
+	for len(nodes) > 0 {
+		batch := nodes
+		if len(batch) > utxoSnapshotBatchSize {
+			batch = batch[:utxoSnapshotBatchSize]
+		}
+		nodes = nodes[len(batch):]
+		err := b.db.Update(func(dbTx database.Tx) error {
+			for _, node := range batch {
+				err := dbPutBlockIndex(dbTx, &node.hash,
+					node.height)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Make the snapshot block the tip of the best chain and start the
+	// background utxo set from scratch.  The size of the block is unknown
+	// until it has been downloaded.
+	state := newBestState(baseNode, 0, 0, 0, header.totalTxns,
+		baseNode.CalcPastMedianTime())
+	err = b.db.Update(func(dbTx database.Tx) error {
+		meta := dbTx.Metadata()
+		err := meta.DeleteBucket(backgroundUtxoSetBucketName)
+		if err != nil && !isDbBucketNotFoundErr(err) {
+			return err
+		}
+		_, err = meta.CreateBucket(backgroundUtxoSetBucketName)
+		if err != nil {
+			return err
+		}
+		err = meta.Put(backgroundUtxoStateConsistencyKeyName,
+			b.chainParams.GenesisHash[:])
+		if err != nil {
+			return err
+		}
+		err = dbPutUtxoSnapshot(dbTx, &baseNode.hash, txOutSetHash)
+		if err != nil {
+			return err
+		}
+		err = dbPutUtxoStateConsistency(dbTx, &baseNode.hash)
+		if err != nil {
+			return err
+		}
+		if err := dbPutUtxoStats(dbTx, stats); err != nil {
+			return err
+		}
+		if err := dbPutBestState(dbTx, state, baseNode.workSum); err != nil {
+			return err
+		}
+		return meta.Delete(utxoSnapshotLoadKeyName)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return stats, state, nil
+}
+
+// rollBackUtxoSnapshotLoad undoes the load of a utxo set snapshot which did not
+// complete, such as when the node was shut down while loading it.  The partially
+// written utxo set is cleared and the blocks which were added to the main chain
+// in the database are removed from it again, after which the utxo set is rebuilt
+// from the genesis block by initUtxoCache.
+//
+// This function MUST be called with the chain state lock held (for writes) or
+// during chain initialization.
+func (b *BlockChain) rollBackUtxoSnapshotLoad() error {
+	var baseHash *chainhash.Hash
+	err := b.db.View(func(dbTx database.Tx) error {
+		serialized := dbTx.Metadata().Get(utxoSnapshotLoadKeyName)
+		if len(serialized) == chainhash.HashSize {
+			baseHash = new(chainhash.Hash)
+			copy(baseHash[:], serialized)
+		}
+		return nil
+	})
+	if err != nil || baseHash == nil {
+		return err
+	}
+
+	log.Infof("Rolling back the incomplete load of utxo snapshot block %v",
+		baseHash)
+
+	tip := b.bestChain.Tip()
+	err = b.db.Update(func(dbTx database.Tx) error {
+		baseNode := b.index.LookupNode(baseHash)
+		for n := baseNode; n != nil && n.height > tip.height; n = n.parent {
+			err := dbRemoveBlockIndex(dbTx, &n.hash, n.height)
+			if err != nil {
+				return err
+			}
+		}
+
+		meta := dbTx.Metadata()
+		err := meta.DeleteBucket(utxoSetBucketName)
+		if err != nil && !isDbBucketNotFoundErr(err) {
+			return err
+		}
+		if _, err := meta.CreateBucket(utxoSetBucketName); err != nil {
+			return err
+		}
+		err = dbPutUtxoStateConsistency(dbTx, b.chainParams.GenesisHash)
+		if err != nil {
+			return err
+		}
+		return meta.Delete(utxoSnapshotLoadKeyName)
+	})
+	if err != nil {
+		return err
+	}
+	b.utxoCache.markFlushed(b.chainParams.GenesisHash, true)
+	return nil
+}
+
+// initUtxoSnapshot restores the state of a loaded utxo set snapshot for which
+// the blocks before its base were not fully validated before the last shutdown
+// and validates the blocks which have been downloaded since.
+//
+// This function MUST only be called during chain initialization.
+func (b *BlockChain) initUtxoSnapshot() error {
+	var baseHash, txOutSetHash, validatedHash *chainhash.Hash
+	err := b.db.View(func(dbTx database.Tx) error {
+		baseHash, txOutSetHash = dbFetchUtxoSnapshot(dbTx)
+		serialized := dbTx.Metadata().Get(
+			backgroundUtxoStateConsistencyKeyName)
+		if len(serialized) == chainhash.HashSize {
+			validatedHash = new(chainhash.Hash)
+			copy(validatedHash[:], serialized)
+		}
+		return nil
+	})
+	if err != nil || baseHash == nil {
+		return err
+	}
+
+	baseNode := b.index.LookupNode(baseHash)
+	if baseNode == nil || !b.bestChain.Contains(baseNode) {
+		return AssertError(fmt.Sprintf("utxo snapshot block %v is not "+
+			"in the main chain", baseHash))
+	}
+	validated := b.bestChain.Genesis()
+	if validatedHash != nil {
+		validated = b.index.LookupNode(validatedHash)
+		if validated == nil || !b.bestChain.Contains(validated) ||
+			validated.height > baseNode.height {
+
+			return AssertError(fmt.Sprintf("background utxo set is "+
+				"consistent with block %v which is not before "+
+				"the utxo snapshot block", validatedHash))
+		}
+	}
+	b.utxoSnapshot = b.newUtxoSnapshot(baseNode, validated, txOutSetHash)
+
+	// Finish falling back to the background utxo set when the snapshot
+	// turned out to be invalid before the last shutdown.  The block which
+	// failed is the first one after the last validated block, unless the
+	// background utxo set did not match the snapshot, in which case it is
+	// the base itself.
+	if b.index.NodeStatus(baseNode).KnownInvalid() {
+		failed := baseNode
+		for n := b.bestChain.Next(validated); n != nil &&
+			n.height <= baseNode.height; n = b.bestChain.Next(n) {
+
+			if b.index.NodeStatus(n).KnownInvalid() {
+				failed = n
+				break
+			}
+		}
+		return b.abandonUtxoSnapshot(failed)
+	}
+
+	log.Infof("Validating the blocks before utxo snapshot block %v "+
+		"(height %d) in the background, currently at height %d",
+		baseNode.hash, baseNode.height, validated.height)
+
+	return b.maybeValidateHistoricalBlocks()
+}
+
+// isHistoricalBlock returns whether or not the passed block node is a block of
+// the main chain before the base of a loaded utxo set snapshot for which the
+// block data has not been processed yet.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) isHistoricalBlock(node *blockNode) bool {
+	s := b.utxoSnapshot
+	return s != nil && node.height > s.validated.height &&
+		node.height <= s.baseNode.height && b.bestChain.Contains(node) &&
+		!b.index.NodeStatus(node).HaveData()
+}
+
+// acceptHistoricalBlock stores the passed block which must be a historical
+// block as determined by isHistoricalBlock and validates all of the blocks
+// after the last one validated in the background for which the block data is
+// available.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) acceptHistoricalBlock(node *blockNode, block *pinutil.Block) error {
+	block.SetHeight(node.height)
+	err := b.checkBlockContext(block, node.parent, BFNone)
+	if err != nil {
+		return err
+	}
+
+	err = b.db.Update(func(dbTx database.Tx) error {
+		return dbStoreBlock(dbTx, block)
+	})
+	if err != nil {
+		return err
+	}
+	b.index.SetStatusFlags(node, statusDataStored)
+	if err := b.index.flushToDB(); err != nil {
+		return err
+	}
+
+	return b.maybeValidateHistoricalBlocks()
+}
+
+// maybeValidateHistoricalBlocks validates the blocks before the base of a
+// loaded utxo set snapshot in order for as long as their block data is
+// available.  The blocks are connected to the background utxo set, which is
+// compared against the snapshot once the base has been reached.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) maybeValidateHistoricalBlocks() error {
+	s := b.utxoSnapshot
+	if s == nil {
+		return nil
+	}
+	for s.validated != s.baseNode {
+		node := b.bestChain.Next(s.validated)
+		if node == nil || !b.index.NodeStatus(node).HaveData() {
+			return nil
+		}
+
+		var block *pinutil.Block
+		err := b.db.View(func(dbTx database.Tx) error {
+			var err error
+			block, err = dbFetchBlockByNode(dbTx, node)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		// Connect the block to the background utxo set while performing
+		// the same checks as for blocks of the main chain.
+		view := NewUtxoViewpoint()
+		view.SetBestHash(&s.validated.hash)
+		stxos := make([]SpentTxOut, 0, countSpentOutputs(block))
+		err = b.checkConnectBlock(node, block, view, s.cache, &stxos)
+		if err != nil {
+			if _, ok := err.(RuleError); ok {
+				log.Errorf("Block %v (height %d) before utxo "+
+					"snapshot block %v is invalid: %v", node.hash,
+					node.height, s.baseNode.hash, err)
+				if err := b.abandonUtxoSnapshot(node); err != nil {
+					return err
+				}
+			}
+			return err
+		}
+		err = b.db.Update(func(dbTx database.Tx) error {
+			return dbPutSpendJournalEntry(dbTx, &node.hash, stxos)
+		})
+		if err != nil {
+			return err
+		}
+		s.cache.commit(view)
+		s.validated = node
+		b.index.SetStatusFlags(node, statusValid)
+
+		s.cache.mtx.Lock()
+		overSize := s.cache.size > s.cache.maxSize
+		s.cache.mtx.Unlock()
+		if overSize {
+			if err := s.flush(b.db, true); err != nil {
+				return err
+			}
+		}
+	}
+	if err := b.index.flushToDB(); err != nil {
+		return err
+	}
+
+	// All of the blocks before the snapshot have been validated, so ensure
+	// the resulting utxo set matches the snapshot.
+	if err := s.flush(b.db, true); err != nil {
+		return err
+	}
+	var txOutSetHash chainhash.Hash
+	err := b.db.View(func(dbTx database.Tx) error {
+		var err error
+		_, txOutSetHash, err = dbWriteUtxoSet(dbTx,
+			backgroundUtxoSetBucketName, ioutil.Discard)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if txOutSetHash != s.txOutSetHash {
+		log.Errorf("The utxo set resulting from validating the blocks "+
+			"before utxo snapshot block %v has hash %v instead of the "+
+			"expected %v", s.baseNode.hash, txOutSetHash,
+			s.txOutSetHash)
+		return b.abandonUtxoSnapshot(s.baseNode)
+	}
+
+	err = b.db.Update(func(dbTx database.Tx) error {
+		meta := dbTx.Metadata()
+		if err := meta.DeleteBucket(backgroundUtxoSetBucketName); err != nil {
+			return err
+		}
+		err := meta.Delete(backgroundUtxoStateConsistencyKeyName)
+		if err != nil {
+			return err
+		}
+		return meta.Delete(utxoSnapshotKeyName)
+	})
+	if err != nil {
+		return err
+	}
+	b.utxoSnapshot = nil
+
+	log.Infof("Validated all blocks before utxo snapshot block %v "+
+		"(height %d)", s.baseNode.hash, s.baseNode.height)
+
+	return nil
+}
+
+// abandonUtxoSnapshot falls back to the utxo set built while validating the
+// blocks before the base of a loaded utxo set snapshot once the passed block,
+// which is either the first block after the last validated one or the base
+// itself, turned out to be invalid.  The block is marked as such along with all
+// of its descendants as having an invalid ancestor, the background utxo set
+// replaces the one loaded from the snapshot, and the best chain is reset to
+// the last valid block.
+//
+// The invalid status of the block is written to the database first, so falling
+// back is resumed by initUtxoSnapshot when it is interrupted.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) abandonUtxoSnapshot(failed *blockNode) error {
+	s := b.utxoSnapshot
+	oldTip := b.bestChain.Tip()
+
+	log.Warnf("Abandoning utxo snapshot block %v (height %d) and falling "+
+		"back to the chain state validated up to height %d",
+		s.baseNode.hash, s.baseNode.height, failed.height-1)
+
+	b.index.UnsetStatusFlags(failed, statusValid)
+	b.index.SetStatusFlags(failed, statusValidateFailed)
+	for _, n := range b.descendants(failed) {
+		b.index.SetStatusFlags(n, statusInvalidAncestor)
+	}
+	if err := b.index.flushToDB(); err != nil {
+		return err
+	}
+
+	// Disconnect the failed block from the background utxo set when it
+	// has already been connected to it, which is the case when the
+	// resulting utxo set did not match the snapshot.
+	if s.validated == failed {
+		var block *pinutil.Block
+		var stxos []SpentTxOut
+		err := b.db.View(func(dbTx database.Tx) error {
+			var err error
+			block, err = dbFetchBlockByNode(dbTx, failed)
+			if err != nil {
+				return err
+			}
+			stxos, err = dbFetchSpendJournalEntry(dbTx, block)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		view := NewUtxoViewpoint()
+		view.SetBestHash(&failed.hash)
+		if err := view.fetchInputUtxos(s.cache, block); err != nil {
+			return err
+		}
+		err = view.disconnectTransactions(b.db, block, stxos)
+		if err != nil {
+			return err
+		}
+		s.cache.commit(view)
+		s.validated = failed.parent
+	}
+	if err := s.flush(b.db, true); err != nil {
+		return err
+	}
+	validated := s.validated
+
+	// Replace the utxo set with the background one while calculating its
+	// statistics.
+	err := b.db.Update(func(dbTx database.Tx) error {
+		meta := dbTx.Metadata()
+		err := meta.DeleteBucket(utxoSetBucketName)
+		if err != nil && !isDbBucketNotFoundErr(err) {
+			return err
+		}
+		_, err = meta.CreateBucket(utxoSetBucketName)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	stats := newUtxoStats()
+	var seekKey []byte
+	for done := false; !done; {
+		err := b.db.Update(func(dbTx database.Tx) error {
+			meta := dbTx.Metadata()
+			utxoBucket := meta.Bucket(utxoSetBucketName)
+			cursor := meta.Bucket(backgroundUtxoSetBucketName).Cursor()
+			ok := cursor.First()
+			if seekKey != nil {
+				ok = cursor.Seek(seekKey)
+			}
+			for i := 0; i < utxoSnapshotBatchSize; i++ {
+				if !ok {
+					done = true
+					return nil
+				}
+				key, serializedEntry := cursor.Key(), cursor.Value()
+				err := stats.addSerialized(key, serializedEntry)
+				if err != nil {
+					return err
+				}
+				if err := utxoBucket.Put(key, serializedEntry); err != nil {
+					return err
+				}
+				ok = cursor.Next()
+			}
+			if ok {
+				seekKey = append(seekKey[:0], cursor.Key()...)
+			} else {
+				done = true
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// Determine the state of the last valid block.  The total number of
+	// transactions is taken from the transaction counts which directly
+	// follow the block headers.
+	var block *pinutil.Block
+	var totalTxns uint64
+	err = b.db.View(func(dbTx database.Tx) error {
+		var err error
+		block, err = dbFetchBlockByNode(dbTx, validated)
+		if err != nil {
+			return err
+		}
+
+		var nodes []*blockNode
+		for n := validated; n != nil; n = n.parent {
+			nodes = append(nodes, n)
+		}
+		for len(nodes) > 0 {
+			batch := nodes
+			if len(batch) > utxoSnapshotBatchSize {
+				batch = batch[:utxoSnapshotBatchSize]
+			}
+			nodes = nodes[len(batch):]
+			regions := make([]database.BlockRegion, len(batch))
+			for i, n := range batch {
+				regions[i] = database.BlockRegion{
+					Hash:   &n.hash,
+					Offset: wire.MaxBlockHeaderPayload,
+					Len:    wire.MaxVarIntPayload,
+				}
+			}
+			txCounts, err := dbTx.FetchBlockRegions(regions)
+			if err != nil {
+				return err
+			}
+			for _, txCount := range txCounts {
+				numTxns, err := wire.ReadVarInt(
+					bytes.NewReader(txCount), 0)
+				if err != nil {
+					return err
+				}
+				totalTxns += numTxns
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	numTxns := uint64(len(block.MsgBlock().Transactions))
+	blockSize := uint64(block.MsgBlock().SerializeSize())
+	blockWeight := uint64(GetBlockWeight(block))
+	state := newBestState(validated, blockSize, blockWeight, numTxns,
+		totalTxns, validated.CalcPastMedianTime())
+
+	// Remove the abandoned blocks from the main chain and make the last
+	// valid block its tip.
+	err = b.db.Update(func(dbTx database.Tx) error {
+		for n := oldTip; n != validated; n = n.parent {
+			err := dbRemoveBlockIndex(dbTx, &n.hash, n.height)
+			if err != nil {
+				return err
+			}
+			err = dbRemoveSpendJournalEntry(dbTx, &n.hash)
+			if err != nil {
+				return err
+			}
+		}
+		err := dbPutUtxoStateConsistency(dbTx, &validated.hash)
+		if err != nil {
+			return err
+		}
+		if err := dbPutUtxoStats(dbTx, stats); err != nil {
+			return err
+		}
+		if err := dbPutBestState(dbTx, state, validated.workSum); err != nil {
+			return err
+		}
+
+		meta := dbTx.Metadata()
+		if err := meta.DeleteBucket(backgroundUtxoSetBucketName); err != nil {
+			return err
+		}
+		err = meta.Delete(backgroundUtxoStateConsistencyKeyName)
+		if err != nil {
+			return err
+		}
+		return meta.Delete(utxoSnapshotKeyName)
+	})
+	if err != nil {
+		return err
+	}
+	b.utxoSnapshot = nil
+	b.utxoStats = stats
+	b.utxoCache.markFlushed(&validated.hash, true)
+	b.bestChain.SetTip(validated)
+	b.stateLock.Lock()
+	b.stateSnapshot = state
+	b.stateLock.Unlock()
+	b.resetBestHeader()
+
+	log.Warnf("Fell back to the chain state at block %v (height %d) after "+
+		"the utxo snapshot turned out to be invalid", validated.hash,
+		validated.height)
+
+	return nil
+}
+
+// flushBackgroundUtxoSet writes the modified entries of the utxo set used to
+// validate the blocks before the base of a loaded utxo set snapshot to the
+// database.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) flushBackgroundUtxoSet() error {
+	if b.utxoSnapshot == nil {
+		return nil
+	}
+	return b.utxoSnapshot.flush(b.db, false)
+}
+
+// HistoricalBlocksToFetch returns the hashes of up to the provided number of
+// blocks before the base of a loaded utxo set snapshot which have not been
+// processed yet, in order of their height.  Nothing is returned when there is
+// no utxo set snapshot for which the blocks still need to be validated.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) HistoricalBlocksToFetch(maxHashes int) []*chainhash.Hash {
+	b.chainLock.RLock()
+	defer b.chainLock.RUnlock()
+
+	s := b.utxoSnapshot
+	if s == nil {
+		return nil
+	}
+
+	var hashes []*chainhash.Hash
+	node := b.bestChain.Next(s.validated)
+	for ; node != nil && node.height <= s.baseNode.height; node = b.bestChain.Next(node) {
+		if len(hashes) >= maxHashes {
+			break
+		}
+		if !b.index.NodeStatus(node).HaveData() {
+			hashes = append(hashes, &node.hash)
+		}
+	}
+	return hashes
+}
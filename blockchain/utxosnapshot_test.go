@@ -0,0 +1,390 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/nyodeco/pind/chaincfg"
+	"github.com/nyodeco/pind/chaincfg/chainhash"
+	"github.com/nyodeco/pind/database"
+	"github.com/nyodeco/pind/wire"
+)
+
+// TestUtxoSnapshot ensures a dumped utxo set snapshot contains every entry of
+// the utxo set along with the reported hash and that snapshots which are not
+// known to the chain parameters are rejected.
+func TestUtxoSnapshot(t *testing.T) {
+	chain, teardownFunc, err := chainSetup("utxosnapshot",
+		&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	// Store a couple of outputs directly in the database.
+	pkScript := []byte{0x51} // OP_TRUE
+	outpoints := []wire.OutPoint{
+		{Hash: chainhash.Hash{0x01}, Index: 0},
+		{Hash: chainhash.Hash{0x02}, Index: 3},
+	}
+	err = chain.db.Update(func(dbTx database.Tx) error {
+		utxoBucket := dbTx.Metadata().Bucket(utxoSetBucketName)
+		for _, outpoint := range outpoints {
+			entry := NewUtxoEntry(wire.NewTxOut(5000, pkScript), 0,
+				false)
+			err := dbPutUtxoEntry(utxoBucket, outpoint, entry)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("dbPutUtxoEntry: unexpected error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	info, err := chain.DumpUtxoSnapshot(&buf)
+	if err != nil {
+		t.Fatalf("DumpUtxoSnapshot: unexpected error: %v", err)
+	}
+	genesisHash := chaincfg.RegressionNetParams.GenesisHash
+	if info.BlockHash != *genesisHash || info.Height != 0 ||
+		info.NumUtxos != uint64(len(outpoints)) {
+
+		t.Fatalf("DumpUtxoSnapshot: unexpected info %+v", info)
+	}
+
+	// Read the snapshot back and ensure it matches the dumped utxo set.
+	r := bytes.NewReader(buf.Bytes())
+	var header utxoSnapshotHeader
+	if err := header.deserialize(r); err != nil {
+		t.Fatalf("deserialize: unexpected error: %v", err)
+	}
+	if header.blockHash != *genesisHash || header.numUtxos != info.NumUtxos {
+		t.Fatalf("deserialize: unexpected header %+v", header)
+	}
+	var numRecords int
+	txOutSetHash, err := readUtxoSnapshotRecords(r, header.numUtxos, 0,
+		func(key, serializedEntry []byte) error {
+			numRecords++
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("readUtxoSnapshotRecords: unexpected error: %v", err)
+	}
+	if numRecords != len(outpoints) || txOutSetHash != info.TxOutSetHash {
+		t.Fatalf("readUtxoSnapshotRecords: got %d records with hash "+
+			"%v, want %d with hash %v", numRecords, txOutSetHash,
+			len(outpoints), info.TxOutSetHash)
+	}
+	if r.Len() != 0 {
+		t.Fatalf("readUtxoSnapshotRecords: %d unread bytes", r.Len())
+	}
+
+	// The network doesn't know any snapshots, so loading must fail.
+	_, err = chain.LoadUtxoSnapshot(bytes.NewReader(buf.Bytes()))
+	if err == nil {
+		t.Fatal("LoadUtxoSnapshot: loaded unknown snapshot")
+	}
+}
+
+// TestAbandonUtxoSnapshot ensures the chain falls back to the background utxo
+// set when a block before the base of a loaded utxo set snapshot is invalid.
+func TestAbandonUtxoSnapshot(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	chain, teardownFunc, err := chainSetup("abandonutxosnapshot", params)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	// Extend the best chain with two blocks which have no data, as is the
+	// case for the blocks before a freshly loaded snapshot.
+	genesis := chain.bestChain.Genesis()
+	nodes := extendFakeChain(chain, genesis, 2, statusNone)
+	tip := nodes[1]
+	chain.bestChain.SetTip(tip)
+
+	// The utxo set loaded from the snapshot differs from the background
+	// utxo set validated up to the genesis block.
+	pkScript := []byte{0x51} // OP_TRUE
+	loaded := wire.OutPoint{Hash: chainhash.Hash{0x01}, Index: 0}
+	background := []wire.OutPoint{
+		{Hash: chainhash.Hash{0x02}, Index: 0},
+		{Hash: chainhash.Hash{0x03}, Index: 1},
+	}
+	err = chain.db.Update(func(dbTx database.Tx) error {
+		meta := dbTx.Metadata()
+		for _, node := range nodes {
+			err := dbPutBlockIndex(dbTx, &node.hash, node.height)
+			if err != nil {
+				return err
+			}
+		}
+		bucket, err := meta.CreateBucket(backgroundUtxoSetBucketName)
+		if err != nil {
+			return err
+		}
+		entry := NewUtxoEntry(wire.NewTxOut(5000, pkScript), 0, false)
+		for _, outpoint := range background {
+			if err := dbPutUtxoEntry(bucket, outpoint, entry); err != nil {
+				return err
+			}
+		}
+		err = dbPutUtxoEntry(meta.Bucket(utxoSetBucketName), loaded,
+			entry)
+		if err != nil {
+			return err
+		}
+		return dbPutUtxoSnapshot(dbTx, &tip.hash, &chainhash.Hash{})
+	})
+	if err != nil {
+		t.Fatalf("unexpected error storing the utxo sets: %v", err)
+	}
+	chain.utxoSnapshot = chain.newUtxoSnapshot(tip, genesis,
+		&chainhash.Hash{})
+
+	// Falling back due to the first block must mark it invalid along with
+	// its descendant and make the genesis block the tip.
+	if err := chain.abandonUtxoSnapshot(nodes[0]); err != nil {
+		t.Fatalf("abandonUtxoSnapshot: unexpected error: %v", err)
+	}
+	if status := chain.index.NodeStatus(nodes[0]); status&statusValidateFailed == 0 {
+		t.Fatalf("failed block has status %v", status)
+	}
+	if status := chain.index.NodeStatus(nodes[1]); status&statusInvalidAncestor == 0 {
+		t.Fatalf("descendant of failed block has status %v", status)
+	}
+	if chain.bestChain.Tip() != genesis || chain.utxoSnapshot != nil {
+		t.Fatalf("best chain tip is %v instead of the genesis block",
+			chain.bestChain.Tip().hash)
+	}
+	best := chain.BestSnapshot()
+	if best.Hash != genesis.hash || best.TotalTxns != 1 {
+		t.Fatalf("unexpected best state %+v", best)
+	}
+
+	// The utxo set must have been replaced with the background one.
+	err = chain.db.View(func(dbTx database.Tx) error {
+		meta := dbTx.Metadata()
+		if meta.Bucket(backgroundUtxoSetBucketName) != nil {
+			t.Fatal("background utxo set still exists")
+		}
+		if baseHash, _ := dbFetchUtxoSnapshot(dbTx); baseHash != nil {
+			t.Fatal("utxo snapshot still exists")
+		}
+		utxoBucket := meta.Bucket(utxoSetBucketName)
+		entry, err := dbFetchUtxoEntryFromBucket(utxoBucket, loaded)
+		if err != nil || entry != nil {
+			t.Fatalf("output from the snapshot still exists: %v", err)
+		}
+		for _, outpoint := range background {
+			entry, err := dbFetchUtxoEntryFromBucket(utxoBucket,
+				outpoint)
+			if err != nil || entry == nil {
+				t.Fatalf("output %v is missing: %v", outpoint, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if chain.utxoStats.numUtxos != uint64(len(background)) {
+		t.Fatalf("utxo set statistics count %d outputs instead of %d",
+			chain.utxoStats.numUtxos, len(background))
+	}
+}
+
+// TestLoadUtxoSnapshot ensures a known utxo set snapshot replaces the utxo set
+// and makes its block the tip of the best chain, and that a load which was
+// interrupted is rolled back.
+func TestLoadUtxoSnapshot(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	chain, teardownFunc, err := chainSetup("loadutxosnapshot", params)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	// Dump a utxo set with a couple of outputs at the genesis block.
+	pkScript := []byte{0x51} // OP_TRUE
+	outpoints := []wire.OutPoint{
+		{Hash: chainhash.Hash{0x01}, Index: 0},
+		{Hash: chainhash.Hash{0x02}, Index: 3},
+	}
+	err = chain.db.Update(func(dbTx database.Tx) error {
+		utxoBucket := dbTx.Metadata().Bucket(utxoSetBucketName)
+		for _, outpoint := range outpoints {
+			entry := NewUtxoEntry(wire.NewTxOut(5000, pkScript), 0,
+				false)
+			err := dbPutUtxoEntry(utxoBucket, outpoint, entry)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("dbPutUtxoEntry: unexpected error: %v", err)
+	}
+	var buf bytes.Buffer
+	info, err := chain.DumpUtxoSnapshot(&buf)
+	if err != nil {
+		t.Fatalf("DumpUtxoSnapshot: unexpected error: %v", err)
+	}
+
+	// Take the snapshot at a block two blocks after the genesis block
+	// whose header is known, and clear the utxo set again.
+	genesis := chain.bestChain.Genesis()
+	base := extendFakeChain(chain, genesis, 2, statusNone)[1]
+	r := bytes.NewReader(buf.Bytes())
+	var header utxoSnapshotHeader
+	if err := header.deserialize(r); err != nil {
+		t.Fatalf("deserialize: unexpected error: %v", err)
+	}
+	header.blockHash = base.hash
+	header.totalTxns = 3
+	var snapshot bytes.Buffer
+	if err := header.serialize(&snapshot); err != nil {
+		t.Fatalf("serialize: unexpected error: %v", err)
+	}
+	if _, err := snapshot.ReadFrom(r); err != nil {
+		t.Fatalf("ReadFrom: unexpected error: %v", err)
+	}
+	err = chain.db.Update(func(dbTx database.Tx) error {
+		meta := dbTx.Metadata()
+		if err := meta.DeleteBucket(utxoSetBucketName); err != nil {
+			return err
+		}
+		_, err := meta.CreateBucket(utxoSetBucketName)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("unable to clear the utxo set: %v", err)
+	}
+
+	// The total number of transactions isn't covered by the hash of the
+	// utxo set, so a snapshot claiming another number must be rejected.
+	chain.chainParams.AssumeUtxo = []chaincfg.AssumeUtxo{{
+		Height:       base.height,
+		BlockHash:    &base.hash,
+		TxOutSetHash: &info.TxOutSetHash,
+		NumUtxos:     info.NumUtxos,
+		TotalTxns:    4,
+	}}
+	_, err = chain.LoadUtxoSnapshot(bytes.NewReader(snapshot.Bytes()))
+	if err == nil {
+		t.Fatal("LoadUtxoSnapshot: loaded snapshot with the wrong " +
+			"total number of transactions")
+	}
+
+	chain.chainParams.AssumeUtxo[0].TotalTxns = 3
+	loaded, err := chain.LoadUtxoSnapshot(bytes.NewReader(snapshot.Bytes()))
+	if err != nil {
+		t.Fatalf("LoadUtxoSnapshot: unexpected error: %v", err)
+	}
+	if loaded.BlockHash != base.hash || loaded.TotalTxns != 3 {
+		t.Fatalf("LoadUtxoSnapshot: unexpected info %+v", loaded)
+	}
+	best := chain.BestSnapshot()
+	if best.Hash != base.hash || best.TotalTxns != 3 {
+		t.Fatalf("unexpected best state %+v", best)
+	}
+	err = chain.db.View(func(dbTx database.Tx) error {
+		meta := dbTx.Metadata()
+		if meta.Get(utxoSnapshotLoadKeyName) != nil {
+			t.Fatal("utxo snapshot load is still in progress")
+		}
+		if baseHash, _ := dbFetchUtxoSnapshot(dbTx); baseHash == nil ||
+			*baseHash != base.hash {
+
+			t.Fatalf("utxo snapshot is at block %v", baseHash)
+		}
+		utxoBucket := meta.Bucket(utxoSetBucketName)
+		for _, outpoint := range outpoints {
+			entry, err := dbFetchUtxoEntryFromBucket(utxoBucket,
+				outpoint)
+			if err != nil || entry == nil {
+				t.Fatalf("output %v is missing: %v", outpoint, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// TestRollBackUtxoSnapshotLoad ensures a utxo set snapshot load which did not
+// complete is undone.
+func TestRollBackUtxoSnapshotLoad(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	chain, teardownFunc, err := chainSetup("rollbackutxosnapshotload",
+		params)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	// Leave the database in the state of a load which was interrupted
+	// after writing part of the utxo set and the block index of the blocks
+	// up to the snapshot block.
+	genesis := chain.bestChain.Genesis()
+	base := extendFakeChain(chain, genesis, 2, statusNone)[1]
+	pkScript := []byte{0x51} // OP_TRUE
+	loaded := wire.OutPoint{Hash: chainhash.Hash{0x01}, Index: 0}
+	err = chain.db.Update(func(dbTx database.Tx) error {
+		meta := dbTx.Metadata()
+		for n := base; n != genesis; n = n.parent {
+			err := dbPutBlockIndex(dbTx, &n.hash, n.height)
+			if err != nil {
+				return err
+			}
+		}
+		entry := NewUtxoEntry(wire.NewTxOut(5000, pkScript), 0, false)
+		err := dbPutUtxoEntry(meta.Bucket(utxoSetBucketName), loaded,
+			entry)
+		if err != nil {
+			return err
+		}
+		return meta.Put(utxoSnapshotLoadKeyName, base.hash[:])
+	})
+	if err != nil {
+		t.Fatalf("unexpected error storing the partial load: %v", err)
+	}
+
+	if err := chain.rollBackUtxoSnapshotLoad(); err != nil {
+		t.Fatalf("rollBackUtxoSnapshotLoad: unexpected error: %v", err)
+	}
+	if err := chain.initUtxoCache(nil); err != nil {
+		t.Fatalf("initUtxoCache: unexpected error: %v", err)
+	}
+	if chain.bestChain.Tip() != genesis || chain.utxoSnapshot != nil {
+		t.Fatalf("best chain tip is %v instead of the genesis block",
+			chain.bestChain.Tip().hash)
+	}
+	err = chain.db.View(func(dbTx database.Tx) error {
+		meta := dbTx.Metadata()
+		if meta.Get(utxoSnapshotLoadKeyName) != nil {
+			t.Fatal("utxo snapshot load is still in progress")
+		}
+		if _, err := dbFetchHashByHeight(dbTx, base.height); err == nil {
+			t.Fatal("snapshot block is still in the main chain")
+		}
+		entry, err := dbFetchUtxoEntryFromBucket(
+			meta.Bucket(utxoSetBucketName), loaded)
+		if err != nil || entry != nil {
+			t.Fatalf("output from the snapshot still exists: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
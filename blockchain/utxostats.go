@@ -0,0 +1,367 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/nyodeco/pind/chaincfg/chainhash"
+	"github.com/nyodeco/pind/database"
+	"github.com/nyodeco/pind/txscript"
+	"github.com/nyodeco/pind/wire"
+	"github.com/nyodeco/pinutil"
+)
+
+// utxoStatsKeyName is the name of the db key used to store the statistics of
+// the utxo set as of the best chain tip.
+var utxoStatsKeyName = []byte("utxosetstats")
+
+// utxoStatsSize is the size of the serialized utxo set statistics.
+const utxoStatsSize = 8 + 8 + 8 + 8 + muHashElementSize*2
+
+// UtxoSetStats houses statistics about the unspent transaction output set as
+// of a block of the best chain along with a commitment to its contents.
+type UtxoSetStats struct {
+	Height      int32          // Height of the block
+	BestBlock   chainhash.Hash // Hash of the block
+	NumTxns     uint64         // Number of transactions with unspent outputs
+	NumUtxos    uint64         // Number of unspent outputs
+	TotalAmount int64          // Total amount of the unspent outputs
+	BogoSize    uint64         // Database independent size of the set
+	MuHash      chainhash.Hash // MuHash3072 of the unspent outputs
+}
+
+// -----------------------------------------------------------------------------
+// The statistics of the utxo set are stored along with the best chain state so
+// they always match the best chain tip.
+//
+// The serialized format is:
+//
+//   <num txns><num utxos><total amount><bogo size><muhash state>
+//
+//   Field          Type      Size
+//   num txns       uint64    8
+//   num utxos      uint64    8
+//   total amount   int64     8
+//   bogo size      uint64    8
+//   muhash state   []byte    768 (numerator and denominator)
+// -----------------------------------------------------------------------------
+
+// utxoStats houses the statistics of the utxo set which are maintained
+// incrementally as blocks are connected and disconnected.
+type utxoStats struct {
+	numTxns     uint64
+	numUtxos    uint64
+	totalAmount int64
+	bogoSize    uint64
+	muHash      *muHash3072
+
+	// lastTxHash is the hash of the transaction of the last output added
+	// by addSerialized, which is used to count the transactions since the
+	// outputs of a transaction are adjacent in the utxo set.
+	lastTxHash *chainhash.Hash
+}
+
+// newUtxoStats returns the statistics of an empty utxo set.
+func newUtxoStats() *utxoStats {
+	return &utxoStats{muHash: newMuHash3072()}
+}
+
+// clone returns a copy of the statistics.
+func (s *utxoStats) clone() *utxoStats {
+	clone := *s
+	clone.muHash = s.muHash.Clone()
+	return &clone
+}
+
+// utxoBogoSize returns the database independent size of an unspent output with
+// the passed public key script.  It accounts for the transaction hash, the
+// output index, the height and coinbase flag, the amount, and the script.
+func utxoBogoSize(pkScript []byte) uint64 {
+	return 32 + 4 + 4 + 8 + 2 + uint64(len(pkScript))
+}
+
+// serializeUtxoStatsItem returns the serialization of an unspent output which
+// is committed to by the MuHash3072 of the utxo set.  It consists of the
+// outpoint, the height combined with the coinbase flag, and the output itself.
+func serializeUtxoStatsItem(outpoint wire.OutPoint, amount int64, pkScript []byte, height int32, isCoinBase bool) []byte {
+	var buf bytes.Buffer
+	buf.Grow(chainhash.HashSize + 4 + 4 + 8 + 9 + len(pkScript))
+	buf.Write(outpoint.Hash[:])
+
+	var scratch [8]byte
+	binary.LittleEndian.PutUint32(scratch[:], outpoint.Index)
+	buf.Write(scratch[:4])
+	code := uint32(height) << 1
+	if isCoinBase {
+		code |= 1
+	}
+	binary.LittleEndian.PutUint32(scratch[:], code)
+	buf.Write(scratch[:4])
+	binary.LittleEndian.PutUint64(scratch[:], uint64(amount))
+	buf.Write(scratch[:])
+
+	// Writing to a bytes.Buffer never fails.
+	_ = wire.WriteVarBytes(&buf, 0, pkScript)
+	return buf.Bytes()
+}
+
+// add updates the statistics for the passed output being added to the set.
+func (s *utxoStats) add(outpoint wire.OutPoint, amount int64, pkScript []byte, height int32, isCoinBase bool) {
+	s.numUtxos++
+	s.totalAmount += amount
+	s.bogoSize += utxoBogoSize(pkScript)
+	s.muHash.Insert(serializeUtxoStatsItem(outpoint, amount, pkScript,
+		height, isCoinBase))
+}
+
+// remove updates the statistics for the passed output being removed from the
+// set.
+func (s *utxoStats) remove(outpoint wire.OutPoint, amount int64, pkScript []byte, height int32, isCoinBase bool) {
+	s.numUtxos--
+	s.totalAmount -= amount
+	s.bogoSize -= utxoBogoSize(pkScript)
+	s.muHash.Remove(serializeUtxoStatsItem(outpoint, amount, pkScript,
+		height, isCoinBase))
+}
+
+// applyBlock updates the statistics for the passed block at the provided
+// height being connected to or, when connect is false, disconnected from the
+// end of the best chain.  The passed spent txouts must be the ones of the
+// block as stored in the spend journal.
+//
+// The passed utxo cache, along with the utxo set in the database it sits in
+// front of, must reflect the utxo set before the block is connected or
+// disconnected.  It is used to determine whether the transactions the block
+// spends outputs of have any other unspent outputs.
+func (s *utxoStats) applyBlock(dbTx database.Tx, cache *utxoCache, block *pinutil.Block, height int32, stxos []SpentTxOut, connect bool) error {
+	// Keep track of the number of unspent outputs the transactions of the
+	// block are left with as well as the number of outputs of earlier
+	// transactions the block spends.
+	created := make(map[chainhash.Hash]int)
+	spent := make(map[chainhash.Hash]int)
+	var stxoIdx int
+	for txIdx, tx := range block.Transactions() {
+		msgTx := tx.MsgTx()
+		isCoinBase := txIdx == 0
+		if !isCoinBase {
+			for _, txIn := range msgTx.TxIn {
+				stxo := &stxos[stxoIdx]
+				stxoIdx++
+				if connect {
+					s.remove(txIn.PreviousOutPoint, stxo.Amount,
+						stxo.PkScript, stxo.Height,
+						stxo.IsCoinBase)
+				} else {
+					s.add(txIn.PreviousOutPoint, stxo.Amount,
+						stxo.PkScript, stxo.Height,
+						stxo.IsCoinBase)
+				}
+
+				hash := txIn.PreviousOutPoint.Hash
+				if _, ok := created[hash]; ok {
+					created[hash]--
+				} else {
+					spent[hash]++
+				}
+			}
+		}
+
+		// Provably unspendable outputs are never added to the set.
+		outpoint := wire.OutPoint{Hash: *tx.Hash()}
+		var numUnspent int
+		for i, txOut := range msgTx.TxOut {
+			if txscript.IsUnspendable(txOut.PkScript) {
+				continue
+			}
+			outpoint.Index = uint32(i)
+			if connect {
+				s.add(outpoint, txOut.Value, txOut.PkScript, height,
+					isCoinBase)
+			} else {
+				s.remove(outpoint, txOut.Value, txOut.PkScript,
+					height, isCoinBase)
+			}
+			numUnspent++
+		}
+		created[*tx.Hash()] = numUnspent
+	}
+
+	// The transactions of the block are only part of the set while any of
+	// their outputs remain unspent.
+	for _, numUnspent := range created {
+		if numUnspent == 0 {
+			continue
+		}
+		if connect {
+			s.numTxns++
+		} else {
+			s.numTxns--
+		}
+	}
+
+	// Earlier transactions leave the set once the block spends all of their
+	// remaining outputs and are added back when it is disconnected.
+	for hash, numSpent := range spent {
+		numUnspent, err := cache.dbNumUnspentTxOuts(dbTx, &hash)
+		if err != nil {
+			return err
+		}
+		switch {
+		case connect && numUnspent == numSpent:
+			s.numTxns--
+		case !connect && numUnspent == 0:
+			s.numTxns++
+		}
+	}
+
+	return nil
+}
+
+// serialize returns the serialization of the statistics.
+func (s *utxoStats) serialize() []byte {
+	serialized := make([]byte, utxoStatsSize)
+	byteOrder.PutUint64(serialized[0:8], s.numTxns)
+	byteOrder.PutUint64(serialized[8:16], s.numUtxos)
+	byteOrder.PutUint64(serialized[16:24], uint64(s.totalAmount))
+	byteOrder.PutUint64(serialized[24:32], s.bogoSize)
+	copy(serialized[32:], s.muHash.serialize())
+	return serialized
+}
+
+// deserializeUtxoStats returns the statistics from the passed serialization.
+func deserializeUtxoStats(serialized []byte) (*utxoStats, error) {
+	if len(serialized) != utxoStatsSize {
+		return nil, errDeserialize("unexpected utxo set statistics size")
+	}
+	s := &utxoStats{
+		numTxns:     byteOrder.Uint64(serialized[0:8]),
+		numUtxos:    byteOrder.Uint64(serialized[8:16]),
+		totalAmount: int64(byteOrder.Uint64(serialized[16:24])),
+		bogoSize:    byteOrder.Uint64(serialized[24:32]),
+		muHash:      newMuHash3072(),
+	}
+	if err := s.muHash.deserialize(serialized[32:]); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// dbPutUtxoStats uses an existing database transaction to store the passed
+// statistics of the utxo set.
+func dbPutUtxoStats(dbTx database.Tx, s *utxoStats) error {
+	return dbTx.Metadata().Put(utxoStatsKeyName, s.serialize())
+}
+
+// dbFetchUtxoStats uses an existing database transaction to fetch the stored
+// statistics of the utxo set.  Nil is returned when they have not been stored
+// yet or were stored before the number of transactions was tracked.
+func dbFetchUtxoStats(dbTx database.Tx) (*utxoStats, error) {
+	serialized := dbTx.Metadata().Get(utxoStatsKeyName)
+	if serialized == nil || len(serialized) == utxoStatsSize-8 {
+		return nil, nil
+	}
+	return deserializeUtxoStats(serialized)
+}
+
+// addSerialized updates the statistics for the unspent output with the passed
+// outpoint key and serialized utxo entry, as stored in the database, being
+// added to the set.  The outputs must be added in the order of their keys so
+// the outputs of each transaction are added one after another.
+func (s *utxoStats) addSerialized(key, serializedEntry []byte) error {
+	if len(key) <= chainhash.HashSize {
+		return errDeserialize("malformed outpoint key")
+	}
+	var outpoint wire.OutPoint
+	copy(outpoint.Hash[:], key)
+	index, _ := deserializeVLQ(key[chainhash.HashSize:])
+	outpoint.Index = uint32(index)
+	if s.lastTxHash == nil || *s.lastTxHash != outpoint.Hash {
+		s.numTxns++
+		s.lastTxHash = &outpoint.Hash
+	}
+
+	entry, err := deserializeUtxoEntry(serializedEntry)
+	if err != nil {
+		return err
+	}
+	s.add(outpoint, entry.Amount(), entry.PkScript(), entry.BlockHeight(),
+		entry.IsCoinBase())
+	return nil
+}
+
+// dbCalcUtxoStats uses an existing database transaction to calculate the
+// statistics of the utxo set in the database from scratch.
+func dbCalcUtxoStats(dbTx database.Tx) (*utxoStats, error) {
+	s := newUtxoStats()
+	cursor := dbTx.Metadata().Bucket(utxoSetBucketName).Cursor()
+	for ok := cursor.First(); ok; ok = cursor.Next() {
+		if err := s.addSerialized(cursor.Key(), cursor.Value()); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// initUtxoStats loads the statistics of the utxo set from the database and
+// calculates them from scratch when they were not stored yet, which is the case
+// for databases created before they were maintained or before the number of
+// transactions was part of them.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) initUtxoStats() error {
+	err := b.db.View(func(dbTx database.Tx) error {
+		var err error
+		b.utxoStats, err = dbFetchUtxoStats(dbTx)
+		return err
+	})
+	if err != nil || b.utxoStats != nil {
+		return err
+	}
+
+	// The utxo set in the database must be up to date.
+	tip := b.bestChain.Tip()
+	if err := b.flushUtxoCache(&tip.hash, false); err != nil {
+		return err
+	}
+
+	if tip.height > 0 {
+		log.Infof("Calculating utxo set statistics.  This might take a " +
+			"while...")
+	}
+	return b.db.Update(func(dbTx database.Tx) error {
+		s, err := dbCalcUtxoStats(dbTx)
+		if err != nil {
+			return err
+		}
+		if err := dbPutUtxoStats(dbTx, s); err != nil {
+			return err
+		}
+		b.utxoStats = s
+		return nil
+	})
+}
+
+// UtxoSetStats returns statistics about the unspent transaction output set as
+// of the current best chain tip.  They are maintained as blocks are connected
+// and disconnected, so no scan of the utxo set is required.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) UtxoSetStats() *UtxoSetStats {
+	b.chainLock.RLock()
+	defer b.chainLock.RUnlock()
+
+	tip := b.bestChain.Tip()
+	return &UtxoSetStats{
+		Height:      tip.height,
+		BestBlock:   tip.hash,
+		NumTxns:     b.utxoStats.numTxns,
+		NumUtxos:    b.utxoStats.numUtxos,
+		TotalAmount: b.utxoStats.totalAmount,
+		BogoSize:    b.utxoStats.bogoSize,
+		MuHash:      b.utxoStats.muHash.Finalize(),
+	}
+}
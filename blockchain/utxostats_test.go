@@ -0,0 +1,293 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nyodeco/pind/chaincfg"
+	"github.com/nyodeco/pind/chaincfg/chainhash"
+	"github.com/nyodeco/pind/database"
+	"github.com/nyodeco/pind/txscript"
+	"github.com/nyodeco/pind/wire"
+	"github.com/nyodeco/pinutil"
+)
+
+// TestMuHash3072 ensures the MuHash3072 implementation produces the expected
+// hashes and that the order of insertions and removals doesn't matter.
+func TestMuHash3072(t *testing.T) {
+	item := func(b byte) []byte {
+		data := make([]byte, 32)
+		data[0] = b
+		return data
+	}
+
+	// This is the test vector of the reference implementation.
+	h := newMuHash3072()
+	h.Insert(item(0))
+	h.Insert(item(1))
+	h.Remove(item(2))
+	want := "10d312b100cbd32ada024a6646e40d3482fcff103668d2625f10002a607d5863"
+	if got := h.Finalize(); got.String() != want {
+		t.Fatalf("Finalize: got %v, want %v", got, want)
+	}
+
+	// Removing an item before it is inserted and serializing the state in
+	// between results in the same hash as never adding it.
+	h2 := newMuHash3072()
+	h2.Remove(item(2))
+	h2.Insert(item(3))
+	h2.Insert(item(0))
+	if err := h2.deserialize(h2.serialize()); err != nil {
+		t.Fatalf("deserialize: unexpected error: %v", err)
+	}
+	h2.Remove(item(3))
+	h2.Insert(item(1))
+	if h2.Finalize() != h.Finalize() {
+		t.Fatalf("Finalize: got %v, want %v", h2.Finalize(),
+			h.Finalize())
+	}
+	if newMuHash3072().Finalize() == h.Finalize() {
+		t.Fatal("Finalize: empty set has the same hash as non-empty set")
+	}
+}
+
+// TestUtxoStats ensures the statistics of the utxo set are updated correctly
+// when blocks are connected and disconnected and match the statistics
+// calculated from the utxo set in the database.
+func TestUtxoStats(t *testing.T) {
+	chain, teardownFunc, err := chainSetup("utxostats",
+		&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	// The utxo set of a new chain is empty.
+	stats := chain.UtxoSetStats()
+	if stats.NumUtxos != 0 || stats.TotalAmount != 0 ||
+		stats.MuHash != newMuHash3072().Finalize() {
+
+		t.Fatalf("UtxoSetStats: unexpected stats for empty set %+v",
+			stats)
+	}
+
+	// Create a block with a coinbase that pays to an unspendable output
+	// as well as a transaction that spends existing outputs, which leaves
+	// one of the earlier transactions without unspent outputs, and one
+	// created earlier in the same block.
+	pkScript := []byte{0x51} // OP_TRUE
+	existing := wire.OutPoint{Hash: chainhash.Hash{0x01}, Index: 2}
+	sibling := wire.OutPoint{Hash: chainhash.Hash{0x01}, Index: 3}
+	other := wire.OutPoint{Hash: chainhash.Hash{0x02}, Index: 0}
+	coinbase := wire.NewMsgTx(1)
+	coinbase.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: wire.OutPoint{Index: wire.MaxPrevOutIndex},
+	})
+	coinbase.AddTxOut(wire.NewTxOut(5000, pkScript))
+	coinbase.AddTxOut(wire.NewTxOut(0, []byte{0x6a})) // OP_RETURN
+	spend := wire.NewMsgTx(1)
+	spend.AddTxIn(wire.NewTxIn(&existing, nil, nil))
+	spend.AddTxIn(wire.NewTxIn(&other, nil, nil))
+	spend.AddTxOut(wire.NewTxOut(2000, pkScript))
+	spend.AddTxOut(wire.NewTxOut(1000, pkScript))
+	spendHash := spend.TxHash()
+	chained := wire.NewMsgTx(1)
+	chained.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&spendHash, 1), nil, nil))
+	chained.AddTxOut(wire.NewTxOut(900, pkScript))
+	block := pinutil.NewBlock(&wire.MsgBlock{
+		Transactions: []*wire.MsgTx{coinbase, spend, chained},
+	})
+	stxos := []SpentTxOut{
+		{Amount: 3000, PkScript: pkScript, Height: 5},
+		{Amount: 700, PkScript: pkScript, Height: 7},
+		{Amount: 1000, PkScript: pkScript, Height: 10},
+	}
+
+	// Build the utxo set before the block in the database and connect the
+	// block to it.  Then build the utxo set after the block and disconnect
+	// the block from it.
+	var before, after, connected, disconnected *utxoStats
+	err = chain.db.Update(func(dbTx database.Tx) error {
+		utxoBucket := dbTx.Metadata().Bucket(utxoSetBucketName)
+		entries := map[wire.OutPoint]*UtxoEntry{
+			existing: NewUtxoEntry(wire.NewTxOut(3000, pkScript), 5,
+				false),
+			sibling: NewUtxoEntry(wire.NewTxOut(500, pkScript), 5,
+				false),
+			other: NewUtxoEntry(wire.NewTxOut(700, pkScript), 7,
+				false),
+		}
+		for outpoint, entry := range entries {
+			err := dbPutUtxoEntry(utxoBucket, outpoint, entry)
+			if err != nil {
+				return err
+			}
+		}
+		var err error
+		if before, err = dbCalcUtxoStats(dbTx); err != nil {
+			return err
+		}
+		connected = before.clone()
+		err = connected.applyBlock(dbTx, chain.utxoCache, block, 10,
+			stxos, true)
+		if err != nil {
+			return err
+		}
+
+		for _, outpoint := range []wire.OutPoint{existing, other} {
+			entry := entries[outpoint]
+			entry.Spend()
+			err := dbPutUtxoEntry(utxoBucket, outpoint, entry)
+			if err != nil {
+				return err
+			}
+		}
+		view := NewUtxoViewpoint()
+		view.AddTxOuts(block.Transactions()[0], 10)
+		view.AddTxOuts(block.Transactions()[1], 10)
+		view.AddTxOuts(block.Transactions()[2], 10)
+		view.LookupEntry(*wire.NewOutPoint(&spendHash, 1)).Spend()
+		if err := dbPutUtxoView(dbTx, view); err != nil {
+			return err
+		}
+		if after, err = dbCalcUtxoStats(dbTx); err != nil {
+			return err
+		}
+		disconnected = after.clone()
+		return disconnected.applyBlock(dbTx, chain.utxoCache, block, 10,
+			stxos, false)
+	})
+	if err != nil {
+		t.Fatalf("unexpected database error: %v", err)
+	}
+	if before.numTxns != 2 || before.numUtxos != 3 {
+		t.Fatalf("dbCalcUtxoStats: unexpected stats %+v", before)
+	}
+	if after.numTxns != 4 || after.numUtxos != 4 ||
+		after.totalAmount != 8400 {
+
+		t.Fatalf("dbCalcUtxoStats: unexpected stats %+v", after)
+	}
+
+	// Connecting the block must produce the statistics of the utxo set
+	// after the block and disconnecting it the ones before it.
+	statsEqual := func(a, b *utxoStats) bool {
+		return a.numTxns == b.numTxns && a.numUtxos == b.numUtxos &&
+			a.totalAmount == b.totalAmount &&
+			a.bogoSize == b.bogoSize &&
+			a.muHash.Finalize() == b.muHash.Finalize()
+	}
+	if !statsEqual(connected, after) {
+		t.Fatalf("applyBlock: connect got %+v, want %+v", connected,
+			after)
+	}
+	if !statsEqual(disconnected, before) {
+		t.Fatalf("applyBlock: disconnect got %+v, want %+v",
+			disconnected, before)
+	}
+
+	// The statistics survive a serialization round trip.
+	deserialized, err := deserializeUtxoStats(after.serialize())
+	if err != nil {
+		t.Fatalf("deserializeUtxoStats: unexpected error: %v", err)
+	}
+	if !statsEqual(deserialized, after) {
+		t.Fatalf("deserializeUtxoStats: got %+v, want %+v",
+			deserialized, after)
+	}
+}
+
+// TestUtxoStatsIssuance ensures the total amount of the utxo set of a chain
+// whose blocks only pay the block subsidy to spendable outputs matches the
+// total issuance.
+func TestUtxoStatsIssuance(t *testing.T) {
+	chain, teardownFunc, err := chainSetup("utxostatsissuance",
+		&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	// Reduce the subsidy every other block so the issuance covers several
+	// subsidy amounts.  The last block also moves the output of the first
+	// coinbase without paying a fee, so the issuance is unaffected.
+	params := chain.chainParams
+	params.SubsidyReductionInterval = 2
+	chain.TstSetCoinbaseMaturity(1)
+
+	// Keep the outputs in the utxo cache so the ones which have not been
+	// written to the database yet are accounted for as well.
+	chain.utxoCache.maxSize = 1024 * 1024
+
+	const numBlocks = 6
+	prev := params.GenesisBlock
+	var firstCoinbase *wire.MsgTx
+	var wantAmount int64
+	for height := int32(1); height <= numBlocks; height++ {
+		subsidy := CalcBlockSubsidy(height, params)
+		wantAmount += subsidy
+
+		coinbaseScript, err := txscript.NewScriptBuilder().
+			AddInt64(int64(height)).AddInt64(0).Script()
+		if err != nil {
+			t.Fatalf("unable to create coinbase script: %v", err)
+		}
+		coinbase := wire.NewMsgTx(1)
+		coinbase.AddTxIn(&wire.TxIn{
+			PreviousOutPoint: wire.OutPoint{
+				Index: wire.MaxPrevOutIndex,
+			},
+			SignatureScript: coinbaseScript,
+			Sequence:        wire.MaxTxInSequenceNum,
+		})
+		coinbase.AddTxOut(wire.NewTxOut(subsidy, []byte{0x51}))
+		txns := []*wire.MsgTx{coinbase}
+		if firstCoinbase == nil {
+			firstCoinbase = coinbase
+		}
+		if height == numBlocks {
+			firstHash := firstCoinbase.TxHash()
+			spend := wire.NewMsgTx(1)
+			spend.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&firstHash, 0),
+				nil, nil))
+			spend.AddTxOut(firstCoinbase.TxOut[0])
+			txns = append(txns, spend)
+		}
+		block := pinutil.NewBlock(&wire.MsgBlock{
+			Header: wire.BlockHeader{
+				Version:   1,
+				PrevBlock: prev.BlockHash(),
+				Timestamp: prev.Header.Timestamp.Add(time.Minute),
+				Bits:      params.PowLimitBits,
+			},
+			Transactions: txns,
+		})
+		merkles := BuildMerkleTreeStore(block.Transactions(), false)
+		block.MsgBlock().Header.MerkleRoot = *merkles[len(merkles)-1]
+		_, _, err = chain.ProcessBlock(block, BFNoPoWCheck)
+		if err != nil {
+			t.Fatalf("ProcessBlock #%d: unexpected error: %v", height,
+				err)
+		}
+		prev = block.MsgBlock()
+	}
+
+	stats := chain.UtxoSetStats()
+	if stats.Height != numBlocks {
+		t.Fatalf("UtxoSetStats: got height %d, want %d", stats.Height,
+			numBlocks)
+	}
+	if stats.TotalAmount != wantAmount {
+		t.Fatalf("UtxoSetStats: got total amount %d, want issuance %d",
+			stats.TotalAmount, wantAmount)
+	}
+	if stats.NumTxns != numBlocks || stats.NumUtxos != numBlocks {
+		t.Fatalf("UtxoSetStats: got %d transactions with %d outputs, "+
+			"want %d of each", stats.NumTxns, stats.NumUtxos,
+			numBlocks)
+	}
+}
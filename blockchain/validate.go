@@ -9,6 +9,9 @@ import (
 	"fmt"
 	"math"
 	"math/big"
+	"runtime"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/nyodeco/pind/chaincfg"
@@ -298,14 +301,19 @@ func CheckTransactionSanity(tx *pinutil.Tx) error {
 	return nil
 }
 
+// powHashFunc returns the proof of work hash of a block header.  It allows the
+// caller to memoize the hashes since calculating them is expensive.
+type powHashFunc func(header *wire.BlockHeader) chainhash.Hash
+
 // checkProofOfWork ensures the block header bits which indicate the target
 // difficulty is in min/max range and that the block hash is less than the
-// target difficulty as claimed.
+// target difficulty as claimed.  The proof of work hash of the header is
+// obtained with the passed function.
 //
 // The flags modify the behavior of this function as follows:
 //  - BFNoPoWCheck: The check to ensure the block hash is less than the target
 //    difficulty is not performed.
-func checkProofOfWork(header *wire.BlockHeader, powLimit *big.Int, flags BehaviorFlags) error {
+func checkProofOfWork(header *wire.BlockHeader, powLimit *big.Int, powHash powHashFunc, flags BehaviorFlags) error {
 	// The target difficulty must be larger than zero.
 	target := CompactToBig(header.Bits)
 	if target.Sign() <= 0 {
@@ -325,7 +333,7 @@ func checkProofOfWork(header *wire.BlockHeader, powLimit *big.Int, flags Behavio
 	// to avoid proof of work checks is set.
 	if flags&BFNoPoWCheck != BFNoPoWCheck {
 		// The block hash must be less than the claimed target.
-		hash := header.PowHash()
+		hash := powHash(header)
 		hashNum := HashToBig(&hash)
 		if hashNum.Cmp(target) > 0 {
 			str := fmt.Sprintf("block hash of %064x is higher than "+
@@ -341,7 +349,80 @@ func checkProofOfWork(header *wire.BlockHeader, powLimit *big.Int, flags Behavio
 // difficulty is in min/max range and that the block hash is less than the
 // target difficulty as claimed.
 func CheckProofOfWork(block *pinutil.Block, powLimit *big.Int) error {
-	return checkProofOfWork(&block.MsgBlock().Header, powLimit, BFNone)
+	return checkProofOfWork(&block.MsgBlock().Header, powLimit,
+		(*wire.BlockHeader).PowHash, BFNone)
+}
+
+// CheckHeadersProofOfWork ensures the proof of work of each of the passed block
+// headers is valid as in CheckProofOfWork.  The headers are verified in
+// parallel and, when all of them are valid, their proof of work hashes are
+// memoized in the block index in place of those of the previous batch, so
+// processing them afterwards, such as with ProcessBlockHeader, doesn't need to
+// calculate the hashes again.  Headers which are already known are skipped.
+//
+// The verification stops as soon as an invalid header is found, so only the
+// error of one of the invalid headers is returned when there are several.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) CheckHeadersProofOfWork(headers []*wire.BlockHeader) error {
+	// Limit the number of goroutines to the number of processor cores
+	// since the work is purely CPU bound.
+	numWorkers := runtime.NumCPU()
+	if numWorkers > len(headers) {
+		numWorkers = len(headers)
+	}
+
+	// Each worker claims the next unverified header until all of them are
+	// verified or any of them is found to be invalid.
+	var next, failed int32
+	errs := make([]error, len(headers))
+	powHashes := make([]*chainhash.Hash, len(headers))
+	var wg sync.WaitGroup
+	wg.Add(numWorkers)
+	for i := 0; i < numWorkers; i++ {
+		go func() {
+			defer wg.Done()
+			for atomic.LoadInt32(&failed) == 0 {
+				idx := int(atomic.AddInt32(&next, 1) - 1)
+				if idx >= len(headers) {
+					return
+				}
+
+				header := headers[idx]
+				blockHash := header.BlockHash()
+				if b.index.LookupNode(&blockHash) != nil {
+					continue
+				}
+				powHash := header.PowHash()
+				err := checkProofOfWork(header, b.chainParams.PowLimit,
+					func(*wire.BlockHeader) chainhash.Hash {
+						return powHash
+					}, BFNone)
+				if err != nil {
+					errs[idx] = err
+					atomic.StoreInt32(&failed, 1)
+					continue
+				}
+				powHashes[idx] = &powHash
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	checked := make(map[chainhash.Hash]chainhash.Hash, len(headers))
+	for idx, powHash := range powHashes {
+		if powHash != nil {
+			checked[headers[idx].BlockHash()] = *powHash
+		}
+	}
+	b.index.setCheckedPowHashes(checked)
+	return nil
 }
 
 // CountSigOps returns the number of signature operations for all transaction
@@ -426,13 +507,14 @@ func CountP2SHSigOps(tx *pinutil.Tx, isCoinBaseTx bool, utxoView *UtxoViewpoint)
 // ensure it is sane before continuing with processing.  These checks are
 // context free.
 //
-// The flags do not modify the behavior of this function directly, however they
-// are needed to pass along to checkProofOfWork.
-func checkBlockHeaderSanity(header *wire.BlockHeader, powLimit *big.Int, timeSource MedianTimeSource, flags BehaviorFlags) error {
+// The flags and the proof of work hash function do not modify the behavior of
+// this function directly, however they are needed to pass along to
+// checkProofOfWork.
+func checkBlockHeaderSanity(header *wire.BlockHeader, powLimit *big.Int, timeSource MedianTimeSource, powHash powHashFunc, flags BehaviorFlags) error {
 	// Ensure the proof of work bits in the block header is in min/max range
 	// and the block hash is less than the target value described by the
 	// bits.
-	err := checkProofOfWork(header, powLimit, flags)
+	err := checkProofOfWork(header, powLimit, powHash, flags)
 	if err != nil {
 		return err
 	}
@@ -463,12 +545,13 @@ func checkBlockHeaderSanity(header *wire.BlockHeader, powLimit *big.Int, timeSou
 // checkBlockSanity performs some preliminary checks on a block to ensure it is
 // sane before continuing with block processing.  These checks are context free.
 //
-// The flags do not modify the behavior of this function directly, however they
-// are needed to pass along to checkBlockHeaderSanity.
-func checkBlockSanity(block *pinutil.Block, powLimit *big.Int, timeSource MedianTimeSource, flags BehaviorFlags) error {
+// The flags and the proof of work hash function do not modify the behavior of
+// this function directly, however they are needed to pass along to
+// checkBlockHeaderSanity.
+func checkBlockSanity(block *pinutil.Block, powLimit *big.Int, timeSource MedianTimeSource, powHash powHashFunc, flags BehaviorFlags) error {
 	msgBlock := block.MsgBlock()
 	header := &msgBlock.Header
-	err := checkBlockHeaderSanity(header, powLimit, timeSource, flags)
+	err := checkBlockHeaderSanity(header, powLimit, timeSource, powHash, flags)
 	if err != nil {
 		return err
 	}
@@ -573,7 +656,8 @@ func checkBlockSanity(block *pinutil.Block, powLimit *big.Int, timeSource Median
 // CheckBlockSanity performs some preliminary checks on a block to ensure it is
 // sane before continuing with block processing.  These checks are context free.
 func CheckBlockSanity(block *pinutil.Block, powLimit *big.Int, timeSource MedianTimeSource) error {
-	return checkBlockSanity(block, powLimit, timeSource, BFNone)
+	return checkBlockSanity(block, powLimit, timeSource,
+		(*wire.BlockHeader).PowHash, BFNone)
 }
 
 // ExtractCoinbaseHeight attempts to extract the height of the block from the
@@ -710,6 +794,30 @@ func (b *BlockChain) checkBlockHeaderContext(header *wire.BlockHeader, prevNode
 		return ruleError(ErrBlockVersionTooOld, str)
 	}
 
+	// Reject blocks which don't signal for a height based deployment
+	// during the period in which signalling for it is required per
+	// BIP0008.
+	for id := range params.Deployments {
+		state, err := b.deploymentState(prevNode, uint32(id))
+		if err != nil {
+			return err
+		}
+		if state != ThresholdMustSignal {
+			continue
+		}
+
+		bitNumber := params.Deployments[id].BitNumber
+		version := uint32(header.Version)
+		if version&vbTopMask != vbTopBits ||
+			version&(uint32(1)<<bitNumber) == 0 {
+
+			str := fmt.Sprintf("block version %#x does not signal "+
+				"for deployment bit %d which must be signalled "+
+				"for", header.Version, bitNumber)
+			return ruleError(ErrMissingDeploymentSignal, str)
+		}
+	}
+
 	return nil
 }
 
@@ -830,7 +938,7 @@ func (b *BlockChain) checkBlockContext(block *pinutil.Block, prevNode *blockNode
 // http://r6.ca/blog/20120206T005236Z.html.
 //
 // This function MUST be called with the chain state lock held (for reads).
-func (b *BlockChain) checkBIP0030(node *blockNode, block *pinutil.Block, view *UtxoViewpoint) error {
+func (b *BlockChain) checkBIP0030(node *blockNode, block *pinutil.Block, view *UtxoViewpoint, cache *utxoCache) error {
 	// Fetch utxos for all of the transaction ouputs in this block.
 	// Typically, there will not be any utxos for any of the outputs.
 	fetchSet := make(map[wire.OutPoint]struct{})
@@ -841,7 +949,7 @@ func (b *BlockChain) checkBIP0030(node *blockNode, block *pinutil.Block, view *U
 			fetchSet[prevOut] = struct{}{}
 		}
 	}
-	err := view.fetchUtxos(b.db, fetchSet)
+	err := view.fetchUtxos(cache, fetchSet)
 	if err != nil {
 		return err
 	}
@@ -985,8 +1093,11 @@ func CheckTransactionInputs(tx *pinutil.Tx, txHeight int32, utxoView *UtxoViewpo
 // connects to the end of the current main chain and then calls this function
 // with that node.
 //
+// The outputs which are not already in the view are loaded through the passed
+// utxo cache.
+//
 // This function MUST be called with the chain state lock held (for writes).
-func (b *BlockChain) checkConnectBlock(node *blockNode, block *pinutil.Block, view *UtxoViewpoint, stxos *[]SpentTxOut) error {
+func (b *BlockChain) checkConnectBlock(node *blockNode, block *pinutil.Block, view *UtxoViewpoint, cache *utxoCache, stxos *[]SpentTxOut) error {
 	// If the side chain blocks end up in the database, a call to
 	// CheckBlockSanity should be done here in case a previous version
 	// allowed a block that is no longer valid.  However, since the
@@ -1025,7 +1136,7 @@ func (b *BlockChain) checkConnectBlock(node *blockNode, block *pinutil.Block, vi
 	// BIP0030 check is expensive since it involves a ton of cache misses in
 	// the utxoset.
 	if !isBIP0030Node(node) && (node.height < b.chainParams.BIP0034Height) {
-		err := b.checkBIP0030(node, block, view)
+		err := b.checkBIP0030(node, block, view, cache)
 		if err != nil {
 			return err
 		}
@@ -1036,7 +1147,7 @@ func (b *BlockChain) checkConnectBlock(node *blockNode, block *pinutil.Block, vi
 	//
 	// These utxo entries are needed for verification of things such as
 	// transaction inputs, counting pay-to-script-hashes, and scripts.
-	err := view.fetchInputUtxos(b.db, block)
+	err := view.fetchInputUtxos(cache, block)
 	if err != nil {
 		return err
 	}
@@ -1153,6 +1264,13 @@ func (b *BlockChain) checkConnectBlock(node *blockNode, block *pinutil.Block, vi
 		runScripts = false
 	}
 
+	// Likewise, don't run scripts for ancestors of the assumed valid block
+	// once it is part of the best known header chain and has been buried
+	// deeply enough.
+	if runScripts && b.isAssumedValid(node) {
+		runScripts = false
+	}
+
 	// Blocks created after the BIP0016 activation time need to have the
 	// pay-to-script-hash checks enabled.
 	var scriptFlags txscript.ScriptFlags
@@ -1260,7 +1378,8 @@ func (b *BlockChain) CheckConnectBlockTemplate(block *pinutil.Block) error {
 		return ruleError(ErrPrevBlockNotBest, str)
 	}
 
-	err := checkBlockSanity(block, b.chainParams.PowLimit, b.timeSource, flags)
+	err := checkBlockSanity(block, b.chainParams.PowLimit, b.timeSource,
+		b.index.PowHash, flags)
 	if err != nil {
 		return err
 	}
@@ -1275,5 +1394,5 @@ func (b *BlockChain) CheckConnectBlockTemplate(block *pinutil.Block) error {
 	view := NewUtxoViewpoint()
 	view.SetBestHash(&tip.hash)
 	newNode := newBlockNode(&header, tip)
-	return b.checkConnectBlock(newNode, block, view, nil)
+	return b.checkConnectBlock(newNode, block, view, b.utxoCache, nil)
 }
@@ -169,6 +169,140 @@ func TestCheckBlockSanity(t *testing.T) {
 	}
 }
 
+// TestCheckHeadersProofOfWork ensures the proof of work of batches of headers
+// is verified and the proof of work hashes are memoized in the block index.
+func TestCheckHeadersProofOfWork(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	chain := newFakeChain(params)
+	target := CompactToBig(params.PowLimitBits)
+
+	// solveHeader returns a header whose proof of work is valid or, when
+	// valid is false, invalid for the regression test network limit.
+	solveHeader := func(nonce uint32, valid bool) *wire.BlockHeader {
+		header := &wire.BlockHeader{
+			Version:   1,
+			PrevBlock: params.GenesisBlock.BlockHash(),
+			Timestamp: params.GenesisBlock.Header.Timestamp,
+			Bits:      params.PowLimitBits,
+			Nonce:     nonce,
+		}
+		for {
+			powHash := header.PowHash()
+			if (HashToBig(&powHash).Cmp(target) <= 0) == valid {
+				return header
+			}
+			header.Nonce++
+		}
+	}
+
+	var headers []*wire.BlockHeader
+	for i := uint32(0); i < 20; i++ {
+		headers = append(headers, solveHeader(i*1000, true))
+	}
+	if err := chain.CheckHeadersProofOfWork(headers); err != nil {
+		t.Fatalf("CheckHeadersProofOfWork: unexpected error: %v", err)
+	}
+	for _, header := range headers {
+		blockHash := header.BlockHash()
+		powHash, ok := chain.index.checkedPowHashes[blockHash]
+		if !ok {
+			t.Fatalf("CheckHeadersProofOfWork: proof of work hash of "+
+				"%v not memoized", blockHash)
+		}
+		if powHash != header.PowHash() {
+			t.Fatalf("CheckHeadersProofOfWork: memoized proof of "+
+				"work hash of %v is %v, want %v", blockHash,
+				powHash, header.PowHash())
+		}
+	}
+
+	// A single header with an invalid proof of work fails the batch and
+	// nothing of it is memoized.
+	invalid := solveHeader(100000, false)
+	err := chain.CheckHeadersProofOfWork([]*wire.BlockHeader{
+		solveHeader(200000, true), invalid,
+	})
+	if rerr, ok := err.(RuleError); !ok || rerr.ErrorCode != ErrHighHash {
+		t.Fatalf("CheckHeadersProofOfWork: got error %v, want %v", err,
+			ErrHighHash)
+	}
+	if len(chain.index.checkedPowHashes) != len(headers) {
+		t.Fatalf("CheckHeadersProofOfWork: %d memoized proof of work "+
+			"hashes after invalid batch, want %d",
+			len(chain.index.checkedPowHashes), len(headers))
+	}
+
+	// The memoized hashes are replaced by the next valid batch.
+	next := solveHeader(300000, true)
+	err = chain.CheckHeadersProofOfWork([]*wire.BlockHeader{next})
+	if err != nil {
+		t.Fatalf("CheckHeadersProofOfWork: unexpected error: %v", err)
+	}
+	if len(chain.index.checkedPowHashes) != 1 {
+		t.Fatalf("CheckHeadersProofOfWork: %d memoized proof of work "+
+			"hashes, want 1", len(chain.index.checkedPowHashes))
+	}
+	if _, ok := chain.index.checkedPowHashes[next.BlockHash()]; !ok {
+		t.Fatalf("CheckHeadersProofOfWork: proof of work hash of %v "+
+			"not memoized", next.BlockHash())
+	}
+
+	// An empty batch is valid.
+	if err := chain.CheckHeadersProofOfWork(nil); err != nil {
+		t.Fatalf("CheckHeadersProofOfWork: unexpected error: %v", err)
+	}
+}
+
+// TestProcessBlockHeaderPowHash ensures the proof of work hash of a header
+// accepted ahead of its block data is kept on its block node.
+func TestProcessBlockHeaderPowHash(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	chain, teardownFunc, err := chainSetup("processblockheaderpowhash",
+		params)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	target := CompactToBig(params.PowLimitBits)
+	header := &wire.BlockHeader{
+		Version:   1,
+		PrevBlock: params.GenesisBlock.BlockHash(),
+		Timestamp: params.GenesisBlock.Header.Timestamp.Add(time.Second),
+		Bits:      params.PowLimitBits,
+	}
+	for {
+		powHash := header.PowHash()
+		if HashToBig(&powHash).Cmp(target) <= 0 {
+			break
+		}
+		header.Nonce++
+	}
+
+	if err := chain.ProcessBlockHeader(header, BFNone); err != nil {
+		t.Fatalf("ProcessBlockHeader: unexpected error: %v", err)
+	}
+	blockHash := header.BlockHash()
+	node := chain.index.LookupNode(&blockHash)
+	if node == nil {
+		t.Fatalf("ProcessBlockHeader: header %v not in block index",
+			blockHash)
+	}
+	if node.powHash == nil || *node.powHash != header.PowHash() {
+		t.Fatalf("ProcessBlockHeader: proof of work hash of %v is %v, "+
+			"want %v", blockHash, node.powHash, header.PowHash())
+	}
+	if powHash := chain.index.PowHash(header); powHash != header.PowHash() {
+		t.Fatalf("PowHash: got %v, want %v", powHash, header.PowHash())
+	}
+
+	chain.index.releasePowHash(node)
+	if node.powHash != nil {
+		t.Fatalf("releasePowHash: proof of work hash of %v not "+
+			"released", blockHash)
+	}
+}
+
 // TestCheckSerializedHeight tests the checkSerializedHeight function with
 // various serialized heights and also does negative tests to ensure errors
 // and handled properly.
@@ -65,6 +65,49 @@ func (c bitConditionChecker) EndTime() uint64 {
 	return math.MaxUint64
 }
 
+// BeginHeight returns the block height at which voting on a height based rule
+// change starts.
+//
+// Since this implementation checks for unknown rules, which are time based, it
+// returns 0.
+//
+// This is part of the thresholdConditionChecker interface implementation.
+func (c bitConditionChecker) BeginHeight() uint32 {
+	return 0
+}
+
+// EndHeight returns the block height at which an attempted height based rule
+// change times out.
+//
+// Since this implementation checks for unknown rules, it returns 0 so the rule
+// is treated as time based.
+//
+// This is part of the thresholdConditionChecker interface implementation.
+func (c bitConditionChecker) EndHeight() uint32 {
+	return 0
+}
+
+// LockInOnTimeout returns whether a height based rule change locks in rather
+// than fails once its timeout height is reached.
+//
+// Since this implementation checks for unknown rules, it returns false.
+//
+// This is part of the thresholdConditionChecker interface implementation.
+func (c bitConditionChecker) LockInOnTimeout() bool {
+	return false
+}
+
+// MinActivationHeight returns the minimum block height at which a locked in
+// rule change becomes active.
+//
+// Since this implementation checks for unknown rules, it returns 0 so the rule
+// activates in the window after it locked in.
+//
+// This is part of the thresholdConditionChecker interface implementation.
+func (c bitConditionChecker) MinActivationHeight() uint32 {
+	return 0
+}
+
 // RuleChangeActivationThreshold is the number of blocks for which the condition
 // must be true in order to lock in a rule change.
 //
@@ -146,6 +189,50 @@ func (c deploymentChecker) EndTime() uint64 {
 	return c.deployment.ExpireTime
 }
 
+// BeginHeight returns the block height at which voting on a height based rule
+// change starts.
+//
+// This implementation returns the value defined by the specific deployment the
+// checker is associated with.
+//
+// This is part of the thresholdConditionChecker interface implementation.
+func (c deploymentChecker) BeginHeight() uint32 {
+	return c.deployment.StartHeight
+}
+
+// EndHeight returns the block height at which an attempted height based rule
+// change times out.
+//
+// This implementation returns the value defined by the specific deployment the
+// checker is associated with.
+//
+// This is part of the thresholdConditionChecker interface implementation.
+func (c deploymentChecker) EndHeight() uint32 {
+	return c.deployment.TimeoutHeight
+}
+
+// LockInOnTimeout returns whether a height based rule change locks in rather
+// than fails once its timeout height is reached.
+//
+// This implementation returns the value defined by the specific deployment the
+// checker is associated with when it is height based.
+//
+// This is part of the thresholdConditionChecker interface implementation.
+func (c deploymentChecker) LockInOnTimeout() bool {
+	return c.deployment.TimeoutHeight != 0 && c.deployment.LockInOnTimeout
+}
+
+// MinActivationHeight returns the minimum block height at which a locked in
+// rule change becomes active.
+//
+// This implementation returns the value defined by the specific deployment the
+// checker is associated with.
+//
+// This is part of the thresholdConditionChecker interface implementation.
+func (c deploymentChecker) MinActivationHeight() uint32 {
+	return c.deployment.MinActivationHeight
+}
+
 // RuleChangeActivationThreshold is the number of blocks for which the condition
 // must be true in order to lock in a rule change.
 //
@@ -180,8 +267,8 @@ func (c deploymentChecker) Condition(node *blockNode) (bool, error) {
 }
 
 // calcNextBlockVersion calculates the expected version of the block after the
-// passed previous block node based on the state of started and locked in
-// rule change deployments.
+// passed previous block node based on the state of started, must signal and
+// locked in rule change deployments.
 //
 // This function differs from the exported CalcNextBlockVersion in that the
 // exported version uses the current best chain as the previous block node
@@ -190,8 +277,9 @@ func (c deploymentChecker) Condition(node *blockNode) (bool, error) {
 // This function MUST be called with the chain state lock held (for writes).
 func (b *BlockChain) calcNextBlockVersion(prevNode *blockNode) (int32, error) {
 	// Set the appropriate bits for each actively defined rule deployment
-	// that is either in the process of being voted on, or locked in for the
-	// activation at the next threshold window change.
+	// that is either in the process of being voted on, required to be
+	// signalled for, or locked in for the activation at the next threshold
+	// window change.
 	expectedVersion := uint32(vbTopBits)
 	for id := 0; id < len(b.chainParams.Deployments); id++ {
 		deployment := &b.chainParams.Deployments[id]
@@ -201,7 +289,8 @@ func (b *BlockChain) calcNextBlockVersion(prevNode *blockNode) (int32, error) {
 		if err != nil {
 			return 0, err
 		}
-		if state == ThresholdStarted || state == ThresholdLockedIn {
+		switch state {
+		case ThresholdStarted, ThresholdMustSignal, ThresholdLockedIn:
 			expectedVersion |= uint32(1) << deployment.BitNumber
 		}
 	}
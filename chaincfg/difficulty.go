@@ -0,0 +1,291 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package chaincfg
+
+import (
+	"errors"
+	"math/big"
+	"time"
+)
+
+// DifficultyBlock provides the information about a block of a chain which is
+// needed to calculate the difficulty of its descendants.
+type DifficultyBlock interface {
+	// Height returns the height of the block.
+	Height() int32
+
+	// Timestamp returns the timestamp of the block as a unix time.
+	Timestamp() int64
+
+	// Bits returns the difficulty target of the block in compact form.
+	Bits() uint32
+
+	// Target returns the difficulty target of the block.
+	Target() *big.Int
+
+	// Parent returns the parent of the block or nil for the genesis block.
+	Parent() DifficultyBlock
+}
+
+// DifficultyAlgorithm defines an algorithm which calculates the difficulty
+// target a block must meet based on the blocks before it.
+type DifficultyAlgorithm interface {
+	// NextTarget returns the difficulty target of the block after the
+	// passed last block which has the provided timestamp.  The caller
+	// limits the result to the proof of work limit of the network.
+	NextTarget(params *Params, lastBlock DifficultyBlock, newBlockTime time.Time) (*big.Int, error)
+}
+
+// DifficultyPeriod defines the difficulty algorithm used by a network from a
+// specific block height on.
+type DifficultyPeriod struct {
+	// Height is the height of the first block whose difficulty target is
+	// calculated with the algorithm.
+	Height int32
+
+	// Algorithm is the difficulty algorithm used for the blocks.
+	Algorithm DifficultyAlgorithm
+}
+
+// defaultDifficultyAlgorithm is the difficulty algorithm used by networks
+// which don't define a difficulty schedule.
+var defaultDifficultyAlgorithm = &RetargetDifficulty{Interval: 1}
+
+// DifficultyAlgorithm returns the difficulty algorithm used to calculate the
+// difficulty target of the block at the passed height.
+func (p *Params) DifficultyAlgorithm(height int32) DifficultyAlgorithm {
+	for i := len(p.DifficultySchedule) - 1; i >= 0; i-- {
+		if height >= p.DifficultySchedule[i].Height {
+			return p.DifficultySchedule[i].Algorithm
+		}
+	}
+	return defaultDifficultyAlgorithm
+}
+
+// ancestorAt returns the ancestor of the passed block the provided number of
+// blocks before it or nil when there is no such block.
+func ancestorAt(block DifficultyBlock, distance int32) DifficultyBlock {
+	for ; block != nil && distance > 0; distance-- {
+		block = block.Parent()
+	}
+	return block
+}
+
+// RetargetDifficulty is the bitcoin difficulty algorithm which scales the
+// target by the time it took to mine the blocks of the last target timespan.
+// The adjustment is limited by the retarget adjustment factors of the network.
+type RetargetDifficulty struct {
+	// Interval is the number of blocks between difficulty retargets.  The
+	// target is retargeted at every block when it is 1 and the target of
+	// the previous block is kept at all other blocks.
+	Interval int32
+}
+
+// Ensure RetargetDifficulty implements the DifficultyAlgorithm interface.
+var _ DifficultyAlgorithm = (*RetargetDifficulty)(nil)
+
+// findPrevTestNetBlock returns the previous block which did not have the
+// special testnet minimum difficulty rule applied.
+func findPrevTestNetBlock(params *Params, startBlock DifficultyBlock) DifficultyBlock {
+	// Search backwards through the chain for the last block without
+	// the special rule applied.
+	blocksPerRetarget := int32(params.TargetTimespan / params.TargetTimePerBlock)
+	block := startBlock
+	for block.Parent() != nil && block.Height()%blocksPerRetarget != 0 &&
+		block.Bits() == params.PowLimitBits {
+
+		block = block.Parent()
+	}
+	return block
+}
+
+// NextTarget returns the difficulty target of the block after the passed last
+// block which has the provided timestamp.
+//
+// This is part of the DifficultyAlgorithm interface implementation.
+func (r *RetargetDifficulty) NextTarget(params *Params, lastBlock DifficultyBlock, newBlockTime time.Time) (*big.Int, error) {
+	// Return the previous block's difficulty requirements if this block
+	// is not at a difficulty retarget interval.
+	if (lastBlock.Height()+1)%r.Interval != 0 {
+		// For networks that support it, allow special reduction of the
+		// required difficulty once too much time has elapsed without
+		// mining a block.
+		if params.ReduceMinDifficulty {
+			// Return minimum difficulty when more than the desired
+			// amount of time has elapsed without mining a block.
+			reductionTime := int64(params.MinDiffReductionTime /
+				time.Second)
+			allowMinTime := lastBlock.Timestamp() + reductionTime
+			if newBlockTime.Unix() > allowMinTime {
+				return params.PowLimit, nil
+			}
+
+			// The block was mined within the desired timeframe, so
+			// return the difficulty for the last block which did
+			// not have the special minimum difficulty rule applied.
+			return findPrevTestNetBlock(params, lastBlock).Target(), nil
+		}
+
+		// For the main network (or any unrecognized networks), simply
+		// return the previous block's difficulty requirements.
+		return lastBlock.Target(), nil
+	}
+
+	// Get the block at the previous retarget (target timespan worth of
+	// blocks).
+	blocksPerRetarget := int32(params.TargetTimespan / params.TargetTimePerBlock)
+	firstBlock := ancestorAt(lastBlock, blocksPerRetarget)
+	if firstBlock == nil {
+		return nil, errors.New("unable to obtain previous retarget block")
+	}
+
+	// Limit the amount of adjustment that can occur to the previous
+	// difficulty.
+	targetTimespan := int64(params.TargetTimespan / time.Second)
+	minTimespan := targetTimespan * (100 - params.RetargetAdjustmentFactorUp) / 100
+	maxTimespan := targetTimespan * (100 + params.RetargetAdjustmentFactorDown) / 100
+	actualTimespan := lastBlock.Timestamp() - firstBlock.Timestamp()
+	adjustedTimespan := actualTimespan
+	if actualTimespan < minTimespan {
+		adjustedTimespan = minTimespan
+	} else if actualTimespan > maxTimespan {
+		adjustedTimespan = maxTimespan
+	}
+
+	// Calculate new target difficulty as:
+	//  currentDifficulty * (adjustedTimespan / targetTimespan)
+	// The result uses integer division which means it will be slightly
+	// rounded down.  Bitcoind also uses integer division to calculate this
+	// result.
+	newTarget := new(big.Int).Mul(lastBlock.Target(),
+		big.NewInt(adjustedTimespan))
+	return newTarget.Div(newTarget, big.NewInt(targetTimespan)), nil
+}
+
+// DigiShieldDifficulty is the DigiShield v3 difficulty algorithm which
+// retargets at every block.  It scales the average target of a short window of
+// blocks by the time it took to mine them, dampened to a quarter of the
+// deviation from the target time and limited by the maximum adjustments.
+type DigiShieldDifficulty struct {
+	// AveragingWindow is the number of blocks whose targets are averaged.
+	AveragingWindow int32
+
+	// MaxAdjustUp and MaxAdjustDown are the maximum percentages by which
+	// the dampened timespan may be shorter or longer than the target
+	// timespan of the averaging window.
+	MaxAdjustUp   int64
+	MaxAdjustDown int64
+}
+
+// Ensure DigiShieldDifficulty implements the DifficultyAlgorithm interface.
+var _ DifficultyAlgorithm = (*DigiShieldDifficulty)(nil)
+
+// NextTarget returns the difficulty target of the block after the passed last
+// block which has the provided timestamp.
+//
+// This is part of the DifficultyAlgorithm interface implementation.
+func (d *DigiShieldDifficulty) NextTarget(params *Params, lastBlock DifficultyBlock, newBlockTime time.Time) (*big.Int, error) {
+	// Use the minimum difficulty until there are enough blocks to fill
+	// the averaging window.
+	firstBlock := ancestorAt(lastBlock, d.AveragingWindow)
+	if firstBlock == nil {
+		return params.PowLimit, nil
+	}
+
+	// Average the targets of the blocks in the window.
+	window := big.NewInt(int64(d.AveragingWindow))
+	avgTarget := new(big.Int)
+	for block := lastBlock; block != firstBlock; block = block.Parent() {
+		avgTarget.Add(avgTarget, block.Target())
+	}
+	avgTarget.Div(avgTarget, window)
+
+	// Dampen the deviation of the actual timespan of the window from the
+	// target timespan and limit it to the maximum adjustments.
+	windowTimespan := int64(params.TargetTimePerBlock/time.Second) *
+		int64(d.AveragingWindow)
+	actualTimespan := lastBlock.Timestamp() - firstBlock.Timestamp()
+	actualTimespan = windowTimespan + (actualTimespan-windowTimespan)/4
+	minTimespan := windowTimespan * (100 - d.MaxAdjustUp) / 100
+	maxTimespan := windowTimespan * (100 + d.MaxAdjustDown) / 100
+	if actualTimespan < minTimespan {
+		actualTimespan = minTimespan
+	} else if actualTimespan > maxTimespan {
+		actualTimespan = maxTimespan
+	}
+
+	// Calculate the new target as:
+	//  avgTarget * (actualTimespan / windowTimespan)
+	newTarget := avgTarget.Mul(avgTarget, big.NewInt(actualTimespan))
+	return newTarget.Div(newTarget, big.NewInt(windowTimespan)), nil
+}
+
+// LWMADifficulty is the linearly weighted moving average difficulty algorithm
+// which retargets at every block.  It scales the average target of a window of
+// blocks by their solve times, which are weighted linearly so that the most
+// recent blocks have the largest influence.
+type LWMADifficulty struct {
+	// AveragingWindow is the number of blocks whose targets and solve
+	// times are averaged.
+	AveragingWindow int32
+}
+
+// Ensure LWMADifficulty implements the DifficultyAlgorithm interface.
+var _ DifficultyAlgorithm = (*LWMADifficulty)(nil)
+
+// NextTarget returns the difficulty target of the block after the passed last
+// block which has the provided timestamp.
+//
+// This is part of the DifficultyAlgorithm interface implementation.
+func (l *LWMADifficulty) NextTarget(params *Params, lastBlock DifficultyBlock, newBlockTime time.Time) (*big.Int, error) {
+	// Use the minimum difficulty until there are enough blocks to fill
+	// the averaging window.
+	n := l.AveragingWindow
+	firstBlock := ancestorAt(lastBlock, n)
+	if firstBlock == nil {
+		return params.PowLimit, nil
+	}
+
+	// Collect the blocks of the window ordered from oldest to newest.
+	blocks := make([]DifficultyBlock, n)
+	for i, block := n-1, lastBlock; i >= 0; i, block = i-1, block.Parent() {
+		blocks[i] = block
+	}
+
+	// Sum the solve times of the blocks weighted by their position in the
+	// window as well as their targets.  Timestamps which are not after the
+	// previous one are treated as one second after it, and solve times are
+	// limited to six times the target time per block to prevent a single
+	// block from dropping the difficulty too much.
+	targetTimePerBlock := int64(params.TargetTimePerBlock / time.Second)
+	prevTimestamp := firstBlock.Timestamp()
+	var weightedSolveTimes int64
+	sumTargets := new(big.Int)
+	for i, block := range blocks {
+		timestamp := block.Timestamp()
+		if timestamp <= prevTimestamp {
+			timestamp = prevTimestamp + 1
+		}
+		solveTime := timestamp - prevTimestamp
+		if solveTime > 6*targetTimePerBlock {
+			solveTime = 6 * targetTimePerBlock
+		}
+		prevTimestamp = timestamp
+
+		weightedSolveTimes += solveTime * int64(i+1)
+		sumTargets.Add(sumTargets, block.Target())
+	}
+
+	// Limit the increase of the difficulty to a factor of ten.
+	k := int64(n) * int64(n+1) * targetTimePerBlock / 2
+	if weightedSolveTimes < k/10 {
+		weightedSolveTimes = k / 10
+	}
+
+	// Calculate the new target as:
+	//  (sumTargets / n) * (weightedSolveTimes / k)
+	newTarget := sumTargets.Mul(sumTargets, big.NewInt(weightedSolveTimes))
+	return newTarget.Div(newTarget, big.NewInt(int64(n)*k)), nil
+}
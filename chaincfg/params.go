@@ -52,6 +52,23 @@ type Checkpoint struct {
 	Hash   *chainhash.Hash
 }
 
+// AssumeUtxo identifies a known good snapshot of the utxo set as of a specific
+// block.  Such a snapshot can be loaded to start a node at that block, in which
+// case the blocks before it are validated in the background and the resulting
+// utxo set is compared against the snapshot.
+//
+// The snapshots are produced with the dumptxoutset RPC, and the hash is the
+// one it reports for the serialized utxo set.  The total number of
+// transactions up to the block is not covered by the hash, so it must match
+// the one reported as well.
+type AssumeUtxo struct {
+	Height       int32
+	BlockHash    *chainhash.Hash
+	TxOutSetHash *chainhash.Hash
+	NumUtxos     uint64
+	TotalTxns    uint64
+}
+
 // DNSSeed identifies a DNS seed.
 type DNSSeed struct {
 	// Host defines the hostname of the seed.
@@ -63,7 +80,10 @@ type DNSSeed struct {
 }
 
 // ConsensusDeployment defines details related to a specific consensus rule
-// change that is voted in.  This is part of BIP0009.
+// change that is voted in.  This is part of BIP0009 and BIP0008.
+//
+// A deployment is time based per BIP0009 unless TimeoutHeight is set, in which
+// case it is height based per BIP0008 and StartTime and ExpireTime are ignored.
 type ConsensusDeployment struct {
 	// BitNumber defines the specific bit number within the block version
 	// this particular soft-fork deployment refers to.
@@ -76,6 +96,26 @@ type ConsensusDeployment struct {
 	// ExpireTime is the median block time after which the attempted
 	// deployment expires.
 	ExpireTime uint64
+
+	// StartHeight is the block height at which voting on a height based
+	// deployment starts.  It must be a multiple of the miner confirmation
+	// window.
+	StartHeight uint32
+
+	// TimeoutHeight is the block height at which the attempted height based
+	// deployment times out.  It must be a multiple of the miner
+	// confirmation window.  A zero value marks a time based deployment.
+	TimeoutHeight uint32
+
+	// LockInOnTimeout makes a height based deployment require signalling
+	// during the last window before the timeout height and lock in
+	// afterwards instead of failing.
+	LockInOnTimeout bool
+
+	// MinActivationHeight is the minimum block height at which a locked in
+	// deployment becomes active.  The deployment stays locked in until
+	// then.  This is part of the Speedy Trial activation method.
+	MinActivationHeight uint32
 }
 
 // Constants that define the deployment offset in the deployments field of the
@@ -183,9 +223,34 @@ type Params struct {
 	// PowNoRetargeting specifies whether the block retargeting calculation is performed.
 	PowNoRetargeting bool
 
+	// DifficultySchedule defines the difficulty algorithms used by the
+	// network ordered by the height from which they apply.  The bitcoin
+	// retarget algorithm retargeting at every block is used before the
+	// first entry and when the schedule is empty.
+	DifficultySchedule []DifficultyPeriod
+
 	// Checkpoints ordered from oldest to newest.
 	Checkpoints []Checkpoint
 
+	// AssumeValid is the hash of a block for which the scripts of all of
+	// its ancestors are assumed to be valid once it is part of the best
+	// known header chain with sufficient work built on top of it.
+	//
+	// A nil value means the scripts of all blocks are verified.
+	AssumeValid *chainhash.Hash
+
+	// AssumeUtxo holds the utxo set snapshots which can be loaded with
+	// BlockChain.LoadUtxoSnapshot.
+	AssumeUtxo []AssumeUtxo
+
+	// MinimumChainWork is the least amount of work the best chain is known
+	// to have.  The headers of a peer are only stored once its chain has
+	// been verified to reach it, which prevents peers from making a node
+	// store long chains of low-work headers.
+	//
+	// A nil value disables the verification.
+	MinimumChainWork *big.Int
+
 	// These fields are related to voting on consensus rule changes as
 	// defined by BIP0009.
 	//
@@ -254,6 +319,11 @@ var MainNetParams = Params{
 	GenerateSupported:        false,
 	PowNoRetargeting:         false,
 
+	// Difficulty algorithms ordered by activation height.
+	DifficultySchedule: []DifficultyPeriod{
+		{0, &RetargetDifficulty{Interval: 1}},
+	},
+
 	// Checkpoints ordered from oldest to newest.
 	Checkpoints: []Checkpoint{
 		{8002, newHashFromStr("73bc3b16d99bbf797f396c9532f80c3b73bb21304280de2efbc5edcb75739234")},
@@ -280,6 +350,28 @@ var MainNetParams = Params{
 		{2532181, newHashFromStr("cacd5149aaed1088ae1db997a741210b0525e941356104120f182f3159931c79")},
 	},
 
+	// No block after the latest checkpoint has been pinned yet, so the
+	// scripts of all blocks after it are verified.  This is intended to be
+	// set to a block which is buried deeply in the main chain as part of
+	// each release.
+	AssumeValid: nil,
+
+	// There are no known utxo set snapshots yet.
+	AssumeUtxo: nil,
+
+	// The least work a valid chain up to the final checkpoint can have,
+	// since no block can have less work than a block at the proof of work
+	// limit.  That is 2532182 blocks with 2^20 work each.
+	//
+	// NOTE: This is only a lower bound on the actual work of the main
+	// chain, so it merely keeps peers from making a node store a chain of
+	// low-work headers which does not even reach the final checkpoint.  It is
+	// intended to be replaced with the chainwork reported by the
+	// getblockchaininfo RPC of a synced node for a block which is buried
+	// deeply in the main chain as part of each release.  Until then, the
+	// minimumchainwork option can be used to raise it.
+	MinimumChainWork: hexToBig("26a35600000"),
+
 
 	// Consensus rule change deployments.
 	//
@@ -359,6 +451,15 @@ var RegressionNetParams = Params{
 	// Checkpoints ordered from oldest to newest.
 	Checkpoints: nil,
 
+	// Verify the scripts of all blocks.
+	AssumeValid: nil,
+
+	// There are no known utxo set snapshots.
+	AssumeUtxo: nil,
+
+	// Headers are stored without verifying the chain work.
+	MinimumChainWork: nil,
+
 	// Consensus rule change deployments.
 	//
 	// The miner confirmation window is defined as:
@@ -432,12 +533,39 @@ var TestNet3Params = Params{
 	GenerateSupported:            false,
 	PowNoRetargeting:             false,
 
+	// Difficulty algorithms ordered by activation height.
+	DifficultySchedule: []DifficultyPeriod{
+		{0, &RetargetDifficulty{Interval: 1}},
+	},
+
 	// Checkpoints ordered from oldest to newest.
 	Checkpoints: []Checkpoint{
 		{2056, newHashFromStr("d3334db071731beaa651f10624c2fea1a5e8c6f9e50f0e602f86262938374148")},
 		{230000, newHashFromStr("c2e6451240a580c3bfa5ddbfad1b001f8655e7c51d5c32c123e16f69c2d2b539")},
 	},
 
+	// No block after the latest checkpoint has been pinned yet, so the
+	// scripts of all blocks after it are verified.  This is intended to be
+	// set to a block which is buried deeply in the test chain as part of
+	// each release.
+	AssumeValid: nil,
+
+	// There are no known utxo set snapshots yet.
+	AssumeUtxo: nil,
+
+	// The least work a valid chain up to the final checkpoint can have,
+	// since no block can have less work than a block at the proof of work
+	// limit.  That is 230001 blocks with 2^20 work each.
+	//
+	// NOTE: This is only a lower bound on the actual work of the test
+	// chain, so it merely keeps peers from making a node store a chain of
+	// low-work headers which does not even reach the final checkpoint.  It is
+	// intended to be replaced with the chainwork reported by the
+	// getblockchaininfo RPC of a synced node for a block which is buried
+	// deeply in the test chain as part of each release.  Until then, the
+	// minimumchainwork option can be used to raise it.
+	MinimumChainWork: hexToBig("3827100000"),
+
 	// Consensus rule change deployments.
 	//
 	// The miner confirmation window is defined as:
@@ -520,6 +648,15 @@ var SimNetParams = Params{
 	// Checkpoints ordered from oldest to newest.
 	Checkpoints: nil,
 
+	// Verify the scripts of all blocks.
+	AssumeValid: nil,
+
+	// There are no known utxo set snapshots.
+	AssumeUtxo: nil,
+
+	// Headers are stored without verifying the chain work.
+	MinimumChainWork: nil,
+
 	// Consensus rule change deployments.
 	//
 	// The miner confirmation window is defined as:
@@ -723,6 +860,18 @@ func newHashFromStr(hexStr string) *chainhash.Hash {
 	return hash
 }
 
+// hexToBig converts the passed hex string into a big integer and will panic
+// if there is an error.  This is only provided for the hard-coded constants so
+// errors in the source code can be detected. It will only (and must only) be
+// called with hard-coded values.
+func hexToBig(hexStr string) *big.Int {
+	n, ok := new(big.Int).SetString(hexStr, 16)
+	if !ok {
+		panic("invalid hex in source file: " + hexStr)
+	}
+	return n
+}
+
 func init() {
 	// Register all default networks when the package is initialized.
 	mustRegister(&MainNetParams)
@@ -84,3 +84,29 @@ func TestInvalidHDKeyID(t *testing.T) {
 		t.Fatalf("HDPrivateKeyToPublicKeyID: want err ErrUnknownHDKeyID, got %v", err)
 	}
 }
+
+// TestDeploymentHeights ensures the heights of the height based deployments of
+// the registered networks are multiples of their miner confirmation window.
+func TestDeploymentHeights(t *testing.T) {
+	t.Parallel()
+
+	for _, params := range []*Params{&MainNetParams, &TestNet3Params,
+		&RegressionNetParams, &SimNetParams} {
+
+		window := params.MinerConfirmationWindow
+		for i, deployment := range params.Deployments {
+			if deployment.TimeoutHeight == 0 {
+				continue
+			}
+			if deployment.StartHeight%window != 0 ||
+				deployment.TimeoutHeight%window != 0 {
+
+				t.Errorf("%s: deployment %d heights %d and %d are "+
+					"not multiples of the miner confirmation "+
+					"window %d", params.Name, i,
+					deployment.StartHeight,
+					deployment.TimeoutHeight, window)
+			}
+		}
+	}
+}
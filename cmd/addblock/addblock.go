@@ -5,6 +5,7 @@
 package main
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 
@@ -83,17 +84,31 @@ func realMain() error {
 	}
 	defer db.Close()
 
-	fi, err := os.Open(cfg.InFile)
-	if err != nil {
-		log.Errorf("Failed to open file %v: %v", cfg.InFile, err)
-		return err
+	// Import from all of the block files in the input directory when one
+	// is specified, recording where a later import should resume from in
+	// the data directory.  Otherwise, import from the single input file.
+	files := []string{cfg.InFile}
+	var resumePath string
+	if cfg.InDir != "" {
+		files, err = filepath.Glob(filepath.Join(cfg.InDir, "blk*.dat"))
+		if err != nil {
+			log.Errorf("Failed to list block files in %v: %v",
+				cfg.InDir, err)
+			return err
+		}
+		if len(files) == 0 {
+			err := fmt.Errorf("no blk*.dat files found in %v",
+				cfg.InDir)
+			log.Error(err)
+			return err
+		}
+		resumePath = filepath.Join(cfg.DataDir, resumeFileName)
 	}
-	defer fi.Close()
 
-	// Create a block importer for the database and input file and start it.
-	// The done channel returned from start will contain an error if
+	// Create a block importer for the database and input files and start
+	// it.  The done channel returned from start will contain an error if
 	// anything went wrong.
-	importer, err := newBlockImporter(db, fi)
+	importer, err := newBlockImporter(db, files, resumePath)
 	if err != nil {
 		log.Errorf("Failed create block importer: %v", err)
 		return err
@@ -113,7 +128,12 @@ func realMain() error {
 
 	log.Infof("Processed a total of %d blocks (%d imported, %d already "+
 		"known)", results.blocksProcessed, results.blocksImported,
-		results.blocksProcessed-results.blocksImported)
+		results.blocksProcessed-results.blocksImported-
+			results.blocksOrphaned)
+	if results.blocksOrphaned > 0 {
+		log.Warnf("%d blocks were not imported since their parents "+
+			"were not found", results.blocksOrphaned)
+	}
 	return nil
 }
 
@@ -38,6 +38,7 @@ type config struct {
 	DataDir        string `short:"b" long:"datadir" description:"Location of the pind data directory"`
 	DbType         string `long:"dbtype" description:"Database backend to use for the Block Chain"`
 	InFile         string `short:"i" long:"infile" description:"File containing the block(s)"`
+	InDir          string `short:"d" long:"indir" description:"Directory containing blk*.dat files with the block(s) in any order, such as the blocks directory of Bitcoin Core -- Overrides --infile"`
 	Progress       int    `short:"p" long:"progress" description:"Show a progress message each time this number of seconds have passed -- Use 0 to disable progress announcements"`
 	RegressionTest bool   `long:"regtest" description:"Use the regression test network"`
 	SimNet         bool   `long:"simnet" description:"Use the simulation test network"`
@@ -148,8 +149,24 @@ func loadConfig() (*config, []string, error) {
 	// worry about changing names per network and such.
 	cfg.DataDir = filepath.Join(cfg.DataDir, netName(activeNetParams))
 
-	// Ensure the specified block file exists.
-	if !fileExists(cfg.InFile) {
+	// Ensure the specified block directory or file exists.
+	if cfg.InDir != "" {
+		if !fileExists(cfg.InDir) {
+			str := "%s: The specified block directory [%v] does " +
+				"not exist"
+			err := fmt.Errorf(str, "loadConfig", cfg.InDir)
+			fmt.Fprintln(os.Stderr, err)
+			parser.WriteHelp(os.Stderr)
+			return nil, nil, err
+		}
+
+		// Use the absolute path so a later import of the directory
+		// resumes regardless of the working directory.
+		cfg.InDir, err = filepath.Abs(cfg.InDir)
+		if err != nil {
+			return nil, nil, err
+		}
+	} else if !fileExists(cfg.InFile) {
 		str := "%s: The specified block file [%v] does not exist"
 		err := fmt.Errorf(str, "loadConfig", cfg.InFile)
 		fmt.Fprintln(os.Stderr, err)
@@ -5,9 +5,15 @@
 package main
 
 import (
+	"bufio"
+	"compress/gzip"
 	"encoding/binary"
+	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"sync"
 	"time"
 
@@ -21,34 +27,72 @@ import (
 
 var zeroHash = chainhash.Hash{}
 
+// resumeFileName is the name of the file in the data directory which records
+// where an import from a directory of block files should resume.
+const resumeFileName = "addblock_resume.json"
+
+// maxOrphanBlocks is the default maximum number of blocks which are held in
+// memory while waiting for their parent.  Block files written by Bitcoin Core
+// are only out of order by the blocks downloaded in parallel, so this is far
+// more than needed in practice.
+const maxOrphanBlocks = 5000
+
 // importResults houses the stats and result as an import operation.
 type importResults struct {
 	blocksProcessed int64
 	blocksImported  int64
+	blocksOrphaned  int64
 	err             error
 }
 
-// blockImporter houses information about an ongoing import from a block data
-// file to the block database.
+// fileBlock is a serialized block along with the index of the block file it
+// was read from.
+type fileBlock struct {
+	serialized []byte
+	fileIdx    int
+}
+
+// orphanBlock is a block that was read before its parent and is held until
+// the parent has been processed.
+type orphanBlock struct {
+	block   *pinutil.Block
+	fileIdx int
+}
+
+// resumeState is the state saved to the resume file in the data directory.
+// It records the block file an import from the directory should start from
+// so that the files which were fully processed are not read again.
+type resumeState struct {
+	Dir  string `json:"dir"`
+	File string `json:"file"`
+}
+
+// blockImporter houses information about an ongoing import from block data
+// files to the block database.
 type blockImporter struct {
 	db                database.DB
 	chain             *blockchain.BlockChain
-	r                 io.ReadSeeker
-	processQueue      chan []byte
+	files             []string
+	resumePath        string
+	r                 io.Reader
+	processQueue      chan *fileBlock
 	doneChan          chan bool
 	errChan           chan error
 	quit              chan struct{}
 	wg                sync.WaitGroup
+	orphans           map[chainhash.Hash][]*orphanBlock
+	numOrphans        int64
+	maxOrphans        int64
+	curFileIdx        int
 	blocksProcessed   int64
 	blocksImported    int64
 	receivedLogBlocks int64
 	receivedLogTx     int64
-	lastHeight        int64
 	lastBlockTime     time.Time
 	lastLogTime       time.Time
 }
 
-// readBlock reads the next block from the input file.
+// readBlock reads the next block from the current input file.
 func (bi *blockImporter) readBlock() ([]byte, error) {
 	// The block file format is:
 	//  <network> <block length> <serialized block>
@@ -62,6 +106,12 @@ func (bi *blockImporter) readBlock() ([]byte, error) {
 		// No block and no error means there are no more blocks to read.
 		return nil, nil
 	}
+
+	// Block files written by Bitcoin Core are preallocated in chunks, so
+	// zeroed space after the last block marks the end of the file.
+	if net == 0 {
+		return nil, nil
+	}
 	if net != uint32(activeNetParams.Net) {
 		return nil, fmt.Errorf("network mismatch -- got %x, want %x",
 			net, uint32(activeNetParams.Net))
@@ -88,90 +138,244 @@ func (bi *blockImporter) readBlock() ([]byte, error) {
 
 // processBlock potentially imports the block into the database.  It first
 // deserializes the raw block while checking for errors.  Already known blocks
-// are skipped and orphan blocks are considered errors.  Finally, it runs the
-// block through the chain rules to ensure it follows all rules and matches
-// up to the known checkpoint.  Returns whether the block was imported along
+// are skipped and blocks whose parent is not known yet are held until it is
+// processed, up to a maximum of maxOrphans blocks.  Finally, it runs the block through the chain rules to ensure it
+// follows all rules and matches up to the known checkpoints, and processes any
+// held blocks which build on it.  Returns the number of blocks imported along
 // with any potential errors.
-func (bi *blockImporter) processBlock(serializedBlock []byte) (bool, error) {
+func (bi *blockImporter) processBlock(fb *fileBlock) (int64, error) {
 	// Deserialize the block which includes checks for malformed blocks.
-	block, err := pinutil.NewBlockFromBytes(serializedBlock)
+	block, err := pinutil.NewBlockFromBytes(fb.serialized)
 	if err != nil {
-		return false, err
+		return 0, err
 	}
 
 	// update progress statistics
 	bi.lastBlockTime = block.MsgBlock().Header.Timestamp
 	bi.receivedLogTx += int64(len(block.MsgBlock().Transactions))
 
-	// Skip blocks that already exist.
+	// Skip blocks that already exist.  Their descendants might still have
+	// been held by a previous pass though.
 	blockHash := block.Hash()
 	exists, err := bi.chain.HaveBlock(blockHash)
 	if err != nil {
-		return false, err
+		return 0, err
 	}
 	if exists {
-		return false, nil
+		return bi.processOrphans(blockHash)
 	}
 
-	// Don't bother trying to process orphans.
-	prevHash := &block.MsgBlock().Header.PrevBlock
-	if !prevHash.IsEqual(&zeroHash) {
-		exists, err := bi.chain.HaveBlock(prevHash)
+	// Hold blocks whose parent has not been seen yet since block files are
+	// not required to contain the blocks in order.
+	prevHash := block.MsgBlock().Header.PrevBlock
+	if prevHash != zeroHash {
+		exists, err := bi.chain.HaveBlock(&prevHash)
 		if err != nil {
-			return false, err
+			return 0, err
 		}
 		if !exists {
-			return false, fmt.Errorf("import file contains block "+
-				"%v which does not link to the available "+
-				"block chain", prevHash)
+			if bi.numOrphans >= bi.maxOrphans {
+				return 0, fmt.Errorf("too many blocks (%d) are "+
+					"held waiting for their parent -- the "+
+					"block files are either missing blocks "+
+					"or too far out of order", bi.numOrphans)
+			}
+			bi.orphans[prevHash] = append(bi.orphans[prevHash],
+				&orphanBlock{block: block, fileIdx: fb.fileIdx})
+			bi.numOrphans++
+			return 0, nil
 		}
 	}
 
-	// Ensure the blocks follows all of the chain rules and match up to the
-	// known checkpoints.
+	if err := bi.connectBlock(block); err != nil {
+		return 0, err
+	}
+	imported, err := bi.processOrphans(blockHash)
+	return imported + 1, err
+}
+
+// connectBlock ensures the block follows all of the chain rules and matches up
+// to the known checkpoints before adding it to the block chain.  Its parent
+// must already be known.
+func (bi *blockImporter) connectBlock(block *pinutil.Block) error {
 	isMainChain, isOrphan, err := bi.chain.ProcessBlock(block,
 		blockchain.BFFastAdd)
 	if err != nil {
-		return false, err
+		return err
+	}
+	if isOrphan {
+		return fmt.Errorf("import file contains an orphan "+
+			"block: %v", block.Hash())
 	}
 	if !isMainChain {
-		return false, fmt.Errorf("import file contains an block that "+
-			"does not extend the main chain: %v", blockHash)
+		log.Debugf("Imported block %v which does not extend the main "+
+			"chain", block.Hash())
 	}
-	if isOrphan {
-		return false, fmt.Errorf("import file contains an orphan "+
-			"block: %v", blockHash)
+
+	return nil
+}
+
+// processOrphans connects all of the held blocks which build on the block with
+// the passed hash, and repeats for those blocks until there are no more.  It
+// returns the number of blocks imported.
+func (bi *blockImporter) processOrphans(hash *chainhash.Hash) (int64, error) {
+	var imported int64
+	processHashes := []chainhash.Hash{*hash}
+	for len(processHashes) > 0 {
+		processHash := processHashes[0]
+		processHashes = processHashes[1:]
+
+		children := bi.orphans[processHash]
+		delete(bi.orphans, processHash)
+		for _, orphan := range children {
+			bi.numOrphans--
+
+			// The same block might be contained in several files.
+			exists, err := bi.chain.HaveBlock(orphan.block.Hash())
+			if err != nil {
+				return imported, err
+			}
+			if !exists {
+				if err := bi.connectBlock(orphan.block); err != nil {
+					return imported, err
+				}
+				imported++
+			}
+			processHashes = append(processHashes, *orphan.block.Hash())
+		}
 	}
 
-	return true, nil
+	return imported, nil
 }
 
-// readHandler is the main handler for reading blocks from the import file.
-// This allows block processing to take place in parallel with block reads.
-// It must be run as a goroutine.
-func (bi *blockImporter) readHandler() {
-out:
+// resumeFileIdx returns the index of the block file a later import should
+// start from when the passed file is the one currently being read.  That is
+// the passed file itself, or the earliest file containing a held block since
+// those blocks would otherwise be lost.
+func (bi *blockImporter) resumeFileIdx(fileIdx int) int {
+	for _, children := range bi.orphans {
+		for _, orphan := range children {
+			if orphan.fileIdx < fileIdx {
+				fileIdx = orphan.fileIdx
+			}
+		}
+	}
+	return fileIdx
+}
+
+// saveResumeState records the block file a later import of the same directory
+// should start from.  It does nothing when not importing from a directory.
+func (bi *blockImporter) saveResumeState(fileIdx int) error {
+	if bi.resumePath == "" {
+		return nil
+	}
+
+	file := bi.files[bi.resumeFileIdx(fileIdx)]
+	state := resumeState{
+		Dir:  filepath.Dir(file),
+		File: filepath.Base(file),
+	}
+	serialized, err := json.Marshal(&state)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(bi.resumePath, serialized, 0600)
+}
+
+// loadResumeFileIdx returns the index of the block file an import of the
+// passed files should start from according to the resume file at the passed
+// path.  The first file is used when there is no resume file or it refers to
+// another directory.
+func loadResumeFileIdx(resumePath string, files []string) (int, error) {
+	serialized, err := ioutil.ReadFile(resumePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	var state resumeState
+	if err := json.Unmarshal(serialized, &state); err != nil {
+		return 0, fmt.Errorf("malformed resume file %s: %v",
+			resumePath, err)
+	}
+	for i, file := range files {
+		if filepath.Dir(file) == state.Dir &&
+			filepath.Base(file) == state.File {
+
+			return i, nil
+		}
+	}
+
+	return 0, nil
+}
+
+// readFile reads all of the blocks from the block file with the passed index
+// and sends them to the process handler.  It returns false when the process
+// handler signalled to exit.
+func (bi *blockImporter) readFile(fileIdx int) (bool, error) {
+	f, err := os.Open(bi.files[fileIdx])
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	// Transparently decompress files which were compressed with gzip, such
+	// as those written by the exportblocks command of dbtool.
+	br := bufio.NewReader(f)
+	bi.r = br
+	magic, err := br.Peek(2)
+	if err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return false, err
+		}
+		defer zr.Close()
+		bi.r = zr
+	}
+
+	log.Infof("Reading blocks from %s (file %d of %d)", bi.files[fileIdx],
+		fileIdx+1, len(bi.files))
+
 	for {
-		// Read the next block from the file and if anything goes wrong
-		// notify the status handler with the error and bail.
+		// Read the next block from the file and bail if anything goes
+		// wrong.
 		serializedBlock, err := bi.readBlock()
 		if err != nil {
-			bi.errChan <- fmt.Errorf("Error reading from input "+
-				"file: %v", err.Error())
-			break out
+			return false, err
 		}
 
-		// A nil block with no error means we're done.
+		// A nil block with no error means we're done with the file.
 		if serializedBlock == nil {
-			break out
+			return true, nil
 		}
 
 		// Send the block or quit if we've been signalled to exit by
 		// the status handler due to an error elsewhere.
 		select {
-		case bi.processQueue <- serializedBlock:
+		case bi.processQueue <- &fileBlock{serializedBlock, fileIdx}:
 		case <-bi.quit:
-			break out
+			return false, nil
+		}
+	}
+}
+
+// readHandler is the main handler for reading blocks from the import files.
+// This allows block processing to take place in parallel with block reads.
+// It must be run as a goroutine.
+func (bi *blockImporter) readHandler() {
+	for fileIdx := bi.curFileIdx; fileIdx < len(bi.files); fileIdx++ {
+		// Read the blocks from the file and if anything goes wrong
+		// notify the status handler with the error and bail.
+		more, err := bi.readFile(fileIdx)
+		if err != nil {
+			bi.errChan <- fmt.Errorf("Error reading from input "+
+				"file %s: %v", bi.files[fileIdx], err.Error())
+			break
+		}
+		if !more {
+			break
 		}
 	}
 
@@ -205,9 +409,10 @@ func (bi *blockImporter) logProgress() {
 	if bi.receivedLogTx == 1 {
 		txStr = "transaction"
 	}
-	log.Infof("Processed %d %s in the last %s (%d %s, height %d, %s)",
-		bi.receivedLogBlocks, blockStr, tDuration, bi.receivedLogTx,
-		txStr, bi.lastHeight, bi.lastBlockTime)
+	log.Infof("Processed %d %s in the last %s (%d %s, height %d, %s, "+
+		"%d held)", bi.receivedLogBlocks, blockStr, tDuration,
+		bi.receivedLogTx, txStr, bi.chain.BestSnapshot().Height,
+		bi.lastBlockTime, bi.numOrphans)
 
 	bi.receivedLogBlocks = 0
 	bi.receivedLogTx = 0
@@ -221,24 +426,36 @@ func (bi *blockImporter) processHandler() {
 out:
 	for {
 		select {
-		case serializedBlock, ok := <-bi.processQueue:
-			// We're done when the channel is closed.
+		case fb, ok := <-bi.processQueue:
+			// We're done when the channel is closed.  Record where a
+			// later import should resume from, which is the last file
+			// since more blocks might be appended to it.
 			if !ok {
+				err := bi.saveResumeState(len(bi.files) - 1)
+				if err != nil {
+					bi.errChan <- err
+				}
 				break out
 			}
 
+			// Record where a later import should resume from each
+			// time a new file is started.
+			if fb.fileIdx != bi.curFileIdx {
+				bi.curFileIdx = fb.fileIdx
+				if err := bi.saveResumeState(fb.fileIdx); err != nil {
+					bi.errChan <- err
+					break out
+				}
+			}
+
 			bi.blocksProcessed++
-			bi.lastHeight++
-			imported, err := bi.processBlock(serializedBlock)
+			imported, err := bi.processBlock(fb)
+			bi.blocksImported += imported
 			if err != nil {
 				bi.errChan <- err
 				break out
 			}
 
-			if imported {
-				bi.blocksImported++
-			}
-
 			bi.logProgress()
 
 		case <-bi.quit:
@@ -259,6 +476,7 @@ func (bi *blockImporter) statusHandler(resultsChan chan *importResults) {
 		resultsChan <- &importResults{
 			blocksProcessed: bi.blocksProcessed,
 			blocksImported:  bi.blocksImported,
+			blocksOrphaned:  bi.numOrphans,
 			err:             err,
 		}
 		close(bi.quit)
@@ -268,12 +486,13 @@ func (bi *blockImporter) statusHandler(resultsChan chan *importResults) {
 		resultsChan <- &importResults{
 			blocksProcessed: bi.blocksProcessed,
 			blocksImported:  bi.blocksImported,
+			blocksOrphaned:  bi.numOrphans,
 			err:             nil,
 		}
 	}
 }
 
-// Import is the core function which handles importing the blocks from the file
+// Import is the core function which handles importing the blocks from the files
 // associated with the block importer to the database.  It returns a channel
 // on which the results will be returned when the operation has completed.
 func (bi *blockImporter) Import() chan *importResults {
@@ -297,9 +516,11 @@ func (bi *blockImporter) Import() chan *importResults {
 	return resultChan
 }
 
-// newBlockImporter returns a new importer for the provided file reader seeker
-// and database.
-func newBlockImporter(db database.DB, r io.ReadSeeker) (*blockImporter, error) {
+// newBlockImporter returns a new importer for the provided block files and
+// database.  When the resume path is not empty, the import starts from the file
+// recorded in it by a previous import and the file to resume from is recorded
+// in it as the import progresses.
+func newBlockImporter(db database.DB, files []string, resumePath string) (*blockImporter, error) {
 	// Create the transaction and address indexes if needed.
 	//
 	// CAUTION: the txindex needs to be first in the indexes array because
@@ -340,13 +561,28 @@ func newBlockImporter(db database.DB, r io.ReadSeeker) (*blockImporter, error) {
 		return nil, err
 	}
 
+	var startFileIdx int
+	if resumePath != "" {
+		startFileIdx, err = loadResumeFileIdx(resumePath, files)
+		if err != nil {
+			return nil, err
+		}
+		if startFileIdx > 0 {
+			log.Infof("Resuming import from %s", files[startFileIdx])
+		}
+	}
+
 	return &blockImporter{
 		db:           db,
-		r:            r,
-		processQueue: make(chan []byte, 2),
+		files:        files,
+		resumePath:   resumePath,
+		processQueue: make(chan *fileBlock, 2),
 		doneChan:     make(chan bool),
 		errChan:      make(chan error),
 		quit:         make(chan struct{}),
+		orphans:      make(map[chainhash.Hash][]*orphanBlock),
+		maxOrphans:   maxOrphanBlocks,
+		curFileIdx:   startFileIdx,
 		chain:        chain,
 		lastLogTime:  time.Now(),
 	}, nil
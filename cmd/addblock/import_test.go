@@ -0,0 +1,303 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btclog"
+	"github.com/nyodeco/pind/blockchain"
+	"github.com/nyodeco/pind/chaincfg"
+	"github.com/nyodeco/pind/chaincfg/chainhash"
+	"github.com/nyodeco/pind/database"
+	"github.com/nyodeco/pind/txscript"
+	"github.com/nyodeco/pind/wire"
+	"github.com/nyodeco/pinutil"
+)
+
+// newTestImporter returns a block importer for a new regression test chain
+// along with a function to tear it down.
+func newTestImporter(t *testing.T) (*blockImporter, func()) {
+	t.Helper()
+
+	log = btclog.Disabled
+	prevParams := activeNetParams
+	params := chaincfg.RegressionNetParams
+	activeNetParams = &params
+
+	dataDir, err := ioutil.TempDir("", "addblocktest")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	db, err := database.Create("ffldb", filepath.Join(dataDir, "blocks"),
+		params.Net)
+	if err != nil {
+		os.RemoveAll(dataDir)
+		t.Fatalf("unable to create database: %v", err)
+	}
+	teardown := func() {
+		db.Close()
+		os.RemoveAll(dataDir)
+		activeNetParams = prevParams
+	}
+
+	chain, err := blockchain.New(&blockchain.Config{
+		DB:          db,
+		ChainParams: &params,
+		TimeSource:  blockchain.NewMedianTime(),
+	})
+	if err != nil {
+		teardown()
+		t.Fatalf("unable to create chain: %v", err)
+	}
+
+	bi := &blockImporter{
+		db:         db,
+		chain:      chain,
+		orphans:    make(map[chainhash.Hash][]*orphanBlock),
+		maxOrphans: maxOrphanBlocks,
+	}
+	return bi, teardown
+}
+
+// solveBlocks returns the passed number of blocks building on the genesis
+// block of the regression test network in order.
+func solveBlocks(t *testing.T, numBlocks int) []*pinutil.Block {
+	t.Helper()
+
+	params := &chaincfg.RegressionNetParams
+	target := blockchain.CompactToBig(params.PowLimitBits)
+	prev := params.GenesisBlock
+	blocks := make([]*pinutil.Block, 0, numBlocks)
+	for height := int64(1); height <= int64(numBlocks); height++ {
+		coinbaseScript, err := txscript.NewScriptBuilder().
+			AddInt64(height).AddInt64(0).Script()
+		if err != nil {
+			t.Fatalf("unable to create coinbase script: %v", err)
+		}
+		coinbase := wire.NewMsgTx(1)
+		coinbase.AddTxIn(&wire.TxIn{
+			PreviousOutPoint: wire.OutPoint{
+				Index: wire.MaxPrevOutIndex,
+			},
+			SignatureScript: coinbaseScript,
+			Sequence:        wire.MaxTxInSequenceNum,
+		})
+		coinbase.AddTxOut(wire.NewTxOut(0, []byte{txscript.OP_TRUE}))
+
+		msgBlock := &wire.MsgBlock{
+			Header: wire.BlockHeader{
+				Version:    4,
+				PrevBlock:  prev.BlockHash(),
+				MerkleRoot: coinbase.TxHash(),
+				Timestamp:  prev.Header.Timestamp.Add(time.Minute),
+				Bits:       params.PowLimitBits,
+			},
+			Transactions: []*wire.MsgTx{coinbase},
+		}
+		for {
+			powHash := msgBlock.Header.PowHash()
+			if blockchain.HashToBig(&powHash).Cmp(target) <= 0 {
+				break
+			}
+			msgBlock.Header.Nonce++
+		}
+
+		blocks = append(blocks, pinutil.NewBlock(msgBlock))
+		prev = msgBlock
+	}
+	return blocks
+}
+
+// processTestBlock runs the passed block read from the file with the passed
+// index through the importer and returns the number of imported blocks.
+func processTestBlock(t *testing.T, bi *blockImporter, block *pinutil.Block, fileIdx int) int64 {
+	t.Helper()
+
+	serialized, err := block.Bytes()
+	if err != nil {
+		t.Fatalf("unable to serialize block: %v", err)
+	}
+	imported, err := bi.processBlock(&fileBlock{serialized, fileIdx})
+	if err != nil {
+		t.Fatalf("processBlock %v: unexpected error: %v", block.Hash(),
+			err)
+	}
+	return imported
+}
+
+// TestProcessOrphans ensures blocks which are read before their parent are
+// held and imported once the parent is processed.
+func TestProcessOrphans(t *testing.T) {
+	bi, teardown := newTestImporter(t)
+	defer teardown()
+
+	blocks := solveBlocks(t, 5)
+
+	// Read the blocks out of order with one of them contained in two
+	// files.  Only the last block is imported right away.
+	tests := []struct {
+		block    *pinutil.Block
+		fileIdx  int
+		imported int64
+		held     int64
+	}{
+		{block: blocks[2], fileIdx: 0, imported: 0, held: 1},
+		{block: blocks[3], fileIdx: 0, imported: 0, held: 2},
+		{block: blocks[2], fileIdx: 1, imported: 0, held: 3},
+		{block: blocks[1], fileIdx: 1, imported: 0, held: 4},
+		{block: blocks[0], fileIdx: 2, imported: 4, held: 0},
+		{block: blocks[4], fileIdx: 2, imported: 1, held: 0},
+	}
+	for i, test := range tests {
+		imported := processTestBlock(t, bi, test.block, test.fileIdx)
+		if imported != test.imported {
+			t.Fatalf("#%d: imported %d blocks, want %d", i, imported,
+				test.imported)
+		}
+		if bi.numOrphans != test.held {
+			t.Fatalf("#%d: holding %d blocks, want %d", i,
+				bi.numOrphans, test.held)
+		}
+	}
+	if len(bi.orphans) != 0 {
+		t.Fatalf("blocks of %d parents are still held", len(bi.orphans))
+	}
+	if height := bi.chain.BestSnapshot().Height; height != 5 {
+		t.Fatalf("best height is %d, want 5", height)
+	}
+
+	// Blocks which are already known do not import anything again.
+	if imported := processTestBlock(t, bi, blocks[0], 3); imported != 0 {
+		t.Fatalf("imported %d known blocks", imported)
+	}
+}
+
+// TestMaxOrphans ensures the import fails once the maximum number of blocks is
+// held waiting for their parent.
+func TestMaxOrphans(t *testing.T) {
+	bi, teardown := newTestImporter(t)
+	defer teardown()
+
+	bi.maxOrphans = 2
+	blocks := solveBlocks(t, 4)
+	processTestBlock(t, bi, blocks[3], 0)
+	processTestBlock(t, bi, blocks[2], 0)
+
+	serialized, err := blocks[1].Bytes()
+	if err != nil {
+		t.Fatalf("unable to serialize block: %v", err)
+	}
+	_, err = bi.processBlock(&fileBlock{serialized, 0})
+	if err == nil {
+		t.Fatal("processBlock: did not fail when holding too many blocks")
+	}
+	if bi.numOrphans != 2 {
+		t.Fatalf("holding %d blocks, want 2", bi.numOrphans)
+	}
+}
+
+// TestResumeFileIdx ensures a later import resumes from the earliest file
+// containing a held block.
+func TestResumeFileIdx(t *testing.T) {
+	bi := &blockImporter{
+		orphans: make(map[chainhash.Hash][]*orphanBlock),
+	}
+	if idx := bi.resumeFileIdx(3); idx != 3 {
+		t.Fatalf("resumeFileIdx without held blocks: got %d, want 3", idx)
+	}
+
+	bi.orphans[chainhash.Hash{0x01}] = []*orphanBlock{
+		{fileIdx: 4}, {fileIdx: 2},
+	}
+	bi.orphans[chainhash.Hash{0x02}] = []*orphanBlock{{fileIdx: 3}}
+	tests := []struct {
+		fileIdx int
+		want    int
+	}{
+		{fileIdx: 5, want: 2},
+		{fileIdx: 2, want: 2},
+		{fileIdx: 1, want: 1},
+	}
+	for _, test := range tests {
+		if idx := bi.resumeFileIdx(test.fileIdx); idx != test.want {
+			t.Fatalf("resumeFileIdx(%d): got %d, want %d",
+				test.fileIdx, idx, test.want)
+		}
+	}
+}
+
+// TestLoadResumeFileIdx ensures the file recorded by saveResumeState is loaded
+// again and that the first file is used when there is nothing to resume.
+func TestLoadResumeFileIdx(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "addblockresume")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	resumePath := filepath.Join(dataDir, resumeFileName)
+	blocksDir := filepath.Join(dataDir, "blocks")
+	files := []string{
+		filepath.Join(blocksDir, "blk00000.dat"),
+		filepath.Join(blocksDir, "blk00001.dat"),
+		filepath.Join(blocksDir, "blk00002.dat"),
+	}
+
+	// The first file is used without a resume file.
+	idx, err := loadResumeFileIdx(resumePath, files)
+	if err != nil {
+		t.Fatalf("loadResumeFileIdx: unexpected error: %v", err)
+	}
+	if idx != 0 {
+		t.Fatalf("loadResumeFileIdx without resume file: got %d, "+
+			"want 0", idx)
+	}
+
+	// The saved file is resumed from.
+	bi := &blockImporter{
+		files:      files,
+		resumePath: resumePath,
+		orphans:    make(map[chainhash.Hash][]*orphanBlock),
+	}
+	if err := bi.saveResumeState(1); err != nil {
+		t.Fatalf("saveResumeState: unexpected error: %v", err)
+	}
+	idx, err = loadResumeFileIdx(resumePath, files)
+	if err != nil {
+		t.Fatalf("loadResumeFileIdx: unexpected error: %v", err)
+	}
+	if idx != 1 {
+		t.Fatalf("loadResumeFileIdx: got %d, want 1", idx)
+	}
+
+	// The first file is used when importing another directory.
+	otherFiles := []string{
+		filepath.Join(dataDir, "other", "blk00000.dat"),
+		filepath.Join(dataDir, "other", "blk00001.dat"),
+	}
+	idx, err = loadResumeFileIdx(resumePath, otherFiles)
+	if err != nil {
+		t.Fatalf("loadResumeFileIdx: unexpected error: %v", err)
+	}
+	if idx != 0 {
+		t.Fatalf("loadResumeFileIdx for another directory: got %d, "+
+			"want 0", idx)
+	}
+
+	// A malformed resume file is an error.
+	err = ioutil.WriteFile(resumePath, []byte("{"), 0600)
+	if err != nil {
+		t.Fatalf("unable to write resume file: %v", err)
+	}
+	if _, err := loadResumeFileIdx(resumePath, files); err == nil {
+		t.Fatal("loadResumeFileIdx: did not fail for malformed resume " +
+			"file")
+	}
+}
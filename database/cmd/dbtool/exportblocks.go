@@ -0,0 +1,208 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/nyodeco/pind/chaincfg/chainhash"
+	"github.com/nyodeco/pind/database"
+)
+
+// exportCmd defines the configuration options for the exportblocks command.
+type exportCmd struct {
+	OutFile   string `short:"o" long:"outfile" description:"File to write the block(s) to"`
+	Start     int32  `long:"start" description:"Height of the first block to export"`
+	End       int32  `long:"end" description:"Height of the last block to export -- Use -1 for the best block"`
+	Compress  bool   `short:"z" long:"compress" description:"Compress the file with gzip"`
+	Progress  int    `short:"p" long:"progress" description:"Show a progress message each time this number of seconds have passed -- Use 0 to disable progress announcements"`
+	Overwrite bool   `long:"overwrite" description:"Overwrite the file if it already exists"`
+}
+
+var (
+	// exportCfg defines the configuration options for the command.
+	exportCfg = exportCmd{
+		OutFile:  "bootstrap.dat",
+		Start:    0,
+		End:      -1,
+		Progress: 10,
+	}
+)
+
+// NOTE: The following only work for the chain state maintained by the
+// blockchain package.  Ideally it would expose the main chain index itself.
+var (
+	// heightIdxName is the name of the bucket which maps the heights of the
+	// blocks of the main chain to their hashes.
+	heightIdxName = []byte("heightidx")
+
+	// chainStateKeyName is the name of the key which houses the state of
+	// the best chain, which starts with its hash followed by its height.
+	chainStateKeyName = []byte("chainstate")
+)
+
+// serializeHeight returns the passed height serialized as a key of the main
+// chain height index.
+func serializeHeight(height int32) []byte {
+	var serializedHeight [4]byte
+	binary.LittleEndian.PutUint32(serializedHeight[:], uint32(height))
+	return serializedHeight[:]
+}
+
+// fetchBestHeight returns the height of the best chain according to the chain
+// state stored in the passed database.
+func fetchBestHeight(db database.DB) (int32, error) {
+	var bestHeight int32
+	err := db.View(func(tx database.Tx) error {
+		serializedState := tx.Metadata().Get(chainStateKeyName)
+		if len(serializedState) < chainhash.HashSize+4 {
+			return fmt.Errorf("the database does not contain a " +
+				"valid chain state")
+		}
+		bestHeight = int32(binary.LittleEndian.Uint32(
+			serializedState[chainhash.HashSize:]))
+		return nil
+	})
+	return bestHeight, err
+}
+
+// writeBlock writes the passed serialized block to the writer in the block
+// file format understood by the addblock utility and the insecureimport
+// command.
+func writeBlock(w io.Writer, serializedBlock []byte) error {
+	// The block file format is:
+	//  <network> <block length> <serialized block>
+	var prefix [8]byte
+	binary.LittleEndian.PutUint32(prefix[:4], uint32(activeNetParams.Net))
+	binary.LittleEndian.PutUint32(prefix[4:], uint32(len(serializedBlock)))
+	if _, err := w.Write(prefix[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(serializedBlock)
+	return err
+}
+
+// Execute is the main entry point for the command.  It's invoked by the parser.
+func (cmd *exportCmd) Execute(args []string) error {
+	// Setup the global config options and ensure they are valid.
+	if err := setupGlobalConfig(); err != nil {
+		return err
+	}
+
+	if !exportCfg.Overwrite && fileExists(exportCfg.OutFile) {
+		return fmt.Errorf("the specified output file [%v] already "+
+			"exists -- use --overwrite to replace it",
+			exportCfg.OutFile)
+	}
+
+	// Load the block database.
+	db, err := loadBlockDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	// Ensure the requested range is part of the main chain.
+	bestHeight, err := fetchBestHeight(db)
+	if err != nil {
+		return err
+	}
+	start, end := exportCfg.Start, exportCfg.End
+	if end < 0 {
+		end = bestHeight
+	}
+	if start < 0 || start > end || end > bestHeight {
+		return fmt.Errorf("invalid block range [%d, %d] -- the best "+
+			"height is %d", start, end, bestHeight)
+	}
+
+	f, err := os.Create(exportCfg.OutFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Buffer the writes to the file and compress them first when requested.
+	bw := bufio.NewWriter(f)
+	var w io.Writer = bw
+	var zw *gzip.Writer
+	if exportCfg.Compress {
+		zw = gzip.NewWriter(bw)
+		w = zw
+	}
+
+	// Stop the export when an interrupt is received.
+	quit := make(chan struct{})
+	addInterruptHandler(func() {
+		close(quit)
+	})
+
+	log.Infof("Exporting blocks %d to %d to %s", start, end,
+		exportCfg.OutFile)
+	startTime := time.Now()
+	lastLogTime := startTime
+	var numLogBlocks int64
+	for height := start; height <= end; height++ {
+		select {
+		case <-quit:
+			return fmt.Errorf("export interrupted at height %d",
+				height)
+		default:
+		}
+
+		var hash chainhash.Hash
+		err = db.View(func(tx database.Tx) error {
+			serializedHash := tx.Metadata().Bucket(heightIdxName).
+				Get(serializeHeight(height))
+			if len(serializedHash) != chainhash.HashSize {
+				return fmt.Errorf("no main chain block at "+
+					"height %d", height)
+			}
+			copy(hash[:], serializedHash)
+
+			serializedBlock, err := tx.FetchBlock(&hash)
+			if err != nil {
+				return err
+			}
+			return writeBlock(w, serializedBlock)
+		})
+		if err != nil {
+			return fmt.Errorf("unable to export block %v (height "+
+				"%d): %v", hash, height, err)
+		}
+
+		// Log the progress at most once every progress interval.
+		numLogBlocks++
+		now := time.Now()
+		if exportCfg.Progress != 0 && now.Sub(lastLogTime) >=
+			time.Second*time.Duration(exportCfg.Progress) {
+
+			log.Infof("Exported %d blocks in the last %s (height %d)",
+				numLogBlocks, now.Sub(lastLogTime).Truncate(
+					10*time.Millisecond), height)
+			numLogBlocks = 0
+			lastLogTime = now
+		}
+	}
+
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			return err
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+
+	log.Infof("Exported %d blocks in %v", end-start+1,
+		time.Since(startTime).Truncate(10*time.Millisecond))
+	return nil
+}
@@ -79,6 +79,12 @@ func realMain() error {
 			"WARNING: This is NOT secure because it does NOT "+
 			"verify chain rules.  It is only provided for testing "+
 			"purposes.", &importCfg)
+	parser.AddCommand("exportblocks",
+		"Export the blocks of the main chain to a bootstrap.dat file",
+		"Export the blocks of the main chain between the start and "+
+			"end heights to a file in the bootstrap.dat format "+
+			"which can be imported with the addblock utility.",
+		&exportCfg)
 	parser.AddCommand("loadheaders",
 		"Time how long to load headers for all blocks in the database",
 		"", &headersCfg)
@@ -16,6 +16,7 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
 
 	"github.com/nyodeco/pind/chaincfg/chainhash"
 	"github.com/nyodeco/pind/database"
@@ -168,6 +169,20 @@ type blockStore struct {
 	// new blocks are written to.
 	writeCursor *writeCursor
 
+	// firstFileNum is the number of the oldest block file that still
+	// exists on disk.  It is only ever non-zero when older block files have
+	// been deleted by pruning.  It must only be accessed atomically.
+	firstFileNum uint32
+
+	// sizeMtx protects the cached total size of the block files from
+	// sizeFirstFileNum up to but not including sizeEndFileNum.  Those
+	// files are no longer written to, so each of them only needs to be
+	// stat'd once to determine the total size of the block files.
+	sizeMtx          sync.Mutex
+	sizeFirstFileNum uint32
+	sizeEndFileNum   uint32
+	filesSize        uint64
+
 	// These functions are set to openFile, openWriteFile, and deleteFile by
 	// default, but are exposed here to allow the whitebox tests to replace
 	// them when working with mock files.
@@ -660,6 +675,15 @@ func (s *blockStore) handleRollback(oldBlockFileNum, oldBlockOffset uint32) {
 		wc.curOffset = oldBlockOffset
 	}()
 
+	// The file being rolled back to might have been included in the cached
+	// size of the block files, so forget it.
+	s.sizeMtx.Lock()
+	if s.sizeEndFileNum > oldBlockFileNum {
+		s.sizeEndFileNum = s.sizeFirstFileNum
+		s.filesSize = 0
+	}
+	s.sizeMtx.Unlock()
+
 	log.Debugf("ROLLBACK: Rolling back to file %d, offset %d",
 		oldBlockFileNum, oldBlockOffset)
 
@@ -712,15 +736,114 @@ func (s *blockStore) handleRollback(oldBlockFileNum, oldBlockOffset uint32) {
 	}
 }
 
+// pruneFiles closes and deletes all block files that are older than the
+// provided block file number and marks it as the oldest remaining block file.
+// The current write file is never deleted.
+//
+// This function MUST only be called after a write transaction which removed the
+// block files has successfully been committed.
+func (s *blockStore) pruneFiles(firstFileNum uint32) {
+	wc := s.writeCursor
+	wc.RLock()
+	if firstFileNum > wc.curFileNum {
+		firstFileNum = wc.curFileNum
+	}
+	wc.RUnlock()
+
+	oldFirstFileNum := atomic.LoadUint32(&s.firstFileNum)
+	if firstFileNum <= oldFirstFileNum {
+		return
+	}
+
+	// Mark the new oldest block file before deleting anything so readers
+	// treat the blocks in the files being deleted as no longer available.
+	atomic.StoreUint32(&s.firstFileNum, firstFileNum)
+
+	for fileNum := oldFirstFileNum; fileNum < firstFileNum; fileNum++ {
+		// Close the file if it's open under the write lock for the
+		// file in case any readers are currently reading from it so
+		// it's not closed out from under them.
+		s.obfMutex.Lock()
+		if obf, ok := s.openBlockFiles[fileNum]; ok {
+			s.lruMutex.Lock()
+			s.openBlocksLRU.Remove(s.fileNumToLRUElem[fileNum])
+			delete(s.fileNumToLRUElem, fileNum)
+			s.lruMutex.Unlock()
+
+			obf.Lock()
+			_ = obf.file.Close()
+			obf.Unlock()
+			delete(s.openBlockFiles, fileNum)
+		}
+		s.obfMutex.Unlock()
+
+		if err := s.deleteFileFunc(fileNum); err != nil {
+			log.Warnf("PRUNE: Failed to delete block file number "+
+				"%d: %v", fileNum, err)
+			continue
+		}
+		log.Debugf("PRUNE: Deleted block file number %d", fileNum)
+	}
+}
+
+// blockFilesSize returns the total number of bytes used by all of the block
+// files that still exist on disk.
+func (s *blockStore) blockFilesSize() (uint64, error) {
+	wc := s.writeCursor
+	wc.RLock()
+	curFileNum, curOffset := wc.curFileNum, wc.curOffset
+	wc.RUnlock()
+
+	s.sizeMtx.Lock()
+	defer s.sizeMtx.Unlock()
+
+	// Start over when older files have been pruned or newer ones were
+	// rolled back since the size was last cached.
+	firstFileNum := atomic.LoadUint32(&s.firstFileNum)
+	if s.sizeFirstFileNum != firstFileNum || s.sizeEndFileNum > curFileNum {
+		s.sizeFirstFileNum = firstFileNum
+		s.sizeEndFileNum = firstFileNum
+		s.filesSize = 0
+	}
+	for ; s.sizeEndFileNum < curFileNum; s.sizeEndFileNum++ {
+		st, err := os.Stat(blockFilePath(s.basePath, s.sizeEndFileNum))
+		if err != nil {
+			str := fmt.Sprintf("failed to stat block file %d: %v",
+				s.sizeEndFileNum, err)
+			return 0, makeDbErr(database.ErrDriverSpecific, str, err)
+		}
+		s.filesSize += uint64(st.Size())
+	}
+
+	return s.filesSize + uint64(curOffset), nil
+}
+
 // scanBlockFiles searches the database directory for all flat block files to
-// find the end of the most recent file.  This position is considered the
-// current write cursor which is also stored in the metadata.  Thus, it is used
-// to detect unexpected shutdowns in the middle of writes so the block files
-// can be reconciled.
-func scanBlockFiles(dbPath string) (int, uint32) {
+// find the oldest file and the end of the most recent file.  This position is
+// considered the current write cursor which is also stored in the metadata.
+// Thus, it is used to detect unexpected shutdowns in the middle of writes so
+// the block files can be reconciled.  The oldest file is only something other
+// than the first one when older files have been pruned.
+func scanBlockFiles(dbPath string) (int, int, uint32) {
+	// Find the oldest block file since older files might have been
+	// deleted by pruning.
+	firstFile := 0
+	fileNames, _ := filepath.Glob(filepath.Join(dbPath, "*.fdb"))
+	for i, fileName := range fileNames {
+		var fileNum int
+		_, err := fmt.Sscanf(filepath.Base(fileName), blockFilenameTemplate,
+			&fileNum)
+		if err != nil {
+			continue
+		}
+		if i == 0 || fileNum < firstFile {
+			firstFile = fileNum
+		}
+	}
+
 	lastFile := -1
 	fileLen := uint32(0)
-	for i := 0; ; i++ {
+	for i := firstFile; ; i++ {
 		filePath := blockFilePath(dbPath, uint32(i))
 		st, err := os.Stat(filePath)
 		if err != nil {
@@ -731,9 +854,9 @@ func scanBlockFiles(dbPath string) (int, uint32) {
 		fileLen = uint32(st.Size())
 	}
 
-	log.Tracef("Scan found latest block file #%d with length %d", lastFile,
-		fileLen)
-	return lastFile, fileLen
+	log.Tracef("Scan found oldest block file #%d and latest block file "+
+		"#%d with length %d", firstFile, lastFile, fileLen)
+	return firstFile, lastFile, fileLen
 }
 
 // newBlockStore returns a new block store with the current block file number
@@ -742,8 +865,9 @@ func newBlockStore(basePath string, network wire.PinNet) *blockStore {
 	// Look for the end of the latest block to file to determine what the
 	// write cursor position is from the viewpoing of the block files on
 	// disk.
-	fileNum, fileOff := scanBlockFiles(basePath)
+	firstFileNum, fileNum, fileOff := scanBlockFiles(basePath)
 	if fileNum == -1 {
+		firstFileNum = 0
 		fileNum = 0
 		fileOff = 0
 	}
@@ -761,6 +885,7 @@ func newBlockStore(basePath string, network wire.PinNet) *blockStore {
 			curFileNum: uint32(fileNum),
 			curOffset:  fileOff,
 		},
+		firstFileNum: uint32(firstFileNum),
 	}
 	store.openFileFunc = store.openFile
 	store.openWriteFileFunc = store.openWriteFile
@@ -13,6 +13,7 @@ import (
 	"runtime"
 	"sort"
 	"sync"
+	"sync/atomic"
 
 	"github.com/nyodeco/pind/chaincfg/chainhash"
 	"github.com/nyodeco/pind/database"
@@ -966,6 +967,11 @@ type transaction struct {
 	pendingBlocks    map[chainhash.Hash]int
 	pendingBlockData []pendingBlock
 
+	// pendingFirstFileNum is the number of the oldest block file to keep
+	// once the transaction is committed.  All older block files are
+	// deleted on commit.  It is zero when no block files are being pruned.
+	pendingFirstFileNum uint32
+
 	// Keys that need to be stored or deleted on commit.
 	pendingKeys   *treap.Mutable
 	pendingRemove *treap.Mutable
@@ -1132,7 +1138,18 @@ func (tx *transaction) hasBlock(hash *chainhash.Hash) bool {
 		return true
 	}
 
-	return tx.hasKey(bucketizedKey(blockIdxBucketID, hash[:]))
+	blockRow := tx.fetchKey(bucketizedKey(blockIdxBucketID, hash[:]))
+	return blockRow != nil && !tx.isPrunedLoc(deserializeBlockLoc(blockRow))
+}
+
+// isPrunedLoc returns whether or not the block at the provided location has
+// been pruned, or will be once the transaction is committed.
+func (tx *transaction) isPrunedLoc(loc blockLocation) bool {
+	firstFileNum := atomic.LoadUint32(&tx.db.store.firstFileNum)
+	if tx.pendingFirstFileNum > firstFileNum {
+		firstFileNum = tx.pendingFirstFileNum
+	}
+	return loc.blockFileNum < firstFileNum
 }
 
 // StoreBlock stores the provided block into the database.  There are no checks
@@ -1234,6 +1251,10 @@ func (tx *transaction) fetchBlockRow(hash *chainhash.Hash) ([]byte, error) {
 		str := fmt.Sprintf("block %s does not exist", hash)
 		return nil, makeDbErr(database.ErrBlockNotFound, str, nil)
 	}
+	if tx.isPrunedLoc(deserializeBlockLoc(blockRow)) {
+		str := fmt.Sprintf("block %s has been pruned", hash)
+		return nil, makeDbErr(database.ErrBlockNotFound, str, nil)
+	}
 
 	return blockRow, nil
 }
@@ -1583,6 +1604,94 @@ func (tx *transaction) FetchBlockRegions(regions []database.BlockRegion) ([][]by
 	return blockRegions, nil
 }
 
+// PruneBlocks deletes the oldest block files until the total size of all block
+// files is no larger than the provided target size in bytes.  Only block files
+// which were written before the one that houses the block identified by the
+// provided keep hash are deleted and the current write file is never deleted.
+// The block files are not deleted until the transaction is committed.
+//
+// Returns the following errors as required by the interface contract:
+//   - ErrBlockNotFound if the block identified by the keep hash does not exist
+//   - ErrTxNotWritable if attempted against a read-only transaction
+//   - ErrTxClosed if the transaction has already been closed
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) PruneBlocks(targetSize uint64, keepHash *chainhash.Hash) (bool, error) {
+	// Ensure transaction state is valid.
+	if err := tx.checkClosed(); err != nil {
+		return false, err
+	}
+
+	// Ensure the transaction is writable.
+	if !tx.writable {
+		str := "prune blocks requires a writable database transaction"
+		return false, makeDbErr(database.ErrTxNotWritable, str, nil)
+	}
+
+	// Nothing to do when the block files are already within the target
+	// size.
+	store := tx.db.store
+	totalSize, err := store.blockFilesSize()
+	if err != nil {
+		return false, err
+	}
+	if totalSize <= targetSize {
+		return false, nil
+	}
+
+	// Blocks pending to be written on commit are always in the current or
+	// a later block file, so there is nothing older than them to prune.
+	if _, exists := tx.pendingBlocks[*keepHash]; exists {
+		return false, nil
+	}
+	blockRow, err := tx.fetchBlockRow(keepHash)
+	if err != nil {
+		return false, err
+	}
+	keepFileNum := deserializeBlockLoc(blockRow).blockFileNum
+
+	// Determine the oldest block file to keep by walking the files from
+	// oldest to newest until enough space would be freed.
+	firstFileNum := atomic.LoadUint32(&store.firstFileNum)
+	if tx.pendingFirstFileNum > firstFileNum {
+		firstFileNum = tx.pendingFirstFileNum
+	}
+	newFirstFileNum := firstFileNum
+	for ; newFirstFileNum < keepFileNum && totalSize > targetSize; newFirstFileNum++ {
+		st, err := os.Stat(blockFilePath(store.basePath, newFirstFileNum))
+		if err != nil {
+			str := fmt.Sprintf("failed to stat block file %d: %v",
+				newFirstFileNum, err)
+			return false, makeDbErr(database.ErrDriverSpecific, str, err)
+		}
+		totalSize -= uint64(st.Size())
+	}
+	if newFirstFileNum == firstFileNum {
+		return false, nil
+	}
+
+	log.Debugf("PRUNE: Pruning block files %d through %d", firstFileNum,
+		newFirstFileNum-1)
+	tx.pendingFirstFileNum = newFirstFileNum
+	return true, nil
+}
+
+// BeenPruned returns whether or not any block files have been deleted from the
+// database due to pruning.
+//
+// Returns the following errors as required by the interface contract:
+//   - ErrTxClosed if the transaction has already been closed
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) BeenPruned() (bool, error) {
+	// Ensure transaction state is valid.
+	if err := tx.checkClosed(); err != nil {
+		return false, err
+	}
+
+	return atomic.LoadUint32(&tx.db.store.firstFileNum) > 0, nil
+}
+
 // close marks the transaction closed then releases any pending data, the
 // underlying snapshot, the transaction read lock, and the write lock when the
 // transaction is writable.
@@ -1592,6 +1701,7 @@ func (tx *transaction) close() {
 	// Clear pending blocks that would have been written on commit.
 	tx.pendingBlocks = nil
 	tx.pendingBlockData = nil
+	tx.pendingFirstFileNum = 0
 
 	// Clear pending keys that would have been written or deleted on commit.
 	tx.pendingKeys = nil
@@ -1666,7 +1776,17 @@ func (tx *transaction) writePendingAndCommit() error {
 
 	// Atomically update the database cache.  The cache automatically
 	// handles flushing to the underlying persistent storage database.
-	return tx.db.cache.commitTx(tx)
+	if err := tx.db.cache.commitTx(tx); err != nil {
+		return err
+	}
+
+	// Delete any block files that were pruned now that the transaction
+	// has been committed.
+	if tx.pendingFirstFileNum != 0 {
+		tx.db.store.pruneFiles(tx.pendingFirstFileNum)
+	}
+
+	return nil
 }
 
 // Commit commits all changes that have been made to the root metadata bucket
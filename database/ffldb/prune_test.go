@@ -0,0 +1,206 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// This file is part of the ffldb package rather than the ffldb_test package as
+// it provides whitebox testing.
+
+package ffldb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nyodeco/pind/chaincfg/chainhash"
+	"github.com/nyodeco/pind/database"
+	"github.com/nyodeco/pind/wire"
+	"github.com/nyodeco/pinutil"
+)
+
+// pruneTestBlocks returns the requested number of unique, unconnected blocks
+// that are suitable for exercising block storage.
+func pruneTestBlocks(numBlocks int) []*pinutil.Block {
+	blocks := make([]*pinutil.Block, 0, numBlocks)
+	for i := 0; i < numBlocks; i++ {
+		msgBlock := wire.NewMsgBlock(&wire.BlockHeader{
+			Version:   1,
+			Timestamp: time.Unix(int64(1600000000+i), 0),
+			Bits:      0x207fffff,
+			Nonce:     uint32(i),
+		})
+		msgTx := wire.NewMsgTx(wire.TxVersion)
+		msgTx.AddTxIn(&wire.TxIn{
+			PreviousOutPoint: *wire.NewOutPoint(&chainhash.Hash{},
+				wire.MaxPrevOutIndex),
+			SignatureScript: make([]byte, 100),
+			Sequence:        wire.MaxTxInSequenceNum,
+		})
+		msgTx.AddTxOut(wire.NewTxOut(int64(i), nil))
+		msgBlock.AddTransaction(msgTx)
+		blocks = append(blocks, pinutil.NewBlock(msgBlock))
+	}
+	return blocks
+}
+
+// TestPruneBlocks ensures pruning deletes the oldest block files, never touches
+// the files housing the block to keep, and that pruned blocks are treated as
+// missing, including after the database is reopened.
+func TestPruneBlocks(t *testing.T) {
+	t.Parallel()
+
+	dbPath := filepath.Join(os.TempDir(), "ffldb-pruneblocks")
+	_ = os.RemoveAll(dbPath)
+	idb, err := database.Create(dbType, dbPath, blockDataNet)
+	if err != nil {
+		t.Fatalf("Failed to create test database (%s) %v", dbType, err)
+	}
+	defer os.RemoveAll(dbPath)
+
+	// Force multiple flat files with the test blocks.
+	store := idb.(*db).store
+	store.maxBlockFileSize = 1024 // 1KiB
+
+	blocks := pruneTestBlocks(40)
+	err = idb.Update(func(tx database.Tx) error {
+		for _, block := range blocks {
+			if err := tx.StoreBlock(block); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		idb.Close()
+		t.Fatalf("StoreBlock: unexpected error: %v", err)
+	}
+
+	// Nothing should be pruned when the files are within the target size.
+	keepBlock := blocks[30]
+	err = idb.Update(func(tx database.Tx) error {
+		pruned, err := tx.PruneBlocks(1<<30, keepBlock.Hash())
+		if err != nil {
+			return err
+		}
+		if pruned {
+			t.Errorf("PruneBlocks: unexpected prune within target")
+		}
+		return nil
+	})
+	if err != nil {
+		idb.Close()
+		t.Fatalf("PruneBlocks: unexpected error: %v", err)
+	}
+
+	// Prune everything possible and ensure the block files older than the
+	// one housing the block to keep are gone.
+	var keepFileNum uint32
+	err = idb.Update(func(tx database.Tx) error {
+		blockRow, err := tx.(*transaction).fetchBlockRow(keepBlock.Hash())
+		if err != nil {
+			return err
+		}
+		keepFileNum = deserializeBlockLoc(blockRow).blockFileNum
+
+		pruned, err := tx.PruneBlocks(0, keepBlock.Hash())
+		if err != nil {
+			return err
+		}
+		if !pruned {
+			t.Errorf("PruneBlocks: expected blocks to be pruned")
+		}
+		return nil
+	})
+	if err != nil {
+		idb.Close()
+		t.Fatalf("PruneBlocks: unexpected error: %v", err)
+	}
+	if keepFileNum == 0 {
+		idb.Close()
+		t.Fatalf("Test blocks unexpectedly fit in a single file")
+	}
+	for fileNum := uint32(0); fileNum < keepFileNum; fileNum++ {
+		_, err := os.Stat(blockFilePath(dbPath, fileNum))
+		if !os.IsNotExist(err) {
+			t.Errorf("Block file %d was not deleted: %v", fileNum, err)
+		}
+	}
+
+	// The cached total size of the block files must account for the files
+	// that were deleted.
+	var wantSize uint64
+	fileNames, _ := filepath.Glob(filepath.Join(dbPath, "*.fdb"))
+	for _, fileName := range fileNames {
+		st, err := os.Stat(fileName)
+		if err != nil {
+			idb.Close()
+			t.Fatalf("Failed to stat block file: %v", err)
+		}
+		wantSize += uint64(st.Size())
+	}
+	totalSize, err := store.blockFilesSize()
+	if err != nil {
+		idb.Close()
+		t.Fatalf("blockFilesSize: unexpected error: %v", err)
+	}
+	if totalSize != wantSize {
+		t.Errorf("blockFilesSize: got %d, want %d", totalSize, wantSize)
+	}
+
+	// checkBlocks ensures only the blocks stored in the remaining files are
+	// available.
+	checkBlocks := func(idb database.DB) {
+		err := idb.View(func(tx database.Tx) error {
+			beenPruned, err := tx.BeenPruned()
+			if err != nil {
+				return err
+			}
+			if !beenPruned {
+				t.Errorf("BeenPruned: expected database to be pruned")
+			}
+
+			var numAvailable int
+			for i, block := range blocks {
+				hasBlock, err := tx.HasBlock(block.Hash())
+				if err != nil {
+					return err
+				}
+				_, fetchErr := tx.FetchBlock(block.Hash())
+				if hasBlock {
+					numAvailable++
+					if fetchErr != nil {
+						t.Errorf("FetchBlock #%d: unexpected "+
+							"error: %v", i, fetchErr)
+					}
+					continue
+				}
+				if i >= 30 {
+					t.Errorf("HasBlock #%d: block to keep "+
+						"was pruned", i)
+				}
+				checkDbError(t, "FetchBlock", fetchErr,
+					database.ErrBlockNotFound)
+			}
+			if numAvailable == len(blocks) {
+				t.Errorf("HasBlock: no blocks were pruned")
+			}
+			return nil
+		})
+		if err != nil {
+			t.Errorf("View: unexpected error: %v", err)
+		}
+	}
+	checkBlocks(idb)
+
+	// Reopen the database and ensure the pruned state is retained.
+	if err := idb.Close(); err != nil {
+		t.Fatalf("Close: unexpected error: %v", err)
+	}
+	idb, err = database.Open(dbType, dbPath, blockDataNet)
+	if err != nil {
+		t.Fatalf("Failed to reopen test database (%s) %v", dbType, err)
+	}
+	defer idb.Close()
+	checkBlocks(idb)
+}
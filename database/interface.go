@@ -389,6 +389,36 @@ type Tx interface {
 	// implementations.
 	FetchBlockRegions(regions []BlockRegion) ([][]byte, error)
 
+	// PruneBlocks deletes the oldest stored blocks until the total size of
+	// the block storage is no larger than the provided target size in
+	// bytes.  Only blocks that were stored before the block identified by
+	// the provided keep hash are eligible for deletion.  Depending on the
+	// backend implementation, blocks might be deleted in groups, so the
+	// resulting size can be larger than the target.  It returns whether or
+	// not any blocks were deleted.
+	//
+	// Only the block data itself is deleted.  Metadata, such as data that
+	// was stored alongside the block by callers, is left untouched.
+	// Deleted blocks are treated as if they do not exist.
+	//
+	// The interface contract guarantees at least the following errors will
+	// be returned (other implementation-specific errors are possible):
+	//   - ErrBlockNotFound if the block identified by the keep hash does
+	//     not exist
+	//   - ErrTxNotWritable if attempted against a read-only transaction
+	//   - ErrTxClosed if the transaction has already been closed
+	//
+	// NOTE: The blocks are not deleted until the transaction is committed.
+	PruneBlocks(targetSize uint64, keepHash *chainhash.Hash) (bool, error)
+
+	// BeenPruned returns whether or not any blocks have ever been deleted
+	// from the database by PruneBlocks.
+	//
+	// The interface contract guarantees at least the following errors will
+	// be returned (other implementation-specific errors are possible):
+	//   - ErrTxClosed if the transaction has already been closed
+	BeenPruned() (bool, error)
+
 	// ******************************************************************
 	// Methods related to both atomic metadata storage and block storage.
 	// ******************************************************************
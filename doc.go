@@ -74,10 +74,26 @@ Application Options:
                               (default all interfaces port: 8333, testnet:
                               18333)
       --logdir=               Directory to log output
+      --maxmempool=           The maximum size in MiB of the transaction memory
+                              pool -- The transactions paying the lowest fee
+                              rates are evicted when it is full -- 0 disables
+                              the limit (default: 300)
       --maxorphantx=          Max number of orphan transactions to keep in
                               memory (default: 100)
       --maxpeers=             Max number of inbound and outbound peers
                               (default: 125)
+      --maxreorgdepth=        Refuse to reorganize the chain when more than this
+                              number of blocks would be disconnected -- 0
+                              disables the limit
+      --mempoolexpiry=        Remove transactions which have been in the
+                              transaction memory pool for longer than this
+                              number of hours along with the transactions
+                              spending them -- 0 disables expiry (default: 336)
+      --minimumchainwork=     Only store the headers of a peer once its chain is
+                              verified to have at least this much work, given
+                              in hex -- Use 0 to store the headers without
+                              verifying the chain work (default:
+                              network-specific)
       --miningaddr=           Add the specified payment address to the list of
                               addresses to use for generated blocks -- At least
                               one address is required if the generate option is
@@ -108,6 +124,9 @@ Application Options:
                               (eg. 127.0.0.1:9050)
       --onionpass=            Password for onion proxy server
       --onionuser=            Username for onion proxy server
+      --persistmempool        Save the transactions in the mempool to mempool.dat
+                              in the data directory on shutdown and reload them
+                              on startup
       --profile=              Enable HTTP profiling on given port -- NOTE port
                               must be between 1024 and 65536
       --proxy=                Connect via SOCKS5 proxy (eg. 127.0.0.1:9050)
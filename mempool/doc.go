@@ -63,6 +63,8 @@ be an exhaustive list.
    - The starting priority for the transaction
  - Manual control of transaction removal
    - Recursive removal of all dependent transactions
+ - Package acceptance which lets a child pay for parents paying too low a fee
+ - Saving the pool to and restoring it from a file across restarts
 
 Errors
 
@@ -8,6 +8,7 @@ import (
 	"container/list"
 	"fmt"
 	"math"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -48,8 +49,63 @@ const (
 	// can be evicted from the mempool when accepting a transaction
 	// replacement.
 	MaxReplacementEvictions = 100
+
+	// rollingFeeHalfLife is the amount of time it takes for the minimum fee
+	// rate raised by evicting transactions from a full pool to halve.  The
+	// fee rate decays faster once the pool has drained below half and a
+	// quarter of its maximum size.
+	rollingFeeHalfLife = time.Hour * 12
+
+	// trimTargetPercent is the percentage of the maximum pool size a full
+	// pool is trimmed to.  Freeing more than needed means the descendant
+	// fee rates of all transactions only have to be determined again once
+	// enough new transactions have been accepted to fill the difference,
+	// rather than for every transaction accepted into a full pool.
+	trimTargetPercent = 90
+
+	// txEntryOverhead, txInOverhead and txOutOverhead estimate the memory
+	// used to track a transaction in the pool beyond its serialized size,
+	// that is, its descriptor, its deserialized form and the entries of
+	// the maps referring to it.
+	txEntryOverhead = 300
+	txInOverhead    = 150
+	txOutOverhead   = 50
 )
 
+// RemovalReason describes why a transaction was removed from the pool without
+// being included in a block.
+type RemovalReason int
+
+const (
+	// RemovalExpiry indicates the transaction, or one of its ancestors,
+	// stayed in the pool for longer than the maximum transaction age.
+	RemovalExpiry RemovalReason = iota
+
+	// RemovalSizeLimit indicates the transaction, or one of its ancestors,
+	// was evicted because the pool exceeded its maximum size.
+	RemovalSizeLimit
+
+	// RemovalReplaced indicates the transaction, or one of its ancestors,
+	// was replaced by a transaction paying a higher fee.
+	RemovalReplaced
+)
+
+// Map of RemovalReason values back to their constant names for pretty
+// printing.
+var removalReasonStrings = map[RemovalReason]string{
+	RemovalExpiry:    "expiry",
+	RemovalSizeLimit: "sizelimit",
+	RemovalReplaced:  "replaced",
+}
+
+// String returns the RemovalReason in human-readable form.
+func (r RemovalReason) String() string {
+	if s, ok := removalReasonStrings[r]; ok {
+		return s
+	}
+	return fmt.Sprintf("Unknown RemovalReason (%d)", int(r))
+}
+
 // Tag represents an identifier to use for tagging orphan transactions.  The
 // caller may choose any scheme it desires, however it is common to use peer IDs
 // so that orphans can be identified by which peer first relayed them.
@@ -103,6 +159,12 @@ type Config struct {
 	// FeeEstimatator provides a feeEstimator. If it is not nil, the mempool
 	// records all new transactions it observes into the feeEstimator.
 	FeeEstimator *FeeEstimator
+
+	// TxRemoved defines an optional function to be called for every
+	// transaction which is removed from the pool without being included
+	// in a block, along with the reason it was removed.  It is invoked
+	// after the mempool lock has been released.
+	TxRemoved func(tx *pinutil.Tx, reason RemovalReason)
 }
 
 // Policy houses the policy (configuration parameters) which is used to
@@ -148,6 +210,19 @@ type Policy struct {
 	// transactions using the Replace-By-Fee (RBF) signaling policy into
 	// the mempool.
 	RejectReplacement bool
+
+	// MaxPoolSize is the maximum estimated memory usage in bytes of the
+	// transactions in the pool.  When it is exceeded, the packages with
+	// the lowest descendant fee rate are evicted and the minimum fee rate
+	// for new transactions is raised above theirs.  A value of 0 means the
+	// pool is not limited.
+	MaxPoolSize int64
+
+	// MaxTxAge is the maximum amount of time a transaction is allowed to
+	// stay in the pool.  Older transactions are removed along with all
+	// transactions which rely on them by ExpireTransactions.  A value of 0
+	// means transactions never expire.
+	MaxTxAge time.Duration
 }
 
 // TxDesc is a descriptor containing a transaction in the mempool along with
@@ -185,11 +260,32 @@ type TxPool struct {
 	pennyTotal    float64 // exponentially decaying total for penny spends.
 	lastPennyUnix int64   // unix time of last ``penny spend''
 
+	// usage is the estimated memory usage of the transactions in the pool.
+	//
+	// rollingMinFeeRate is the minimum fee rate in satoshi/kB new
+	// transactions must pay after transactions were evicted due to the
+	// pool being full.  It decays over time starting from when it was
+	// last updated.
+	usage                int64
+	rollingMinFeeRate    float64
+	lastRollingFeeUpdate time.Time
+
 	// nextExpireScan is the time after which the orphan pool will be
 	// scanned in order to evict orphans.  This is NOT a hard deadline as
 	// the scan will only run when an orphan is added to the pool as opposed
 	// to on an unconditional timer.
 	nextExpireScan time.Time
+
+	// removedTxns holds the transactions removed from the pool which the
+	// TxRemoved callback has not been invoked for yet.
+	removedTxns []removedTx
+}
+
+// removedTx describes a transaction removed from the pool along with the
+// reason it was removed.
+type removedTx struct {
+	tx     *pinutil.Tx
+	reason RemovalReason
 }
 
 // Ensure the TxPool type implements the mining.TxSource interface.
@@ -263,6 +359,31 @@ func (mp *TxPool) RemoveOrphansByTag(tag Tag) uint64 {
 	return numEvicted
 }
 
+// OrphanSpenders returns the orphan transactions which spend outputs of the
+// passed transaction.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) OrphanSpenders(tx *pinutil.Tx) []*pinutil.Tx {
+	mp.mtx.RLock()
+	defer mp.mtx.RUnlock()
+
+	var spenders []*pinutil.Tx
+	seen := make(map[chainhash.Hash]struct{})
+	prevOut := wire.OutPoint{Hash: *tx.Hash()}
+	for txOutIdx := range tx.MsgTx().TxOut {
+		prevOut.Index = uint32(txOutIdx)
+		for hash, orphan := range mp.orphansByPrev[prevOut] {
+			if _, ok := seen[hash]; ok {
+				continue
+			}
+			seen[hash] = struct{}{}
+			spenders = append(spenders, orphan)
+		}
+	}
+
+	return spenders
+}
+
 // limitNumOrphans limits the number of orphan transactions by evicting a random
 // orphan if adding a new one would cause it to overflow the max allowed.
 //
@@ -491,6 +612,7 @@ func (mp *TxPool) removeTransaction(tx *pinutil.Tx, removeRedeemers bool) {
 			delete(mp.outpoints, txIn.PreviousOutPoint)
 		}
 		delete(mp.pool, *txHash)
+		mp.usage -= txMemUsage(tx)
 		atomic.StoreInt64(&mp.lastUpdated, time.Now().Unix())
 	}
 }
@@ -508,6 +630,96 @@ func (mp *TxPool) RemoveTransaction(tx *pinutil.Tx, removeRedeemers bool) {
 	mp.mtx.Unlock()
 }
 
+// evictTransaction removes the passed transaction along with all transactions
+// which rely on it from the pool and reports each removed transaction with the
+// given reason.  It returns the number of removed transactions.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) evictTransaction(tx *pinutil.Tx, reason RemovalReason) int {
+	descendants := mp.txDescendants(tx, nil)
+	mp.removeTransaction(tx, true)
+
+	mp.txRemoved(tx, reason)
+	for _, descendant := range descendants {
+		mp.txRemoved(descendant, reason)
+	}
+	return len(descendants) + 1
+}
+
+// txRemoved logs the removal of the passed transaction from the pool for the
+// given reason and queues it for the TxRemoved callback when one is
+// configured.  The callback is invoked by notifyRemovedTxns once the mempool
+// lock has been released.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) txRemoved(tx *pinutil.Tx, reason RemovalReason) {
+	log.Debugf("Removed transaction %v from the pool (reason: %v)",
+		tx.Hash(), reason)
+	if mp.cfg.TxRemoved != nil {
+		mp.removedTxns = append(mp.removedTxns, removedTx{tx, reason})
+	}
+}
+
+// notifyRemovedTxns invokes the TxRemoved callback for the transactions which
+// were removed from the pool since the last call.  This allows the callback to
+// block or call back into the pool.
+//
+// This function MUST NOT be called with the mempool lock held.
+func (mp *TxPool) notifyRemovedTxns() {
+	mp.mtx.Lock()
+	removed := mp.removedTxns
+	mp.removedTxns = nil
+	mp.mtx.Unlock()
+
+	for _, r := range removed {
+		mp.cfg.TxRemoved(r.tx, r.reason)
+	}
+}
+
+// ExpireTransactions removes all transactions which have been in the pool for
+// longer than the maximum transaction age along with all transactions which
+// rely on them, and returns the number of removed transactions.  Nothing is
+// removed when the policy does not define a maximum transaction age.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) ExpireTransactions() int {
+	maxAge := mp.cfg.Policy.MaxTxAge
+	if maxAge <= 0 {
+		return 0
+	}
+
+	// Protect concurrent access.  The removed transactions are reported
+	// once the lock is released.
+	defer mp.notifyRemovedTxns()
+	mp.mtx.Lock()
+	defer mp.mtx.Unlock()
+
+	cutoff := time.Now().Add(-maxAge)
+	var expired []*pinutil.Tx
+	for _, txDesc := range mp.pool {
+		if txDesc.Added.Before(cutoff) {
+			expired = append(expired, txDesc.Tx)
+		}
+	}
+
+	// Transactions which were already removed as the descendant of another
+	// expired transaction are skipped.
+	var numExpired int
+	for _, tx := range expired {
+		if _, ok := mp.pool[*tx.Hash()]; !ok {
+			continue
+		}
+		numExpired += mp.evictTransaction(tx, RemovalExpiry)
+	}
+
+	if numExpired > 0 {
+		log.Infof("Expired %d %s older than %v from the pool",
+			numExpired, pickNoun(numExpired, "transaction",
+				"transactions"), maxAge)
+	}
+	return numExpired
+}
+
 // RemoveDoubleSpends removes all transactions which spend outputs spent by the
 // passed transaction from the memory pool.  Removing those transactions then
 // leads to removing all transactions which rely on them, recursively.  This is
@@ -551,6 +763,7 @@ func (mp *TxPool) addTransaction(utxoView *blockchain.UtxoViewpoint, tx *pinutil
 	for _, txIn := range tx.MsgTx().TxIn {
 		mp.outpoints[txIn.PreviousOutPoint] = tx
 	}
+	mp.usage += txMemUsage(tx)
 	atomic.StoreInt64(&mp.lastUpdated, time.Now().Unix())
 
 	// Add unconfirmed address index entries associated with the transaction
@@ -567,6 +780,112 @@ func (mp *TxPool) addTransaction(utxoView *blockchain.UtxoViewpoint, tx *pinutil
 	return txD
 }
 
+// txMemUsage returns the estimated memory used to track the passed transaction
+// in the pool.
+func txMemUsage(tx *pinutil.Tx) int64 {
+	msgTx := tx.MsgTx()
+	return int64(msgTx.SerializeSize()) + txEntryOverhead +
+		int64(len(msgTx.TxIn))*txInOverhead +
+		int64(len(msgTx.TxOut))*txOutOverhead
+}
+
+// minFeeRate returns the minimum fee rate in satoshi/kB new transactions must
+// pay because transactions were evicted from the pool when it was full.  The
+// fee rate decays exponentially, faster the emptier the pool is, and is zero
+// once it drops below half of the minimum relay fee.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) minFeeRate() int64 {
+	if mp.rollingMinFeeRate == 0 {
+		return 0
+	}
+
+	halfLife := rollingFeeHalfLife
+	switch maxSize := mp.cfg.Policy.MaxPoolSize; {
+	case mp.usage < maxSize/4:
+		halfLife /= 4
+	case mp.usage < maxSize/2:
+		halfLife /= 2
+	}
+
+	now := time.Now()
+	elapsed := now.Sub(mp.lastRollingFeeUpdate)
+	mp.rollingMinFeeRate /= math.Pow(2, elapsed.Seconds()/halfLife.Seconds())
+	mp.lastRollingFeeUpdate = now
+	if mp.rollingMinFeeRate < float64(mp.cfg.Policy.MinRelayTxFee)/2 {
+		mp.rollingMinFeeRate = 0
+	}
+
+	return int64(mp.rollingMinFeeRate)
+}
+
+// trimToSize evicts transactions from the pool once its estimated memory usage
+// exceeds the maximum pool size until it no longer exceeds trimTargetPercent of
+// it.  The transaction with the lowest fee rate of itself and all of its
+// descendants is evicted along with those descendants first, and the minimum
+// fee rate new transactions must pay is raised to the evicted fee rate plus
+// the minimum relay fee.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) trimToSize() {
+	maxSize := mp.cfg.Policy.MaxPoolSize
+	if maxSize <= 0 || mp.usage <= maxSize {
+		return
+	}
+	targetSize := maxSize * trimTargetPercent / 100
+
+	// Determine the descendant fee rate of every transaction in the pool.
+	type evictCandidate struct {
+		tx      *pinutil.Tx
+		feeRate int64
+	}
+	candidates := make([]evictCandidate, 0, len(mp.pool))
+	cache := make(map[chainhash.Hash]map[chainhash.Hash]*pinutil.Tx)
+	for _, txDesc := range mp.pool {
+		fee, size := txDesc.Fee, GetTxVirtualSize(txDesc.Tx)
+		for hash := range mp.txDescendants(txDesc.Tx, cache) {
+			fee += mp.pool[hash].Fee
+			size += GetTxVirtualSize(mp.pool[hash].Tx)
+		}
+		candidates = append(candidates, evictCandidate{
+			tx:      txDesc.Tx,
+			feeRate: fee * 1000 / size,
+		})
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].feeRate < candidates[j].feeRate
+	})
+
+	// Evict the packages with the lowest fee rates until the pool is down
+	// to the target size.  Candidates which were already evicted as the
+	// descendant of another one are skipped.
+	var numEvicted int
+	for _, candidate := range candidates {
+		if mp.usage <= targetSize {
+			break
+		}
+		if _, ok := mp.pool[*candidate.tx.Hash()]; !ok {
+			continue
+		}
+
+		newMinFeeRate := float64(candidate.feeRate +
+			int64(mp.cfg.Policy.MinRelayTxFee))
+		if newMinFeeRate > float64(mp.minFeeRate()) {
+			mp.rollingMinFeeRate = newMinFeeRate
+			mp.lastRollingFeeUpdate = time.Now()
+		}
+
+		log.Debugf("Evicting transaction %v (descendant fee_rate=%v "+
+			"sat/kb) from full pool", candidate.tx.Hash(),
+			candidate.feeRate)
+		numEvicted += mp.evictTransaction(candidate.tx, RemovalSizeLimit)
+	}
+
+	log.Debugf("Evicted %d transactions from full pool (usage %d, min "+
+		"fee_rate=%v sat/kb)", numEvicted, mp.usage,
+		int64(mp.rollingMinFeeRate))
+}
+
 // checkPoolDoubleSpend checks whether or not the passed transaction is
 // attempting to spend coins already spent by other transactions in the pool.
 // If it does, we'll check whether each of those transactions are signaling for
@@ -830,9 +1149,13 @@ func (mp *TxPool) FetchTransaction(txHash *chainhash.Hash) (*pinutil.Tx, error)
 // valid, no error is returned. Otherwise, an error is returned indicating what
 // went wrong.
 //
+// The fee and virtual size the replacement is judged by are normally those of
+// the transaction itself, but are those of the whole package when the
+// transaction is accepted as part of a package.
+//
 // This function MUST be called with the mempool lock held (for reads).
 func (mp *TxPool) validateReplacement(tx *pinutil.Tx,
-	txFee int64) (map[chainhash.Hash]*pinutil.Tx, error) {
+	txFee, txSize int64) (map[chainhash.Hash]*pinutil.Tx, error) {
 
 	// First, we'll make sure the set of conflicting transactions doesn't
 	// exceed the maximum allowed.
@@ -865,7 +1188,6 @@ func (mp *TxPool) validateReplacement(tx *pinutil.Tx,
 	// block. Requiring that the fee rate always be increased is also an
 	// easy-to-reason about way to prevent DoS attacks via replacements.
 	var (
-		txSize           = GetTxVirtualSize(tx)
 		txFeeRate        = txFee * 1000 / txSize
 		conflictsFee     int64
 		conflictsParents = make(map[chainhash.Hash]struct{})
@@ -919,12 +1241,115 @@ func (mp *TxPool) validateReplacement(tx *pinutil.Tx,
 	return conflicts, nil
 }
 
-// maybeAcceptTransaction is the internal function which implements the public
-// MaybeAcceptTransaction.  See the comment for MaybeAcceptTransaction for
-// more details.
+// checkTransactionFees ensures the passed transaction paying the passed fee
+// satisfies the fee and priority policy of the memory pool.  It also updates
+// the state of the free transaction rate limiter when the rate limit flag is
+// set.
 //
 // This function MUST be called with the mempool lock held (for writes).
-func (mp *TxPool) maybeAcceptTransaction(tx *pinutil.Tx, isNew, rateLimit, rejectDupOrphans bool) ([]*chainhash.Hash, *TxDesc, error) {
+func (mp *TxPool) checkTransactionFees(tx *pinutil.Tx, utxoView *blockchain.UtxoViewpoint, txFee int64, nextBlockHeight int32, isNew, rateLimit bool) error {
+	// Don't allow transactions with fees too low to get into a mined block.
+	//
+	// Most miners allow a free transaction area in blocks they mine to go
+	// alongside the area used for high-priority transactions as well as
+	// transactions with fees.  A transaction size of up to 1000 bytes is
+	// considered safe to go into this section.  Further, the minimum fee
+	// calculated below on its own would encourage several small
+	// transactions to avoid fees rather than one single larger transaction
+	// which is more desirable.  Therefore, as long as the size of the
+	// transaction does not exceeed 1000 less than the reserved space for
+	// high-priority transactions, don't require a fee for it.
+	serializedSize := GetTxVirtualSize(tx)
+	minFee := calcMinRequiredTxRelayFee(serializedSize,
+		mp.cfg.Policy.MinRelayTxFee)
+	if serializedSize >= (DefaultBlockPrioritySize-1000) && txFee < minFee {
+		str := fmt.Sprintf("transaction %v has %d fees which is under "+
+			"the required amount of %d", tx.Hash(), txFee,
+			minFee)
+		return txRuleError(wire.RejectInsufficientFee, str)
+	}
+
+	// Don't allow new transactions paying less than the minimum fee rate
+	// the pool was raised to by evicting transactions when it was full.
+	// Transactions which are being added back to the memory pool from
+	// blocks that have been disconnected during a reorg are exempted.
+	if minFeeRate := mp.minFeeRate(); isNew && minFeeRate > 0 {
+		poolMinFee := minFeeRate * serializedSize / 1000
+		if txFee < poolMinFee {
+			str := fmt.Sprintf("transaction %v has %d fees which is "+
+				"under the mempool minimum fee of %d", tx.Hash(),
+				txFee, poolMinFee)
+			return txRuleError(wire.RejectInsufficientFee,
+				str)
+		}
+	}
+
+	// Require that free transactions have sufficient priority to be mined
+	// in the next block.  Transactions which are being added back to the
+	// memory pool from blocks that have been disconnected during a reorg
+	// are exempted.
+	if isNew && !mp.cfg.Policy.DisableRelayPriority && txFee < minFee {
+		currentPriority := mining.CalcPriority(tx.MsgTx(), utxoView,
+			nextBlockHeight)
+		if currentPriority <= mining.MinHighPriority {
+			str := fmt.Sprintf("transaction %v has insufficient "+
+				"priority (%g <= %g)", tx.Hash(),
+				currentPriority, mining.MinHighPriority)
+			return txRuleError(wire.RejectInsufficientFee, str)
+		}
+	}
+
+	// Free-to-relay transactions are rate limited here to prevent
+	// penny-flooding with tiny transactions as a form of attack.
+	if rateLimit && txFee < minFee {
+		nowUnix := time.Now().Unix()
+		// Decay passed data with an exponentially decaying ~10 minute
+		// window - matches bitcoind handling.
+		mp.pennyTotal *= math.Pow(1.0-1.0/600.0,
+			float64(nowUnix-mp.lastPennyUnix))
+		mp.lastPennyUnix = nowUnix
+
+		// Are we still over the limit?
+		if mp.pennyTotal >= mp.cfg.Policy.FreeTxRelayLimit*10*1000 {
+			str := fmt.Sprintf("transaction %v has been rejected "+
+				"by the rate limiter due to low fees", tx.Hash())
+			return txRuleError(wire.RejectInsufficientFee, str)
+		}
+		oldTotal := mp.pennyTotal
+
+		mp.pennyTotal += float64(serializedSize)
+		log.Tracef("rate limit: curTotal %v, nextTotal: %v, "+
+			"limit %v", oldTotal, mp.pennyTotal,
+			mp.cfg.Policy.FreeTxRelayLimit*10*1000)
+	}
+
+	return nil
+}
+
+// txAcceptance houses the details of a transaction which passed all of the
+// checks performed by checkTransactionAcceptance.
+type txAcceptance struct {
+	utxoView   *blockchain.UtxoViewpoint
+	bestHeight int32
+	fee        int64
+	conflicts  map[chainhash.Hash]*pinutil.Tx
+}
+
+// checkTransactionAcceptance performs all of the checks which determine
+// whether the passed transaction may be accepted into the memory pool without
+// modifying the pool.  The only state it updates is that of the free
+// transaction rate limiter when the rate limit flag is set.
+//
+// When the defer fees flag is set, the checks of the fee the transaction pays
+// and of the replacement of any conflicting transactions are left to the
+// caller, which is expected to perform them for the package the transaction
+// is a part of instead.
+//
+// When the transaction is an orphan, the hashes of its unknown parents are
+// returned instead.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) checkTransactionAcceptance(tx *pinutil.Tx, isNew, rateLimit, rejectDupOrphans, deferFees bool) ([]*chainhash.Hash, *txAcceptance, error) {
 	txHash := tx.Hash()
 
 	// If a transaction has witness data, and segwit isn't active yet, If
@@ -1134,71 +1559,22 @@ func (mp *TxPool) maybeAcceptTransaction(tx *pinutil.Tx, isNew, rateLimit, rejec
 		return nil, nil, txRuleError(wire.RejectNonstandard, str)
 	}
 
-	// Don't allow transactions with fees too low to get into a mined block.
-	//
-	// Most miners allow a free transaction area in blocks they mine to go
-	// alongside the area used for high-priority transactions as well as
-	// transactions with fees.  A transaction size of up to 1000 bytes is
-	// considered safe to go into this section.  Further, the minimum fee
-	// calculated below on its own would encourage several small
-	// transactions to avoid fees rather than one single larger transaction
-	// which is more desirable.  Therefore, as long as the size of the
-	// transaction does not exceeed 1000 less than the reserved space for
-	// high-priority transactions, don't require a fee for it.
-	serializedSize := GetTxVirtualSize(tx)
-	minFee := calcMinRequiredTxRelayFee(serializedSize,
-		mp.cfg.Policy.MinRelayTxFee)
-	if serializedSize >= (DefaultBlockPrioritySize-1000) && txFee < minFee {
-		str := fmt.Sprintf("transaction %v has %d fees which is under "+
-			"the required amount of %d", txHash, txFee,
-			minFee)
-		return nil, nil, txRuleError(wire.RejectInsufficientFee, str)
-	}
-
-	// Require that free transactions have sufficient priority to be mined
-	// in the next block.  Transactions which are being added back to the
-	// memory pool from blocks that have been disconnected during a reorg
-	// are exempted.
-	if isNew && !mp.cfg.Policy.DisableRelayPriority && txFee < minFee {
-		currentPriority := mining.CalcPriority(tx.MsgTx(), utxoView,
-			nextBlockHeight)
-		if currentPriority <= mining.MinHighPriority {
-			str := fmt.Sprintf("transaction %v has insufficient "+
-				"priority (%g <= %g)", txHash,
-				currentPriority, mining.MinHighPriority)
-			return nil, nil, txRuleError(wire.RejectInsufficientFee, str)
-		}
-	}
-
-	// Free-to-relay transactions are rate limited here to prevent
-	// penny-flooding with tiny transactions as a form of attack.
-	if rateLimit && txFee < minFee {
-		nowUnix := time.Now().Unix()
-		// Decay passed data with an exponentially decaying ~10 minute
-		// window - matches bitcoind handling.
-		mp.pennyTotal *= math.Pow(1.0-1.0/600.0,
-			float64(nowUnix-mp.lastPennyUnix))
-		mp.lastPennyUnix = nowUnix
-
-		// Are we still over the limit?
-		if mp.pennyTotal >= mp.cfg.Policy.FreeTxRelayLimit*10*1000 {
-			str := fmt.Sprintf("transaction %v has been rejected "+
-				"by the rate limiter due to low fees", txHash)
-			return nil, nil, txRuleError(wire.RejectInsufficientFee, str)
+	// Don't allow transactions paying too low a fee unless the fees are
+	// checked for the package the transaction is a part of by the caller.
+	if !deferFees {
+		err := mp.checkTransactionFees(tx, utxoView, txFee,
+			nextBlockHeight, isNew, rateLimit)
+		if err != nil {
+			return nil, nil, err
 		}
-		oldTotal := mp.pennyTotal
-
-		mp.pennyTotal += float64(serializedSize)
-		log.Tracef("rate limit: curTotal %v, nextTotal: %v, "+
-			"limit %v", oldTotal, mp.pennyTotal,
-			mp.cfg.Policy.FreeTxRelayLimit*10*1000)
 	}
 
 	// If the transaction has any conflicts and we've made it this far, then
 	// we're processing a potential replacement.
 	var conflicts map[chainhash.Hash]*pinutil.Tx
-	if isReplacement {
-		conflicts, err = mp.validateReplacement(tx, txFee)
+	if isReplacement && !deferFees {
+		conflicts, err = mp.validateReplacement(tx, txFee,
+			GetTxVirtualSize(tx))
 		if err != nil {
 			return nil, nil, err
 		}
@@ -1216,21 +1592,54 @@ func (mp *TxPool) maybeAcceptTransaction(tx *pinutil.Tx, isNew, rateLimit, rejec
 		return nil, nil, err
 	}
 
+	return nil, &txAcceptance{
+		utxoView:   utxoView,
+		bestHeight: bestHeight,
+		fee:        txFee,
+		conflicts:  conflicts,
+	}, nil
+}
+
+// maybeAcceptTransaction is the internal function which implements the public
+// MaybeAcceptTransaction.  See the comment for MaybeAcceptTransaction for
+// more details.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) maybeAcceptTransaction(tx *pinutil.Tx, isNew, rateLimit, rejectDupOrphans bool) ([]*chainhash.Hash, *TxDesc, error) {
+	txHash := tx.Hash()
+
+	missingParents, acceptance, err := mp.checkTransactionAcceptance(tx,
+		isNew, rateLimit, rejectDupOrphans, false)
+	if err != nil || len(missingParents) > 0 {
+		return missingParents, nil, err
+	}
+
 	// Now that we've deemed the transaction as valid, we can add it to the
 	// mempool. If it ended up replacing any transactions, we'll remove them
 	// first.
-	for _, conflict := range conflicts {
+	for _, conflict := range acceptance.conflicts {
 		log.Debugf("Replacing transaction %v (fee_rate=%v sat/kb) "+
 			"with %v (fee_rate=%v sat/kb)\n", conflict.Hash(),
-			mp.pool[*conflict.Hash()].FeePerKB, tx.Hash(),
-			txFee*1000/serializedSize)
+			mp.pool[*conflict.Hash()].FeePerKB, txHash,
+			acceptance.fee*1000/GetTxVirtualSize(tx))
 
 		// The conflict set should already include the descendants for
 		// each one, so we don't need to remove the redeemers within
 		// this call as they'll be removed eventually.
 		mp.removeTransaction(conflict, false)
+		mp.txRemoved(conflict, RemovalReplaced)
+	}
+	txD := mp.addTransaction(acceptance.utxoView, tx, acceptance.bestHeight,
+		acceptance.fee)
+
+	// Evict transactions when the pool is full.  The transaction itself
+	// might be among them when it pays a lower fee rate than the others.
+	mp.trimToSize()
+	if _, ok := mp.pool[*txHash]; !ok {
+		str := fmt.Sprintf("transaction %v was evicted since the "+
+			"mempool is full", txHash)
+		return nil, nil, txRuleError(wire.RejectInsufficientFee, str)
 	}
-	txD := mp.addTransaction(utxoView, tx, bestHeight, txFee)
 
 	log.Debugf("Accepted transaction %v (pool size: %v)", txHash,
 		len(mp.pool))
@@ -1254,6 +1663,7 @@ func (mp *TxPool) MaybeAcceptTransaction(tx *pinutil.Tx, isNew, rateLimit bool)
 	mp.mtx.Lock()
 	hashes, txD, err := mp.maybeAcceptTransaction(tx, isNew, rateLimit, true)
 	mp.mtx.Unlock()
+	mp.notifyRemovedTxns()
 
 	return hashes, txD, err
 }
@@ -1355,6 +1765,7 @@ func (mp *TxPool) ProcessOrphans(acceptedTx *pinutil.Tx) []*TxDesc {
 	mp.mtx.Lock()
 	acceptedTxns := mp.processOrphans(acceptedTx)
 	mp.mtx.Unlock()
+	mp.notifyRemovedTxns()
 
 	return acceptedTxns
 }
@@ -1373,7 +1784,9 @@ func (mp *TxPool) ProcessOrphans(acceptedTx *pinutil.Tx) []*TxDesc {
 func (mp *TxPool) ProcessTransaction(tx *pinutil.Tx, allowOrphan, rateLimit bool, tag Tag) ([]*TxDesc, error) {
 	log.Tracef("Processing transaction %v", tx.Hash())
 
-	// Protect concurrent access.
+	// Protect concurrent access.  The transactions removed while accepting
+	// it are reported once the lock is released.
+	defer mp.notifyRemovedTxns()
 	mp.mtx.Lock()
 	defer mp.mtx.Unlock()
 
@@ -1423,6 +1836,82 @@ func (mp *TxPool) ProcessTransaction(tx *pinutil.Tx, allowOrphan, rateLimit bool
 	return nil, err
 }
 
+// TestAcceptResult describes whether a transaction checked by TestMempoolAccept
+// would be accepted into the memory pool.
+type TestAcceptResult struct {
+	// Tx is the transaction which was checked.
+	Tx *pinutil.Tx
+
+	// Allowed indicates whether the transaction would be accepted.
+	Allowed bool
+
+	// MissingParents holds the unknown parents of the transaction when it
+	// is rejected as an orphan.
+	MissingParents []*chainhash.Hash
+
+	// RejectErr is the rule error the transaction was rejected with.  It
+	// is nil when the transaction is allowed or is an orphan.
+	RejectErr error
+
+	// Fee and VSize are the fee paid by the transaction and its virtual
+	// size.  The fee is only set when the transaction is allowed.
+	Fee   int64
+	VSize int64
+}
+
+// TestMempoolAccept checks whether each of the passed transactions would be
+// accepted into the memory pool by ProcessTransaction, without adding any of
+// them to the pool or touching the orphan pool.  The transactions may spend
+// the outputs of transactions earlier in the list, in which case those are
+// only allowed when all of their parents are.  Free transactions are not
+// subject to the rate limiter since nothing is relayed.
+//
+// Rule violations are reported through the results, so an error is only
+// returned when something actually went wrong while checking a transaction.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) TestMempoolAccept(txns []*pinutil.Tx) ([]*TestAcceptResult, error) {
+	// Protect concurrent access.
+	mp.mtx.Lock()
+	defer mp.mtx.Unlock()
+
+	// Transactions which pass the checks are staged in the pool so that
+	// transactions later in the list are able to spend their outputs.
+	// The staged transactions are removed once all of the transactions
+	// have been checked.
+	staged := newStagedTxns()
+	defer mp.unstageTransactions(staged)
+
+	results := make([]*TestAcceptResult, 0, len(txns))
+	for _, tx := range txns {
+		result := &TestAcceptResult{
+			Tx:    tx,
+			VSize: GetTxVirtualSize(tx),
+		}
+		results = append(results, result)
+
+		missingParents, acceptance, err := mp.checkTransactionAcceptance(
+			tx, true, false, true, false)
+		if err != nil {
+			if _, ok := err.(RuleError); !ok {
+				return nil, err
+			}
+			result.RejectErr = err
+			continue
+		}
+		if len(missingParents) > 0 {
+			result.MissingParents = missingParents
+			continue
+		}
+		result.Allowed = true
+		result.Fee = acceptance.fee
+
+		mp.stageTransaction(staged, tx, acceptance)
+	}
+
+	return results, nil
+}
+
 // Count returns the number of transactions in the main pool.  It does not
 // include the orphan pool.
 //
@@ -1471,16 +1960,29 @@ func (mp *TxPool) TxDescs() []*TxDesc {
 }
 
 // MiningDescs returns a slice of mining descriptors for all the transactions
-// in the pool.
+// in the pool along with their unconfirmed ancestors.
 //
 // This is part of the mining.TxSource interface implementation and is safe for
 // concurrent access as required by the interface contract.
 func (mp *TxPool) MiningDescs() []*mining.TxDesc {
 	mp.mtx.RLock()
 	descs := make([]*mining.TxDesc, len(mp.pool))
+	cache := make(map[chainhash.Hash]map[chainhash.Hash]*pinutil.Tx)
 	i := 0
 	for _, desc := range mp.pool {
-		descs[i] = &desc.TxDesc
+		// Copy the descriptor so the ancestors are not kept in the
+		// pool.
+		miningDesc := desc.TxDesc
+		ancestors := mp.txAncestors(desc.Tx, cache)
+		if len(ancestors) > 0 {
+			miningDesc.Ancestors = make([]chainhash.Hash, 0,
+				len(ancestors))
+			for hash := range ancestors {
+				miningDesc.Ancestors = append(
+					miningDesc.Ancestors, hash)
+			}
+		}
+		descs[i] = &miningDesc
 		i++
 	}
 	mp.mtx.RUnlock()
@@ -1537,6 +2039,165 @@ func (mp *TxPool) RawMempoolVerbose() map[string]*pinjson.GetRawMempoolVerboseRe
 	return result
 }
 
+// mempoolEntry returns the details of the passed transaction in the pool along
+// with the totals of its ancestors and descendants in the pool, which include
+// the transaction itself.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) mempoolEntry(desc *TxDesc) *pinjson.GetMempoolEntryResult {
+	tx := desc.Tx
+	vsize := GetTxVirtualSize(tx)
+
+	ancestors := mp.txAncestors(tx, nil)
+	ancestorSize, ancestorFee := vsize, desc.Fee
+	for hash := range ancestors {
+		ancestor := mp.pool[hash]
+		ancestorSize += GetTxVirtualSize(ancestor.Tx)
+		ancestorFee += ancestor.Fee
+	}
+	descendants := mp.txDescendants(tx, nil)
+	descendantSize, descendantFee := vsize, desc.Fee
+	for hash := range descendants {
+		descendant := mp.pool[hash]
+		descendantSize += GetTxVirtualSize(descendant.Tx)
+		descendantFee += descendant.Fee
+	}
+
+	// There is no way to prioritise transactions, so the modified fees
+	// are always the same as the fees the transactions pay.  The fees of
+	// the ancestors and descendants are in satoshi while the others are
+	// in bitcoin.
+	fee := pinutil.Amount(desc.Fee).ToBTC()
+	entry := &pinjson.GetMempoolEntryResult{
+		VSize:           int32(vsize),
+		Size:            int32(tx.MsgTx().SerializeSize()),
+		Weight:          blockchain.GetTransactionWeight(tx),
+		Fee:             fee,
+		ModifiedFee:     fee,
+		Time:            desc.Added.Unix(),
+		Height:          int64(desc.Height),
+		DescendantCount: int64(len(descendants) + 1),
+		DescendantSize:  descendantSize,
+		DescendantFees:  float64(descendantFee),
+		AncestorCount:   int64(len(ancestors) + 1),
+		AncestorSize:    ancestorSize,
+		AncestorFees:    float64(ancestorFee),
+		WTxId:           tx.MsgTx().WitnessHash().String(),
+		Fees: pinjson.MempoolFees{
+			Base:       fee,
+			Modified:   fee,
+			Ancestor:   pinutil.Amount(ancestorFee).ToBTC(),
+			Descendant: pinutil.Amount(descendantFee).ToBTC(),
+		},
+		Depends:           make([]string, 0),
+		BIP125Replaceable: mp.signalsReplacement(tx, nil),
+	}
+	// Parents which are spent by several inputs are only listed once.
+	depends := make(map[chainhash.Hash]struct{})
+	for _, txIn := range tx.MsgTx().TxIn {
+		hash := &txIn.PreviousOutPoint.Hash
+		if _, ok := depends[*hash]; ok || !mp.haveTransaction(hash) {
+			continue
+		}
+		depends[*hash] = struct{}{}
+		entry.Depends = append(entry.Depends, hash.String())
+	}
+
+	return entry
+}
+
+// MempoolEntry returns the details of the transaction with the passed hash in
+// the pool, including the totals of its ancestors and descendants in the pool
+// and whether it signals replacement as defined by BIP 125.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) MempoolEntry(txHash *chainhash.Hash) (*pinjson.GetMempoolEntryResult, error) {
+	mp.mtx.RLock()
+	defer mp.mtx.RUnlock()
+
+	desc, exists := mp.pool[*txHash]
+	if !exists {
+		return nil, fmt.Errorf("transaction is not in the pool")
+	}
+
+	return mp.mempoolEntry(desc), nil
+}
+
+// MempoolAncestors returns the details of all of the unconfirmed ancestors of
+// the transaction with the passed hash in the pool keyed by their hashes.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) MempoolAncestors(txHash *chainhash.Hash) (map[string]*pinjson.GetMempoolEntryResult, error) {
+	mp.mtx.RLock()
+	defer mp.mtx.RUnlock()
+
+	desc, exists := mp.pool[*txHash]
+	if !exists {
+		return nil, fmt.Errorf("transaction is not in the pool")
+	}
+
+	ancestors := mp.txAncestors(desc.Tx, nil)
+	result := make(map[string]*pinjson.GetMempoolEntryResult,
+		len(ancestors))
+	for hash := range ancestors {
+		result[hash.String()] = mp.mempoolEntry(mp.pool[hash])
+	}
+
+	return result, nil
+}
+
+// MempoolDescendants returns the details of all of the transactions in the pool
+// which spend outputs of the transaction with the passed hash, either directly
+// or through other transactions in the pool, keyed by their hashes.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) MempoolDescendants(txHash *chainhash.Hash) (map[string]*pinjson.GetMempoolEntryResult, error) {
+	mp.mtx.RLock()
+	defer mp.mtx.RUnlock()
+
+	desc, exists := mp.pool[*txHash]
+	if !exists {
+		return nil, fmt.Errorf("transaction is not in the pool")
+	}
+
+	descendants := mp.txDescendants(desc.Tx, nil)
+	result := make(map[string]*pinjson.GetMempoolEntryResult,
+		len(descendants))
+	for hash := range descendants {
+		result[hash.String()] = mp.mempoolEntry(mp.pool[hash])
+	}
+
+	return result, nil
+}
+
+// Usage returns the estimated memory usage in bytes of the transactions in the
+// main pool.  It does not include the orphan pool.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) Usage() int64 {
+	mp.mtx.RLock()
+	usage := mp.usage
+	mp.mtx.RUnlock()
+
+	return usage
+}
+
+// MinFeeRate returns the minimum fee rate per kB a transaction must pay to be
+// accepted into the pool.  It is the minimum relay fee unless transactions
+// were recently evicted due to the pool being full.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) MinFeeRate() pinutil.Amount {
+	mp.mtx.Lock()
+	minFeeRate := pinutil.Amount(mp.minFeeRate())
+	mp.mtx.Unlock()
+
+	if minFeeRate < mp.cfg.Policy.MinRelayTxFee {
+		return mp.cfg.Policy.MinRelayTxFee
+	}
+	return minFeeRate
+}
+
 // LastUpdated returns the last time a transaction was added to or removed from
 // the main pool.  It does not include the orphan pool.
 //
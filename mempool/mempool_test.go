@@ -5,6 +5,7 @@
 package mempool
 
 import (
+	"bytes"
 	"encoding/hex"
 	"reflect"
 	"strings"
@@ -1810,3 +1811,716 @@ func TestRBF(t *testing.T) {
 		}
 	}
 }
+
+// TestTestMempoolAccept ensures that transactions checked by TestMempoolAccept
+// are reported with the correct outcome, that transactions may spend the
+// outputs of transactions earlier in the list, and that the pool is left
+// untouched.
+func TestTestMempoolAccept(t *testing.T) {
+	t.Parallel()
+
+	harness, outputs, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	tc := &testContext{t, harness}
+
+	// Create a chain of transactions rooted with the first spendable output
+	// provided by the harness.
+	chainedTxns, err := harness.CreateTxChain(outputs[0], 3)
+	if err != nil {
+		t.Fatalf("unable to create transaction chain: %v", err)
+	}
+
+	// Ensure the whole chain is allowed when checked in order and that
+	// none of the transactions end up in the pool.
+	results, err := harness.txPool.TestMempoolAccept(chainedTxns)
+	if err != nil {
+		t.Fatalf("TestMempoolAccept: unexpected error: %v", err)
+	}
+	if len(results) != len(chainedTxns) {
+		t.Fatalf("TestMempoolAccept: got %d results, want %d",
+			len(results), len(chainedTxns))
+	}
+	for i, result := range results {
+		if !result.Allowed || result.RejectErr != nil {
+			t.Fatalf("TestMempoolAccept: transaction %d not "+
+				"allowed: %v", i, result.RejectErr)
+		}
+		if result.VSize != GetTxVirtualSize(chainedTxns[i]) {
+			t.Fatalf("TestMempoolAccept: unexpected vsize for "+
+				"transaction %d -- got %d, want %d", i,
+				result.VSize, GetTxVirtualSize(chainedTxns[i]))
+		}
+		testPoolMembership(tc, chainedTxns[i], false, false)
+	}
+	if harness.txPool.Count() != 0 || len(harness.txPool.outpoints) != 0 {
+		t.Fatalf("TestMempoolAccept: pool modified -- %d "+
+			"transactions, %d outpoints", harness.txPool.Count(),
+			len(harness.txPool.outpoints))
+	}
+
+	// Ensure the descendants are reported as orphans when their parent is
+	// left out of the list.
+	results, err = harness.txPool.TestMempoolAccept(chainedTxns[1:])
+	if err != nil {
+		t.Fatalf("TestMempoolAccept: unexpected error: %v", err)
+	}
+	for i, result := range results {
+		if result.Allowed || len(result.MissingParents) != 1 {
+			t.Fatalf("TestMempoolAccept: transaction %d not "+
+				"reported as an orphan", i+1)
+		}
+		testPoolMembership(tc, chainedTxns[i+1], false, false)
+	}
+
+	// Add the root of the chain to the pool and ensure a transaction which
+	// double spends it without replacing it is rejected while the rest of
+	// the chain is still allowed.
+	_, err = harness.txPool.ProcessTransaction(chainedTxns[0], false, false, 0)
+	if err != nil {
+		t.Fatalf("ProcessTransaction: unexpected error: %v", err)
+	}
+	doubleSpend, err := harness.CreateSignedTx(outputs, 1, 1000, false)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+	checkTxns := append([]*pinutil.Tx{doubleSpend}, chainedTxns[1:]...)
+	results, err = harness.txPool.TestMempoolAccept(checkTxns)
+	if err != nil {
+		t.Fatalf("TestMempoolAccept: unexpected error: %v", err)
+	}
+	if results[0].Allowed || results[0].RejectErr == nil {
+		t.Fatal("TestMempoolAccept: double spend was allowed")
+	}
+	code, _ := extractRejectCode(results[0].RejectErr)
+	if code != wire.RejectDuplicate {
+		t.Fatalf("TestMempoolAccept: unexpected reject code -- got "+
+			"%v, want %v", code, wire.RejectDuplicate)
+	}
+	for i, result := range results[1:] {
+		if !result.Allowed {
+			t.Fatalf("TestMempoolAccept: transaction %d not "+
+				"allowed: %v", i+1, result.RejectErr)
+		}
+	}
+	if harness.txPool.Count() != 1 ||
+		harness.txPool.CheckSpend(outputs[0].outPoint) != chainedTxns[0] {
+
+		t.Fatal("TestMempoolAccept: pool modified")
+	}
+}
+
+// TestMaxPoolSize ensures that the transactions with the lowest descendant fee
+// rate are evicted once the pool exceeds its maximum size, and that new
+// transactions must then pay more than the fee rate of the evicted ones.
+func TestMaxPoolSize(t *testing.T) {
+	t.Parallel()
+
+	harness, _, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	ctx := &testContext{t, harness}
+
+	// Add a parent paying a low fee with a child paying a high one, along
+	// with a transaction paying a moderate fee on its own, and then limit
+	// the pool so it is trimmed to its current size.
+	coinbase := ctx.addCoinbaseTx(4)
+	coinbaseOut := func(i uint32) []spendableOutput {
+		return []spendableOutput{txOutToSpendableOut(coinbase, i)}
+	}
+	parent := ctx.addSignedTx(coinbaseOut(0), 1, 500, false, false)
+	child := ctx.addSignedTx(
+		[]spendableOutput{txOutToSpendableOut(parent, 0)}, 1, 20000,
+		false, false,
+	)
+	moderate := ctx.addSignedTx(coinbaseOut(1), 1, 3000, false, false)
+	harness.txPool.cfg.Policy.MaxPoolSize = harness.txPool.Usage() * 100 /
+		trimTargetPercent
+	if minFeeRate := harness.txPool.MinFeeRate(); minFeeRate !=
+		harness.txPool.cfg.Policy.MinRelayTxFee {
+
+		t.Fatalf("unexpected min fee rate before eviction -- got %v, "+
+			"want %v", minFeeRate,
+			harness.txPool.cfg.Policy.MinRelayTxFee)
+	}
+
+	// Adding another transaction must evict the moderate one since the
+	// parent is paid for by its child.  The eviction is reported without
+	// the mempool lock held.
+	var removed []*pinutil.Tx
+	harness.txPool.cfg.TxRemoved = func(tx *pinutil.Tx, reason RemovalReason) {
+		if harness.txPool.HaveTransaction(tx.Hash()) {
+			t.Errorf("removed transaction %v is still in the pool",
+				tx.Hash())
+		}
+		if reason != RemovalSizeLimit {
+			t.Errorf("unexpected removal reason for %v -- got %v, "+
+				"want %v", tx.Hash(), reason, RemovalSizeLimit)
+		}
+		removed = append(removed, tx)
+	}
+	ctx.addSignedTx(coinbaseOut(2), 1, 5000, false, false)
+	testPoolMembership(ctx, moderate, false, false)
+	if len(removed) != 1 || removed[0] != moderate {
+		t.Fatalf("unexpected removal notifications %v", removed)
+	}
+	testPoolMembership(ctx, parent, false, true)
+	testPoolMembership(ctx, child, false, true)
+	targetSize := harness.txPool.cfg.Policy.MaxPoolSize *
+		trimTargetPercent / 100
+	if harness.txPool.Usage() > targetSize {
+		t.Fatalf("pool usage %d exceeds the trim target size %d",
+			harness.txPool.Usage(), targetSize)
+	}
+
+	// The minimum fee rate must now exceed the fee rate of the evicted
+	// transaction.
+	evictedFeeRate := pinutil.Amount(3000 * 1000 /
+		GetTxVirtualSize(moderate))
+	minFeeRate := harness.txPool.MinFeeRate()
+	if minFeeRate <= evictedFeeRate {
+		t.Fatalf("min fee rate %v does not exceed the evicted fee "+
+			"rate %v", minFeeRate, evictedFeeRate)
+	}
+
+	// Transactions paying less than the minimum fee rate are rejected.
+	cheap, err := harness.CreateSignedTx(coinbaseOut(3), 1, 1000, false)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+	_, err = harness.txPool.ProcessTransaction(cheap, false, false, 0)
+	if err == nil {
+		t.Fatal("ProcessTransaction: accepted transaction below the " +
+			"min fee rate")
+	}
+	code, _ := extractRejectCode(err)
+	if code != wire.RejectInsufficientFee {
+		t.Fatalf("ProcessTransaction: unexpected reject code -- got "+
+			"%v, want %v", code, wire.RejectInsufficientFee)
+	}
+	testPoolMembership(ctx, cheap, false, false)
+
+	// The minimum fee rate decays over time and no longer applies once it
+	// drops below half of the minimum relay fee.
+	harness.txPool.mtx.Lock()
+	harness.txPool.lastRollingFeeUpdate = time.Now().Add(-rollingFeeHalfLife * 10)
+	harness.txPool.mtx.Unlock()
+	if minFeeRate := harness.txPool.MinFeeRate(); minFeeRate !=
+		harness.txPool.cfg.Policy.MinRelayTxFee {
+
+		t.Fatalf("unexpected min fee rate after decay -- got %v, "+
+			"want %v", minFeeRate,
+			harness.txPool.cfg.Policy.MinRelayTxFee)
+	}
+}
+
+// TestExpireTransactions ensures that transactions which stayed in the pool for
+// longer than the maximum transaction age are removed along with their
+// descendants and reported with the expiry reason.
+func TestExpireTransactions(t *testing.T) {
+	t.Parallel()
+
+	harness, _, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	ctx := &testContext{t, harness}
+
+	// The callback is invoked without the mempool lock held, so querying
+	// the pool from it must not deadlock.
+	removed := make(map[chainhash.Hash]RemovalReason)
+	harness.txPool.cfg.TxRemoved = func(tx *pinutil.Tx, reason RemovalReason) {
+		if harness.txPool.HaveTransaction(tx.Hash()) {
+			t.Errorf("removed transaction %v is still in the pool",
+				tx.Hash())
+		}
+		removed[*tx.Hash()] = reason
+	}
+
+	// Add an old transaction with a new child along with another new
+	// transaction.
+	coinbase := ctx.addCoinbaseTx(2)
+	old := ctx.addSignedTx(
+		[]spendableOutput{txOutToSpendableOut(coinbase, 0)}, 1, 1000,
+		false, false,
+	)
+	child := ctx.addSignedTx(
+		[]spendableOutput{txOutToSpendableOut(old, 0)}, 1, 1000,
+		false, false,
+	)
+	recent := ctx.addSignedTx(
+		[]spendableOutput{txOutToSpendableOut(coinbase, 1)}, 1, 1000,
+		false, false,
+	)
+	harness.txPool.mtx.Lock()
+	harness.txPool.pool[*old.Hash()].Added = time.Now().Add(-2 * time.Hour)
+	harness.txPool.mtx.Unlock()
+
+	// Nothing expires without a maximum transaction age.
+	if n := harness.txPool.ExpireTransactions(); n != 0 {
+		t.Fatalf("expired %d transactions without a maximum age", n)
+	}
+
+	// The old transaction and its child expire once the maximum age is
+	// exceeded while the recent one stays in the pool.
+	harness.txPool.cfg.Policy.MaxTxAge = time.Hour
+	if n := harness.txPool.ExpireTransactions(); n != 2 {
+		t.Fatalf("unexpected number of expired transactions -- got "+
+			"%d, want 2", n)
+	}
+	testPoolMembership(ctx, old, false, false)
+	testPoolMembership(ctx, child, false, false)
+	testPoolMembership(ctx, recent, false, true)
+
+	if len(removed) != 2 {
+		t.Fatalf("unexpected number of removal notifications -- got "+
+			"%d, want 2", len(removed))
+	}
+	for _, tx := range []*pinutil.Tx{old, child} {
+		reason, ok := removed[*tx.Hash()]
+		if !ok {
+			t.Fatalf("missing removal notification for %v",
+				tx.Hash())
+		}
+		if reason != RemovalExpiry {
+			t.Fatalf("unexpected removal reason for %v -- got %v, "+
+				"want %v", tx.Hash(), reason, RemovalExpiry)
+		}
+	}
+}
+
+// TestDumpLoad ensures that transactions written by Dump are accepted into a
+// new pool by Load in the same state, keeping the time they were added, while
+// expired transactions are skipped.
+func TestDumpLoad(t *testing.T) {
+	t.Parallel()
+
+	harness, _, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	ctx := &testContext{t, harness}
+
+	// Add a chain of transactions along with an unrelated transaction
+	// which was added long ago.
+	coinbase := ctx.addCoinbaseTx(2)
+	chainedTxns, err := harness.CreateTxChain(
+		txOutToSpendableOut(coinbase, 0), 3,
+	)
+	if err != nil {
+		t.Fatalf("unable to create transaction chain: %v", err)
+	}
+	for _, tx := range chainedTxns {
+		_, err := harness.txPool.ProcessTransaction(tx, false, false, 0)
+		if err != nil {
+			t.Fatalf("ProcessTransaction: failed to accept "+
+				"transaction: %v", err)
+		}
+	}
+	old := ctx.addSignedTx(
+		[]spendableOutput{txOutToSpendableOut(coinbase, 1)}, 1, 1000,
+		false, false,
+	)
+	oldAdded := time.Unix(time.Now().Add(-2*time.Hour).Unix(), 0)
+	harness.txPool.mtx.Lock()
+	harness.txPool.pool[*old.Hash()].Added = oldAdded
+	harness.txPool.mtx.Unlock()
+
+	var buf bytes.Buffer
+	n, err := harness.txPool.Dump(&buf)
+	if err != nil {
+		t.Fatalf("Dump: unexpected error: %v", err)
+	}
+	if n != len(chainedTxns)+1 {
+		t.Fatalf("Dump: unexpected number of transactions -- got %d, "+
+			"want %d", n, len(chainedTxns)+1)
+	}
+	dump := buf.Bytes()
+
+	// Loading the transactions into a new pool must accept all of them,
+	// regardless of the random order of the pool, and keep the time the
+	// old transaction was added.
+	harness.txPool = New(&harness.txPool.cfg)
+	result, err := harness.txPool.Load(bytes.NewReader(dump), nil)
+	if err != nil {
+		t.Fatalf("Load: unexpected error: %v", err)
+	}
+	if *result != (LoadResult{Accepted: len(chainedTxns) + 1}) {
+		t.Fatalf("Load: unexpected result %+v", *result)
+	}
+	for _, tx := range append(chainedTxns, old) {
+		testPoolMembership(ctx, tx, false, true)
+	}
+	harness.txPool.mtx.RLock()
+	added := harness.txPool.pool[*old.Hash()].Added
+	harness.txPool.mtx.RUnlock()
+	if !added.Equal(oldAdded) {
+		t.Fatalf("Load: unexpected added time -- got %v, want %v",
+			added, oldAdded)
+	}
+
+	// The old transaction is skipped once it exceeds the maximum age.
+	harness.txPool = New(&harness.txPool.cfg)
+	harness.txPool.cfg.Policy.MaxTxAge = time.Hour
+	result, err = harness.txPool.Load(bytes.NewReader(dump), nil)
+	if err != nil {
+		t.Fatalf("Load: unexpected error: %v", err)
+	}
+	want := LoadResult{Accepted: len(chainedTxns), Expired: 1}
+	if *result != want {
+		t.Fatalf("Load: unexpected result -- got %+v, want %+v",
+			*result, want)
+	}
+	testPoolMembership(ctx, old, false, false)
+}
+
+// TestMiningDescsAncestors ensures the mining descriptors of the transactions
+// in the pool list their unconfirmed ancestors.
+func TestMiningDescsAncestors(t *testing.T) {
+	t.Parallel()
+
+	harness, _, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	ctx := &testContext{t, harness}
+
+	// Create a chain of three transactions.
+	coinbase := ctx.addCoinbaseTx(1)
+	parent := ctx.addSignedTx(
+		[]spendableOutput{txOutToSpendableOut(coinbase, 0)}, 1, 1000,
+		false, false,
+	)
+	child := ctx.addSignedTx(
+		[]spendableOutput{txOutToSpendableOut(parent, 0)}, 1, 1000,
+		false, false,
+	)
+	grandchild := ctx.addSignedTx(
+		[]spendableOutput{txOutToSpendableOut(child, 0)}, 1, 1000,
+		false, false,
+	)
+
+	wantAncestors := map[chainhash.Hash][]*pinutil.Tx{
+		*parent.Hash():     nil,
+		*child.Hash():      {parent},
+		*grandchild.Hash(): {parent, child},
+	}
+	descs := harness.txPool.MiningDescs()
+	if len(descs) != len(wantAncestors) {
+		t.Fatalf("unexpected number of mining descriptors -- got %d, "+
+			"want %d", len(descs), len(wantAncestors))
+	}
+	for _, desc := range descs {
+		want := wantAncestors[*desc.Tx.Hash()]
+		if len(desc.Ancestors) != len(want) {
+			t.Fatalf("unexpected number of ancestors for %v -- "+
+				"got %d, want %d", desc.Tx.Hash(),
+				len(desc.Ancestors), len(want))
+		}
+		for _, ancestor := range want {
+			found := false
+			for _, hash := range desc.Ancestors {
+				if hash == *ancestor.Hash() {
+					found = true
+				}
+			}
+			if !found {
+				t.Fatalf("ancestor %v of %v is missing",
+					ancestor.Hash(), desc.Tx.Hash())
+			}
+		}
+	}
+
+	// The ancestors are not kept in the pool.
+	harness.txPool.mtx.RLock()
+	defer harness.txPool.mtx.RUnlock()
+	if harness.txPool.pool[*grandchild.Hash()].Ancestors != nil {
+		t.Fatalf("ancestors kept in the pool")
+	}
+}
+
+// TestMempoolEntry ensures the details of transactions in the pool include the
+// totals of their ancestors and descendants along with whether they signal
+// replacement, and that their ancestors and descendants are reported.
+func TestMempoolEntry(t *testing.T) {
+	t.Parallel()
+
+	harness, _, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	ctx := &testContext{t, harness}
+
+	// Create a chain of three transactions where only the first signals
+	// replacement along with a lone transaction which does not, and a
+	// transaction which spends two outputs of the same parent.
+	coinbase := ctx.addCoinbaseTx(3)
+	parent := ctx.addSignedTx(
+		[]spendableOutput{txOutToSpendableOut(coinbase, 0)}, 1, 1000,
+		true, false,
+	)
+	child := ctx.addSignedTx(
+		[]spendableOutput{txOutToSpendableOut(parent, 0)}, 1, 2000,
+		false, false,
+	)
+	grandchild := ctx.addSignedTx(
+		[]spendableOutput{txOutToSpendableOut(child, 0)}, 1, 3000,
+		false, false,
+	)
+	lone := ctx.addSignedTx(
+		[]spendableOutput{txOutToSpendableOut(coinbase, 1)}, 1, 1000,
+		false, false,
+	)
+	split := ctx.addSignedTx(
+		[]spendableOutput{txOutToSpendableOut(coinbase, 2)}, 2, 1000,
+		false, false,
+	)
+	merge := ctx.addSignedTx([]spendableOutput{
+		txOutToSpendableOut(split, 0), txOutToSpendableOut(split, 1),
+	}, 1, 1500, false, false)
+
+	tests := []struct {
+		name            string
+		tx              *pinutil.Tx
+		fee             pinutil.Amount
+		ancestorCount   int64
+		ancestorFees    pinutil.Amount
+		descendantCount int64
+		descendantFees  pinutil.Amount
+		depends         []*pinutil.Tx
+		replaceable     bool
+	}{
+		{
+			name:            "parent",
+			tx:              parent,
+			fee:             1000,
+			ancestorCount:   1,
+			ancestorFees:    1000,
+			descendantCount: 3,
+			descendantFees:  6000,
+			replaceable:     true,
+		},
+		{
+			name:            "child",
+			tx:              child,
+			fee:             2000,
+			ancestorCount:   2,
+			ancestorFees:    3000,
+			descendantCount: 2,
+			descendantFees:  5000,
+			depends:         []*pinutil.Tx{parent},
+			replaceable:     true,
+		},
+		{
+			name:            "grandchild",
+			tx:              grandchild,
+			fee:             3000,
+			ancestorCount:   3,
+			ancestorFees:    6000,
+			descendantCount: 1,
+			descendantFees:  3000,
+			depends:         []*pinutil.Tx{child},
+			replaceable:     true,
+		},
+		{
+			name:            "lone",
+			tx:              lone,
+			fee:             1000,
+			ancestorCount:   1,
+			ancestorFees:    1000,
+			descendantCount: 1,
+			descendantFees:  1000,
+		},
+		{
+			name:            "merge",
+			tx:              merge,
+			fee:             1500,
+			ancestorCount:   2,
+			ancestorFees:    2500,
+			descendantCount: 1,
+			descendantFees:  1500,
+			depends:         []*pinutil.Tx{split},
+		},
+	}
+
+	for _, test := range tests {
+		entry, err := harness.txPool.MempoolEntry(test.tx.Hash())
+		if err != nil {
+			t.Fatalf("%s: unable to get mempool entry: %v", test.name,
+				err)
+		}
+		if entry.Fees.Base != test.fee.ToBTC() {
+			t.Fatalf("%s: unexpected fee -- got %v, want %v",
+				test.name, entry.Fees.Base, test.fee.ToBTC())
+		}
+		if entry.AncestorCount != test.ancestorCount {
+			t.Fatalf("%s: unexpected ancestor count -- got %d, "+
+				"want %d", test.name, entry.AncestorCount,
+				test.ancestorCount)
+		}
+		if entry.AncestorFees != float64(test.ancestorFees) ||
+			entry.Fees.Ancestor != test.ancestorFees.ToBTC() {
+
+			t.Fatalf("%s: unexpected ancestor fees -- got %v and "+
+				"%v, want %v", test.name, entry.AncestorFees,
+				entry.Fees.Ancestor, test.ancestorFees)
+		}
+		if entry.DescendantCount != test.descendantCount {
+			t.Fatalf("%s: unexpected descendant count -- got %d, "+
+				"want %d", test.name, entry.DescendantCount,
+				test.descendantCount)
+		}
+		if entry.DescendantFees != float64(test.descendantFees) ||
+			entry.Fees.Descendant != test.descendantFees.ToBTC() {
+
+			t.Fatalf("%s: unexpected descendant fees -- got %v "+
+				"and %v, want %v", test.name,
+				entry.DescendantFees, entry.Fees.Descendant,
+				test.descendantFees)
+		}
+		if len(entry.Depends) != len(test.depends) {
+			t.Fatalf("%s: unexpected number of dependencies -- "+
+				"got %d, want %d", test.name,
+				len(entry.Depends), len(test.depends))
+		}
+		for i, depend := range test.depends {
+			if entry.Depends[i] != depend.Hash().String() {
+				t.Fatalf("%s: unexpected dependency -- got %v, "+
+					"want %v", test.name, entry.Depends[i],
+					depend.Hash())
+			}
+		}
+		if entry.BIP125Replaceable != test.replaceable {
+			t.Fatalf("%s: unexpected replaceability -- got %v, "+
+				"want %v", test.name, entry.BIP125Replaceable,
+				test.replaceable)
+		}
+	}
+
+	// The ancestors and descendants are keyed by their hashes.
+	ancestors, err := harness.txPool.MempoolAncestors(grandchild.Hash())
+	if err != nil {
+		t.Fatalf("unable to get mempool ancestors: %v", err)
+	}
+	if len(ancestors) != 2 || ancestors[parent.Hash().String()] == nil ||
+		ancestors[child.Hash().String()] == nil {
+
+		t.Fatalf("unexpected ancestors %v", ancestors)
+	}
+	descendants, err := harness.txPool.MempoolDescendants(parent.Hash())
+	if err != nil {
+		t.Fatalf("unable to get mempool descendants: %v", err)
+	}
+	if len(descendants) != 2 ||
+		descendants[child.Hash().String()] == nil ||
+		descendants[grandchild.Hash().String()] == nil {
+
+		t.Fatalf("unexpected descendants %v", descendants)
+	}
+
+	// Transactions which are not in the pool must be rejected.
+	if _, err := harness.txPool.MempoolEntry(coinbase.Hash()); err == nil {
+		t.Fatalf("mempool entry for transaction not in the pool")
+	}
+	if _, err := harness.txPool.MempoolAncestors(coinbase.Hash()); err == nil {
+		t.Fatalf("mempool ancestors for transaction not in the pool")
+	}
+	if _, err := harness.txPool.MempoolDescendants(coinbase.Hash()); err == nil {
+		t.Fatalf("mempool descendants for transaction not in the pool")
+	}
+}
+
+// TestProcessPackage ensures a child paying a high fee gets its parent paying
+// too low a fee on its own accepted when they are processed as a package, while
+// packages paying too low a fee as a whole or not forming a package of a child
+// and its parents are rejected.
+func TestProcessPackage(t *testing.T) {
+	t.Parallel()
+
+	harness, _, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	ctx := &testContext{t, harness}
+
+	// Enable relay priority so free transactions are rejected on their
+	// own.
+	harness.txPool.cfg.Policy.DisableRelayPriority = false
+
+	// Fund the transactions with an unconfirmed transaction so spending
+	// its outputs has no priority.
+	coinbase := ctx.addCoinbaseTx(1)
+	funding := ctx.addSignedTx(
+		[]spendableOutput{txOutToSpendableOut(coinbase, 0)}, 2, 1000,
+		false, false,
+	)
+	createTx := func(input spendableOutput, fee pinutil.Amount) *pinutil.Tx {
+		t.Helper()
+		tx, err := harness.CreateSignedTx(
+			[]spendableOutput{input}, 1, fee, false,
+		)
+		if err != nil {
+			t.Fatalf("unable to create transaction: %v", err)
+		}
+		return tx
+	}
+
+	// The free parent is rejected on its own and its child is an orphan.
+	parent := createTx(txOutToSpendableOut(funding, 0), 0)
+	child := createTx(txOutToSpendableOut(parent, 0), 10000)
+	_, err = harness.txPool.ProcessTransaction(parent, false, false, 0)
+	if !isInsufficientFee(err) {
+		t.Fatalf("free parent not rejected for its fee: %v", err)
+	}
+	_, err = harness.txPool.ProcessTransaction(child, true, false, 0)
+	if err != nil {
+		t.Fatalf("unable to process child: %v", err)
+	}
+	testPoolMembership(ctx, child, true, false)
+
+	// Packages which are not a child preceded by its parents are rejected.
+	other := createTx(txOutToSpendableOut(funding, 1), 10000)
+	invalidPkgs := [][]*pinutil.Tx{
+		{child, parent},
+		{other, parent, child},
+		{parent, parent, child},
+	}
+	for i, pkg := range invalidPkgs {
+		_, err := harness.txPool.ProcessPackage(pkg, false)
+		if code, _ := extractRejectCode(err); code != wire.RejectInvalid {
+			t.Fatalf("invalid package #%d not rejected: %v", i, err)
+		}
+	}
+	testPoolMembership(ctx, parent, false, false)
+	testPoolMembership(ctx, other, false, false)
+
+	// The package pays enough as a whole, so both transactions are
+	// accepted and the child is removed from the orphan pool.
+	accepted, err := harness.txPool.ProcessPackage(
+		[]*pinutil.Tx{parent, child}, false,
+	)
+	if err != nil {
+		t.Fatalf("unable to process package: %v", err)
+	}
+	if len(accepted) != 2 || accepted[0].Tx != parent ||
+		accepted[1].Tx != child {
+
+		t.Fatalf("unexpected accepted transactions: %v", accepted)
+	}
+	testPoolMembership(ctx, parent, false, true)
+	testPoolMembership(ctx, child, false, true)
+
+	// A package paying too low a fee as a whole is rejected.
+	parent2 := createTx(txOutToSpendableOut(funding, 1), 0)
+	child2 := createTx(txOutToSpendableOut(parent2, 0), 1)
+	_, err = harness.txPool.ProcessPackage(
+		[]*pinutil.Tx{parent2, child2}, false,
+	)
+	if !isInsufficientFee(err) {
+		t.Fatalf("low fee package not rejected for its fee: %v", err)
+	}
+	testPoolMembership(ctx, parent2, false, false)
+	testPoolMembership(ctx, child2, false, false)
+}
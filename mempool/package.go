@@ -0,0 +1,402 @@
+// Copyright (c) 2013-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nyodeco/pind/chaincfg/chainhash"
+	"github.com/nyodeco/pind/mining"
+	"github.com/nyodeco/pind/wire"
+	"github.com/nyodeco/pinutil"
+)
+
+const (
+	// MaxPackageCount is the maximum number of transactions a package may
+	// consist of.
+	MaxPackageCount = 25
+
+	// MaxPackageSize is the maximum total virtual size of the transactions
+	// a package may consist of.
+	MaxPackageSize = 101000
+)
+
+// stagedTxns tracks the transactions which were temporarily added to the pool
+// while checking transactions which spend their outputs, along with the
+// spenders of the outpoints they displaced.
+type stagedTxns struct {
+	txns     []*pinutil.Tx
+	spenders map[wire.OutPoint]*pinutil.Tx
+}
+
+// newStagedTxns returns an empty set of staged transactions.
+func newStagedTxns() *stagedTxns {
+	return &stagedTxns{
+		spenders: make(map[wire.OutPoint]*pinutil.Tx),
+	}
+}
+
+// stageTransaction temporarily adds the passed transaction which passed the
+// acceptance checks to the pool so that transactions spending its outputs can
+// be checked.  Nothing besides the pool and the spent outpoints is updated.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) stageTransaction(staged *stagedTxns, tx *pinutil.Tx, acceptance *txAcceptance) {
+	mp.pool[*tx.Hash()] = &TxDesc{
+		TxDesc: mining.TxDesc{
+			Tx:       tx,
+			Added:    time.Now(),
+			Height:   acceptance.bestHeight,
+			Fee:      acceptance.fee,
+			FeePerKB: acceptance.fee * 1000 / GetTxVirtualSize(tx),
+		},
+	}
+	for _, txIn := range tx.MsgTx().TxIn {
+		prevOut := txIn.PreviousOutPoint
+		if _, ok := staged.spenders[prevOut]; !ok {
+			staged.spenders[prevOut] = mp.outpoints[prevOut]
+		}
+		mp.outpoints[prevOut] = tx
+	}
+	staged.txns = append(staged.txns, tx)
+}
+
+// unstageTransactions removes the passed staged transactions from the pool and
+// restores the spenders of the outpoints they displaced.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) unstageTransactions(staged *stagedTxns) {
+	for _, tx := range staged.txns {
+		delete(mp.pool, *tx.Hash())
+	}
+	for prevOut, spender := range staged.spenders {
+		if spender == nil {
+			delete(mp.outpoints, prevOut)
+			continue
+		}
+		mp.outpoints[prevOut] = spender
+	}
+	staged.txns = nil
+	staged.spenders = make(map[wire.OutPoint]*pinutil.Tx)
+}
+
+// checkPackage ensures the passed transactions form a package which can be
+// accepted into the pool as a whole.  A package consists of a child
+// transaction, which comes last, preceded by its parents sorted so that every
+// transaction comes after the transactions in the package it spends.  The
+// transactions may not spend the same outputs more than once and may not
+// exceed the maximum number of transactions or total virtual size of a package.
+func checkPackage(txns []*pinutil.Tx) error {
+	if len(txns) == 0 || len(txns) > MaxPackageCount {
+		str := fmt.Sprintf("package must consist of between 1 and %d "+
+			"transactions", MaxPackageCount)
+		return txRuleError(wire.RejectInvalid, str)
+	}
+
+	var totalSize int64
+	seen := make(map[chainhash.Hash]struct{}, len(txns))
+	spent := make(map[wire.OutPoint]struct{})
+	for _, tx := range txns {
+		totalSize += GetTxVirtualSize(tx)
+		if _, ok := seen[*tx.Hash()]; ok {
+			str := fmt.Sprintf("package contains transaction %v "+
+				"more than once", tx.Hash())
+			return txRuleError(wire.RejectInvalid, str)
+		}
+		seen[*tx.Hash()] = struct{}{}
+
+		for _, txIn := range tx.MsgTx().TxIn {
+			prevOut := txIn.PreviousOutPoint
+			if _, ok := spent[prevOut]; ok {
+				str := fmt.Sprintf("package transaction %v "+
+					"spends output %v which is already "+
+					"spent in the package", tx.Hash(),
+					prevOut)
+				return txRuleError(wire.RejectInvalid, str)
+			}
+			spent[prevOut] = struct{}{}
+		}
+	}
+	if totalSize > MaxPackageSize {
+		str := fmt.Sprintf("package virtual size of %d is larger than "+
+			"the max allowed size of %d", totalSize, MaxPackageSize)
+		return txRuleError(wire.RejectInvalid, str)
+	}
+
+	// Every transaction other than the child must be a parent of the child
+	// and may only spend transactions in the package which precede it.
+	child := txns[len(txns)-1]
+	childParents := make(map[chainhash.Hash]struct{})
+	for _, txIn := range child.MsgTx().TxIn {
+		childParents[txIn.PreviousOutPoint.Hash] = struct{}{}
+	}
+	preceding := make(map[chainhash.Hash]struct{}, len(txns))
+	for i, tx := range txns {
+		if _, ok := childParents[*tx.Hash()]; !ok && i != len(txns)-1 {
+			str := fmt.Sprintf("package transaction %v is not a "+
+				"parent of the child %v", tx.Hash(), child.Hash())
+			return txRuleError(wire.RejectInvalid, str)
+		}
+		for _, txIn := range tx.MsgTx().TxIn {
+			hash := txIn.PreviousOutPoint.Hash
+			if _, ok := seen[hash]; !ok {
+				continue
+			}
+			if _, ok := preceding[hash]; !ok {
+				str := fmt.Sprintf("package transaction %v "+
+					"comes before its parent %v", tx.Hash(),
+					hash)
+				return txRuleError(wire.RejectInvalid, str)
+			}
+		}
+		preceding[*tx.Hash()] = struct{}{}
+	}
+
+	return nil
+}
+
+// checkPackageFees ensures a package paying the passed total fee for the passed
+// total virtual size pays at least the minimum relay fee and the minimum fee
+// the pool was raised to by evicting transactions when it was full.  Unlike a
+// single transaction, a package is never relayed for free based on priority.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) checkPackageFees(pkgFee, pkgSize int64) error {
+	minFee := calcMinRequiredTxRelayFee(pkgSize, mp.cfg.Policy.MinRelayTxFee)
+	if pkgFee < minFee {
+		str := fmt.Sprintf("package has %d fees which is under the "+
+			"required amount of %d", pkgFee, minFee)
+		return txRuleError(wire.RejectInsufficientFee, str)
+	}
+
+	if minFeeRate := mp.minFeeRate(); minFeeRate > 0 {
+		poolMinFee := minFeeRate * pkgSize / 1000
+		if pkgFee < poolMinFee {
+			str := fmt.Sprintf("package has %d fees which is under "+
+				"the mempool minimum fee of %d", pkgFee,
+				poolMinFee)
+			return txRuleError(wire.RejectInsufficientFee, str)
+		}
+	}
+
+	return nil
+}
+
+// isInsufficientFee returns whether the passed error is a rule error rejecting
+// a transaction for paying too low a fee.
+func isInsufficientFee(err error) bool {
+	code, found := extractRejectCode(err)
+	return found && code == wire.RejectInsufficientFee
+}
+
+// acceptPackage checks the passed transactions, which were rejected on their
+// own for paying too low a fee or spend such transactions, together and adds
+// them to the pool when the package as a whole pays a sufficient fee and
+// satisfies the RBF policy for any transactions it replaces.  When the pool is
+// full and some of the package is evicted right away, the transactions that
+// remain in the pool are returned along with an error.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) acceptPackage(txns []*pinutil.Tx) ([]*TxDesc, error) {
+	// Check every transaction with the fees deferred, staging each one so
+	// the transactions spending its outputs can be checked.
+	staged := newStagedTxns()
+	acceptances := make([]*txAcceptance, 0, len(txns))
+	var pkgFee, pkgSize int64
+	for _, tx := range txns {
+		missingParents, acceptance, err := mp.checkTransactionAcceptance(
+			tx, true, false, false, true)
+		if err == nil && len(missingParents) > 0 {
+			str := fmt.Sprintf("package transaction %v references "+
+				"outputs of unknown or fully-spent transaction "+
+				"%v", tx.Hash(), missingParents[0])
+			err = txRuleError(wire.RejectDuplicate, str)
+		}
+		if err != nil {
+			mp.unstageTransactions(staged)
+			return nil, err
+		}
+		mp.stageTransaction(staged, tx, acceptance)
+		acceptances = append(acceptances, acceptance)
+		pkgFee += acceptance.fee
+		pkgSize += GetTxVirtualSize(tx)
+	}
+	mp.unstageTransactions(staged)
+
+	if err := mp.checkPackageFees(pkgFee, pkgSize); err != nil {
+		return nil, err
+	}
+
+	// Any transactions replaced by the package must be paid for by the
+	// package as a whole.
+	replaced := make(map[chainhash.Hash]*pinutil.Tx)
+	for _, tx := range txns {
+		if len(mp.txConflicts(tx)) == 0 {
+			continue
+		}
+		conflicts, err := mp.validateReplacement(tx, pkgFee, pkgSize)
+		if err != nil {
+			return nil, err
+		}
+		for hash, conflict := range conflicts {
+			replaced[hash] = conflict
+		}
+	}
+	if len(replaced) > 0 {
+		var replacedFee int64
+		for hash := range replaced {
+			replacedFee += mp.pool[hash].Fee
+		}
+		minFee := calcMinRequiredTxRelayFee(pkgSize,
+			mp.cfg.Policy.MinRelayTxFee)
+		if pkgFee < replacedFee+minFee {
+			str := fmt.Sprintf("package has an insufficient "+
+				"absolute fee to replace %d transactions: needs "+
+				"%v, has %v", len(replaced), replacedFee+minFee,
+				pkgFee)
+			return nil, txRuleError(wire.RejectInsufficientFee, str)
+		}
+	}
+
+	// Now that the package is deemed valid, remove the transactions it
+	// replaces and add it to the pool.
+	for hash, conflict := range replaced {
+		log.Debugf("Replacing transaction %v (fee_rate=%v sat/kb) with "+
+			"package (fee_rate=%v sat/kb)", hash,
+			mp.pool[hash].FeePerKB, pkgFee*1000/pkgSize)
+		mp.removeTransaction(conflict, false)
+		mp.txRemoved(conflict, RemovalReplaced)
+	}
+	txDescs := make([]*TxDesc, 0, len(txns))
+	for i, tx := range txns {
+		acceptance := acceptances[i]
+		txD := mp.addTransaction(acceptance.utxoView, tx,
+			acceptance.bestHeight, acceptance.fee)
+		txDescs = append(txDescs, txD)
+	}
+
+	// Evict transactions when the pool is full.  The package itself might
+	// be among them when it pays a lower fee rate than the others.
+	// The transactions that survived are kept in the pool and returned
+	// along with the error so the caller can still announce them.
+	mp.trimToSize()
+	survivors := txDescs[:0]
+	var evictErr error
+	for _, txD := range txDescs {
+		if _, ok := mp.pool[*txD.Tx.Hash()]; ok {
+			survivors = append(survivors, txD)
+			continue
+		}
+		if evictErr == nil {
+			str := fmt.Sprintf("package transaction %v was evicted "+
+				"since the mempool is full", txD.Tx.Hash())
+			evictErr = txRuleError(wire.RejectInsufficientFee, str)
+		}
+	}
+	if evictErr != nil {
+		return survivors, evictErr
+	}
+
+	log.Debugf("Accepted package of %d %s (pool size: %v)", len(txns),
+		pickNoun(len(txns), "transaction", "transactions"), len(mp.pool))
+
+	return txDescs, nil
+}
+
+// ProcessPackage handles the insertion of a package of transactions into the
+// memory pool, which allows a child paying a high fee to get its parents paying
+// too low a fee on their own accepted, also known as child-pays-for-parent.
+// The package must consist of the child, which comes last, preceded by its
+// parents sorted so that every transaction comes after its parents in the
+// package.
+//
+// Each transaction is first processed on its own.  The transactions which are
+// rejected for paying too low a fee, along with the transactions spending them,
+// are then checked together and accepted when the package as a whole pays a
+// sufficient fee and satisfies the RBF policy for any transactions it replaces.
+// The transactions of the package may be in the orphan pool, in which case
+// they are removed from it once accepted.
+//
+// It returns a slice of transactions added to the mempool, including any
+// orphan transactions that were added as a result of the package being
+// accepted.  Transactions which were accepted on their own are kept in the
+// pool and returned even when the package is rejected with an error.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) ProcessPackage(txns []*pinutil.Tx, rateLimit bool) ([]*TxDesc, error) {
+	if err := checkPackage(txns); err != nil {
+		return nil, err
+	}
+
+	// Protect concurrent access.  The transactions removed while accepting
+	// the package are reported once the lock is released.
+	defer mp.notifyRemovedTxns()
+	mp.mtx.Lock()
+	defer mp.mtx.Unlock()
+
+	// Attempt to accept each transaction on its own first, deferring the
+	// ones paying too low a fee along with the ones spending them.
+	var acceptedTxns, newTxns []*TxDesc
+	var deferred []*pinutil.Tx
+	deferredHashes := make(map[chainhash.Hash]struct{})
+	var pkgErr error
+	for _, tx := range txns {
+		if mp.isTransactionInPool(tx.Hash()) {
+			continue
+		}
+
+		spendsDeferred := false
+		for _, txIn := range tx.MsgTx().TxIn {
+			hash := txIn.PreviousOutPoint.Hash
+			if _, ok := deferredHashes[hash]; ok {
+				spendsDeferred = true
+				break
+			}
+		}
+
+		if !spendsDeferred {
+			missingParents, txD, err := mp.maybeAcceptTransaction(tx,
+				true, rateLimit, false)
+			if err == nil && len(missingParents) == 0 {
+				acceptedTxns = append(acceptedTxns, txD)
+				continue
+			}
+			if err == nil {
+				str := fmt.Sprintf("package transaction %v "+
+					"references outputs of unknown or "+
+					"fully-spent transaction %v", tx.Hash(),
+					missingParents[0])
+				err = txRuleError(wire.RejectDuplicate, str)
+			}
+			if !isInsufficientFee(err) {
+				pkgErr = err
+				break
+			}
+		}
+
+		deferred = append(deferred, tx)
+		deferredHashes[*tx.Hash()] = struct{}{}
+	}
+
+	// Check the deferred transactions together as a package.
+	if pkgErr == nil && len(deferred) > 0 {
+		var txDescs []*TxDesc
+		txDescs, pkgErr = mp.acceptPackage(deferred)
+		acceptedTxns = append(acceptedTxns, txDescs...)
+	}
+
+	// Accept any orphan transactions that depend on the accepted
+	// transactions and remove the accepted transactions themselves from
+	// the orphan pool.
+	for _, txD := range acceptedTxns {
+		mp.removeOrphan(txD.Tx, false)
+	}
+	for _, txD := range acceptedTxns {
+		newTxns = append(newTxns, mp.processOrphans(txD.Tx)...)
+	}
+
+	return append(acceptedTxns, newTxns...), pkgErr
+}
@@ -0,0 +1,174 @@
+// Copyright (c) 2013-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/nyodeco/pind/chaincfg/chainhash"
+	"github.com/nyodeco/pind/wire"
+	"github.com/nyodeco/pinutil"
+)
+
+// dumpVersion is the version of the format the transactions in the pool are
+// written in by Dump.
+const dumpVersion = 1
+
+// errInterruptRequested indicates that loading the transactions into the pool
+// was cancelled due to a user-requested interrupt.
+var errInterruptRequested = errors.New("interrupt requested")
+
+// LoadResult describes the outcome of loading the transactions written by Dump
+// back into the pool.
+type LoadResult struct {
+	// Accepted is the number of transactions accepted into the pool.
+	Accepted int
+
+	// Failed is the number of transactions which were rejected by the
+	// pool, such as when they were confirmed or double spent in the
+	// meantime.
+	Failed int
+
+	// Expired is the number of transactions which were skipped because
+	// they were added to the pool longer than the maximum transaction age
+	// ago.
+	Expired int
+}
+
+// Dump writes all transactions in the pool along with the time they were added
+// to the passed writer so they can be restored with Load, and returns the
+// number of written transactions.  Transactions are always written after the
+// transactions in the pool they spend.
+//
+// The format is:
+//  <version> <number of transactions> [<time added> <serialized tx>]...
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) Dump(w io.Writer) (int, error) {
+	mp.mtx.RLock()
+	defer mp.mtx.RUnlock()
+
+	err := binary.Write(w, binary.LittleEndian, uint32(dumpVersion))
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Write(w, binary.LittleEndian, uint64(len(mp.pool)))
+	if err != nil {
+		return 0, err
+	}
+
+	// Write the parents of every transaction first so that Load is able to
+	// accept the transactions in the order they are read.
+	written := make(map[chainhash.Hash]struct{}, len(mp.pool))
+	var writeTx func(txDesc *TxDesc) error
+	writeTx = func(txDesc *TxDesc) error {
+		if _, ok := written[*txDesc.Tx.Hash()]; ok {
+			return nil
+		}
+		written[*txDesc.Tx.Hash()] = struct{}{}
+
+		for _, txIn := range txDesc.Tx.MsgTx().TxIn {
+			parent, ok := mp.pool[txIn.PreviousOutPoint.Hash]
+			if !ok {
+				continue
+			}
+			if err := writeTx(parent); err != nil {
+				return err
+			}
+		}
+
+		err := binary.Write(w, binary.LittleEndian, txDesc.Added.Unix())
+		if err != nil {
+			return err
+		}
+		return txDesc.Tx.MsgTx().Serialize(w)
+	}
+	for _, txDesc := range mp.pool {
+		if err := writeTx(txDesc); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(written), nil
+}
+
+// Load reads transactions written by Dump from the passed reader and adds them
+// to the pool through the normal acceptance rules, keeping the time they were
+// originally added.  Transactions which were added longer than the maximum
+// transaction age ago are skipped.  Loading stops with an error when the
+// interrupt channel is closed.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) Load(r io.Reader, interrupt <-chan struct{}) (*LoadResult, error) {
+	var version uint32
+	if err := binary.Read(r, binary.LittleEndian, &version); err != nil {
+		return nil, err
+	}
+	if version != dumpVersion {
+		return nil, fmt.Errorf("unsupported mempool dump version %d",
+			version)
+	}
+	var numTxns uint64
+	if err := binary.Read(r, binary.LittleEndian, &numTxns); err != nil {
+		return nil, err
+	}
+
+	var result LoadResult
+	now := time.Now()
+	for i := uint64(0); i < numTxns; i++ {
+		select {
+		case <-interrupt:
+			return nil, errInterruptRequested
+		default:
+		}
+
+		var addedUnix int64
+		err := binary.Read(r, binary.LittleEndian, &addedUnix)
+		if err != nil {
+			return nil, err
+		}
+		var msgTx wire.MsgTx
+		if err := msgTx.Deserialize(r); err != nil {
+			return nil, err
+		}
+
+		added := time.Unix(addedUnix, 0)
+		maxAge := mp.cfg.Policy.MaxTxAge
+		if maxAge > 0 && now.Sub(added) > maxAge {
+			result.Expired++
+			continue
+		}
+
+		tx := pinutil.NewTx(&msgTx)
+		mp.mtx.Lock()
+		missingParents, txD, err := mp.maybeAcceptTransaction(tx, true,
+			false, true)
+		if txD != nil {
+			txD.Added = added
+		}
+		mp.mtx.Unlock()
+		mp.notifyRemovedTxns()
+		switch {
+		case err != nil:
+			log.Debugf("Unable to load transaction %v: %v",
+				tx.Hash(), err)
+			result.Failed++
+
+		case len(missingParents) > 0:
+			log.Debugf("Unable to load orphan transaction %v",
+				tx.Hash())
+			result.Failed++
+
+		default:
+			result.Accepted++
+		}
+	}
+
+	return &result, nil
+}
@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"container/heap"
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/nyodeco/pind/blockchain"
@@ -51,6 +52,12 @@ type TxDesc struct {
 
 	// FeePerKB is the fee the transaction pays in Satoshi per 1000 bytes.
 	FeePerKB int64
+
+	// Ancestors holds the hashes of the transactions in the source pool the
+	// transaction spends outputs of, either directly or through other
+	// transactions in the source pool.  It is only set on the descriptors
+	// returned by TxSource.MiningDescs.
+	Ancestors []chainhash.Hash
 }
 
 // TxSource represents a source of transactions to consider for inclusion in
@@ -64,7 +71,7 @@ type TxSource interface {
 	LastUpdated() time.Time
 
 	// MiningDescs returns a slice of mining descriptors for all the
-	// transactions in the source pool.
+	// transactions in the source pool along with their ancestors.
 	MiningDescs() []*TxDesc
 
 	// HaveTransaction returns whether or not the passed transaction hash
@@ -86,6 +93,33 @@ type txPrioItem struct {
 	// transactions in the source pool and hence must come after them in
 	// a block.
 	dependsOn map[chainhash.Hash]struct{}
+
+	// The following fields are used to select the transaction as part of
+	// an ancestor package.
+	//
+	// size is the virtual size of the transaction.  ancestors holds the
+	// ancestors of the transaction in the source pool which have not been
+	// added to the block yet and descendants holds the transactions which
+	// have it as an ancestor.  ancestorFee and ancestorSize are the total
+	// fee and virtual size of the transaction along with those ancestors.
+	size         int64
+	ancestors    map[chainhash.Hash]*txPrioItem
+	descendants  map[chainhash.Hash]*txPrioItem
+	ancestorFee  int64
+	ancestorSize int64
+
+	// index is the index of the item in the priority queue it is in or -1
+	// once it has been removed.
+	index int
+}
+
+// ancestorFeePerKB returns the fee per kilobyte the transaction pays along
+// with its ancestors which have not been added to the block yet.
+func (item *txPrioItem) ancestorFeePerKB() int64 {
+	if item.ancestorSize == 0 {
+		return 0
+	}
+	return item.ancestorFee * 1000 / item.ancestorSize
 }
 
 // txPriorityQueueLessFunc describes a function that can be used as a compare
@@ -116,12 +150,16 @@ func (pq *txPriorityQueue) Less(i, j int) bool {
 // part of the heap.Interface implementation.
 func (pq *txPriorityQueue) Swap(i, j int) {
 	pq.items[i], pq.items[j] = pq.items[j], pq.items[i]
+	pq.items[i].index = i
+	pq.items[j].index = j
 }
 
 // Push pushes the passed item onto the priority queue.  It is part of the
 // heap.Interface implementation.
 func (pq *txPriorityQueue) Push(x interface{}) {
-	pq.items = append(pq.items, x.(*txPrioItem))
+	item := x.(*txPrioItem)
+	item.index = len(pq.items)
+	pq.items = append(pq.items, item)
 }
 
 // Pop removes the highest priority item (according to Less) from the priority
@@ -129,6 +167,7 @@ func (pq *txPriorityQueue) Push(x interface{}) {
 func (pq *txPriorityQueue) Pop() interface{} {
 	n := len(pq.items)
 	item := pq.items[n-1]
+	item.index = -1
 	pq.items[n-1] = nil
 	pq.items = pq.items[0 : n-1]
 	return item
@@ -165,6 +204,20 @@ func txPQByFee(pq *txPriorityQueue, i, j int) bool {
 	return pq.items[i].feePerKB > pq.items[j].feePerKB
 }
 
+// txPQByAncestorFee sorts a txPriorityQueue by the fees per kilobyte of the
+// transactions along with their ancestors which have not been added to the
+// block yet and then transaction priority.
+func txPQByAncestorFee(pq *txPriorityQueue, i, j int) bool {
+	// Using > here so that pop gives the highest fee package as opposed
+	// to the lowest.  Sort by fee first, then priority.
+	feeI := pq.items[i].ancestorFeePerKB()
+	feeJ := pq.items[j].ancestorFeePerKB()
+	if feeI == feeJ {
+		return pq.items[i].priority > pq.items[j].priority
+	}
+	return feeI > feeJ
+}
+
 // newTxPriorityQueue returns a new transaction priority queue that reserves the
 // passed amount of space for the elements.  The new priority queue uses either
 // the txPQByPriority or the txPQByFee compare function depending on the
@@ -183,6 +236,102 @@ func newTxPriorityQueue(reserve int, sortByFee bool) *txPriorityQueue {
 	return pq
 }
 
+// txPackageSelector selects the transactions to add to a block as packages of a
+// transaction along with its ancestors which have not been added yet.  The
+// packages are ordered by the fees per kilobyte of the package as a whole,
+// which allows a transaction paying a high fee to pull in its ancestors paying
+// a low fee, also known as child-pays-for-parent.
+type txPackageSelector struct {
+	pq *txPriorityQueue
+}
+
+// newTxPackageSelector returns a package selector for the passed items.  The
+// ancestors of every item must already be set and must only refer to other
+// passed items.
+func newTxPackageSelector(items []*txPrioItem) *txPackageSelector {
+	pq := &txPriorityQueue{
+		lessFunc: txPQByAncestorFee,
+		items:    make([]*txPrioItem, 0, len(items)),
+	}
+	for _, item := range items {
+		item.descendants = make(map[chainhash.Hash]*txPrioItem)
+	}
+	for _, item := range items {
+		item.ancestorFee = item.fee
+		item.ancestorSize = item.size
+		for _, ancestor := range item.ancestors {
+			ancestor.descendants[*item.tx.Hash()] = item
+			item.ancestorFee += ancestor.fee
+			item.ancestorSize += ancestor.size
+		}
+		pq.Push(item)
+	}
+	heap.Init(pq)
+
+	return &txPackageSelector{pq: pq}
+}
+
+// Len returns the number of items which can still be selected.
+func (s *txPackageSelector) Len() int {
+	return s.pq.Len()
+}
+
+// Next returns the package paying the highest fees per kilobyte along with the
+// item the package was selected for.  The package consists of the item and its
+// ancestors which have not been added yet, ordered so that every transaction
+// comes after its ancestors.  The caller is expected to pass each of them to
+// Added, or the selected item to Skip or Remove, before calling Next again.
+func (s *txPackageSelector) Next() ([]*txPrioItem, *txPrioItem) {
+	item := s.pq.items[0]
+	pkg := make([]*txPrioItem, 0, len(item.ancestors)+1)
+	for _, ancestor := range item.ancestors {
+		pkg = append(pkg, ancestor)
+	}
+	pkg = append(pkg, item)
+
+	// The remaining ancestors of a transaction are always a superset of
+	// the remaining ancestors of each of them, so ordering by the number
+	// of remaining ancestors puts every transaction after its ancestors.
+	sort.Slice(pkg, func(i, j int) bool {
+		return len(pkg[i].ancestors) < len(pkg[j].ancestors)
+	})
+	return pkg, item
+}
+
+// Added marks the passed item as added to the block and removes it from the
+// remaining ancestors of its descendants.
+func (s *txPackageSelector) Added(item *txPrioItem) {
+	if item.index >= 0 {
+		heap.Remove(s.pq, item.index)
+	}
+	for _, descendant := range item.descendants {
+		delete(descendant.ancestors, *item.tx.Hash())
+		descendant.ancestorFee -= item.fee
+		descendant.ancestorSize -= item.size
+		if descendant.index >= 0 {
+			heap.Fix(s.pq, descendant.index)
+		}
+	}
+}
+
+// Skip removes the passed item from the items which can be selected.  It may
+// still be added to the block as part of the package of one of its
+// descendants.
+func (s *txPackageSelector) Skip(item *txPrioItem) {
+	if item.index >= 0 {
+		heap.Remove(s.pq, item.index)
+	}
+}
+
+// Remove removes the passed item along with all of its descendants from the
+// items which can be selected, such as when it is not valid in the block.
+func (s *txPackageSelector) Remove(item *txPrioItem) {
+	s.Skip(item)
+	for _, descendant := range item.descendants {
+		s.Skip(descendant)
+	}
+}
+
 // BlockTemplate houses a block that has yet to be solved along with additional
 // details about the fees and the number of signature operations for each
 // transaction in the block.
@@ -301,6 +450,25 @@ func spendTransaction(utxoView *blockchain.UtxoViewpoint, tx *pinutil.Tx, height
 	return nil
 }
 
+// witnessCommitmentWeight returns the weight that including a witness
+// commitment adds to the passed coinbase transaction.
+func witnessCommitmentWeight(coinbaseTx *pinutil.Tx) uint32 {
+	// Model the coinbase transaction with a witness commitment and take the
+	// difference of the weight before and after the addition of the
+	// commitment.
+	coinbaseCopy := pinutil.NewTx(coinbaseTx.MsgTx().Copy())
+	coinbaseCopy.MsgTx().TxIn[0].Witness = [][]byte{
+		bytes.Repeat([]byte("a"), blockchain.CoinbaseWitnessDataLen),
+	}
+	coinbaseCopy.MsgTx().AddTxOut(&wire.TxOut{
+		PkScript: bytes.Repeat([]byte("a"),
+			blockchain.CoinbaseWitnessPkScriptLength),
+	})
+
+	return uint32(blockchain.GetTransactionWeight(coinbaseCopy) -
+		blockchain.GetTransactionWeight(coinbaseTx))
+}
+
 // logSkippedDeps logs any dependencies which are also skipped as a result of
 // skipping a transaction while generating a block template at the trace level.
 func logSkippedDeps(tx *pinutil.Tx, deps map[chainhash.Hash]*txPrioItem) {
@@ -395,24 +563,29 @@ func NewBlkTmplGenerator(policy *Policy, params *chaincfg.Params,
 // higher fee per kilobyte are preferred.  Finally, the block generation related
 // policy settings are all taken into account.
 //
-// Transactions which only spend outputs from other transactions already in the
-// block chain are immediately added to a priority queue which either
-// prioritizes based on the priority (then fee per kilobyte) or the fee per
-// kilobyte (then priority) depending on whether or not the BlockPrioritySize
-// policy setting allots space for high-priority transactions.  Transactions
+// When the BlockPrioritySize policy setting allots space for high-priority
+// transactions, transactions which only spend outputs from other transactions
+// already in the block chain are immediately added to a priority queue which
+// prioritizes based on the priority (then fee per kilobyte).  Transactions
 // which spend outputs from other transactions in the source pool are added to a
 // dependency map so they can be added to the priority queue once the
 // transactions they depend on have been included.
 //
 // Once the high-priority area (if configured) has been filled with
 // transactions, or the priority falls below what is considered high-priority,
-// the priority queue is updated to prioritize by fees per kilobyte (then
-// priority).
+// the rest of the block is filled with ancestor packages.  An ancestor package
+// consists of a transaction along with all of its ancestors in the source pool
+// which have not been included yet, and the packages are prioritized by the fee
+// per kilobyte of the package as a whole (then priority).  Thus a transaction
+// paying a high fee causes its ancestors paying a low fee to be included along
+// with it ahead of transactions paying less than the package, which is also
+// known as child-pays-for-parent.  After a package is included, the packages
+// of its descendants are updated to no longer count the included transactions.
 //
-// When the fees per kilobyte drop below the TxMinFreeFee policy setting, the
-// transaction will be skipped unless the BlockMinSize policy setting is
+// When the fees per kilobyte of a package drop below the TxMinFreeFee policy
+// setting, the package will be skipped unless the BlockMinSize policy setting is
 // nonzero, in which case the block will be filled with the low-fee/free
-// transactions until the block size reaches that minimum size.
+// packages until the block size reaches that minimum size.
 //
 // Any transactions which would cause the block to exceed the BlockMaxSize
 // policy setting, exceed the maximum allowed signature operations per block, or
@@ -430,8 +603,8 @@ func NewBlkTmplGenerator(policy *Policy, params *chaincfg.Params,
 //  |                                   |   |
 //  |                                   |   |
 //  |                                   |   |--- policy.BlockMaxSize
-//  |  Transactions prioritized by fee  |   |
-//  |  until <= policy.TxMinFreeFee     |   |
+//  |  Ancestor packages prioritized by |   |
+//  |  fee until <= policy.TxMinFreeFee |   |
 //  |                                   |   |
 //  |                                   |   |
 //  |                                   |   |
@@ -490,6 +663,13 @@ func (g *BlkTmplGenerator) NewBlockTemplate(payToAddress pinutil.Address) (*Bloc
 	// in the block once each transaction has been included.
 	dependers := make(map[chainhash.Hash]map[chainhash.Hash]*txPrioItem)
 
+	// prioItems and ancestors track every transaction considered for
+	// inclusion along with its ancestors in the source pool so the block
+	// can be filled with ancestor packages once the high-priority area is
+	// full.
+	prioItems := make(map[chainhash.Hash]*txPrioItem, len(sourceTxns))
+	ancestors := make(map[chainhash.Hash][]chainhash.Hash, len(sourceTxns))
+
 	// Create slices to hold the fees and number of signature operations
 	// for each of the selected transactions and add an entry for the
 	// coinbase.  This allows the code below to simply append details about
@@ -578,6 +758,11 @@ mempoolLoop:
 		// Calculate the fee in Satoshi/kB.
 		prioItem.feePerKB = txDesc.FeePerKB
 		prioItem.fee = txDesc.Fee
+		prioItem.size = (blockchain.GetTransactionWeight(tx) +
+			(blockchain.WitnessScaleFactor - 1)) /
+			blockchain.WitnessScaleFactor
+		prioItems[*tx.Hash()] = prioItem
+		ancestors[*tx.Hash()] = txDesc.Ancestors
 
 		// Add the transaction to the priority queue to mark it ready
 		// for inclusion in the block unless it has dependencies.
@@ -614,67 +799,14 @@ mempoolLoop:
 
 	witnessIncluded := false
 
-	// Choose which transactions make it into the block.
-	for priorityQueue.Len() > 0 {
-		// Grab the highest priority (or highest fee per kilobyte
-		// depending on the sort order) transaction.
-		prioItem := heap.Pop(priorityQueue).(*txPrioItem)
+	// addTx adds the transaction of the passed item to the block unless
+	// it would exceed the maximum signature operation cost per block or
+	// its inputs or scripts are not valid in the block.  It returns
+	// whether the transaction was added.
+	includedTxns := make(map[chainhash.Hash]struct{}, len(prioItems))
+	addTx := func(prioItem *txPrioItem) bool {
 		tx := prioItem.tx
 
-		switch {
-		// If segregated witness has not been activated yet, then we
-		// shouldn't include any witness transactions in the block.
-		case !segwitActive && tx.HasWitness():
-			continue
-
-		// Otherwise, Keep track of if we've included a transaction
-		// with witness data or not. If so, then we'll need to include
-		// the witness commitment as the last output in the coinbase
-		// transaction.
-		case segwitActive && !witnessIncluded && tx.HasWitness():
-			// If we're about to include a transaction bearing
-			// witness data, then we'll also need to include a
-			// witness commitment in the coinbase transaction.
-			// Therefore, we account for the additional weight
-			// within the block with a model coinbase tx with a
-			// witness commitment.
-			coinbaseCopy := pinutil.NewTx(coinbaseTx.MsgTx().Copy())
-			coinbaseCopy.MsgTx().TxIn[0].Witness = [][]byte{
-				bytes.Repeat([]byte("a"),
-					blockchain.CoinbaseWitnessDataLen),
-			}
-			coinbaseCopy.MsgTx().AddTxOut(&wire.TxOut{
-				PkScript: bytes.Repeat([]byte("a"),
-					blockchain.CoinbaseWitnessPkScriptLength),
-			})
-
-			// In order to accurately account for the weight
-			// addition due to this coinbase transaction, we'll add
-			// the difference of the transaction before and after
-			// the addition of the commitment to the block weight.
-			weightDiff := blockchain.GetTransactionWeight(coinbaseCopy) -
-				blockchain.GetTransactionWeight(coinbaseTx)
-
-			blockWeight += uint32(weightDiff)
-
-			witnessIncluded = true
-		}
-
-		// Grab any transactions which depend on this one.
-		deps := dependers[*tx.Hash()]
-
-		// Enforce maximum block size.  Also check for overflow.
-		txWeight := uint32(blockchain.GetTransactionWeight(tx))
-		blockPlusTxWeight := blockWeight + txWeight
-		if blockPlusTxWeight < blockWeight ||
-			blockPlusTxWeight >= g.policy.BlockMaxWeight {
-
-			log.Tracef("Skipping tx %s because it would exceed "+
-				"the max block weight", tx.Hash())
-			logSkippedDeps(tx, deps)
-			continue
-		}
-
 		// Enforce maximum signature operation cost per block.  Also
 		// check for overflow.
 		sigOpCost, err := blockchain.GetSigOpCost(tx, false,
@@ -682,59 +814,13 @@ mempoolLoop:
 		if err != nil {
 			log.Tracef("Skipping tx %s due to error in "+
 				"GetSigOpCost: %v", tx.Hash(), err)
-			logSkippedDeps(tx, deps)
-			continue
+			return false
 		}
 		if blockSigOpCost+int64(sigOpCost) < blockSigOpCost ||
 			blockSigOpCost+int64(sigOpCost) > blockchain.MaxBlockSigOpsCost {
 			log.Tracef("Skipping tx %s because it would "+
 				"exceed the maximum sigops per block", tx.Hash())
-			logSkippedDeps(tx, deps)
-			continue
-		}
-
-		// Skip free transactions once the block is larger than the
-		// minimum block size.
-		if sortedByFee &&
-			prioItem.feePerKB < int64(g.policy.TxMinFreeFee) &&
-			blockPlusTxWeight >= g.policy.BlockMinWeight {
-
-			log.Tracef("Skipping tx %s with feePerKB %d "+
-				"< TxMinFreeFee %d and block weight %d >= "+
-				"minBlockWeight %d", tx.Hash(), prioItem.feePerKB,
-				g.policy.TxMinFreeFee, blockPlusTxWeight,
-				g.policy.BlockMinWeight)
-			logSkippedDeps(tx, deps)
-			continue
-		}
-
-		// Prioritize by fee per kilobyte once the block is larger than
-		// the priority size or there are no more high-priority
-		// transactions.
-		if !sortedByFee && (blockPlusTxWeight >= g.policy.BlockPrioritySize ||
-			prioItem.priority <= MinHighPriority) {
-
-			log.Tracef("Switching to sort by fees per "+
-				"kilobyte blockSize %d >= BlockPrioritySize "+
-				"%d || priority %.2f <= minHighPriority %.2f",
-				blockPlusTxWeight, g.policy.BlockPrioritySize,
-				prioItem.priority, MinHighPriority)
-
-			sortedByFee = true
-			priorityQueue.SetLessFunc(txPQByFee)
-
-			// Put the transaction back into the priority queue and
-			// skip it so it is re-priortized by fees if it won't
-			// fit into the high-priority section or the priority
-			// is too low.  Otherwise this transaction will be the
-			// final one in the high-priority section, so just fall
-			// though to the code below so it is added now.
-			if blockPlusTxWeight > g.policy.BlockPrioritySize ||
-				prioItem.priority < MinHighPriority {
-
-				heap.Push(priorityQueue, prioItem)
-				continue
-			}
+			return false
 		}
 
 		// Ensure the transaction inputs pass all of the necessary
@@ -744,8 +830,7 @@ mempoolLoop:
 		if err != nil {
 			log.Tracef("Skipping tx %s due to error in "+
 				"CheckTransactionInputs: %v", tx.Hash(), err)
-			logSkippedDeps(tx, deps)
-			continue
+			return false
 		}
 		err = blockchain.ValidateTransactionScripts(tx, blockUtxos,
 			txscript.StandardVerifyFlags, g.sigCache,
@@ -753,8 +838,7 @@ mempoolLoop:
 		if err != nil {
 			log.Tracef("Skipping tx %s due to error in "+
 				"ValidateTransactionScripts: %v", tx.Hash(), err)
-			logSkippedDeps(tx, deps)
-			continue
+			return false
 		}
 
 		// Spend the transaction inputs in the block utxo view and add
@@ -767,14 +851,87 @@ mempoolLoop:
 		// save the fees and signature operation counts to the block
 		// template.
 		blockTxns = append(blockTxns, tx)
-		blockWeight += txWeight
+		blockWeight += uint32(blockchain.GetTransactionWeight(tx))
 		blockSigOpCost += int64(sigOpCost)
 		totalFees += prioItem.fee
 		txFees = append(txFees, prioItem.fee)
 		txSigOpCosts = append(txSigOpCosts, int64(sigOpCost))
+		includedTxns[*tx.Hash()] = struct{}{}
 
-		log.Tracef("Adding tx %s (priority %.2f, feePerKB %.2f)",
+		log.Tracef("Adding tx %s (priority %.2f, feePerKB %d)",
 			prioItem.tx.Hash(), prioItem.priority, prioItem.feePerKB)
+		return true
+	}
+
+	// Fill the high-priority area of the block, if any, with the
+	// transactions having the highest priority.
+	for !sortedByFee && priorityQueue.Len() > 0 {
+		// Grab the highest priority transaction.
+		prioItem := heap.Pop(priorityQueue).(*txPrioItem)
+		tx := prioItem.tx
+
+		switch {
+		// If segregated witness has not been activated yet, then we
+		// shouldn't include any witness transactions in the block.
+		case !segwitActive && tx.HasWitness():
+			continue
+
+		// Otherwise, Keep track of if we've included a transaction
+		// with witness data or not. If so, then we'll need to include
+		// the witness commitment as the last output in the coinbase
+		// transaction, so account for its additional weight within the
+		// block.
+		case segwitActive && !witnessIncluded && tx.HasWitness():
+			blockWeight += witnessCommitmentWeight(coinbaseTx)
+			witnessIncluded = true
+		}
+
+		// Grab any transactions which depend on this one.
+		deps := dependers[*tx.Hash()]
+
+		// Enforce maximum block size.  Also check for overflow.
+		txWeight := uint32(blockchain.GetTransactionWeight(tx))
+		blockPlusTxWeight := blockWeight + txWeight
+		if blockPlusTxWeight < blockWeight ||
+			blockPlusTxWeight >= g.policy.BlockMaxWeight {
+
+			log.Tracef("Skipping tx %s because it would exceed "+
+				"the max block weight", tx.Hash())
+			logSkippedDeps(tx, deps)
+			continue
+		}
+
+		// Switch to ancestor packages prioritized by fee per kilobyte
+		// once the block is larger than the priority size or there are
+		// no more high-priority transactions.
+		if blockPlusTxWeight >= g.policy.BlockPrioritySize ||
+			prioItem.priority <= MinHighPriority {
+
+			log.Tracef("Switching to sort by fees per "+
+				"kilobyte blockSize %d >= BlockPrioritySize "+
+				"%d || priority %.2f <= minHighPriority %.2f",
+				blockPlusTxWeight, g.policy.BlockPrioritySize,
+				prioItem.priority, MinHighPriority)
+
+			sortedByFee = true
+
+			// Leave the transaction to be re-prioritized by fees if
+			// it won't fit into the high-priority section or the
+			// priority is too low.  Otherwise this transaction will
+			// be the final one in the high-priority section, so
+			// just fall though to the code below so it is added
+			// now.
+			if blockPlusTxWeight > g.policy.BlockPrioritySize ||
+				prioItem.priority < MinHighPriority {
+
+				break
+			}
+		}
+
+		if !addTx(prioItem) {
+			logSkippedDeps(tx, deps)
+			continue
+		}
 
 		// Add transactions which depend on this one (and also do not
 		// have any other unsatisified dependencies) to the priority
@@ -789,6 +946,109 @@ mempoolLoop:
 		}
 	}
 
+	// Gather the remaining transactions along with their ancestors which
+	// have not been added to the block yet.  Transactions which have an
+	// ancestor that could not be considered for inclusion, such as a
+	// non-finalized one, can't be added either.
+	pkgItems := make([]*txPrioItem, 0, len(prioItems)-len(includedTxns))
+candidateLoop:
+	for hash, prioItem := range prioItems {
+		if _, ok := includedTxns[hash]; ok {
+			continue
+		}
+
+		prioItem.ancestors = make(map[chainhash.Hash]*txPrioItem)
+		for _, ancestorHash := range ancestors[hash] {
+			if _, ok := includedTxns[ancestorHash]; ok {
+				continue
+			}
+			ancestor, ok := prioItems[ancestorHash]
+			if !ok {
+				log.Tracef("Skipping tx %s since it depends on "+
+					"unavailable tx %s", hash, ancestorHash)
+				continue candidateLoop
+			}
+			prioItem.ancestors[ancestorHash] = ancestor
+		}
+		pkgItems = append(pkgItems, prioItem)
+	}
+
+	// Fill the rest of the block with ancestor packages, choosing the
+	// package paying the highest fees per kilobyte as a whole first.
+	selector := newTxPackageSelector(pkgItems)
+	for selector.Len() > 0 {
+		pkg, prioItem := selector.Next()
+		tx := prioItem.tx
+
+		// If segregated witness has not been activated yet, then we
+		// shouldn't include any witness transactions in the block, nor
+		// any transactions which depend on them.
+		var pkgWeight uint32
+		pkgHasWitness := false
+		for _, item := range pkg {
+			pkgWeight += uint32(blockchain.GetTransactionWeight(item.tx))
+			if item.tx.HasWitness() {
+				pkgHasWitness = true
+				if !segwitActive {
+					selector.Remove(item)
+				}
+			}
+		}
+		if !segwitActive && pkgHasWitness {
+			continue
+		}
+
+		// Account for the witness commitment in the coinbase
+		// transaction when the package is the first to include
+		// witness data.
+		var commitmentWeight uint32
+		if segwitActive && !witnessIncluded && pkgHasWitness {
+			commitmentWeight = witnessCommitmentWeight(coinbaseTx)
+		}
+
+		// Enforce maximum block size.  Also check for overflow.
+		blockPlusPkgWeight := blockWeight + commitmentWeight + pkgWeight
+		if blockPlusPkgWeight < blockWeight ||
+			blockPlusPkgWeight >= g.policy.BlockMaxWeight {
+
+			log.Tracef("Skipping tx %s because its package of %d "+
+				"transactions would exceed the max block weight",
+				tx.Hash(), len(pkg))
+			selector.Skip(prioItem)
+			continue
+		}
+
+		// Skip free packages once the block is larger than the minimum
+		// block size.
+		pkgFeePerKB := prioItem.ancestorFeePerKB()
+		if pkgFeePerKB < int64(g.policy.TxMinFreeFee) &&
+			blockPlusPkgWeight >= g.policy.BlockMinWeight {
+
+			log.Tracef("Skipping tx %s with package feePerKB %d "+
+				"< TxMinFreeFee %d and block weight %d >= "+
+				"minBlockWeight %d", tx.Hash(), pkgFeePerKB,
+				g.policy.TxMinFreeFee, blockPlusPkgWeight,
+				g.policy.BlockMinWeight)
+			selector.Skip(prioItem)
+			continue
+		}
+
+		log.Tracef("Adding package of %d transactions for tx %s "+
+			"(package feePerKB %d)", len(pkg), tx.Hash(), pkgFeePerKB)
+
+		if commitmentWeight != 0 {
+			blockWeight += commitmentWeight
+			witnessIncluded = true
+		}
+		for _, item := range pkg {
+			if !addTx(item) {
+				selector.Remove(item)
+				break
+			}
+			selector.Added(item)
+		}
+	}
+
 	// Now that the actual transactions have been selected, update the
 	// block weight for the real transaction count and coinbase value with
 	// the total fees accordingly.
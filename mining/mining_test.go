@@ -6,9 +6,20 @@ package mining
 
 import (
 	"container/heap"
+	"io/ioutil"
 	"math/rand"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/nyodeco/pind/blockchain"
+	"github.com/nyodeco/pind/chaincfg"
+	"github.com/nyodeco/pind/chaincfg/chainhash"
+	"github.com/nyodeco/pind/database"
+	_ "github.com/nyodeco/pind/database/ffldb"
+	"github.com/nyodeco/pind/txscript"
+	"github.com/nyodeco/pind/wire"
 	"github.com/nyodeco/pinutil"
 )
 
@@ -108,3 +119,318 @@ func TestTxFeePrioHeap(t *testing.T) {
 		highest = prioItem
 	}
 }
+
+// newTestPkgItem returns a priority item for a unique fake transaction paying
+// the passed fee with the passed virtual size and the passed ancestors.
+func newTestPkgItem(id uint32, fee, size int64, ancestors ...*txPrioItem) *txPrioItem {
+	msgTx := wire.NewMsgTx(wire.TxVersion)
+	msgTx.LockTime = id
+	item := &txPrioItem{
+		tx:        pinutil.NewTx(msgTx),
+		fee:       fee,
+		size:      size,
+		feePerKB:  fee * 1000 / size,
+		ancestors: make(map[chainhash.Hash]*txPrioItem),
+	}
+	for _, ancestor := range ancestors {
+		item.ancestors[*ancestor.tx.Hash()] = ancestor
+	}
+	return item
+}
+
+// TestTxPackageSelector ensures ancestor packages are selected by the fee per
+// kilobyte of the package as a whole so that a child paying a high fee pulls
+// its parent paying a low fee into the block ahead of lower-feerate single
+// transactions.
+func TestTxPackageSelector(t *testing.T) {
+	// The parent alone pays less than every other transaction, but its
+	// package with the child pays more than the single transactions.  The
+	// second child only pays for itself once the parent was added.
+	parent := newTestPkgItem(1, 100, 1000)
+	child := newTestPkgItem(2, 20000, 200, parent)
+	grandchild := newTestPkgItem(3, 100, 250, parent, child)
+	child2 := newTestPkgItem(4, 300, 1000, parent)
+	single := newTestPkgItem(5, 5000, 500)
+	lowSingle := newTestPkgItem(6, 2000, 1000)
+
+	items := []*txPrioItem{lowSingle, child2, single, grandchild, child,
+		parent}
+	selector := newTxPackageSelector(items)
+
+	names := map[*txPrioItem]string{
+		parent:     "parent",
+		child:      "child",
+		grandchild: "grandchild",
+		child2:     "child2",
+		single:     "single",
+		lowSingle:  "lowSingle",
+	}
+	wantPkgs := [][]*txPrioItem{
+		{parent, child},
+		{single},
+		{lowSingle},
+		{grandchild},
+		{child2},
+	}
+	for i, wantPkg := range wantPkgs {
+		if selector.Len() == 0 {
+			t.Fatalf("package %d: no package selected", i)
+		}
+		pkg, item := selector.Next()
+		if item != wantPkg[len(wantPkg)-1] {
+			t.Fatalf("package %d: selected %s, want %s", i,
+				names[item], names[wantPkg[len(wantPkg)-1]])
+		}
+		if len(pkg) != len(wantPkg) {
+			t.Fatalf("package %d: got %d transactions, want %d", i,
+				len(pkg), len(wantPkg))
+		}
+		for j := range pkg {
+			if pkg[j] != wantPkg[j] {
+				t.Fatalf("package %d: transaction %d is %s, "+
+					"want %s", i, j, names[pkg[j]],
+					names[wantPkg[j]])
+			}
+			selector.Added(pkg[j])
+		}
+	}
+	if selector.Len() != 0 {
+		t.Fatalf("%d transactions left after selecting all packages",
+			selector.Len())
+	}
+	if child2.ancestorFee != child2.fee || len(child2.ancestors) != 0 {
+		t.Fatalf("ancestors of child2 not updated after adding parent")
+	}
+}
+
+// TestTxPackageSelectorRemove ensures removing a transaction from the package
+// selector, such as when it is invalid, also removes its descendants while
+// skipping a transaction still allows it to be added as an ancestor.
+func TestTxPackageSelectorRemove(t *testing.T) {
+	parent := newTestPkgItem(1, 100, 1000)
+	child := newTestPkgItem(2, 20000, 200, parent)
+	other := newTestPkgItem(3, 1000, 1000)
+	otherChild := newTestPkgItem(4, 500, 1000, other)
+	selector := newTxPackageSelector([]*txPrioItem{parent, child, other,
+		otherChild})
+
+	// Skip the parent package and ensure it is still added along with the
+	// child.
+	_, item := selector.Next()
+	if item != child {
+		t.Fatalf("first selected transaction is not the child")
+	}
+	selector.Skip(parent)
+	pkg, item := selector.Next()
+	if item != child || len(pkg) != 2 || pkg[0] != parent {
+		t.Fatalf("skipped parent is not part of the child package")
+	}
+	selector.Added(parent)
+	selector.Added(child)
+
+	// Remove the other transaction and ensure its child is removed too.
+	_, item = selector.Next()
+	if item != other {
+		t.Fatalf("next selected transaction is not the other one")
+	}
+	selector.Remove(other)
+	if selector.Len() != 0 {
+		t.Fatalf("%d transactions left after removing the other one",
+			selector.Len())
+	}
+}
+
+// fakeTxSource is a transaction source which provides a fixed set of
+// transactions.
+type fakeTxSource struct {
+	descs []*TxDesc
+}
+
+// LastUpdated returns the zero time since the source never changes.
+//
+// This is part of the TxSource interface.
+func (s *fakeTxSource) LastUpdated() time.Time {
+	return time.Time{}
+}
+
+// MiningDescs returns the descriptors of the transactions in the source.
+//
+// This is part of the TxSource interface.
+func (s *fakeTxSource) MiningDescs() []*TxDesc {
+	return s.descs
+}
+
+// HaveTransaction returns whether or not the passed transaction hash is one of
+// the transactions in the source.
+//
+// This is part of the TxSource interface.
+func (s *fakeTxSource) HaveTransaction(hash *chainhash.Hash) bool {
+	for _, desc := range s.descs {
+		if desc.Tx.Hash().IsEqual(hash) {
+			return true
+		}
+	}
+	return false
+}
+
+// newTestChain returns a regression test chain with enough blocks for the
+// coinbases of the returned first blocks, which pay to outputs anyone can
+// spend, to be mature, along with a function to tear it down.
+func newTestChain(t *testing.T, numSpendable int) (*blockchain.BlockChain, []*wire.MsgTx, func()) {
+	t.Helper()
+
+	params := chaincfg.RegressionNetParams
+	dataDir, err := ioutil.TempDir("", "miningtest")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	db, err := database.Create("ffldb", filepath.Join(dataDir, "blocks"),
+		params.Net)
+	if err != nil {
+		os.RemoveAll(dataDir)
+		t.Fatalf("unable to create database: %v", err)
+	}
+	teardown := func() {
+		db.Close()
+		os.RemoveAll(dataDir)
+	}
+	chain, err := blockchain.New(&blockchain.Config{
+		DB:          db,
+		ChainParams: &params,
+		TimeSource:  blockchain.NewMedianTime(),
+	})
+	if err != nil {
+		teardown()
+		t.Fatalf("unable to create chain: %v", err)
+	}
+
+	numBlocks := int32(params.CoinbaseMaturity) + int32(numSpendable)
+	prev := params.GenesisBlock
+	coinbases := make([]*wire.MsgTx, 0, numSpendable)
+	for height := int32(1); height <= numBlocks; height++ {
+		coinbaseScript, err := txscript.NewScriptBuilder().
+			AddInt64(int64(height)).AddInt64(0).Script()
+		if err != nil {
+			teardown()
+			t.Fatalf("unable to create coinbase script: %v", err)
+		}
+		coinbase := wire.NewMsgTx(1)
+		coinbase.AddTxIn(&wire.TxIn{
+			PreviousOutPoint: wire.OutPoint{
+				Index: wire.MaxPrevOutIndex,
+			},
+			SignatureScript: coinbaseScript,
+			Sequence:        wire.MaxTxInSequenceNum,
+		})
+		coinbase.AddTxOut(wire.NewTxOut(
+			blockchain.CalcBlockSubsidy(height, &params),
+			[]byte{txscript.OP_TRUE}))
+		if len(coinbases) < numSpendable {
+			coinbases = append(coinbases, coinbase)
+		}
+
+		block := pinutil.NewBlock(&wire.MsgBlock{
+			Header: wire.BlockHeader{
+				Version:   1,
+				PrevBlock: prev.BlockHash(),
+				Timestamp: prev.Header.Timestamp.Add(time.Minute),
+				Bits:      params.PowLimitBits,
+			},
+			Transactions: []*wire.MsgTx{coinbase},
+		})
+		merkles := blockchain.BuildMerkleTreeStore(block.Transactions(),
+			false)
+		block.MsgBlock().Header.MerkleRoot = *merkles[len(merkles)-1]
+		_, _, err = chain.ProcessBlock(block, blockchain.BFNoPoWCheck)
+		if err != nil {
+			teardown()
+			t.Fatalf("ProcessBlock #%d: unexpected error: %v", height,
+				err)
+		}
+		prev = block.MsgBlock()
+	}
+	return chain, coinbases, teardown
+}
+
+// TestNewBlockTemplateAncestorPackages ensures block templates include a child
+// paying a high fee along with its parent paying a low fee ahead of a single
+// transaction paying a fee between the two.
+func TestNewBlockTemplateAncestorPackages(t *testing.T) {
+	chain, coinbases, teardown := newTestChain(t, 2)
+	defer teardown()
+
+	// spend returns a transaction spending the first output of the passed
+	// transaction to an output anyone can spend while paying the passed
+	// fee, along with its mining descriptor.
+	spend := func(prev *wire.MsgTx, fee int64, ancestors ...*pinutil.Tx) *TxDesc {
+		prevHash := prev.TxHash()
+		msgTx := wire.NewMsgTx(1)
+		msgTx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&prevHash, 0), nil,
+			nil))
+		msgTx.AddTxOut(wire.NewTxOut(prev.TxOut[0].Value-fee,
+			[]byte{txscript.OP_TRUE}))
+		tx := pinutil.NewTx(msgTx)
+		desc := &TxDesc{
+			Tx:       tx,
+			Fee:      fee,
+			FeePerKB: fee * 1000 / int64(msgTx.SerializeSize()),
+		}
+		for _, ancestor := range ancestors {
+			desc.Ancestors = append(desc.Ancestors, *ancestor.Hash())
+		}
+		return desc
+	}
+
+	// The parent alone pays less than the single transaction, while the
+	// package of the parent and its child pays more.
+	parent := spend(coinbases[0], 100)
+	child := spend(parent.Tx.MsgTx(), 20000, parent.Tx)
+	single := spend(coinbases[1], 2000)
+	pkgSize := parent.Tx.MsgTx().SerializeSize() +
+		child.Tx.MsgTx().SerializeSize()
+	pkgFeePerKB := (parent.Fee + child.Fee) * 1000 / int64(pkgSize)
+	if parent.FeePerKB >= single.FeePerKB || pkgFeePerKB <= single.FeePerKB {
+		t.Fatal("unexpected fee rates of the test transactions")
+	}
+
+	policy := &Policy{
+		BlockMaxWeight: blockchain.MaxBlockWeight - 1000,
+		BlockMaxSize:   blockchain.MaxBlockBaseSize - 1000,
+		TxMinFreeFee:   1000,
+	}
+	source := &fakeTxSource{
+		descs: []*TxDesc{single, child, parent},
+	}
+	g := NewBlkTmplGenerator(policy, &chaincfg.RegressionNetParams, source,
+		chain, blockchain.NewMedianTime(), txscript.NewSigCache(100),
+		txscript.NewHashCache(100))
+	template, err := g.NewBlockTemplate(nil)
+	if err != nil {
+		t.Fatalf("NewBlockTemplate: unexpected error: %v", err)
+	}
+
+	names := map[chainhash.Hash]string{
+		*parent.Tx.Hash(): "parent",
+		*child.Tx.Hash():  "child",
+		*single.Tx.Hash(): "single",
+	}
+	want := []string{"parent", "child", "single"}
+	txns := template.Block.Transactions[1:]
+	if len(txns) != len(want) {
+		t.Fatalf("NewBlockTemplate: got %d transactions, want %d",
+			len(txns), len(want))
+	}
+	for i, tx := range txns {
+		if name := names[tx.TxHash()]; name != want[i] {
+			t.Fatalf("NewBlockTemplate: transaction %d is %s, want %s",
+				i, name, want[i])
+		}
+	}
+	wantFees := []int64{parent.Fee, child.Fee, single.Fee}
+	for i, fee := range template.Fees[1:] {
+		if fee != wantFees[i] {
+			t.Fatalf("NewBlockTemplate: fee of transaction %d is %d, "+
+				"want %d", i, fee, wantFees[i])
+		}
+	}
+}
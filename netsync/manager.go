@@ -32,6 +32,11 @@ const (
 	// hashes to store in memory.
 	maxRejectedTxns = 1000
 
+	// maxLowFeeTxns is the maximum number of transactions rejected for
+	// paying too low a fee which are kept so they can still be accepted
+	// along with an orphan spending them as a package.
+	maxLowFeeTxns = 100
+
 	// maxRequestedBlocks is the maximum number of requested block
 	// hashes to store in memory.
 	maxRequestedBlocks = wire.MaxInvPerMsg
@@ -192,6 +197,7 @@ type SyncManager struct {
 
 	// These fields should only be accessed from the blockHandler thread
 	rejectedTxns     map[chainhash.Hash]struct{}
+	lowFeeTxns       map[chainhash.Hash]*pinutil.Tx
 	requestedTxns    map[chainhash.Hash]struct{}
 	requestedBlocks  map[chainhash.Hash]struct{}
 	syncPeer         *peerpkg.Peer
@@ -204,6 +210,18 @@ type SyncManager struct {
 	startHeader      *list.Element
 	nextCheckpoint   *chaincfg.Checkpoint
 
+	// The following fields are used for the low-work headers presync
+	// which verifies the headers chain of the sync peer reaches the
+	// minimum chain work before its headers are stored.
+	headersPresyncMode bool
+	headersSync        *blockchain.HeadersSync
+
+	// tipHeadersMode is set while the headers after the final checkpoint
+	// are downloaded from the sync peer ahead of the blocks so the best
+	// known header chain, and thus the assumed valid block, is known while
+	// the blocks are validated.
+	tipHeadersMode bool
+
 	// An optional fee estimator.
 	feeEstimator *mempool.FeeEstimator
 }
@@ -357,7 +375,24 @@ func (sm *SyncManager) startSync() {
 		// and fully validate them.  Finally, regression test mode does
 		// not support the headers-first approach so do normal block
 		// downloads when in regression test mode.
-		if sm.nextCheckpoint != nil &&
+		//
+		// Before any of that, the headers chain of the peer is presynced
+		// when the best known header chain does not have the minimum
+		// chain work yet so a peer can't make us store a long chain of
+		// low-work headers.  Also, once past the final checkpoint, the
+		// remaining headers are downloaded before the blocks so the
+		// scripts of the blocks up to the assumed valid block can be
+		// skipped.
+		if !sm.chain.HasMinimumChainWork() &&
+			sm.chainParams != &chaincfg.RegressionNetParams {
+
+			bestHash, _ := sm.chain.BestHeader()
+			locator := sm.chain.BlockLocatorFromHash(&bestHash)
+			bestPeer.PushGetHeadersMsg(locator, &zeroHash)
+			sm.headersPresyncMode = true
+			log.Infof("Presyncing headers from peer %s until the "+
+				"minimum chain work is reached", bestPeer.Addr())
+		} else if sm.nextCheckpoint != nil &&
 			best.Height < sm.nextCheckpoint.Height &&
 			sm.chainParams != &chaincfg.RegressionNetParams {
 
@@ -366,10 +401,11 @@ func (sm *SyncManager) startSync() {
 			log.Infof("Downloading headers for blocks %d to "+
 				"%d from peer %s", best.Height+1,
 				sm.nextCheckpoint.Height, bestPeer.Addr())
-		} else {
+		} else if !sm.fetchTipHeaders(bestPeer) {
 			bestPeer.PushGetBlocksMsg(locator, &zeroHash)
 		}
 		sm.syncPeer = bestPeer
+		sm.fetchHistoricalBlocks()
 
 		// Reset the last progress time now that we have a non-nil
 		// syncPeer to avoid instantly detecting it as stalled in the
@@ -573,6 +609,8 @@ func (sm *SyncManager) updateSyncPeer(dcSyncPeer bool) {
 		best := sm.chain.BestSnapshot()
 		sm.resetHeaderState(&best.Hash, best.Height)
 	}
+	sm.resetHeadersPresyncState()
+	sm.tipHeadersMode = false
 
 	sm.syncPeer = nil
 	sm.startSync()
@@ -639,12 +677,108 @@ func (sm *SyncManager) handleTxMsg(tmsg *txMsg) {
 		// send it.
 		code, reason := mempool.ErrToRejectErr(err)
 		peer.PushRejectMsg(wire.CmdTx, code, reason, txHash, false)
+
+		// Keep transactions rejected for paying too low a fee so they
+		// can still be accepted along with an orphan spending them as
+		// a package, and try so for the orphans already received.
+		if code == wire.RejectInsufficientFee {
+			if len(sm.lowFeeTxns)+1 > maxLowFeeTxns {
+				for hash := range sm.lowFeeTxns {
+					delete(sm.lowFeeTxns, hash)
+					break
+				}
+			}
+			sm.lowFeeTxns[*txHash] = tmsg.tx
+
+			for _, orphan := range sm.txMemPool.OrphanSpenders(tmsg.tx) {
+				sm.processOrphanPackage(orphan, peer)
+			}
+		}
+		return
+	}
+
+	// Nothing is accepted when the transaction was added to the orphan
+	// pool, so attempt to accept it along with any of its missing parents
+	// which were rejected for paying too low a fee.
+	if len(acceptedTxs) == 0 {
+		sm.processOrphanPackage(tmsg.tx, peer)
 		return
 	}
 
 	sm.peerNotifier.AnnounceNewTransactions(acceptedTxs)
 }
 
+// processOrphanPackage attempts to accept the passed orphan transaction as a
+// package along with its missing parents which were rejected for paying too
+// low a fee.  This allows a child to pay for its parents even though peers
+// relay each transaction on its own.
+func (sm *SyncManager) processOrphanPackage(orphan *pinutil.Tx, peer *peerpkg.Peer) {
+	// Gather the parents of the orphan which were rejected for paying too
+	// low a fee.
+	parents := make(map[chainhash.Hash]*pinutil.Tx)
+	for _, txIn := range orphan.MsgTx().TxIn {
+		hash := txIn.PreviousOutPoint.Hash
+		if parent, ok := sm.lowFeeTxns[hash]; ok {
+			parents[hash] = parent
+		}
+	}
+	if len(parents) == 0 {
+		return
+	}
+
+	// Order the parents so that every parent comes after the other parents
+	// it spends as required for a package.
+	pkg := make([]*pinutil.Tx, 0, len(parents)+1)
+	added := make(map[chainhash.Hash]struct{}, len(parents))
+	for len(pkg) < len(parents) {
+		numAdded := len(pkg)
+		for hash, parent := range parents {
+			if _, ok := added[hash]; ok {
+				continue
+			}
+			ready := true
+			for _, txIn := range parent.MsgTx().TxIn {
+				prevHash := txIn.PreviousOutPoint.Hash
+				_, isParent := parents[prevHash]
+				_, isAdded := added[prevHash]
+				if isParent && !isAdded {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				pkg = append(pkg, parent)
+				added[hash] = struct{}{}
+			}
+		}
+		if len(pkg) == numAdded {
+			return
+		}
+	}
+	pkg = append(pkg, orphan)
+
+	acceptedTxs, err := sm.txMemPool.ProcessPackage(pkg, true)
+	for _, txD := range acceptedTxs {
+		delete(sm.lowFeeTxns, *txD.Tx.Hash())
+		delete(sm.rejectedTxns, *txD.Tx.Hash())
+	}
+	if len(acceptedTxs) > 0 {
+		sm.peerNotifier.AnnounceNewTransactions(acceptedTxs)
+	}
+	if err != nil {
+		log.Debugf("Rejected orphan transaction %v from %s along with "+
+			"its low fee parents: %v", orphan.Hash(), peer, err)
+		return
+	}
+
+	parentStr := "parents"
+	if len(parents) == 1 {
+		parentStr = "parent"
+	}
+	log.Debugf("Accepted orphan transaction %v from %s along with %d "+
+		"low fee %s", orphan.Hash(), peer, len(parents), parentStr)
+}
+
 // current returns true if we believe we are synced with our peers, false if we
 // still have blocks to check
 func (sm *SyncManager) current() bool {
@@ -807,6 +941,7 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 
 		// Clear the rejected transactions.
 		sm.rejectedTxns = make(map[chainhash.Hash]struct{})
+		sm.lowFeeTxns = make(map[chainhash.Hash]*pinutil.Tx)
 	}
 
 	// Update the block height for this peer. But only send a message to
@@ -821,6 +956,12 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 		}
 	}
 
+	// Request more of the blocks before a loaded utxo snapshot from the
+	// sync peer when the request queue is getting short.
+	if peer == sm.syncPeer && len(state.requestedBlocks) < minInFlightBlocks {
+		sm.fetchHistoricalBlocks()
+	}
+
 	// Nothing more to do if we aren't in headers-first mode.
 	if !sm.headersFirstMode {
 		return
@@ -860,10 +1001,14 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 
 	// This is headers-first mode, the block is a checkpoint, and there are
 	// no more checkpoints, so switch to normal mode by requesting blocks
-	// from the block after this one up to the end of the chain (zero hash).
+	// from the block after this one up to the end of the chain (zero hash)
+	// once the remaining headers have been downloaded.
 	sm.headersFirstMode = false
 	sm.headerList.Init()
 	log.Infof("Reached the final checkpoint -- switching to normal mode")
+	if sm.fetchTipHeaders(peer) {
+		return
+	}
 	locator := blockchain.BlockLocator([]*chainhash.Hash{blockHash})
 	err = peer.PushGetBlocksMsg(locator, &zeroHash)
 	if err != nil {
@@ -927,6 +1072,36 @@ func (sm *SyncManager) fetchHeaderBlocks() {
 	}
 }
 
+// fetchHistoricalBlocks creates and sends a request to the syncPeer for the
+// blocks before the base of a loaded utxo snapshot which still need to be
+// downloaded so they can be validated in the background.
+func (sm *SyncManager) fetchHistoricalBlocks() {
+	hashes := sm.chain.HistoricalBlocksToFetch(maxRequestedBlocks)
+	if len(hashes) == 0 {
+		return
+	}
+
+	syncPeerState := sm.peerStates[sm.syncPeer]
+	gdmsg := wire.NewMsgGetDataSizeHint(uint(len(hashes)))
+	for _, hash := range hashes {
+		if _, exists := sm.requestedBlocks[*hash]; exists {
+			continue
+		}
+
+		sm.requestedBlocks[*hash] = struct{}{}
+		syncPeerState.requestedBlocks[*hash] = struct{}{}
+
+		iv := wire.NewInvVect(wire.InvTypeBlock, hash)
+		if sm.syncPeer.IsWitnessEnabled() {
+			iv.Type = wire.InvTypeWitnessBlock
+		}
+		gdmsg.AddInvVect(iv)
+	}
+	if len(gdmsg.InvList) > 0 {
+		sm.syncPeer.QueueMessage(gdmsg, nil)
+	}
+}
+
 // handleHeadersMsg handles block header messages from all peers.  Headers are
 // requested when performing a headers-first sync.
 func (sm *SyncManager) handleHeadersMsg(hmsg *headersMsg) {
@@ -937,8 +1112,23 @@ func (sm *SyncManager) handleHeadersMsg(hmsg *headersMsg) {
 		return
 	}
 
-	// The remote peer is misbehaving if we didn't request headers.
+	// Headers received from the sync peer during the presync are handled
+	// separately since they are not stored until the chain is known to
+	// have the minimum chain work.
 	msg := hmsg.headers
+	if sm.headersPresyncMode && peer == sm.syncPeer {
+		sm.handlePresyncHeaders(peer, msg)
+		return
+	}
+
+	// Likewise for the headers after the final checkpoint which are
+	// downloaded from the sync peer ahead of the blocks.
+	if sm.tipHeadersMode && peer == sm.syncPeer {
+		sm.handleTipHeaders(peer, msg)
+		return
+	}
+
+	// The remote peer is misbehaving if we didn't request headers.
 	numHeaders := len(msg.Headers)
 	if !sm.headersFirstMode {
 		log.Warnf("Got %d unrequested headers from %s -- "+
@@ -952,6 +1142,16 @@ func (sm *SyncManager) handleHeadersMsg(hmsg *headersMsg) {
 		return
 	}
 
+	// Verify the proof of work of all of the received headers in parallel
+	// up front since it is by far the most expensive check and would
+	// otherwise be performed serially as each header is processed.
+	if err := sm.chain.CheckHeadersProofOfWork(msg.Headers); err != nil {
+		log.Warnf("Received block header with invalid proof of work "+
+			"from peer %s -- disconnecting: %v", peer.Addr(), err)
+		peer.Disconnect()
+		return
+	}
+
 	// Process all of the received headers ensuring each one connects to the
 	// previous and that checkpoints match.
 	receivedCheckpoint := false
@@ -987,6 +1187,17 @@ func (sm *SyncManager) handleHeadersMsg(hmsg *headersMsg) {
 			return
 		}
 
+		// Add the header to the block index so the chain is aware of
+		// the best known header chain ahead of the block data.
+		err := sm.chain.ProcessBlockHeader(blockHeader, blockchain.BFNone)
+		if err != nil {
+			log.Warnf("Received invalid block header %v from peer "+
+				"%s -- disconnecting: %v", blockHash, peer.Addr(),
+				err)
+			peer.Disconnect()
+			return
+		}
+
 		// Verify the header at the next checkpoint height matches.
 		if node.height == sm.nextCheckpoint.Height {
 			if node.hash.IsEqual(sm.nextCheckpoint.Hash) {
@@ -1035,6 +1246,189 @@ func (sm *SyncManager) handleHeadersMsg(hmsg *headersMsg) {
 	}
 }
 
+// resetHeadersPresyncState ends the low-work headers presync, if any.
+func (sm *SyncManager) resetHeadersPresyncState() {
+	sm.headersPresyncMode = false
+	sm.headersSync = nil
+}
+
+// handlePresyncHeaders handles block headers received from the sync peer
+// during the low-work headers presync.  The headers are only stored once they
+// have been verified to be part of a chain with the minimum chain work, after
+// which the sync is restarted normally.
+func (sm *SyncManager) handlePresyncHeaders(peer *peerpkg.Peer, msg *wire.MsgHeaders) {
+	// An empty headers message means the peer has no more headers, which
+	// is handled below when there is a presync in progress.
+	numHeaders := len(msg.Headers)
+	if sm.headersSync == nil {
+		if numHeaders == 0 {
+			sm.finishHeadersPresync(peer)
+			return
+		}
+
+		var err error
+		sm.headersSync, err = sm.chain.NewHeadersSync(
+			&msg.Headers[0].PrevBlock)
+		if err != nil {
+			log.Warnf("Received block headers which do not connect "+
+				"to a known block from peer %s -- disconnecting: %v",
+				peer.Addr(), err)
+			peer.Disconnect()
+			return
+		}
+	}
+
+	if err := sm.chain.CheckHeadersProofOfWork(msg.Headers); err != nil {
+		log.Warnf("Received block header with invalid proof of work "+
+			"from peer %s -- disconnecting: %v", peer.Addr(), err)
+		peer.Disconnect()
+		return
+	}
+
+	fullMessage := numHeaders == wire.MaxBlockHeadersPerMsg
+	released, requestMore, err := sm.headersSync.ProcessHeaders(
+		msg.Headers, fullMessage)
+	if err != nil {
+		log.Warnf("Received invalid block headers during the presync "+
+			"from peer %s -- disconnecting: %v", peer.Addr(), err)
+		peer.Disconnect()
+		return
+	}
+	sm.lastProgressTime = time.Now()
+
+	// Store the headers which have been verified to be part of the chain
+	// with the minimum chain work.
+	for _, header := range released {
+		err := sm.chain.ProcessBlockHeader(header, blockchain.BFNone)
+		if err != nil {
+			log.Warnf("Received invalid block header %v from peer "+
+				"%s -- disconnecting: %v", header.BlockHash(),
+				peer.Addr(), err)
+			peer.Disconnect()
+			return
+		}
+	}
+
+	if requestMore {
+		locator := sm.headersSync.Locator()
+		err := peer.PushGetHeadersMsg(locator, &zeroHash)
+		if err != nil {
+			log.Warnf("Failed to send getheaders message to "+
+				"peer %s: %v", peer.Addr(), err)
+		}
+		return
+	}
+	sm.finishHeadersPresync(peer)
+}
+
+// finishHeadersPresync ends the low-work headers presync with the passed sync
+// peer and restarts the sync.  The peer is no longer considered for syncing
+// when its headers chain does not reach the minimum chain work.
+func (sm *SyncManager) finishHeadersPresync(peer *peerpkg.Peer) {
+	sm.resetHeadersPresyncState()
+	if !sm.chain.HasMinimumChainWork() {
+		log.Infof("Headers chain of peer %s does not have the minimum "+
+			"chain work", peer.Addr())
+		if state, exists := sm.peerStates[peer]; exists {
+			state.syncCandidate = false
+		}
+	} else {
+		log.Infof("Headers presync with peer %s reached the minimum "+
+			"chain work", peer.Addr())
+	}
+	sm.syncPeer = nil
+	sm.startSync()
+}
+
+// fetchTipHeaders requests the headers after the best known header from the
+// passed sync peer when it has announced a later block than that header and
+// returns whether or not they were requested.  The blocks are downloaded once
+// the peer has no more headers.
+func (sm *SyncManager) fetchTipHeaders(peer *peerpkg.Peer) bool {
+	// Regression test mode does not support the headers-first approach.
+	if sm.chainParams == &chaincfg.RegressionNetParams {
+		return false
+	}
+
+	bestHash, bestHeight := sm.chain.BestHeader()
+	if peer.LastBlock() <= bestHeight {
+		return false
+	}
+
+	locator := sm.chain.BlockLocatorFromHash(&bestHash)
+	err := peer.PushGetHeadersMsg(locator, &zeroHash)
+	if err != nil {
+		log.Warnf("Failed to send getheaders message to peer %s: %v",
+			peer.Addr(), err)
+		return false
+	}
+	sm.tipHeadersMode = true
+	log.Infof("Downloading headers for blocks %d to %d from peer %s",
+		bestHeight+1, peer.LastBlock(), peer.Addr())
+	return true
+}
+
+// handleTipHeaders handles block headers received from the sync peer while
+// downloading the headers after the final checkpoint.  The headers are added
+// to the block index and, once the peer has no more of them, the blocks are
+// downloaded.
+func (sm *SyncManager) handleTipHeaders(peer *peerpkg.Peer, msg *wire.MsgHeaders) {
+	numHeaders := len(msg.Headers)
+	if numHeaders > 0 {
+		err := sm.chain.CheckHeadersProofOfWork(msg.Headers)
+		if err != nil {
+			log.Warnf("Received block header with invalid proof of "+
+				"work from peer %s -- disconnecting: %v",
+				peer.Addr(), err)
+			peer.Disconnect()
+			return
+		}
+
+		for _, header := range msg.Headers {
+			err := sm.chain.ProcessBlockHeader(header, blockchain.BFNone)
+			if err != nil {
+				log.Warnf("Received invalid block header %v from "+
+					"peer %s -- disconnecting: %v",
+					header.BlockHash(), peer.Addr(), err)
+				peer.Disconnect()
+				return
+			}
+		}
+		sm.lastProgressTime = time.Now()
+	}
+
+	// The peer likely has more headers when the message is full, so
+	// request the next batch starting from the latest received header.
+	if numHeaders == wire.MaxBlockHeadersPerMsg {
+		finalHash := msg.Headers[numHeaders-1].BlockHash()
+		locator := blockchain.BlockLocator([]*chainhash.Hash{&finalHash})
+		err := peer.PushGetHeadersMsg(locator, &zeroHash)
+		if err != nil {
+			log.Warnf("Failed to send getheaders message to "+
+				"peer %s: %v", peer.Addr(), err)
+		}
+		return
+	}
+
+	// The best known header chain now reaches the tip of the peer, so
+	// download the blocks after the current best block.
+	sm.tipHeadersMode = false
+	_, bestHeight := sm.chain.BestHeader()
+	log.Infof("Received the block headers up to height %d from peer %s: "+
+		"Fetching blocks", bestHeight, peer.Addr())
+	locator, err := sm.chain.LatestBlockLocator()
+	if err != nil {
+		log.Errorf("Failed to get block locator for the latest block: "+
+			"%v", err)
+		return
+	}
+	err = peer.PushGetBlocksMsg(locator, &zeroHash)
+	if err != nil {
+		log.Warnf("Failed to send getblocks message to peer %s: %v",
+			peer.Addr(), err)
+	}
+}
+
 // handleNotFoundMsg handles notfound messages from all peers.
 func (sm *SyncManager) handleNotFoundMsg(nfmsg *notFoundMsg) {
 	peer := nfmsg.peer
@@ -1181,8 +1575,10 @@ func (sm *SyncManager) handleInvMsg(imsg *invMsg) {
 		// for the peer.
 		peer.AddKnownInventory(iv)
 
-		// Ignore inventory when we're in headers-first mode.
-		if sm.headersFirstMode {
+		// Ignore inventory when we're in headers-first mode or
+		// downloading headers ahead of the blocks otherwise.
+		if sm.headersFirstMode || sm.headersPresyncMode ||
+			sm.tipHeadersMode {
 			continue
 		}
 
@@ -1447,6 +1843,10 @@ func (sm *SyncManager) handleBlockchainNotification(notification *blockchain.Not
 			sm.peerNotifier.AnnounceNewTransactions(acceptedTxs)
 		}
 
+		// Remove any transactions which have been in the transaction
+		// pool for longer than the maximum transaction age.
+		sm.txMemPool.ExpireTransactions()
+
 		// Register block with the fee estimator, if it exists.
 		if sm.feeEstimator != nil {
 			err := sm.feeEstimator.RegisterBlock(block)
@@ -1639,6 +2039,7 @@ func New(config *Config) (*SyncManager, error) {
 		txMemPool:       config.TxMemPool,
 		chainParams:     config.ChainParams,
 		rejectedTxns:    make(map[chainhash.Hash]struct{}),
+		lowFeeTxns:      make(map[chainhash.Hash]*pinutil.Tx),
 		requestedTxns:   make(map[chainhash.Hash]struct{}),
 		requestedBlocks: make(map[chainhash.Hash]struct{}),
 		peerStates:      make(map[*peerpkg.Peer]*peerSyncState),
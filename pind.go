@@ -157,6 +157,12 @@ func pindMain(serverChan chan<- *server) error {
 		pindLog.Infof("Gracefully shutting down the server...")
 		server.Stop()
 		server.WaitForShutdown()
+
+		// Write the utxo cache to the database now that no more blocks
+		// are being processed.
+		if err := server.chain.FlushUtxoCache(); err != nil {
+			pindLog.Errorf("Unable to flush utxo cache: %v", err)
+		}
 		srvrLog.Infof("Server shutdown complete")
 	}()
 	server.Start()
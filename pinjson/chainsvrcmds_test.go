@@ -265,6 +265,19 @@ func TestChainSvrCmds(t *testing.T) {
 				Range:      &pinjson.DescriptorRange{Value: []int{0, 2}},
 			},
 		},
+		{
+			name: "dumptxoutset",
+			newCmd: func() (interface{}, error) {
+				return pinjson.NewCmd("dumptxoutset", "utxo.dat")
+			},
+			staticCmd: func() interface{} {
+				return pinjson.NewDumpTxOutSetCmd("utxo.dat")
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"dumptxoutset","params":["utxo.dat"],"id":1}`,
+			unmarshalled: &pinjson.DumpTxOutSetCmd{
+				Path: "utxo.dat",
+			},
+		},
 		{
 			name: "getaddednodeinfo",
 			newCmd: func() (interface{}, error) {
@@ -699,6 +712,62 @@ func TestChainSvrCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"getinfo","params":[],"id":1}`,
 			unmarshalled: &pinjson.GetInfoCmd{},
 		},
+		{
+			name: "getmempoolancestors",
+			newCmd: func() (interface{}, error) {
+				return pinjson.NewCmd("getmempoolancestors", "txhash")
+			},
+			staticCmd: func() interface{} {
+				return pinjson.NewGetMempoolAncestorsCmd("txhash", nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getmempoolancestors","params":["txhash"],"id":1}`,
+			unmarshalled: &pinjson.GetMempoolAncestorsCmd{
+				TxID:    "txhash",
+				Verbose: pinjson.Bool(false),
+			},
+		},
+		{
+			name: "getmempoolancestors optional",
+			newCmd: func() (interface{}, error) {
+				return pinjson.NewCmd("getmempoolancestors", "txhash", true)
+			},
+			staticCmd: func() interface{} {
+				return pinjson.NewGetMempoolAncestorsCmd("txhash", pinjson.Bool(true))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getmempoolancestors","params":["txhash",true],"id":1}`,
+			unmarshalled: &pinjson.GetMempoolAncestorsCmd{
+				TxID:    "txhash",
+				Verbose: pinjson.Bool(true),
+			},
+		},
+		{
+			name: "getmempooldescendants",
+			newCmd: func() (interface{}, error) {
+				return pinjson.NewCmd("getmempooldescendants", "txhash")
+			},
+			staticCmd: func() interface{} {
+				return pinjson.NewGetMempoolDescendantsCmd("txhash", nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getmempooldescendants","params":["txhash"],"id":1}`,
+			unmarshalled: &pinjson.GetMempoolDescendantsCmd{
+				TxID:    "txhash",
+				Verbose: pinjson.Bool(false),
+			},
+		},
+		{
+			name: "getmempooldescendants optional",
+			newCmd: func() (interface{}, error) {
+				return pinjson.NewCmd("getmempooldescendants", "txhash", true)
+			},
+			staticCmd: func() interface{} {
+				return pinjson.NewGetMempoolDescendantsCmd("txhash", pinjson.Bool(true))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getmempooldescendants","params":["txhash",true],"id":1}`,
+			unmarshalled: &pinjson.GetMempoolDescendantsCmd{
+				TxID:    "txhash",
+				Verbose: pinjson.Bool(true),
+			},
+		},
 		{
 			name: "getmempoolentry",
 			newCmd: func() (interface{}, error) {
@@ -1025,6 +1094,19 @@ func TestChainSvrCmds(t *testing.T) {
 				BlockHash: "123",
 			},
 		},
+		{
+			name: "loadtxoutset",
+			newCmd: func() (interface{}, error) {
+				return pinjson.NewCmd("loadtxoutset", "utxo.dat")
+			},
+			staticCmd: func() interface{} {
+				return pinjson.NewLoadTxOutSetCmd("utxo.dat")
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"loadtxoutset","params":["utxo.dat"],"id":1}`,
+			unmarshalled: &pinjson.LoadTxOutSetCmd{
+				Path: "utxo.dat",
+			},
+		},
 		{
 			name: "ping",
 			newCmd: func() (interface{}, error) {
@@ -1049,6 +1131,19 @@ func TestChainSvrCmds(t *testing.T) {
 				BlockHash: "0123",
 			},
 		},
+		{
+			name: "pruneblockchain",
+			newCmd: func() (interface{}, error) {
+				return pinjson.NewCmd("pruneblockchain", 1000)
+			},
+			staticCmd: func() interface{} {
+				return pinjson.NewPruneBlockchainCmd(1000)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"pruneblockchain","params":[1000],"id":1}`,
+			unmarshalled: &pinjson.PruneBlockchainCmd{
+				Height: 1000,
+			},
+		},
 		{
 			name: "reconsiderblock",
 			newCmd: func() (interface{}, error) {
@@ -1062,6 +1157,17 @@ func TestChainSvrCmds(t *testing.T) {
 				BlockHash: "123",
 			},
 		},
+		{
+			name: "savemempool",
+			newCmd: func() (interface{}, error) {
+				return pinjson.NewCmd("savemempool")
+			},
+			staticCmd: func() interface{} {
+				return pinjson.NewSaveMempoolCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"savemempool","params":[],"id":1}`,
+			unmarshalled: &pinjson.SaveMempoolCmd{},
+		},
 		{
 			name: "searchrawtransactions",
 			newCmd: func() (interface{}, error) {
@@ -1355,6 +1461,32 @@ func TestChainSvrCmds(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "submitpackage",
+			newCmd: func() (interface{}, error) {
+				return pinjson.NewCmd("submitpackage", []string{"1122", "3344"})
+			},
+			staticCmd: func() interface{} {
+				return pinjson.NewSubmitPackageCmd([]string{"1122", "3344"})
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"submitpackage","params":[["1122","3344"]],"id":1}`,
+			unmarshalled: &pinjson.SubmitPackageCmd{
+				RawTxns: []string{"1122", "3344"},
+			},
+		},
+		{
+			name: "testmempoolaccept",
+			newCmd: func() (interface{}, error) {
+				return pinjson.NewCmd("testmempoolaccept", []string{"1122", "3344"})
+			},
+			staticCmd: func() interface{} {
+				return pinjson.NewTestMempoolAcceptCmd([]string{"1122", "3344"})
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"testmempoolaccept","params":[["1122","3344"]],"id":1}`,
+			unmarshalled: &pinjson.TestMempoolAcceptCmd{
+				RawTxns: []string{"1122", "3344"},
+			},
+		},
 		{
 			name: "uptime",
 			newCmd: func() (interface{}, error) {
@@ -1460,6 +1592,30 @@ func TestChainSvrCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"getdescriptorinfo","params":["123"],"id":1}`,
 			unmarshalled: &pinjson.GetDescriptorInfoCmd{Descriptor: "123"},
 		},
+		{
+			name: "getdeploymentinfo",
+			newCmd: func() (interface{}, error) {
+				return pinjson.NewCmd("getdeploymentinfo")
+			},
+			staticCmd: func() interface{} {
+				return pinjson.NewGetDeploymentInfoCmd(nil)
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getdeploymentinfo","params":[],"id":1}`,
+			unmarshalled: &pinjson.GetDeploymentInfoCmd{BlockHash: nil},
+		},
+		{
+			name: "getdeploymentinfo optional",
+			newCmd: func() (interface{}, error) {
+				return pinjson.NewCmd("getdeploymentinfo", "123")
+			},
+			staticCmd: func() interface{} {
+				return pinjson.NewGetDeploymentInfoCmd(pinjson.String("123"))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getdeploymentinfo","params":["123"],"id":1}`,
+			unmarshalled: &pinjson.GetDeploymentInfoCmd{
+				BlockHash: pinjson.String("123"),
+			},
+		},
 	}
 
 	t.Logf("Running %d tests", len(tests))
@@ -82,7 +82,7 @@ type GetBlockVerboseResult struct {
 	VersionHex    string        `json:"versionHex"`
 	MerkleRoot    string        `json:"merkleroot"`
 	Tx            []string      `json:"tx,omitempty"`
-	RawTx         []TxRawResult `json:"rawtx,omitempty"` // Note: this field is always empty when verbose != 2.
+	RawTx         []TxRawResult `json:"rawtx,omitempty"` // Note: this field is always empty when verbose < 2.
 	Time          int64         `json:"time"`
 	Nonce         uint32        `json:"nonce"`
 	Bits          string        `json:"bits"`
@@ -117,6 +117,15 @@ type GetBlockVerboseTxResult struct {
 	NextHash      string        `json:"nextblockhash,omitempty"`
 }
 
+// GetChainTipsResult models the data of a single tip returned from the
+// getchaintips command.
+type GetChainTipsResult struct {
+	Height    int32  `json:"height"`
+	Hash      string `json:"hash"`
+	BranchLen int32  `json:"branchlen"`
+	Status    string `json:"status"`
+}
+
 // GetChainTxStatsResult models the data from the getchaintxstats command.
 type GetChainTxStatsResult struct {
 	Time                   int64   `json:"time"`
@@ -172,12 +181,16 @@ type SoftForkDescription struct {
 // Bip9SoftForkDescription describes the current state of a defined BIP0009
 // version bits soft-fork.
 type Bip9SoftForkDescription struct {
-	Status     string `json:"status"`
-	Bit        uint8  `json:"bit"`
-	StartTime1 int64  `json:"startTime"`
-	StartTime2 int64  `json:"start_time"`
-	Timeout    int64  `json:"timeout"`
-	Since      int32  `json:"since"`
+	Status              string `json:"status"`
+	Bit                 uint8  `json:"bit"`
+	StartTime1          int64  `json:"startTime"`
+	StartTime2          int64  `json:"start_time"`
+	Timeout             int64  `json:"timeout"`
+	StartHeight         int32  `json:"start_height,omitempty"`
+	TimeoutHeight       int32  `json:"timeout_height,omitempty"`
+	LockInOnTimeout     bool   `json:"lockinontimeout,omitempty"`
+	MinActivationHeight int32  `json:"min_activation_height"`
+	Since               int32  `json:"since"`
 }
 
 // StartTime returns the starting time of the softfork as a Unix epoch.
@@ -188,6 +201,39 @@ func (d *Bip9SoftForkDescription) StartTime() int64 {
 	return d.StartTime2
 }
 
+// DeploymentStatistics describes the signalling for a deployment within the
+// confirmation window which contains a block.
+type DeploymentStatistics struct {
+	Period      uint32 `json:"period"`
+	Threshold   uint32 `json:"threshold"`
+	PeriodStart int32  `json:"period_start"`
+	Elapsed     uint32 `json:"elapsed"`
+	Count       uint32 `json:"count"`
+	Possible    bool   `json:"possible"`
+}
+
+// DeploymentInfo describes the parameters and the state of a deployment for a
+// block along with the signalling for it while it is voted on.
+type DeploymentInfo struct {
+	Bit                 uint8                 `json:"bit"`
+	StartTime           int64                 `json:"start_time"`
+	Timeout             int64                 `json:"timeout"`
+	StartHeight         int32                 `json:"start_height,omitempty"`
+	TimeoutHeight       int32                 `json:"timeout_height,omitempty"`
+	LockInOnTimeout     bool                  `json:"lockinontimeout,omitempty"`
+	MinActivationHeight int32                 `json:"min_activation_height"`
+	Status              string                `json:"status"`
+	Statistics          *DeploymentStatistics `json:"statistics,omitempty"`
+}
+
+// GetDeploymentInfoResult models the data returned from the getdeploymentinfo
+// command.
+type GetDeploymentInfoResult struct {
+	Hash        string                     `json:"hash"`
+	Height      int32                      `json:"height"`
+	Deployments map[string]*DeploymentInfo `json:"deployments"`
+}
+
 // SoftForks describes the current softforks enabled by the backend. Softforks
 // activated through BIP9 are grouped together separate from any other softforks
 // with different activation types.
@@ -227,6 +273,7 @@ type GetBlockChainInfoResult struct {
 	PruneHeight          int32   `json:"pruneheight,omitempty"`
 	ChainWork            string  `json:"chainwork,omitempty"`
 	SizeOnDisk           int64   `json:"size_on_disk,omitempty"`
+	Warnings             string  `json:"warnings,omitempty"`
 	*SoftForks
 	*UnifiedSoftForks
 }
@@ -298,9 +345,7 @@ type GetBlockTemplateResult struct {
 	RejectReasion string   `json:"reject-reason,omitempty"`
 }
 
-// GetMempoolEntryResult models the data returned from the getmempoolentry's
-// fee field
-
+// MempoolFees models the data returned from the getmempoolentry's fees field.
 type MempoolFees struct {
 	Base       float64 `json:"base"`
 	Modified   float64 `json:"modified"`
@@ -327,13 +372,21 @@ type GetMempoolEntryResult struct {
 	WTxId           string      `json:"wtxid"`
 	Fees            MempoolFees `json:"fees"`
 	Depends         []string    `json:"depends"`
+
+	// BIP125Replaceable is whether the transaction or one of its
+	// unconfirmed ancestors signals replacement as defined by BIP 125.
+	BIP125Replaceable bool `json:"bip125-replaceable"`
 }
 
 // GetMempoolInfoResult models the data returned from the getmempoolinfo
 // command.
 type GetMempoolInfoResult struct {
-	Size  int64 `json:"size"`
-	Bytes int64 `json:"bytes"`
+	Size          int64   `json:"size"`
+	Bytes         int64   `json:"bytes"`
+	Usage         int64   `json:"usage"`
+	MaxMempool    int64   `json:"maxmempool"`
+	MempoolMinFee float64 `json:"mempoolminfee"`
+	MinRelayTxFee float64 `json:"minrelaytxfee"`
 }
 
 // NetworksResult models the networks data from the getnetworkinfo command.
@@ -390,6 +443,7 @@ type GetPeerInfoResult struct {
 	RelayTxes      bool    `json:"relaytxes"`
 	LastSend       int64   `json:"lastsend"`
 	LastRecv       int64   `json:"lastrecv"`
+	LastBlock      int64   `json:"lastblock"`
 	BytesSent      uint64  `json:"bytessent"`
 	BytesRecv      uint64  `json:"bytesrecv"`
 	ConnTime       int64   `json:"conntime"`
@@ -448,10 +502,46 @@ type GetTxOutSetInfoResult struct {
 	TxOuts         int64          `json:"txouts"`
 	BogoSize       int64          `json:"bogosize"`
 	HashSerialized chainhash.Hash `json:"hash_serialized_2"`
+	MuHash         chainhash.Hash `json:"muhash"`
 	DiskSize       int64          `json:"disk_size"`
 	TotalAmount    pinutil.Amount `json:"total_amount"`
 }
 
+// MarshalJSON provides a custom Marshal method for GetTxOutSetInfoResult.
+// The hashes are encoded as strings, the total amount in BTC, and the fields
+// which are not known to the server are omitted.
+func (g *GetTxOutSetInfoResult) MarshalJSON() ([]byte, error) {
+	var hashSerialized, muHash string
+	if g.HashSerialized != (chainhash.Hash{}) {
+		hashSerialized = g.HashSerialized.String()
+	}
+	if g.MuHash != (chainhash.Hash{}) {
+		muHash = g.MuHash.String()
+	}
+	result := struct {
+		Height         int64   `json:"height"`
+		BestBlock      string  `json:"bestblock"`
+		Transactions   int64   `json:"transactions,omitempty"`
+		TxOuts         int64   `json:"txouts"`
+		BogoSize       int64   `json:"bogosize"`
+		HashSerialized string  `json:"hash_serialized_2,omitempty"`
+		MuHash         string  `json:"muhash,omitempty"`
+		DiskSize       int64   `json:"disk_size,omitempty"`
+		TotalAmount    float64 `json:"total_amount"`
+	}{
+		Height:         g.Height,
+		BestBlock:      g.BestBlock.String(),
+		Transactions:   g.Transactions,
+		TxOuts:         g.TxOuts,
+		BogoSize:       g.BogoSize,
+		HashSerialized: hashSerialized,
+		MuHash:         muHash,
+		DiskSize:       g.DiskSize,
+		TotalAmount:    g.TotalAmount.ToBTC(),
+	}
+	return json.Marshal(result)
+}
+
 // UnmarshalJSON unmarshals the result of the gettxoutsetinfo JSON-RPC call
 func (g *GetTxOutSetInfoResult) UnmarshalJSON(data []byte) error {
 	// Step 1: Create type aliases of the original struct.
@@ -462,6 +552,7 @@ func (g *GetTxOutSetInfoResult) UnmarshalJSON(data []byte) error {
 	aux := &struct {
 		BestBlock      string  `json:"bestblock"`
 		HashSerialized string  `json:"hash_serialized_2"`
+		MuHash         string  `json:"muhash"`
 		TotalAmount    float64 `json:"total_amount"`
 		*Alias
 	}{
@@ -488,6 +579,13 @@ func (g *GetTxOutSetInfoResult) UnmarshalJSON(data []byte) error {
 
 	g.HashSerialized = *serializedHash
 
+	muHash, err := chainhash.NewHashFromStr(aux.MuHash)
+	if err != nil {
+		return err
+	}
+
+	g.MuHash = *muHash
+
 	amount, err := pinutil.NewAmount(aux.TotalAmount)
 	if err != nil {
 		return err
@@ -498,6 +596,29 @@ func (g *GetTxOutSetInfoResult) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// DumpTxOutSetResult models the data from the dumptxoutset command.
+type DumpTxOutSetResult struct {
+	CoinsWritten uint64 `json:"coins_written"`
+	BaseHash     string `json:"base_hash"`
+	BaseHeight   int32  `json:"base_height"`
+	Path         string `json:"path"`
+	TxOutSetHash string `json:"txoutset_hash"`
+	TotalTxns    uint64 `json:"nchaintx"`
+}
+
+// SaveMempoolResult models the data from the savemempool command.
+type SaveMempoolResult struct {
+	Filename string `json:"filename"`
+}
+
+// LoadTxOutSetResult models the data from the loadtxoutset command.
+type LoadTxOutSetResult struct {
+	CoinsLoaded uint64 `json:"coins_loaded"`
+	TipHash     string `json:"tip_hash"`
+	BaseHeight  int32  `json:"base_height"`
+	Path        string `json:"path"`
+}
+
 // GetNetTotalsResult models the data returned from the getnettotals command.
 type GetNetTotalsResult struct {
 	TotalBytesRecv uint64 `json:"totalbytesrecv"`
@@ -517,12 +638,13 @@ type ScriptSig struct {
 // getrawtransaction, decoderawtransaction, and searchrawtransaction use the
 // same structure.
 type Vin struct {
-	Coinbase  string     `json:"coinbase"`
-	Txid      string     `json:"txid"`
-	Vout      uint32     `json:"vout"`
-	ScriptSig *ScriptSig `json:"scriptSig"`
-	Sequence  uint32     `json:"sequence"`
-	Witness   []string   `json:"txinwitness"`
+	Coinbase  string             `json:"coinbase"`
+	Txid      string             `json:"txid"`
+	Vout      uint32             `json:"vout"`
+	ScriptSig *ScriptSig         `json:"scriptSig"`
+	Sequence  uint32             `json:"sequence"`
+	Witness   []string           `json:"txinwitness"`
+	PrevOut   *SpentOutputResult `json:"prevout,omitempty"`
 }
 
 // IsCoinBase returns a bool to show if a Vin is a Coinbase one or not.
@@ -553,35 +675,48 @@ func (v *Vin) MarshalJSON() ([]byte, error) {
 
 	if v.HasWitness() {
 		txStruct := struct {
-			Txid      string     `json:"txid"`
-			Vout      uint32     `json:"vout"`
-			ScriptSig *ScriptSig `json:"scriptSig"`
-			Witness   []string   `json:"txinwitness"`
-			Sequence  uint32     `json:"sequence"`
+			Txid      string             `json:"txid"`
+			Vout      uint32             `json:"vout"`
+			ScriptSig *ScriptSig         `json:"scriptSig"`
+			Witness   []string           `json:"txinwitness"`
+			PrevOut   *SpentOutputResult `json:"prevout,omitempty"`
+			Sequence  uint32             `json:"sequence"`
 		}{
 			Txid:      v.Txid,
 			Vout:      v.Vout,
 			ScriptSig: v.ScriptSig,
 			Witness:   v.Witness,
+			PrevOut:   v.PrevOut,
 			Sequence:  v.Sequence,
 		}
 		return json.Marshal(txStruct)
 	}
 
 	txStruct := struct {
-		Txid      string     `json:"txid"`
-		Vout      uint32     `json:"vout"`
-		ScriptSig *ScriptSig `json:"scriptSig"`
-		Sequence  uint32     `json:"sequence"`
+		Txid      string             `json:"txid"`
+		Vout      uint32             `json:"vout"`
+		ScriptSig *ScriptSig         `json:"scriptSig"`
+		PrevOut   *SpentOutputResult `json:"prevout,omitempty"`
+		Sequence  uint32             `json:"sequence"`
 	}{
 		Txid:      v.Txid,
 		Vout:      v.Vout,
 		ScriptSig: v.ScriptSig,
+		PrevOut:   v.PrevOut,
 		Sequence:  v.Sequence,
 	}
 	return json.Marshal(txStruct)
 }
 
+// SpentOutputResult models the output spent by a transaction input which is
+// returned by the getblock command when the verbosity is 3.
+type SpentOutputResult struct {
+	Generated    bool               `json:"generated"`
+	Height       int32              `json:"height"`
+	Value        float64            `json:"value"`
+	ScriptPubKey ScriptPubKeyResult `json:"scriptPubKey"`
+}
+
 // PrevOut represents previous output for an input Vin.
 type PrevOut struct {
 	Addresses []string `json:"addresses,omitempty"`
@@ -721,6 +856,10 @@ type TxRawResult struct {
 	Time          int64  `json:"time,omitempty"`
 	Blocktime     int64  `json:"blocktime,omitempty"`
 	PinData       string `json:"pinData,omitempty"`
+
+	// Fee is the fee paid by the transaction.  It is only set by the
+	// getblock command when the verbosity is 3.
+	Fee float64 `json:"fee,omitempty"`
 }
 
 // SearchRawTransactionsResult models the data from the searchrawtransaction
@@ -743,6 +882,45 @@ type SearchRawTransactionsResult struct {
 	PinData       string 	   `json:"pinData,omitempty"`
 }
 
+// SubmitPackageFees describes the fees paid by a transaction accepted by the
+// submitpackage command.
+type SubmitPackageFees struct {
+	Base float64 `json:"base"`
+}
+
+// SubmitPackageTxResult models the data returned from the submitpackage command
+// for each of the transactions in the package.
+type SubmitPackageTxResult struct {
+	Txid  string             `json:"txid"`
+	Wtxid string             `json:"wtxid"`
+	Vsize int64              `json:"vsize,omitempty"`
+	Fees  *SubmitPackageFees `json:"fees,omitempty"`
+	Error string             `json:"error,omitempty"`
+}
+
+// SubmitPackageResult models the data returned from the submitpackage command.
+type SubmitPackageResult struct {
+	PackageMsg string                  `json:"package_msg"`
+	TxResults  []SubmitPackageTxResult `json:"tx-results"`
+}
+
+// TestMempoolAcceptFees describes the fees paid by a transaction checked by the
+// testmempoolaccept command.
+type TestMempoolAcceptFees struct {
+	Base float64 `json:"base"`
+}
+
+// TestMempoolAcceptResult models the data returned from the testmempoolaccept
+// command for each of the checked transactions.
+type TestMempoolAcceptResult struct {
+	Txid         string                 `json:"txid"`
+	Wtxid        string                 `json:"wtxid"`
+	Allowed      bool                   `json:"allowed"`
+	Vsize        int64                  `json:"vsize,omitempty"`
+	Fees         *TestMempoolAcceptFees `json:"fees,omitempty"`
+	RejectReason string                 `json:"reject-reason,omitempty"`
+}
+
 // TxRawDecodeResult models the data from the decoderawtransaction command.
 type TxRawDecodeResult struct {
 	Txid     string `json:"txid"`
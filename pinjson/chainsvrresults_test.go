@@ -47,6 +47,28 @@ func TestChainSvrCustomResults(t *testing.T) {
 			},
 			expected: `{"txid":"123","vout":1,"scriptSig":{"asm":"0","hex":"00"},"sequence":4294967295}`,
 		},
+		{
+			name: "custom vin marshal with spent output",
+			result: &pinjson.Vin{
+				Txid: "123",
+				Vout: 1,
+				ScriptSig: &pinjson.ScriptSig{
+					Asm: "0",
+					Hex: "00",
+				},
+				PrevOut: &pinjson.SpentOutputResult{
+					Height: 100,
+					Value:  0.5,
+					ScriptPubKey: pinjson.ScriptPubKeyResult{
+						Asm:  "OP_TRUE",
+						Hex:  "51",
+						Type: "nonstandard",
+					},
+				},
+				Sequence: 4294967295,
+			},
+			expected: `{"txid":"123","vout":1,"scriptSig":{"asm":"0","hex":"00"},"prevout":{"generated":false,"height":100,"value":0.5,"scriptPubKey":{"asm":"OP_TRUE","hex":"51","type":"nonstandard"}},"sequence":4294967295}`,
+		},
 		{
 			name: "custom vinprevout marshal with coinbase",
 			result: &pinjson.VinPrevOut{
@@ -132,6 +154,39 @@ func TestGetTxOutSetInfoResult(t *testing.T) {
 						panic(err)
 					}
 
+					return a
+				}(),
+			},
+		},
+		{
+			name:   "GetTxOutSetInfoResult - muhash",
+			result: `{"height":123,"bestblock":"000000000000005f94116250e2407310463c0a7cf950f1af9ebe935b1c0687ab","txouts":1,"bogosize":51,"muhash":"10d312b100cbd32ada024a6646e40d3482fcff103668d2625f10002a607d5863","total_amount":0.2}`,
+			want: pinjson.GetTxOutSetInfoResult{
+				Height: 123,
+				BestBlock: func() chainhash.Hash {
+					h, err := chainhash.NewHashFromStr("000000000000005f94116250e2407310463c0a7cf950f1af9ebe935b1c0687ab")
+					if err != nil {
+						panic(err)
+					}
+
+					return *h
+				}(),
+				TxOuts:   1,
+				BogoSize: 51,
+				MuHash: func() chainhash.Hash {
+					h, err := chainhash.NewHashFromStr("10d312b100cbd32ada024a6646e40d3482fcff103668d2625f10002a607d5863")
+					if err != nil {
+						panic(err)
+					}
+
+					return *h
+				}(),
+				TotalAmount: func() pinutil.Amount {
+					a, err := pinutil.NewAmount(0.2)
+					if err != nil {
+						panic(err)
+					}
+
 					return a
 				}(),
 			},
@@ -154,6 +209,19 @@ func TestGetTxOutSetInfoResult(t *testing.T) {
 				spew.Sdump(test.want))
 			continue
 		}
+
+		// Marshalling the result must produce the original JSON.
+		marshalled, err := json.Marshal(&out)
+		if err != nil {
+			t.Errorf("Test #%d (%s) unexpected marshal error: %v", i,
+				test.name, err)
+			continue
+		}
+		if string(marshalled) != test.result {
+			t.Errorf("Test #%d (%s) unexpected marshalled data - "+
+				"got %s, want %s", i, test.name, marshalled,
+				test.result)
+		}
 	}
 }
 
@@ -22,6 +22,10 @@ const (
 	// Deprecated: Use FilteredBlockDisconnectedNtfnMethod instead.
 	BlockDisconnectedNtfnMethod = "blockdisconnected"
 
+	// ChainReorganizedNtfnMethod is the method used for notifications
+	// from the chain server that the main chain has been reorganized.
+	ChainReorganizedNtfnMethod = "chainreorganized"
+
 	// FilteredBlockConnectedNtfnMethod is the new method used for
 	// notifications from the chain server that a block has been connected.
 	FilteredBlockConnectedNtfnMethod = "filteredblockconnected"
@@ -31,6 +35,11 @@ const (
 	// disconnected.
 	FilteredBlockDisconnectedNtfnMethod = "filteredblockdisconnected"
 
+	// ReorgRejectedNtfnMethod is the method used for notifications from
+	// the chain server that a reorganization of the main chain was refused
+	// because it is deeper than the maximum reorganization depth.
+	ReorgRejectedNtfnMethod = "reorgrejected"
+
 	// RecvTxNtfnMethod is the legacy, deprecated method used for
 	// notifications from the chain server that a transaction which pays to
 	// a registered address has been processed.
@@ -71,6 +80,11 @@ const (
 	// more details in the notification.
 	TxAcceptedVerboseNtfnMethod = "txacceptedverbose"
 
+	// TxRemovedNtfnMethod is the method used for notifications from the
+	// chain server that a transaction has been removed from the mempool
+	// without being included in a block.
+	TxRemovedNtfnMethod = "txremoved"
+
 	// RelevantTxAcceptedNtfnMethod is the new method used for notifications
 	// from the chain server that inform a client that a transaction that
 	// matches the loaded filter was accepted by the mempool.
@@ -119,6 +133,25 @@ func NewBlockDisconnectedNtfn(hash string, height int32, time int64) *BlockDisco
 	}
 }
 
+// ChainReorganizedNtfn defines the chainreorganized JSON-RPC notification.
+type ChainReorganizedNtfn struct {
+	ForkHash   string
+	ForkHeight int32
+	Detached   []string
+	Attached   []string
+}
+
+// NewChainReorganizedNtfn returns a new instance which can be used to issue a
+// chainreorganized JSON-RPC notification.
+func NewChainReorganizedNtfn(forkHash string, forkHeight int32, detached, attached []string) *ChainReorganizedNtfn {
+	return &ChainReorganizedNtfn{
+		ForkHash:   forkHash,
+		ForkHeight: forkHeight,
+		Detached:   detached,
+		Attached:   attached,
+	}
+}
+
 // FilteredBlockConnectedNtfn defines the filteredblockconnected JSON-RPC
 // notification.
 type FilteredBlockConnectedNtfn struct {
@@ -161,6 +194,29 @@ type BlockDetails struct {
 	Time   int64  `json:"time"`
 }
 
+// ReorgRejectedNtfn defines the reorgrejected JSON-RPC notification.
+type ReorgRejectedNtfn struct {
+	ForkHash     string
+	ForkHeight   int32
+	OldTipHash   string
+	OldTipHeight int32
+	NewTipHash   string
+	NewTipHeight int32
+}
+
+// NewReorgRejectedNtfn returns a new instance which can be used to issue a
+// reorgrejected JSON-RPC notification.
+func NewReorgRejectedNtfn(forkHash string, forkHeight int32, oldTipHash string, oldTipHeight int32, newTipHash string, newTipHeight int32) *ReorgRejectedNtfn {
+	return &ReorgRejectedNtfn{
+		ForkHash:     forkHash,
+		ForkHeight:   forkHeight,
+		OldTipHash:   oldTipHash,
+		OldTipHeight: oldTipHeight,
+		NewTipHash:   newTipHash,
+		NewTipHeight: newTipHeight,
+	}
+}
+
 // RecvTxNtfn defines the recvtx JSON-RPC notification.
 //
 // Deprecated: Use RelevantTxAcceptedNtfn and FilteredBlockConnectedNtfn
@@ -273,6 +329,21 @@ func NewTxAcceptedVerboseNtfn(rawTx TxRawResult) *TxAcceptedVerboseNtfn {
 	}
 }
 
+// TxRemovedNtfn defines the txremoved JSON-RPC notification.
+type TxRemovedNtfn struct {
+	TxID   string
+	Reason string
+}
+
+// NewTxRemovedNtfn returns a new instance which can be used to issue a
+// txremoved JSON-RPC notification.
+func NewTxRemovedNtfn(txHash string, reason string) *TxRemovedNtfn {
+	return &TxRemovedNtfn{
+		TxID:   txHash,
+		Reason: reason,
+	}
+}
+
 // RelevantTxAcceptedNtfn defines the parameters to the relevanttxaccepted
 // JSON-RPC notification.
 type RelevantTxAcceptedNtfn struct {
@@ -292,13 +363,16 @@ func init() {
 
 	MustRegisterCmd(BlockConnectedNtfnMethod, (*BlockConnectedNtfn)(nil), flags)
 	MustRegisterCmd(BlockDisconnectedNtfnMethod, (*BlockDisconnectedNtfn)(nil), flags)
+	MustRegisterCmd(ChainReorganizedNtfnMethod, (*ChainReorganizedNtfn)(nil), flags)
 	MustRegisterCmd(FilteredBlockConnectedNtfnMethod, (*FilteredBlockConnectedNtfn)(nil), flags)
 	MustRegisterCmd(FilteredBlockDisconnectedNtfnMethod, (*FilteredBlockDisconnectedNtfn)(nil), flags)
+	MustRegisterCmd(ReorgRejectedNtfnMethod, (*ReorgRejectedNtfn)(nil), flags)
 	MustRegisterCmd(RecvTxNtfnMethod, (*RecvTxNtfn)(nil), flags)
 	MustRegisterCmd(RedeemingTxNtfnMethod, (*RedeemingTxNtfn)(nil), flags)
 	MustRegisterCmd(RescanFinishedNtfnMethod, (*RescanFinishedNtfn)(nil), flags)
 	MustRegisterCmd(RescanProgressNtfnMethod, (*RescanProgressNtfn)(nil), flags)
 	MustRegisterCmd(TxAcceptedNtfnMethod, (*TxAcceptedNtfn)(nil), flags)
 	MustRegisterCmd(TxAcceptedVerboseNtfnMethod, (*TxAcceptedVerboseNtfn)(nil), flags)
+	MustRegisterCmd(TxRemovedNtfnMethod, (*TxRemovedNtfn)(nil), flags)
 	MustRegisterCmd(RelevantTxAcceptedNtfnMethod, (*RelevantTxAcceptedNtfn)(nil), flags)
 }
@@ -59,6 +59,22 @@ func TestChainSvrWsNtfns(t *testing.T) {
 				Time:   123456789,
 			},
 		},
+		{
+			name: "chainreorganized",
+			newNtfn: func() (interface{}, error) {
+				return pinjson.NewCmd("chainreorganized", "123", 100000, []string{"456", "789"}, []string{"abc"})
+			},
+			staticNtfn: func() interface{} {
+				return pinjson.NewChainReorganizedNtfn("123", 100000, []string{"456", "789"}, []string{"abc"})
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"chainreorganized","params":["123",100000,["456","789"],["abc"]],"id":null}`,
+			unmarshalled: &pinjson.ChainReorganizedNtfn{
+				ForkHash:   "123",
+				ForkHeight: 100000,
+				Detached:   []string{"456", "789"},
+				Attached:   []string{"abc"},
+			},
+		},
 		{
 			name: "filteredblockconnected",
 			newNtfn: func() (interface{}, error) {
@@ -88,6 +104,24 @@ func TestChainSvrWsNtfns(t *testing.T) {
 				Header: "header",
 			},
 		},
+		{
+			name: "reorgrejected",
+			newNtfn: func() (interface{}, error) {
+				return pinjson.NewCmd("reorgrejected", "123", 100000, "456", 100010, "789", 100011)
+			},
+			staticNtfn: func() interface{} {
+				return pinjson.NewReorgRejectedNtfn("123", 100000, "456", 100010, "789", 100011)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"reorgrejected","params":["123",100000,"456",100010,"789",100011],"id":null}`,
+			unmarshalled: &pinjson.ReorgRejectedNtfn{
+				ForkHash:     "123",
+				ForkHeight:   100000,
+				OldTipHash:   "456",
+				OldTipHeight: 100010,
+				NewTipHash:   "789",
+				NewTipHeight: 100011,
+			},
+		},
 		{
 			name: "recvtx",
 			newNtfn: func() (interface{}, error) {
@@ -212,6 +246,20 @@ func TestChainSvrWsNtfns(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "txremoved",
+			newNtfn: func() (interface{}, error) {
+				return pinjson.NewCmd("txremoved", "123", "expiry")
+			},
+			staticNtfn: func() interface{} {
+				return pinjson.NewTxRemovedNtfn("123", "expiry")
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"txremoved","params":["123","expiry"],"id":null}`,
+			unmarshalled: &pinjson.TxRemovedNtfn{
+				TxID:   "123",
+				Reason: "expiry",
+			},
+		},
 		{
 			name: "relevanttxaccepted",
 			newNtfn: func() (interface{}, error) {
@@ -128,6 +128,19 @@ func NewGetHeadersCmd(blockLocators []string, hashStop string) *GetHeadersCmd {
 	}
 }
 
+// GetUtxoCacheInfoCmd defines the getutxocacheinfo JSON-RPC command.
+//
+// NOTE: This is a pind extension.
+type GetUtxoCacheInfoCmd struct{}
+
+// NewGetUtxoCacheInfoCmd returns a new instance which can be used to issue a
+// getutxocacheinfo JSON-RPC command.
+//
+// NOTE: This is a pind extension.
+func NewGetUtxoCacheInfoCmd() *GetUtxoCacheInfoCmd {
+	return &GetUtxoCacheInfoCmd{}
+}
+
 // VersionCmd defines the version JSON-RPC command.
 //
 // NOTE: This is a btcsuite extension ported from
@@ -152,5 +165,6 @@ func init() {
 	MustRegisterCmd("getbestblock", (*GetBestBlockCmd)(nil), flags)
 	MustRegisterCmd("getcurrentnet", (*GetCurrentNetCmd)(nil), flags)
 	MustRegisterCmd("getheaders", (*GetHeadersCmd)(nil), flags)
+	MustRegisterCmd("getutxocacheinfo", (*GetUtxoCacheInfoCmd)(nil), flags)
 	MustRegisterCmd("version", (*VersionCmd)(nil), flags)
 }
@@ -194,6 +194,17 @@ func TestPindExtCmds(t *testing.T) {
 				HashStop: "000000000000000000ba33b33e1fad70b69e234fc24414dd47113bff38f523f7",
 			},
 		},
+		{
+			name: "getutxocacheinfo",
+			newCmd: func() (interface{}, error) {
+				return pinjson.NewCmd("getutxocacheinfo")
+			},
+			staticCmd: func() interface{} {
+				return pinjson.NewGetUtxoCacheInfoCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getutxocacheinfo","params":[],"id":1}`,
+			unmarshalled: &pinjson.GetUtxoCacheInfoCmd{},
+		},
 		{
 			name: "version",
 			newCmd: func() (interface{}, error) {
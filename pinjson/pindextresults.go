@@ -18,3 +18,17 @@ type VersionResult struct {
 	Prerelease    string `json:"prerelease"`
 	BuildMetadata string `json:"buildmetadata"`
 }
+
+// GetUtxoCacheInfoResult models the data from the getutxocacheinfo command.
+//
+// NOTE: This is a pind extension.
+type GetUtxoCacheInfoResult struct {
+	Entries        int64   `json:"entries"`
+	Size           int64   `json:"size"`
+	MaxSize        int64   `json:"maxsize"`
+	Hits           int64   `json:"hits"`
+	Misses         int64   `json:"misses"`
+	HitRate        float64 `json:"hitrate"`
+	LastFlushBlock string  `json:"lastflushblock"`
+	LastFlushTime  int64   `json:"lastflushtime"`
+}
@@ -6,6 +6,7 @@ package main
 
 import (
 	"sync/atomic"
+	"time"
 
 	"github.com/nyodeco/pind/blockchain"
 	"github.com/nyodeco/pind/chaincfg/chainhash"
@@ -61,6 +62,19 @@ func (p *rpcPeer) FeeFilter() int64 {
 	return atomic.LoadInt64(&(*serverPeer)(p).feeFilter)
 }
 
+// LastBlockTime returns the last time the peer announced a new block which was
+// accepted, or the zero time if it has not done so.
+//
+// This function is safe for concurrent access and is part of the rpcserverPeer
+// interface implementation.
+func (p *rpcPeer) LastBlockTime() time.Time {
+	lastBlockTime := atomic.LoadInt64(&(*serverPeer)(p).lastBlockTime)
+	if lastBlockTime == 0 {
+		return time.Time{}
+	}
+	return time.Unix(lastBlockTime, 0)
+}
+
 // rpcConnManager provides a connection manager for use with the RPC server and
 // implements the rpcserverConnManager interface.
 type rpcConnManager struct {
@@ -232,6 +246,15 @@ func (cm *rpcConnManager) NodeAddresses() []*wire.NetAddress {
 	return cm.server.addrManager.AddressCache()
 }
 
+// StaleTipStatus returns whether or not the best chain tip is currently
+// considered stale along with the time it was last seen to advance.
+//
+// This function is safe for concurrent access and is part of the
+// rpcserverConnManager interface implementation.
+func (cm *rpcConnManager) StaleTipStatus() (bool, time.Time) {
+	return cm.server.StaleTipStatus()
+}
+
 // rpcSyncMgr provides a block manager for use with the RPC server and
 // implements the rpcserverSyncManager interface.
 type rpcSyncMgr struct {
@@ -307,6 +307,86 @@ func (c *Client) GetBlockCount() (int64, error) {
 	return c.GetBlockCountAsync().Receive()
 }
 
+// FutureGetChainTipsResult is a future promise to deliver the result of a
+// GetChainTipsAsync RPC invocation (or an applicable error).
+type FutureGetChainTipsResult chan *response
+
+// Receive waits for the response promised by the future and returns the tips
+// of all known branches of the block tree.
+func (r FutureGetChainTipsResult) Receive() ([]pinjson.GetChainTipsResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var chainTips []pinjson.GetChainTipsResult
+	err = json.Unmarshal(res, &chainTips)
+	if err != nil {
+		return nil, err
+	}
+
+	return chainTips, nil
+}
+
+// GetChainTipsAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on the
+// returned instance.
+//
+// See GetChainTips for the blocking version and more details.
+func (c *Client) GetChainTipsAsync() FutureGetChainTipsResult {
+	cmd := pinjson.NewGetChainTipsCmd()
+	return c.sendCmd(cmd)
+}
+
+// GetChainTips returns information about the tips of all known branches of the
+// block tree, including the best chain.
+func (c *Client) GetChainTips() ([]pinjson.GetChainTipsResult, error) {
+	return c.GetChainTipsAsync().Receive()
+}
+
+// FutureGetDeploymentInfoResult is a future promise to deliver the result of a
+// GetDeploymentInfoAsync RPC invocation (or an applicable error).
+type FutureGetDeploymentInfoResult chan *response
+
+// Receive waits for the response promised by the future and returns the state
+// of each defined deployment along with the signalling for it.
+func (r FutureGetDeploymentInfoResult) Receive() (*pinjson.GetDeploymentInfoResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var deploymentInfo pinjson.GetDeploymentInfoResult
+	err = json.Unmarshal(res, &deploymentInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	return &deploymentInfo, nil
+}
+
+// GetDeploymentInfoAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See GetDeploymentInfo for the blocking version and more details.
+func (c *Client) GetDeploymentInfoAsync(blockHash *chainhash.Hash) FutureGetDeploymentInfoResult {
+	var hash *string
+	if blockHash != nil {
+		hash = pinjson.String(blockHash.String())
+	}
+
+	cmd := pinjson.NewGetDeploymentInfoCmd(hash)
+	return c.sendCmd(cmd)
+}
+
+// GetDeploymentInfo returns the state of each defined deployment for the block
+// with the given hash along with the signalling for it.  The best block is used
+// when the hash is nil.
+func (c *Client) GetDeploymentInfo(blockHash *chainhash.Hash) (*pinjson.GetDeploymentInfoResult, error) {
+	return c.GetDeploymentInfoAsync(blockHash).Receive()
+}
+
 // FutureGetChainTxStatsResult is a future promise to deliver the result of a
 // GetChainTxStatsAsync RPC invocation (or an applicable error).
 type FutureGetChainTxStatsResult chan *response
@@ -724,6 +804,194 @@ func (c *Client) GetMempoolEntry(txHash string) (*pinjson.GetMempoolEntryResult,
 	return c.GetMempoolEntryAsync(txHash).Receive()
 }
 
+// FutureGetMempoolAncestorsResult is a future promise to deliver the result of
+// a GetMempoolAncestorsAsync RPC invocation (or an applicable error).
+type FutureGetMempoolAncestorsResult chan *response
+
+// Receive waits for the response promised by the future and returns the hashes
+// of all in-mempool ancestors of the transaction.
+func (r FutureGetMempoolAncestorsResult) Receive() ([]*chainhash.Hash, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal the result as an array of strings.
+	var txHashStrs []string
+	err = json.Unmarshal(res, &txHashStrs)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create a slice of hashes from the string slice.
+	txHashes := make([]*chainhash.Hash, 0, len(txHashStrs))
+	for _, hashStr := range txHashStrs {
+		txHash, err := chainhash.NewHashFromStr(hashStr)
+		if err != nil {
+			return nil, err
+		}
+		txHashes = append(txHashes, txHash)
+	}
+
+	return txHashes, nil
+}
+
+// GetMempoolAncestorsAsync returns an instance of a type that can be used to
+// get the result of the RPC at some future time by invoking the Receive
+// function on the returned instance.
+//
+// See GetMempoolAncestors for the blocking version and more details.
+func (c *Client) GetMempoolAncestorsAsync(txHash string) FutureGetMempoolAncestorsResult {
+	cmd := pinjson.NewGetMempoolAncestorsCmd(txHash, pinjson.Bool(false))
+	return c.sendCmd(cmd)
+}
+
+// GetMempoolAncestors returns the hashes of all in-mempool ancestors of the
+// transaction in the memory pool given its hash.
+//
+// See GetMempoolAncestorsVerbose to retrieve data structures with information
+// about the ancestors instead.
+func (c *Client) GetMempoolAncestors(txHash string) ([]*chainhash.Hash, error) {
+	return c.GetMempoolAncestorsAsync(txHash).Receive()
+}
+
+// FutureGetMempoolAncestorsVerboseResult is a future promise to deliver the
+// result of a GetMempoolAncestorsVerboseAsync RPC invocation (or an applicable
+// error).
+type FutureGetMempoolAncestorsVerboseResult chan *response
+
+// Receive waits for the response promised by the future and returns a map of
+// transaction hashes to an associated data structure with information about the
+// transaction for all in-mempool ancestors of the transaction.
+func (r FutureGetMempoolAncestorsVerboseResult) Receive() (map[string]pinjson.GetMempoolEntryResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal the result as a map of strings (tx shas) to their detailed
+	// results.
+	var mempoolItems map[string]pinjson.GetMempoolEntryResult
+	err = json.Unmarshal(res, &mempoolItems)
+	if err != nil {
+		return nil, err
+	}
+	return mempoolItems, nil
+}
+
+// GetMempoolAncestorsVerboseAsync returns an instance of a type that can be
+// used to get the result of the RPC at some future time by invoking the Receive
+// function on the returned instance.
+//
+// See GetMempoolAncestorsVerbose for the blocking version and more details.
+func (c *Client) GetMempoolAncestorsVerboseAsync(txHash string) FutureGetMempoolAncestorsVerboseResult {
+	cmd := pinjson.NewGetMempoolAncestorsCmd(txHash, pinjson.Bool(true))
+	return c.sendCmd(cmd)
+}
+
+// GetMempoolAncestorsVerbose returns a map of transaction hashes to an
+// associated data structure with information about the transaction for all
+// in-mempool ancestors of the transaction in the memory pool given its hash.
+//
+// See GetMempoolAncestors to retrieve only the transaction hashes instead.
+func (c *Client) GetMempoolAncestorsVerbose(txHash string) (map[string]pinjson.GetMempoolEntryResult, error) {
+	return c.GetMempoolAncestorsVerboseAsync(txHash).Receive()
+}
+
+// FutureGetMempoolDescendantsResult is a future promise to deliver the result of
+// a GetMempoolDescendantsAsync RPC invocation (or an applicable error).
+type FutureGetMempoolDescendantsResult chan *response
+
+// Receive waits for the response promised by the future and returns the hashes
+// of all in-mempool descendants of the transaction.
+func (r FutureGetMempoolDescendantsResult) Receive() ([]*chainhash.Hash, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal the result as an array of strings.
+	var txHashStrs []string
+	err = json.Unmarshal(res, &txHashStrs)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create a slice of hashes from the string slice.
+	txHashes := make([]*chainhash.Hash, 0, len(txHashStrs))
+	for _, hashStr := range txHashStrs {
+		txHash, err := chainhash.NewHashFromStr(hashStr)
+		if err != nil {
+			return nil, err
+		}
+		txHashes = append(txHashes, txHash)
+	}
+
+	return txHashes, nil
+}
+
+// GetMempoolDescendantsAsync returns an instance of a type that can be used to
+// get the result of the RPC at some future time by invoking the Receive
+// function on the returned instance.
+//
+// See GetMempoolDescendants for the blocking version and more details.
+func (c *Client) GetMempoolDescendantsAsync(txHash string) FutureGetMempoolDescendantsResult {
+	cmd := pinjson.NewGetMempoolDescendantsCmd(txHash, pinjson.Bool(false))
+	return c.sendCmd(cmd)
+}
+
+// GetMempoolDescendants returns the hashes of all in-mempool descendants of the
+// transaction in the memory pool given its hash.
+//
+// See GetMempoolDescendantsVerbose to retrieve data structures with information
+// about the descendants instead.
+func (c *Client) GetMempoolDescendants(txHash string) ([]*chainhash.Hash, error) {
+	return c.GetMempoolDescendantsAsync(txHash).Receive()
+}
+
+// FutureGetMempoolDescendantsVerboseResult is a future promise to deliver the
+// result of a GetMempoolDescendantsVerboseAsync RPC invocation (or an applicable
+// error).
+type FutureGetMempoolDescendantsVerboseResult chan *response
+
+// Receive waits for the response promised by the future and returns a map of
+// transaction hashes to an associated data structure with information about the
+// transaction for all in-mempool descendants of the transaction.
+func (r FutureGetMempoolDescendantsVerboseResult) Receive() (map[string]pinjson.GetMempoolEntryResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal the result as a map of strings (tx shas) to their detailed
+	// results.
+	var mempoolItems map[string]pinjson.GetMempoolEntryResult
+	err = json.Unmarshal(res, &mempoolItems)
+	if err != nil {
+		return nil, err
+	}
+	return mempoolItems, nil
+}
+
+// GetMempoolDescendantsVerboseAsync returns an instance of a type that can be
+// used to get the result of the RPC at some future time by invoking the Receive
+// function on the returned instance.
+//
+// See GetMempoolDescendantsVerbose for the blocking version and more details.
+func (c *Client) GetMempoolDescendantsVerboseAsync(txHash string) FutureGetMempoolDescendantsVerboseResult {
+	cmd := pinjson.NewGetMempoolDescendantsCmd(txHash, pinjson.Bool(true))
+	return c.sendCmd(cmd)
+}
+
+// GetMempoolDescendantsVerbose returns a map of transaction hashes to an
+// associated data structure with information about the transaction for all
+// in-mempool descendants of the transaction in the memory pool given its hash.
+//
+// See GetMempoolDescendants to retrieve only the transaction hashes instead.
+func (c *Client) GetMempoolDescendantsVerbose(txHash string) (map[string]pinjson.GetMempoolEntryResult, error) {
+	return c.GetMempoolDescendantsVerboseAsync(txHash).Receive()
+}
+
 // FutureGetRawMempoolResult is a future promise to deliver the result of a
 // GetRawMempoolAsync RPC invocation (or an applicable error).
 type FutureGetRawMempoolResult chan *response
@@ -1151,6 +1419,224 @@ func (c *Client) InvalidateBlock(blockHash *chainhash.Hash) error {
 	return c.InvalidateBlockAsync(blockHash).Receive()
 }
 
+// FutureReconsiderBlockResult is a future promise to deliver the result of a
+// ReconsiderBlockAsync RPC invocation (or an applicable error).
+type FutureReconsiderBlockResult chan *response
+
+// Receive waits for the response promised by the future and returns an error
+// if the block could not be reconsidered.
+func (r FutureReconsiderBlockResult) Receive() error {
+	_, err := receiveFuture(r)
+
+	return err
+}
+
+// ReconsiderBlockAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on the
+// returned instance.
+//
+// See ReconsiderBlock for the blocking version and more details.
+func (c *Client) ReconsiderBlockAsync(blockHash *chainhash.Hash) FutureReconsiderBlockResult {
+	hash := ""
+	if blockHash != nil {
+		hash = blockHash.String()
+	}
+
+	cmd := pinjson.NewReconsiderBlockCmd(hash)
+	return c.sendCmd(cmd)
+}
+
+// ReconsiderBlock removes the invalidity status of a specific block along with
+// its ancestors and descendants, undoing the effects of InvalidateBlock.
+func (c *Client) ReconsiderBlock(blockHash *chainhash.Hash) error {
+	return c.ReconsiderBlockAsync(blockHash).Receive()
+}
+
+// FuturePreciousBlockResult is a future promise to deliver the result of a
+// PreciousBlockAsync RPC invocation (or an applicable error).
+type FuturePreciousBlockResult chan *response
+
+// Receive waits for the response promised by the future and returns an error
+// if the block could not be marked as precious.
+func (r FuturePreciousBlockResult) Receive() error {
+	_, err := receiveFuture(r)
+
+	return err
+}
+
+// PreciousBlockAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on the
+// returned instance.
+//
+// See PreciousBlock for the blocking version and more details.
+func (c *Client) PreciousBlockAsync(blockHash *chainhash.Hash) FuturePreciousBlockResult {
+	hash := ""
+	if blockHash != nil {
+		hash = blockHash.String()
+	}
+
+	cmd := pinjson.NewPreciousBlockCmd(hash)
+	return c.sendCmd(cmd)
+}
+
+// PreciousBlock treats a specific block as if it were received before any
+// competing blocks with the same amount of work.
+func (c *Client) PreciousBlock(blockHash *chainhash.Hash) error {
+	return c.PreciousBlockAsync(blockHash).Receive()
+}
+
+// FuturePruneBlockchainResult is a future promise to deliver the result of a
+// PruneBlockchainAsync RPC invocation (or an applicable error).
+type FuturePruneBlockchainResult chan *response
+
+// Receive waits for the response promised by the future and returns the height
+// of the last block for which the data has been pruned.
+func (r FuturePruneBlockchainResult) Receive() (int64, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return 0, err
+	}
+
+	// Unmarshal the result as an int64.
+	var height int64
+	err = json.Unmarshal(res, &height)
+	if err != nil {
+		return 0, err
+	}
+	return height, nil
+}
+
+// PruneBlockchainAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See PruneBlockchain for the blocking version and more details.
+func (c *Client) PruneBlockchainAsync(height int64) FuturePruneBlockchainResult {
+	cmd := pinjson.NewPruneBlockchainCmd(height)
+	return c.sendCmd(cmd)
+}
+
+// PruneBlockchain deletes the block data up to and including the provided
+// height and returns the height of the last block for which the data has been
+// pruned.  The server must be running in prune mode.
+func (c *Client) PruneBlockchain(height int64) (int64, error) {
+	return c.PruneBlockchainAsync(height).Receive()
+}
+
+// FutureSaveMempoolResult is a future promise to deliver the result of a
+// SaveMempoolAsync RPC invocation (or an applicable error).
+type FutureSaveMempoolResult chan *response
+
+// Receive waits for the response promised by the future and returns the
+// results of SaveMempoolAsync RPC invocation.
+func (r FutureSaveMempoolResult) Receive() (*pinjson.SaveMempoolResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal result as a savemempool result object.
+	var saveResult pinjson.SaveMempoolResult
+	err = json.Unmarshal(res, &saveResult)
+	if err != nil {
+		return nil, err
+	}
+	return &saveResult, nil
+}
+
+// SaveMempoolAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on the
+// returned instance.
+//
+// See SaveMempool for the blocking version and more details.
+func (c *Client) SaveMempoolAsync() FutureSaveMempoolResult {
+	cmd := pinjson.NewSaveMempoolCmd()
+	return c.sendCmd(cmd)
+}
+
+// SaveMempool writes the transactions in the memory pool of the server to the
+// mempool.dat file in its data directory.
+func (c *Client) SaveMempool() (*pinjson.SaveMempoolResult, error) {
+	return c.SaveMempoolAsync().Receive()
+}
+
+// FutureDumpTxOutSetResult is a future promise to deliver the result of a
+// DumpTxOutSetAsync RPC invocation (or an applicable error).
+type FutureDumpTxOutSetResult chan *response
+
+// Receive waits for the response promised by the future and returns the
+// results of DumpTxOutSetAsync RPC invocation.
+func (r FutureDumpTxOutSetResult) Receive() (*pinjson.DumpTxOutSetResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal result as a dumptxoutset result object.
+	var dumpResult pinjson.DumpTxOutSetResult
+	err = json.Unmarshal(res, &dumpResult)
+	if err != nil {
+		return nil, err
+	}
+	return &dumpResult, nil
+}
+
+// DumpTxOutSetAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on the
+// returned instance.
+//
+// See DumpTxOutSet for the blocking version and more details.
+func (c *Client) DumpTxOutSetAsync(path string) FutureDumpTxOutSetResult {
+	cmd := pinjson.NewDumpTxOutSetCmd(path)
+	return c.sendCmd(cmd)
+}
+
+// DumpTxOutSet writes a snapshot of the unspent transaction output set at the
+// best block of the server to the provided path.  Relative paths are
+// interpreted relative to the data directory of the server.
+func (c *Client) DumpTxOutSet(path string) (*pinjson.DumpTxOutSetResult, error) {
+	return c.DumpTxOutSetAsync(path).Receive()
+}
+
+// FutureLoadTxOutSetResult is a future promise to deliver the result of a
+// LoadTxOutSetAsync RPC invocation (or an applicable error).
+type FutureLoadTxOutSetResult chan *response
+
+// Receive waits for the response promised by the future and returns the
+// results of LoadTxOutSetAsync RPC invocation.
+func (r FutureLoadTxOutSetResult) Receive() (*pinjson.LoadTxOutSetResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal result as a loadtxoutset result object.
+	var loadResult pinjson.LoadTxOutSetResult
+	err = json.Unmarshal(res, &loadResult)
+	if err != nil {
+		return nil, err
+	}
+	return &loadResult, nil
+}
+
+// LoadTxOutSetAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on the
+// returned instance.
+//
+// See LoadTxOutSet for the blocking version and more details.
+func (c *Client) LoadTxOutSetAsync(path string) FutureLoadTxOutSetResult {
+	cmd := pinjson.NewLoadTxOutSetCmd(path)
+	return c.sendCmd(cmd)
+}
+
+// LoadTxOutSet loads the unspent transaction output set snapshot at the
+// provided path, which must have been written by DumpTxOutSet, and makes the
+// block it was taken at the chain tip of the server.  The blocks before the
+// snapshot are validated in the background afterwards.
+func (c *Client) LoadTxOutSet(path string) (*pinjson.LoadTxOutSetResult, error) {
+	return c.LoadTxOutSetAsync(path).Receive()
+}
+
 // FutureGetCFilterResult is a future promise to deliver the result of a
 // GetCFilterAsync RPC invocation (or an applicable error).
 type FutureGetCFilterResult chan *response
@@ -471,3 +471,45 @@ func (c *Client) VersionAsync() FutureVersionResult {
 func (c *Client) Version() (map[string]pinjson.VersionResult, error) {
 	return c.VersionAsync().Receive()
 }
+
+// FutureGetUtxoCacheInfoResult is a future promise to deliver the result of a
+// GetUtxoCacheInfoAsync RPC invocation (or an applicable error).
+type FutureGetUtxoCacheInfoResult chan *response
+
+// Receive waits for the response promised by the future and returns the
+// results of GetUtxoCacheInfoAsync RPC invocation.
+func (r FutureGetUtxoCacheInfoResult) Receive() (*pinjson.GetUtxoCacheInfoResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal result as an getutxocacheinfo result object.
+	var cacheInfo *pinjson.GetUtxoCacheInfoResult
+	err = json.Unmarshal(res, &cacheInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	return cacheInfo, nil
+}
+
+// GetUtxoCacheInfoAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See GetUtxoCacheInfo for the blocking version and more details.
+//
+// NOTE: This is a pind extension.
+func (c *Client) GetUtxoCacheInfoAsync() FutureGetUtxoCacheInfoResult {
+	cmd := pinjson.NewGetUtxoCacheInfoCmd()
+	return c.sendCmd(cmd)
+}
+
+// GetUtxoCacheInfo returns statistics about the in-memory cache of unspent
+// transaction outputs such as its size and hit rate.
+//
+// NOTE: This is a pind extension.
+func (c *Client) GetUtxoCacheInfo() (*pinjson.GetUtxoCacheInfoResult, error) {
+	return c.GetUtxoCacheInfoAsync().Receive()
+}
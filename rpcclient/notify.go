@@ -121,6 +121,27 @@ type NotificationHandlers struct {
 	// OnBlockDisconnected: it receives the block's height and header.
 	OnFilteredBlockDisconnected func(height int32, header *wire.BlockHeader)
 
+	// OnChainReorganized is invoked when the main chain was reorganized.
+	// It receives the hash and height of the last common block and the
+	// hashes of the blocks which were disconnected, starting with the old
+	// tip, and connected, ending with the new tip.  It is invoked after
+	// the notifications of the individual blocks.  It will only be invoked
+	// if a preceding call to NotifyBlocks has been made to register for the
+	// notification and the function is non-nil.
+	OnChainReorganized func(forkHash *chainhash.Hash, forkHeight int32,
+		detached, attached []*chainhash.Hash)
+
+	// OnReorgRejected is invoked when a reorganization of the main chain
+	// was refused by the server because more blocks than its maximum
+	// reorganization depth would have been disconnected.  It receives the
+	// hashes and heights of the last common block, the main chain tip and
+	// the tip of the rejected chain.  It will only be invoked if a
+	// preceding call to NotifyBlocks has been made to register for the
+	// notification and the function is non-nil.
+	OnReorgRejected func(forkHash *chainhash.Hash, forkHeight int32,
+		oldTipHash *chainhash.Hash, oldTipHeight int32,
+		newTipHash *chainhash.Hash, newTipHeight int32)
+
 	// OnRecvTx is invoked when a transaction that receives funds to a
 	// registered address is received into the memory pool and also
 	// connected to the longest (best) chain.  It will only be invoked if a
@@ -179,6 +200,14 @@ type NotificationHandlers struct {
 	// made to register for the notification and the function is non-nil.
 	OnTxAcceptedVerbose func(txDetails *pinjson.TxRawResult)
 
+	// OnTxRemoved is invoked when a transaction is removed from the memory
+	// pool without being included in a block.  It receives the reason the
+	// transaction was removed, such as "expiry", "sizelimit" or "replaced".
+	// It will only be invoked if a preceding call to NotifyNewTransactions
+	// has been made to register for the notification and the function is
+	// non-nil.
+	OnTxRemoved func(hash *chainhash.Hash, reason string)
+
 	// OnPindConnected is invoked when a wallet connects or disconnects from
 	// pind.
 	//
@@ -290,6 +319,43 @@ func (c *Client) handleNotification(ntfn *rawNotification) {
 		c.ntfnHandlers.OnFilteredBlockDisconnected(blockHeight,
 			blockHeader)
 
+	// OnChainReorganized
+	case pinjson.ChainReorganizedNtfnMethod:
+		// Ignore the notification if the client is not interested in
+		// it.
+		if c.ntfnHandlers.OnChainReorganized == nil {
+			return
+		}
+
+		forkHash, forkHeight, detached, attached, err :=
+			parseChainReorganizedNtfnParams(ntfn.Params)
+		if err != nil {
+			log.Warnf("Received invalid chain reorganized "+
+				"notification: %v", err)
+			return
+		}
+
+		c.ntfnHandlers.OnChainReorganized(forkHash, forkHeight,
+			detached, attached)
+
+	// OnReorgRejected
+	case pinjson.ReorgRejectedNtfnMethod:
+		// Ignore the notification if the client is not interested in
+		// it.
+		if c.ntfnHandlers.OnReorgRejected == nil {
+			return
+		}
+
+		hashes, heights, err := parseReorgNtfnParams(ntfn.Params)
+		if err != nil {
+			log.Warnf("Received invalid reorg rejected "+
+				"notification: %v", err)
+			return
+		}
+
+		c.ntfnHandlers.OnReorgRejected(hashes[0], heights[0], hashes[1],
+			heights[1], hashes[2], heights[2])
+
 	// OnRecvTx
 	case pinjson.RecvTxNtfnMethod:
 		// Ignore the notification if the client is not interested in
@@ -409,6 +475,23 @@ func (c *Client) handleNotification(ntfn *rawNotification) {
 
 		c.ntfnHandlers.OnTxAcceptedVerbose(rawTx)
 
+	// OnTxRemoved
+	case pinjson.TxRemovedNtfnMethod:
+		// Ignore the notification if the client is not interested in
+		// it.
+		if c.ntfnHandlers.OnTxRemoved == nil {
+			return
+		}
+
+		hash, reason, err := parseTxRemovedNtfnParams(ntfn.Params)
+		if err != nil {
+			log.Warnf("Received invalid tx removed notification: %v",
+				err)
+			return
+		}
+
+		c.ntfnHandlers.OnTxRemoved(hash, reason)
+
 	// OnPindConnected
 	case pinjson.PindConnectedNtfnMethod:
 		// Ignore the notification if the client is not interested in
@@ -615,6 +698,87 @@ func parseFilteredBlockDisconnectedParams(params []json.RawMessage) (int32,
 	return blockHeight, &blockHeader, nil
 }
 
+// parseChainReorganizedNtfnParams parses out the hash and height of the last
+// common block and the hashes of the detached and attached blocks included in
+// a chainreorganized notification.
+func parseChainReorganizedNtfnParams(params []json.RawMessage) (*chainhash.Hash,
+	int32, []*chainhash.Hash, []*chainhash.Hash, error) {
+
+	if len(params) != 4 {
+		return nil, 0, nil, nil, wrongNumParams(len(params))
+	}
+
+	// Unmarshal first parameter as a string.
+	var forkHashStr string
+	err := json.Unmarshal(params[0], &forkHashStr)
+	if err != nil {
+		return nil, 0, nil, nil, err
+	}
+	forkHash, err := chainhash.NewHashFromStr(forkHashStr)
+	if err != nil {
+		return nil, 0, nil, nil, err
+	}
+
+	// Unmarshal second parameter as an integer.
+	var forkHeight int32
+	err = json.Unmarshal(params[1], &forkHeight)
+	if err != nil {
+		return nil, 0, nil, nil, err
+	}
+
+	// Unmarshal third and fourth parameters as slices of hash strings.
+	var hashes [2][]*chainhash.Hash
+	for i := range hashes {
+		var hashStrs []string
+		err = json.Unmarshal(params[i+2], &hashStrs)
+		if err != nil {
+			return nil, 0, nil, nil, err
+		}
+		hashes[i] = make([]*chainhash.Hash, 0, len(hashStrs))
+		for _, hashStr := range hashStrs {
+			hash, err := chainhash.NewHashFromStr(hashStr)
+			if err != nil {
+				return nil, 0, nil, nil, err
+			}
+			hashes[i] = append(hashes[i], hash)
+		}
+	}
+
+	return forkHash, forkHeight, hashes[0], hashes[1], nil
+}
+
+// parseReorgNtfnParams parses out the hashes and heights of the last common
+// block, the old chain tip and the new chain tip included in a notification
+// about a reorganization.
+func parseReorgNtfnParams(params []json.RawMessage) ([3]*chainhash.Hash,
+	[3]int32, error) {
+
+	var hashes [3]*chainhash.Hash
+	var heights [3]int32
+	if len(params) != 6 {
+		return hashes, heights, wrongNumParams(len(params))
+	}
+
+	// Unmarshal the parameters as pairs of a hash string and an integer.
+	for i := range hashes {
+		var hashStr string
+		err := json.Unmarshal(params[i*2], &hashStr)
+		if err != nil {
+			return hashes, heights, err
+		}
+		hashes[i], err = chainhash.NewHashFromStr(hashStr)
+		if err != nil {
+			return hashes, heights, err
+		}
+		err = json.Unmarshal(params[i*2+1], &heights[i])
+		if err != nil {
+			return hashes, heights, err
+		}
+	}
+
+	return hashes, heights, nil
+}
+
 func parseHexParam(param json.RawMessage) ([]byte, error) {
 	var s string
 	err := json.Unmarshal(param, &s)
@@ -753,6 +917,38 @@ func parseTxAcceptedNtfnParams(params []json.RawMessage) (*chainhash.Hash,
 	return txHash, amt, nil
 }
 
+// parseTxRemovedNtfnParams parses out the transaction hash and the removal
+// reason from the parameters of a txremoved notification.
+func parseTxRemovedNtfnParams(params []json.RawMessage) (*chainhash.Hash,
+	string, error) {
+
+	if len(params) != 2 {
+		return nil, "", wrongNumParams(len(params))
+	}
+
+	// Unmarshal first parameter as a string.
+	var txHashStr string
+	err := json.Unmarshal(params[0], &txHashStr)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Unmarshal second parameter as a string.
+	var reason string
+	err = json.Unmarshal(params[1], &reason)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Decode string encoding of transaction sha.
+	txHash, err := chainhash.NewHashFromStr(txHashStr)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return txHash, reason, nil
+}
+
 // parseTxAcceptedVerboseNtfnParams parses out details about a raw transaction
 // from the parameters of a txacceptedverbose notification.
 func parseTxAcceptedVerboseNtfnParams(params []json.RawMessage) (*pinjson.TxRawResult,
@@ -16,11 +16,14 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
 	"math/big"
 	"math/rand"
 	"net"
 	"net/http"
 	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -75,6 +78,10 @@ const (
 
 	// maxProtocolVersion is the max protocol version the server supports.
 	maxProtocolVersion = 70002
+
+	// maxTestMempoolAcceptTxns is the maximum number of transactions which
+	// may be checked by a single testmempoolaccept request.
+	maxTestMempoolAcceptTxns = 25
 )
 
 var (
@@ -135,6 +142,7 @@ var rpcHandlersBeforeInit = map[string]commandHandler{
 	"debuglevel":             handleDebugLevel,
 	"decoderawtransaction":   handleDecodeRawTransaction,
 	"decodescript":           handleDecodeScript,
+	"dumptxoutset":           handleDumpTxOutSet,
 	"estimatefee":            handleEstimateFee,
 	"generate":               handleGenerate,
 	"getaddednodeinfo":       handleGetAddedNodeInfo,
@@ -148,13 +156,18 @@ var rpcHandlersBeforeInit = map[string]commandHandler{
 	"getblocktemplate":       handleGetBlockTemplate,
 	"getcfilter":             handleGetCFilter,
 	"getcfilterheader":       handleGetCFilterHeader,
+	"getchaintips":           handleGetChainTips,
 	"getconnectioncount":     handleGetConnectionCount,
 	"getcurrentnet":          handleGetCurrentNet,
+	"getdeploymentinfo":      handleGetDeploymentInfo,
 	"getdifficulty":          handleGetDifficulty,
 	"getgenerate":            handleGetGenerate,
 	"gethashespersec":        handleGetHashesPerSec,
 	"getheaders":             handleGetHeaders,
 	"getinfo":                handleGetInfo,
+	"getmempoolancestors":    handleGetMempoolAncestors,
+	"getmempooldescendants":  handleGetMempoolDescendants,
+	"getmempoolentry":        handleGetMempoolEntry,
 	"getmempoolinfo":         handleGetMempoolInfo,
 	"getmininginfo":          handleGetMiningInfo,
 	"getnettotals":           handleGetNetTotals,
@@ -164,15 +177,24 @@ var rpcHandlersBeforeInit = map[string]commandHandler{
 	"getrawmempool":          handleGetRawMempool,
 	"getrawtransaction":      handleGetRawTransaction,
 	"gettxout":               handleGetTxOut,
+	"gettxoutsetinfo":        handleGetTxOutSetInfo,
+	"getutxocacheinfo":       handleGetUtxoCacheInfo,
 	"help":                   handleHelp,
+	"invalidateblock":        handleInvalidateBlock,
 	"node":                   handleNode,
 	"ping":                   handlePing,
+	"preciousblock":          handlePreciousBlock,
+	"pruneblockchain":        handlePruneBlockchain,
+	"reconsiderblock":        handleReconsiderBlock,
+	"savemempool":            handleSaveMempool,
 	"searchrawtransactions":  handleSearchRawTransactions,
 	"sendrawtransaction":     handleSendRawTransaction,
 	"setgenerate":            handleSetGenerate,
 	"signmessagewithprivkey": handleSignMessageWithPrivKey,
 	"stop":                   handleStop,
 	"submitblock":            handleSubmitBlock,
+	"submitpackage":          handleSubmitPackage,
+	"testmempoolaccept":      handleTestMempoolAccept,
 	"uptime":                 handleUptime,
 	"validateaddress":        handleValidateAddress,
 	"verifychain":            handleVerifyChain,
@@ -200,7 +222,6 @@ var rpcAskWallet = map[string]struct{}{
 	"getreceivedbyaccount":   {},
 	"getreceivedbyaddress":   {},
 	"gettransaction":         {},
-	"gettxoutsetinfo":        {},
 	"getunconfirmedbalance":  {},
 	"getwalletinfo":          {},
 	"importprivkey":          {},
@@ -231,13 +252,12 @@ var rpcAskWallet = map[string]struct{}{
 // Commands that are currently unimplemented, but should ultimately be.
 var rpcUnimplemented = map[string]struct{}{
 	"estimatepriority": {},
-	"getchaintips":     {},
-	"getmempoolentry":  {},
 	"getnetworkinfo":   {},
 	"getwork":          {},
-	"invalidateblock":  {},
-	"preciousblock":    {},
-	"reconsiderblock":  {},
+
+	// Loading utxo set snapshots is only useful once a snapshot of the
+	// main network is known to the chain parameters.
+	"loadtxoutset": {},
 }
 
 // Commands that are available to a limited user
@@ -268,18 +288,26 @@ var rpcLimited = map[string]struct{}{
 	"getblockheader":        {},
 	"getcfilter":            {},
 	"getcfilterheader":      {},
+	"getchaintips":          {},
 	"getcurrentnet":         {},
+	"getdeploymentinfo":     {},
 	"getdifficulty":         {},
 	"getheaders":            {},
 	"getinfo":               {},
+	"getmempoolancestors":   {},
+	"getmempooldescendants": {},
+	"getmempoolentry":       {},
 	"getnettotals":          {},
 	"getnetworkhashps":      {},
 	"getrawmempool":         {},
 	"getrawtransaction":     {},
 	"gettxout":              {},
+	"gettxoutsetinfo":       {},
 	"searchrawtransactions": {},
 	"sendrawtransaction":    {},
 	"submitblock":           {},
+	"submitpackage":         {},
+	"testmempoolaccept":     {},
 	"uptime":                {},
 	"validateaddress":       {},
 	"verifymessage":         {},
@@ -862,6 +890,65 @@ func handleDecodeScript(s *rpcServer, cmd interface{}, closeChan <-chan struct{}
 	return reply, nil
 }
 
+// txOutSetPath returns the path of a utxo set snapshot file.  Relative paths
+// are interpreted relative to the data directory.
+func txOutSetPath(path string) string {
+	path = cleanAndExpandPath(path)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(cfg.DataDir, path)
+	}
+	return path
+}
+
+// handleDumpTxOutSet implements the dumptxoutset command.
+func handleDumpTxOutSet(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*pinjson.DumpTxOutSetCmd)
+
+	path := txOutSetPath(c.Path)
+	if _, err := os.Stat(path); err == nil {
+		return nil, &pinjson.RPCError{
+			Code: pinjson.ErrRPCInvalidParameter,
+			Message: fmt.Sprintf("%s already exists.  If you are sure "+
+				"this is what you want, move it out of the way first",
+				path),
+		}
+	}
+
+	// Write the snapshot to a temporary file first so an interrupted dump
+	// is never mistaken for a complete one.
+	tmpPath := path + ".incomplete"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return nil, &pinjson.RPCError{
+			Code:    pinjson.ErrRPCMisc,
+			Message: err.Error(),
+		}
+	}
+	info, err := s.cfg.Chain.DumpUtxoSnapshot(f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return nil, &pinjson.RPCError{
+			Code:    pinjson.ErrRPCMisc,
+			Message: err.Error(),
+		}
+	}
+
+	return &pinjson.DumpTxOutSetResult{
+		CoinsWritten: info.NumUtxos,
+		BaseHash:     info.BlockHash.String(),
+		BaseHeight:   info.Height,
+		Path:         path,
+		TxOutSetHash: info.TxOutSetHash.String(),
+		TotalTxns:    info.TotalTxns,
+	}, nil
+}
+
 // handleEstimateFee handles estimatefee commands.
 func handleEstimateFee(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*pinjson.EstimateFeeCmd)
@@ -1151,8 +1238,23 @@ func handleGetBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (i
 
 		blockReply.Tx = txNames
 	} else {
+		// The outputs spent by the transactions are loaded from the
+		// spend journal when requested, which is only available for
+		// blocks in the main chain.
+		var stxos []blockchain.SpentTxOut
+		withPrevOuts := *c.Verbosity >= 3 &&
+			s.cfg.Chain.MainChainHasBlock(hash)
+		if withPrevOuts {
+			stxos, err = s.cfg.Chain.FetchSpendJournal(blk)
+			if err != nil {
+				context := "Failed to load spent outputs"
+				return nil, internalRPCError(err.Error(), context)
+			}
+		}
+
 		txns := blk.Transactions()
 		rawTxns := make([]pinjson.TxRawResult, len(txns))
+		var stxoIdx int
 		for i, tx := range txns {
 			rawTxn, err := createTxRawResult(params, tx.MsgTx(),
 				tx.Hash().String(), blockHeader, hash.String(),
@@ -1160,6 +1262,17 @@ func handleGetBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (i
 			if err != nil {
 				return nil, err
 			}
+			if withPrevOuts && i > 0 {
+				numInputs := len(tx.MsgTx().TxIn)
+				if stxoIdx+numInputs > len(stxos) {
+					context := "Failed to load spent outputs"
+					return nil, internalRPCError("spend journal "+
+						"is missing entries", context)
+				}
+				addSpentOutputs(rawTxn, tx.MsgTx(),
+					stxos[stxoIdx:stxoIdx+numInputs], params)
+				stxoIdx += numInputs
+			}
 			rawTxns[i] = *rawTxn
 		}
 		blockReply.RawTx = rawTxns
@@ -1168,6 +1281,47 @@ func handleGetBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (i
 	return blockReply, nil
 }
 
+// addSpentOutputs adds the passed outputs spent by the inputs of the provided
+// transaction, in the same order, along with the fee paid by the transaction to
+// its raw transaction result.
+func addSpentOutputs(txReply *pinjson.TxRawResult, mtx *wire.MsgTx, stxos []blockchain.SpentTxOut, chainParams *chaincfg.Params) {
+	var totalIn int64
+	for i := range txReply.Vin {
+		stxo := &stxos[i]
+		totalIn += stxo.Amount
+
+		// The disassembled string will contain [error] inline if the
+		// script doesn't fully parse, so ignore the error here.  The
+		// same applies to the extracted addresses.
+		disbuf, _ := txscript.DisasmString(stxo.PkScript)
+		scriptClass, addrs, reqSigs, _ := txscript.ExtractPkScriptAddrs(
+			stxo.PkScript, chainParams)
+		encodedAddrs := make([]string, len(addrs))
+		for j, addr := range addrs {
+			encodedAddrs[j] = addr.EncodeAddress()
+		}
+
+		txReply.Vin[i].PrevOut = &pinjson.SpentOutputResult{
+			Generated: stxo.IsCoinBase,
+			Height:    stxo.Height,
+			Value:     pinutil.Amount(stxo.Amount).ToBTC(),
+			ScriptPubKey: pinjson.ScriptPubKeyResult{
+				Asm:       disbuf,
+				Hex:       hex.EncodeToString(stxo.PkScript),
+				ReqSigs:   int32(reqSigs),
+				Type:      scriptClass.String(),
+				Addresses: encodedAddrs,
+			},
+		}
+	}
+
+	var totalOut int64
+	for _, txOut := range mtx.TxOut {
+		totalOut += txOut.Value
+	}
+	txReply.Fee = pinutil.Amount(totalIn - totalOut).ToBTC()
+}
+
 // softForkStatus converts a ThresholdState state into a human readable string
 // corresponding to the particular state.
 func softForkStatus(state blockchain.ThresholdState) (string, error) {
@@ -1182,11 +1336,35 @@ func softForkStatus(state blockchain.ThresholdState) (string, error) {
 		return "active", nil
 	case blockchain.ThresholdFailed:
 		return "failed", nil
+	case blockchain.ThresholdMustSignal:
+		return "must_signal", nil
 	default:
 		return "", fmt.Errorf("unknown deployment state: %v", state)
 	}
 }
 
+// deploymentName maps the integer deployment ID into a human readable
+// fork-name.
+func deploymentName(deployment int) (string, error) {
+	switch deployment {
+	case chaincfg.DeploymentTestDummy:
+		return "dummy", nil
+
+	case chaincfg.DeploymentCSV:
+		return "csv", nil
+
+	case chaincfg.DeploymentSegwit:
+		return "segwit", nil
+
+	default:
+		return "", &pinjson.RPCError{
+			Code: pinjson.ErrRPCInternal.Code,
+			Message: fmt.Sprintf("Unknown deployment %v detected",
+				deployment),
+		}
+	}
+}
+
 // handleGetBlockChainInfo implements the getblockchaininfo command.
 func handleGetBlockChainInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	// Obtain a snapshot of the current best known blockchain state. We'll
@@ -1194,20 +1372,41 @@ func handleGetBlockChainInfo(s *rpcServer, cmd interface{}, closeChan <-chan str
 	params := s.cfg.ChainParams
 	chain := s.cfg.Chain
 	chainSnapshot := chain.BestSnapshot()
+	_, bestHeaderHeight := chain.BestHeader()
 
 	chainInfo := &pinjson.GetBlockChainInfoResult{
 		Chain:         params.Name,
 		Blocks:        chainSnapshot.Height,
-		Headers:       chainSnapshot.Height,
+		Headers:       bestHeaderHeight,
 		BestBlockHash: chainSnapshot.Hash.String(),
 		Difficulty:    getDifficultyRatio(chainSnapshot.Bits, params),
 		MedianTime:    chainSnapshot.MedianTime.Unix(),
-		Pruned:        false,
+		Pruned:        chain.IsPruned(),
+		ChainWork:     fmt.Sprintf("%064x", chainSnapshot.ChainWork),
 		SoftForks: &pinjson.SoftForks{
 			Bip9SoftForks: make(map[string]*pinjson.Bip9SoftForkDescription),
 		},
 	}
 
+	// Warn about a reorganization which was refused for exceeding the
+	// maximum reorganization depth since the chain might not be the one
+	// with the most work.
+	if rejected := chain.LastRejectedReorg(); rejected != nil {
+		chainInfo.Warnings = fmt.Sprintf("Refused to reorganize %d "+
+			"blocks to block %v at height %d which exceeds the "+
+			"maximum reorganization depth", rejected.Depth(),
+			rejected.NewTipHash, rejected.NewTipHeight)
+	}
+
+	if chainInfo.Pruned {
+		pruneHeight, err := chain.PruneHeight()
+		if err != nil {
+			context := "Failed to obtain prune height"
+			return nil, internalRPCError(err.Error(), context)
+		}
+		chainInfo.PruneHeight = pruneHeight
+	}
+
 	// Next, populate the response with information describing the current
 	// status of soft-forks deployed via the super-majority block
 	// signalling mechanism.
@@ -1247,23 +1446,9 @@ func handleGetBlockChainInfo(s *rpcServer, cmd interface{}, closeChan <-chan str
 	for deployment, deploymentDetails := range params.Deployments {
 		// Map the integer deployment ID into a human readable
 		// fork-name.
-		var forkName string
-		switch deployment {
-		case chaincfg.DeploymentTestDummy:
-			forkName = "dummy"
-
-		case chaincfg.DeploymentCSV:
-			forkName = "csv"
-
-		case chaincfg.DeploymentSegwit:
-			forkName = "segwit"
-
-		default:
-			return nil, &pinjson.RPCError{
-				Code: pinjson.ErrRPCInternal.Code,
-				Message: fmt.Sprintf("Unknown deployment %v "+
-					"detected", deployment),
-			}
+		forkName, err := deploymentName(deployment)
+		if err != nil {
+			return nil, err
 		}
 
 		// Query the chain for the current status of the deployment as
@@ -1289,10 +1474,14 @@ func handleGetBlockChainInfo(s *rpcServer, cmd interface{}, closeChan <-chan str
 		// Finally, populate the soft-fork description with all the
 		// information gathered above.
 		chainInfo.SoftForks.Bip9SoftForks[forkName] = &pinjson.Bip9SoftForkDescription{
-			Status:     strings.ToLower(statusString),
-			Bit:        deploymentDetails.BitNumber,
-			StartTime2: int64(deploymentDetails.StartTime),
-			Timeout:    int64(deploymentDetails.ExpireTime),
+			Status:              strings.ToLower(statusString),
+			Bit:                 deploymentDetails.BitNumber,
+			StartTime2:          int64(deploymentDetails.StartTime),
+			Timeout:             int64(deploymentDetails.ExpireTime),
+			StartHeight:         int32(deploymentDetails.StartHeight),
+			TimeoutHeight:       int32(deploymentDetails.TimeoutHeight),
+			LockInOnTimeout:     deploymentDetails.LockInOnTimeout,
+			MinActivationHeight: int32(deploymentDetails.MinActivationHeight),
 		}
 	}
 
@@ -2240,6 +2429,21 @@ func handleGetCFilterHeader(s *rpcServer, cmd interface{}, closeChan <-chan stru
 	return hash.String(), nil
 }
 
+// handleGetChainTips implements the getchaintips command.
+func handleGetChainTips(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	chainTips := s.cfg.Chain.ChainTips()
+	result := make([]pinjson.GetChainTipsResult, 0, len(chainTips))
+	for _, chainTip := range chainTips {
+		result = append(result, pinjson.GetChainTipsResult{
+			Height:    chainTip.Height,
+			Hash:      chainTip.Hash.String(),
+			BranchLen: chainTip.BranchLen,
+			Status:    chainTip.Status.String(),
+		})
+	}
+	return result, nil
+}
+
 // handleGetConnectionCount implements the getconnectioncount command.
 func handleGetConnectionCount(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	return s.cfg.ConnMgr.ConnectedCount(), nil
@@ -2250,6 +2454,85 @@ func handleGetCurrentNet(s *rpcServer, cmd interface{}, closeChan <-chan struct{
 	return s.cfg.ChainParams.Net, nil
 }
 
+// handleGetDeploymentInfo implements the getdeploymentinfo command.
+func handleGetDeploymentInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*pinjson.GetDeploymentInfoCmd)
+
+	// Default to the block at the end of the current best chain.
+	hash := &s.cfg.Chain.BestSnapshot().Hash
+	if c.BlockHash != nil {
+		var err error
+		hash, err = chainhash.NewHashFromStr(*c.BlockHash)
+		if err != nil {
+			return nil, rpcDecodeHexError(*c.BlockHash)
+		}
+	}
+
+	// The deployment state is available for side chain blocks as well.
+	height, err := s.cfg.Chain.HeightByHash(hash)
+	if err != nil {
+		return nil, &pinjson.RPCError{
+			Code:    pinjson.ErrRPCBlockNotFound,
+			Message: "Block not found",
+		}
+	}
+
+	result := &pinjson.GetDeploymentInfoResult{
+		Hash:        hash.String(),
+		Height:      height,
+		Deployments: make(map[string]*pinjson.DeploymentInfo),
+	}
+	for deployment, deploymentDetails := range s.cfg.ChainParams.Deployments {
+		forkName, err := deploymentName(deployment)
+		if err != nil {
+			return nil, err
+		}
+
+		stats, err := s.cfg.Chain.DeploymentStats(hash,
+			uint32(deployment))
+		if err != nil {
+			context := "Failed to obtain deployment status"
+			return nil, internalRPCError(err.Error(), context)
+		}
+		statusString, err := softForkStatus(stats.State)
+		if err != nil {
+			return nil, &pinjson.RPCError{
+				Code: pinjson.ErrRPCInternal.Code,
+				Message: fmt.Sprintf("unknown deployment status: %v",
+					stats.State),
+			}
+		}
+
+		info := &pinjson.DeploymentInfo{
+			Bit:                 deploymentDetails.BitNumber,
+			StartTime:           int64(deploymentDetails.StartTime),
+			Timeout:             int64(deploymentDetails.ExpireTime),
+			StartHeight:         int32(deploymentDetails.StartHeight),
+			TimeoutHeight:       int32(deploymentDetails.TimeoutHeight),
+			LockInOnTimeout:     deploymentDetails.LockInOnTimeout,
+			MinActivationHeight: int32(deploymentDetails.MinActivationHeight),
+			Status:              statusString,
+		}
+
+		// The signalling statistics are only meaningful while the
+		// deployment is being voted on.
+		switch stats.State {
+		case blockchain.ThresholdStarted, blockchain.ThresholdMustSignal:
+			info.Statistics = &pinjson.DeploymentStatistics{
+				Period:      stats.Period,
+				Threshold:   stats.Threshold,
+				PeriodStart: stats.PeriodStart,
+				Elapsed:     stats.Elapsed,
+				Count:       stats.Count,
+				Possible:    stats.Possible,
+			}
+		}
+		result.Deployments[forkName] = info
+	}
+
+	return result, nil
+}
+
 // handleGetDifficulty implements the getdifficulty command.
 func handleGetDifficulty(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	best := s.cfg.Chain.BestSnapshot()
@@ -2323,9 +2606,99 @@ func handleGetInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (in
 		RelayFee:        cfg.minRelayTxFee.ToBTC(),
 	}
 
+	// Warn about a best chain tip which has not advanced in a long time
+	// since the server might be partitioned from the network.
+	if stale, lastUpdate := s.cfg.ConnMgr.StaleTipStatus(); stale {
+		ret.Errors = fmt.Sprintf("Warning: the best chain tip has not "+
+			"advanced since %v, the node might be partitioned from "+
+			"the network", lastUpdate.UTC())
+	}
+
 	return ret, nil
 }
 
+// rpcNotInMempoolError is a convenience function for returning a nicely
+// formatted RPC error which indicates the provided transaction is not in the
+// memory pool.
+func rpcNotInMempoolError() *pinjson.RPCError {
+	return pinjson.NewRPCError(pinjson.ErrRPCInvalidAddressOrKey,
+		"Transaction not in mempool")
+}
+
+// mempoolEntryHashes returns the hashes of the passed mempool entries sorted
+// so the response does not depend on map iteration order.
+func mempoolEntryHashes(entries map[string]*pinjson.GetMempoolEntryResult) []string {
+	hashStrings := make([]string, 0, len(entries))
+	for hash := range entries {
+		hashStrings = append(hashStrings, hash)
+	}
+	sort.Strings(hashStrings)
+	return hashStrings
+}
+
+// handleGetMempoolAncestors implements the getmempoolancestors command.
+func handleGetMempoolAncestors(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*pinjson.GetMempoolAncestorsCmd)
+
+	txHash, err := chainhash.NewHashFromStr(c.TxID)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.TxID)
+	}
+
+	ancestors, err := s.cfg.TxMemPool.MempoolAncestors(txHash)
+	if err != nil {
+		return nil, rpcNotInMempoolError()
+	}
+
+	if c.Verbose != nil && *c.Verbose {
+		return ancestors, nil
+	}
+
+	// The response is simply an array of the transaction hashes if the
+	// verbose flag is not set.
+	return mempoolEntryHashes(ancestors), nil
+}
+
+// handleGetMempoolDescendants implements the getmempooldescendants command.
+func handleGetMempoolDescendants(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*pinjson.GetMempoolDescendantsCmd)
+
+	txHash, err := chainhash.NewHashFromStr(c.TxID)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.TxID)
+	}
+
+	descendants, err := s.cfg.TxMemPool.MempoolDescendants(txHash)
+	if err != nil {
+		return nil, rpcNotInMempoolError()
+	}
+
+	if c.Verbose != nil && *c.Verbose {
+		return descendants, nil
+	}
+
+	// The response is simply an array of the transaction hashes if the
+	// verbose flag is not set.
+	return mempoolEntryHashes(descendants), nil
+}
+
+// handleGetMempoolEntry implements the getmempoolentry command.
+func handleGetMempoolEntry(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*pinjson.GetMempoolEntryCmd)
+
+	txHash, err := chainhash.NewHashFromStr(c.TxID)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.TxID)
+	}
+
+	entry, err := s.cfg.TxMemPool.MempoolEntry(txHash)
+	if err != nil {
+		return nil, rpcNotInMempoolError()
+	}
+
+	return entry, nil
+}
+
 // handleGetMempoolInfo implements the getmempoolinfo command.
 func handleGetMempoolInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	mempoolTxns := s.cfg.TxMemPool.TxDescs()
@@ -2336,8 +2709,12 @@ func handleGetMempoolInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct
 	}
 
 	ret := &pinjson.GetMempoolInfoResult{
-		Size:  int64(len(mempoolTxns)),
-		Bytes: numBytes,
+		Size:          int64(len(mempoolTxns)),
+		Bytes:         numBytes,
+		Usage:         s.cfg.TxMemPool.Usage(),
+		MaxMempool:    int64(cfg.MaxMempoolSizeMiB) * 1024 * 1024,
+		MempoolMinFee: s.cfg.TxMemPool.MinFeeRate().ToBTC(),
+		MinRelayTxFee: cfg.minRelayTxFee.ToBTC(),
 	}
 
 	return ret, nil
@@ -2547,6 +2924,9 @@ func handleGetPeerInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 			FeeFilter:      p.FeeFilter(),
 			SyncNode:       statsSnap.ID == syncPeerID,
 		}
+		if lastBlockTime := p.LastBlockTime(); !lastBlockTime.IsZero() {
+			info.LastBlock = lastBlockTime.Unix()
+		}
 		if p.ToPeer().LastPingNonce() != 0 {
 			wait := float64(time.Since(statsSnap.LastPingTime).Nanoseconds())
 			// We actually want microseconds.
@@ -2802,6 +3182,41 @@ func handleGetTxOut(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (i
 	return txOutReply, nil
 }
 
+// handleGetTxOutSetInfo handles gettxoutsetinfo commands.
+func handleGetTxOutSetInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	stats := s.cfg.Chain.UtxoSetStats()
+	return &pinjson.GetTxOutSetInfoResult{
+		Height:       int64(stats.Height),
+		BestBlock:    stats.BestBlock,
+		Transactions: int64(stats.NumTxns),
+		TxOuts:       int64(stats.NumUtxos),
+		BogoSize:     int64(stats.BogoSize),
+		MuHash:       stats.MuHash,
+		TotalAmount:  pinutil.Amount(stats.TotalAmount),
+	}, nil
+}
+
+// handleGetUtxoCacheInfo implements the getutxocacheinfo command.
+func handleGetUtxoCacheInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	stats := s.cfg.Chain.UtxoCacheStats()
+
+	var hitRate float64
+	if lookups := stats.Hits + stats.Misses; lookups > 0 {
+		hitRate = float64(stats.Hits) / float64(lookups)
+	}
+
+	return &pinjson.GetUtxoCacheInfoResult{
+		Entries:        int64(stats.Entries),
+		Size:           int64(stats.Size),
+		MaxSize:        int64(stats.MaxSize),
+		Hits:           int64(stats.Hits),
+		Misses:         int64(stats.Misses),
+		HitRate:        hitRate,
+		LastFlushBlock: stats.LastFlushHash.String(),
+		LastFlushTime:  stats.LastFlushTime.Unix(),
+	}, nil
+}
+
 // handleHelp implements the help command.
 func handleHelp(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*pinjson.HelpCmd)
@@ -2841,6 +3256,43 @@ func handleHelp(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (inter
 	return help, nil
 }
 
+// blockStatusRPCError converts an error returned while changing the validity of
+// a block to an RPC error.  Requests refused by the rules for doing so are
+// reported as invalid parameters and all other errors as database failures.
+func blockStatusRPCError(err error) *pinjson.RPCError {
+	if _, ok := err.(blockchain.RuleError); ok {
+		return &pinjson.RPCError{
+			Code:    pinjson.ErrRPCInvalidParameter,
+			Message: err.Error(),
+		}
+	}
+	return &pinjson.RPCError{
+		Code:    pinjson.ErrRPCDatabase,
+		Message: err.Error(),
+	}
+}
+
+// handleInvalidateBlock implements the invalidateblock command.
+func handleInvalidateBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*pinjson.InvalidateBlockCmd)
+
+	hash, err := chainhash.NewHashFromStr(c.BlockHash)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.BlockHash)
+	}
+	if _, err := s.cfg.Chain.HeaderByHash(hash); err != nil {
+		return nil, &pinjson.RPCError{
+			Code:    pinjson.ErrRPCBlockNotFound,
+			Message: "Block not found",
+		}
+	}
+
+	if err := s.cfg.Chain.InvalidateBlock(hash); err != nil {
+		return nil, blockStatusRPCError(err)
+	}
+	return nil, nil
+}
+
 // handlePing implements the ping command.
 func handlePing(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	// Ask server to ping \o_
@@ -2854,6 +3306,88 @@ func handlePing(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (inter
 	return nil, nil
 }
 
+// handlePreciousBlock implements the preciousblock command.
+func handlePreciousBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*pinjson.PreciousBlockCmd)
+
+	hash, err := chainhash.NewHashFromStr(c.BlockHash)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.BlockHash)
+	}
+	if _, err := s.cfg.Chain.HeaderByHash(hash); err != nil {
+		return nil, &pinjson.RPCError{
+			Code:    pinjson.ErrRPCBlockNotFound,
+			Message: "Block not found",
+		}
+	}
+
+	if err := s.cfg.Chain.PreciousBlock(hash); err != nil {
+		return nil, blockStatusRPCError(err)
+	}
+	return nil, nil
+}
+
+// handlePruneBlockchain implements the pruneblockchain command.
+func handlePruneBlockchain(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*pinjson.PruneBlockchainCmd)
+
+	if !s.cfg.Chain.IsPruned() {
+		return nil, &pinjson.RPCError{
+			Code:    pinjson.ErrRPCMisc,
+			Message: "Cannot prune blocks because node is not in prune mode",
+		}
+	}
+	if c.Height < 0 || c.Height > math.MaxInt32 {
+		return nil, &pinjson.RPCError{
+			Code:    pinjson.ErrRPCInvalidParameter,
+			Message: "Negative or out of range block height",
+		}
+	}
+
+	lastPruned, err := s.cfg.Chain.PruneBlocks(int32(c.Height))
+	if err != nil {
+		return nil, &pinjson.RPCError{
+			Code:    pinjson.ErrRPCMisc,
+			Message: err.Error(),
+		}
+	}
+	return int64(lastPruned), nil
+}
+
+// handleReconsiderBlock implements the reconsiderblock command.
+func handleReconsiderBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*pinjson.ReconsiderBlockCmd)
+
+	hash, err := chainhash.NewHashFromStr(c.BlockHash)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.BlockHash)
+	}
+	if _, err := s.cfg.Chain.HeaderByHash(hash); err != nil {
+		return nil, &pinjson.RPCError{
+			Code:    pinjson.ErrRPCBlockNotFound,
+			Message: "Block not found",
+		}
+	}
+
+	if err := s.cfg.Chain.ReconsiderBlock(hash); err != nil {
+		return nil, blockStatusRPCError(err)
+	}
+	return nil, nil
+}
+
+// handleSaveMempool implements the savemempool command.
+func handleSaveMempool(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	path, err := s.cfg.SaveMempool()
+	if err != nil {
+		return nil, &pinjson.RPCError{
+			Code:    pinjson.ErrRPCMisc,
+			Message: err.Error(),
+		}
+	}
+
+	return &pinjson.SaveMempoolResult{Filename: path}, nil
+}
+
 // retrievedTx represents a transaction that was either loaded from the
 // transaction memory pool or from the database.  When a transaction is loaded
 // from the database, it is loaded with the raw serialized bytes while the
@@ -3565,6 +4099,162 @@ func handleSubmitBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 	return nil, nil
 }
 
+// decodeRawTxns deserializes the passed hex-encoded raw transactions, returning
+// an RPC error for the first one that fails to decode.
+func decodeRawTxns(rawTxns []string) ([]*pinutil.Tx, error) {
+	txns := make([]*pinutil.Tx, 0, len(rawTxns))
+	for _, hexStr := range rawTxns {
+		if len(hexStr)%2 != 0 {
+			hexStr = "0" + hexStr
+		}
+		serializedTx, err := hex.DecodeString(hexStr)
+		if err != nil {
+			return nil, rpcDecodeHexError(hexStr)
+		}
+		var msgTx wire.MsgTx
+		err = msgTx.Deserialize(bytes.NewReader(serializedTx))
+		if err != nil {
+			return nil, &pinjson.RPCError{
+				Code:    pinjson.ErrRPCDeserialization,
+				Message: "TX decode failed: " + err.Error(),
+			}
+		}
+		txns = append(txns, pinutil.NewTx(&msgTx))
+	}
+	return txns, nil
+}
+
+// handleSubmitPackage implements the submitpackage command.
+func handleSubmitPackage(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*pinjson.SubmitPackageCmd)
+	if len(c.RawTxns) == 0 || len(c.RawTxns) > mempool.MaxPackageCount {
+		return nil, &pinjson.RPCError{
+			Code: pinjson.ErrRPCInvalidParameter,
+			Message: fmt.Sprintf("Between 1 and %d transactions must "+
+				"be provided", mempool.MaxPackageCount),
+		}
+	}
+
+	// Deserialize all of the transactions before processing any of them.
+	txns, err := decodeRawTxns(c.RawTxns)
+	if err != nil {
+		return nil, err
+	}
+
+	// Transactions accepted on their own are kept in the memory pool even
+	// when the package is rejected, so relay them either way.
+	acceptedTxs, err := s.cfg.TxMemPool.ProcessPackage(txns, false)
+	if err != nil {
+		if _, ok := err.(mempool.RuleError); !ok {
+			rpcsLog.Errorf("Failed to process package: %v", err)
+			return nil, internalRPCError(err.Error(),
+				"Failed to process package")
+		}
+		rpcsLog.Debugf("Rejected package: %v", err)
+	}
+	if len(acceptedTxs) > 0 {
+		// Generate and relay inventory vectors for all newly accepted
+		// transactions and notify both websocket and getblocktemplate
+		// long poll clients of them.
+		s.cfg.ConnMgr.RelayTransactions(acceptedTxs)
+		s.NotifyNewTransactions(acceptedTxs)
+	}
+
+	accepted := make(map[chainhash.Hash]*mempool.TxDesc, len(acceptedTxs))
+	for _, txD := range acceptedTxs {
+		accepted[*txD.Tx.Hash()] = txD
+	}
+	reply := pinjson.SubmitPackageResult{
+		PackageMsg: "success",
+		TxResults:  make([]pinjson.SubmitPackageTxResult, 0, len(txns)),
+	}
+	if err != nil {
+		reply.PackageMsg = err.Error()
+	}
+	for _, tx := range txns {
+		txResult := pinjson.SubmitPackageTxResult{
+			Txid:  tx.Hash().String(),
+			Wtxid: tx.MsgTx().WitnessHash().String(),
+		}
+		txD, ok := accepted[*tx.Hash()]
+		switch {
+		case ok:
+			txResult.Vsize = mempool.GetTxVirtualSize(tx)
+			txResult.Fees = &pinjson.SubmitPackageFees{
+				Base: pinutil.Amount(txD.Fee).ToBTC(),
+			}
+
+			// Keep track of the accepted package transactions so
+			// that they can be rebroadcast if they don't make
+			// their way into a block.
+			iv := wire.NewInvVect(wire.InvTypeTx, tx.Hash())
+			s.cfg.ConnMgr.AddRebroadcastInventory(iv, txD)
+
+		case s.cfg.TxMemPool.IsTransactionInPool(tx.Hash()):
+			txResult.Vsize = mempool.GetTxVirtualSize(tx)
+
+		default:
+			txResult.Error = "package-not-validated"
+		}
+		reply.TxResults = append(reply.TxResults, txResult)
+	}
+
+	return reply, nil
+}
+
+// handleTestMempoolAccept implements the testmempoolaccept command.
+func handleTestMempoolAccept(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*pinjson.TestMempoolAcceptCmd)
+	if len(c.RawTxns) == 0 || len(c.RawTxns) > maxTestMempoolAcceptTxns {
+		return nil, &pinjson.RPCError{
+			Code: pinjson.ErrRPCInvalidParameter,
+			Message: fmt.Sprintf("Between 1 and %d transactions must "+
+				"be provided", maxTestMempoolAcceptTxns),
+		}
+	}
+
+	// Deserialize all of the transactions before checking any of them.
+	txns, err := decodeRawTxns(c.RawTxns)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := s.cfg.TxMemPool.TestMempoolAccept(txns)
+	if err != nil {
+		return nil, internalRPCError(err.Error(),
+			"Failed to check transactions")
+	}
+
+	reply := make([]pinjson.TestMempoolAcceptResult, 0, len(results))
+	for _, result := range results {
+		msgTx := result.Tx.MsgTx()
+		txResult := pinjson.TestMempoolAcceptResult{
+			Txid:    result.Tx.Hash().String(),
+			Wtxid:   msgTx.WitnessHash().String(),
+			Allowed: result.Allowed,
+		}
+		switch {
+		case result.Allowed:
+			txResult.Vsize = result.VSize
+			txResult.Fees = &pinjson.TestMempoolAcceptFees{
+				Base: pinutil.Amount(result.Fee).ToBTC(),
+			}
+
+		case len(result.MissingParents) > 0:
+			txResult.RejectReason = fmt.Sprintf("missing-inputs: "+
+				"transaction %v references outputs of unknown "+
+				"or fully-spent transaction %v", result.Tx.Hash(),
+				result.MissingParents[0])
+
+		default:
+			txResult.RejectReason = result.RejectErr.Error()
+		}
+		reply = append(reply, txResult)
+	}
+
+	return reply, nil
+}
+
 // handleUptime implements the uptime command.
 func handleUptime(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	return time.Now().Unix() - s.cfg.StartupTime, nil
@@ -3863,6 +4553,14 @@ func (s *rpcServer) NotifyNewTransactions(txns []*mempool.TxDesc) {
 	}
 }
 
+// NotifyTransactionRemoved notifies websocket clients that the passed
+// transaction was removed from the memory pool without being included in a
+// block.  This function should be called whenever the mempool removes a
+// transaction for one of the reasons defined by mempool.RemovalReason.
+func (s *rpcServer) NotifyTransactionRemoved(tx *pinutil.Tx, reason mempool.RemovalReason) {
+	s.ntfnMgr.NotifyMempoolTxRemoved(tx, reason)
+}
+
 // limitConnections responds with a 503 service unavailable and returns true if
 // adding another client would exceed the maximum allow RPC clients.
 //
@@ -4451,6 +5149,10 @@ type rpcserverPeer interface {
 	// FeeFilter returns the requested current minimum fee rate for which
 	// transactions should be announced.
 	FeeFilter() int64
+
+	// LastBlockTime returns the last time the peer announced a new block
+	// which was accepted, or the zero time if it has not done so.
+	LastBlockTime() time.Time
 }
 
 // rpcserverConnManager represents a connection manager for use with the RPC
@@ -4516,6 +5218,11 @@ type rpcserverConnManager interface {
 	// NodeAddresses returns an array consisting node addresses which can
 	// potentially be used to find new nodes in the network.
 	NodeAddresses() []*wire.NetAddress
+
+	// StaleTipStatus returns whether or not the best chain tip is
+	// currently considered stale along with the time it was last seen to
+	// advance.
+	StaleTipStatus() (bool, time.Time)
 }
 
 // rpcserverSyncManager represents a sync manager for use with the RPC server.
@@ -4576,6 +5283,10 @@ type rpcserverConfig struct {
 	// TxMemPool defines the transaction memory pool to interact with.
 	TxMemPool *mempool.TxPool
 
+	// SaveMempool writes the transactions in the memory pool to the file
+	// they are reloaded from on startup and returns its path.
+	SaveMempool func() (string, error)
+
 	// These fields allow the RPC server to interface with mining.
 	//
 	// Generator produces block templates and the CPUMiner solves them using
@@ -4656,6 +5367,29 @@ func (s *rpcServer) handleBlockchainNotification(notification *blockchain.Notifi
 
 		// Notify registered websocket clients.
 		s.ntfnMgr.NotifyBlockDisconnected(block)
+
+	case blockchain.NTReorgRejected:
+		rejected, ok := notification.Data.(*blockchain.ReorgRejected)
+		if !ok {
+			rpcsLog.Warnf("Chain reorg rejected notification is not " +
+				"a rejected reorg.")
+			break
+		}
+
+		// Notify registered websocket clients so they can react to the
+		// rejected reorganization.
+		s.ntfnMgr.NotifyReorgRejected(rejected)
+
+	case blockchain.NTChainReorganized:
+		reorg, ok := notification.Data.(*blockchain.ChainReorganized)
+		if !ok {
+			rpcsLog.Warnf("Chain reorganized notification is not a " +
+				"reorganization.")
+			break
+		}
+
+		// Notify registered websocket clients.
+		s.ntfnMgr.NotifyChainReorganized(reorg)
 	}
 }
 
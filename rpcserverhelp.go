@@ -80,6 +80,13 @@ var helpDescsEnUS = map[string]string{
 	"vin-scriptSig":   "The signature script used to redeem the origin transaction as a JSON object (non-coinbase txns only)",
 	"vin-txinwitness": "The witness used to redeem the input encoded as a string array of its items",
 	"vin-sequence":    "The script sequence number",
+	"vin-prevout":     "The output spent by the input (only for getblock when verbosity=3)",
+
+	// SpentOutputResult help.
+	"spentoutputresult-generated":    "Whether the spent output was created by a coinbase transaction",
+	"spentoutputresult-height":       "The height of the block containing the spent output",
+	"spentoutputresult-value":        "The amount of the spent output in BTC",
+	"spentoutputresult-scriptPubKey": "The public key script of the spent output as a JSON object",
 
 	// ScriptPubKeyResult help.
 	"scriptpubkeyresult-asm":       "Disassembly of the script",
@@ -115,6 +122,18 @@ var helpDescsEnUS = map[string]string{
 	"decodescript--synopsis": "Returns a JSON object with information about the provided hex-encoded script.",
 	"decodescript-hexscript": "Hex-encoded script",
 
+	// DumpTxOutSetCmd help.
+	"dumptxoutset--synopsis": "Writes a snapshot of the unspent transaction output set at the current best block to a file.",
+	"dumptxoutset-path":      "The path of the file to write, relative to the data directory unless absolute",
+
+	// DumpTxOutSetResult help.
+	"dumptxoutsetresult-coins_written": "The number of unspent transaction outputs written",
+	"dumptxoutsetresult-base_hash":     "The hash of the block the snapshot was taken at",
+	"dumptxoutsetresult-base_height":   "The height of the block the snapshot was taken at",
+	"dumptxoutsetresult-path":          "The absolute path of the written file",
+	"dumptxoutsetresult-txoutset_hash": "The hash of the serialized unspent transaction outputs",
+	"dumptxoutsetresult-nchaintx":      "The total number of transactions in the chain up to and including the block the snapshot was taken at",
+
 	// EstimateFeeCmd help.
 	"estimatefee--synopsis": "Estimate the fee per kilobyte in satoshis " +
 		"required for a transaction to be mined before a certain number of " +
@@ -162,7 +181,7 @@ var helpDescsEnUS = map[string]string{
 	// GetBlockCmd help.
 	"getblock--synopsis":   "Returns information about a block given its hash.",
 	"getblock-hash":        "The hash of the block",
-	"getblock-verbosity":   "Specifies whether the block data should be returned as a hex-encoded string (0), as parsed data with a slice of TXIDs (1), or as parsed data with parsed transaction data (2) ",
+	"getblock-verbosity":   "Specifies whether the block data should be returned as a hex-encoded string (0), as parsed data with a slice of TXIDs (1), as parsed data with parsed transaction data (2), or as parsed data with parsed transaction data including the outputs spent by the inputs and the fees (3)",
 	"getblock--condition0": "verbosity=0",
 	"getblock--condition1": "verbosity=1",
 	"getblock--result0":    "Hex-encoded bytes of the serialized block",
@@ -185,6 +204,7 @@ var helpDescsEnUS = map[string]string{
 	"getblockchaininforesult-initialblockdownload": "Estimate of whether this node is in Initial Block Download mode",
 	"getblockchaininforesult-softforks":            "The status of the super-majority soft-forks",
 	"getblockchaininforesult-unifiedsoftforks":     "The status of the super-majority soft-forks used by bitcoind on or after v0.19.0",
+	"getblockchaininforesult-warnings":             "Warnings about the state of the chain, such as a reorganization refused for exceeding the maximum reorganization depth",
 
 	// SoftForkDescription help.
 	"softforkdescription-reject":  "The current activation status of the softfork",
@@ -220,6 +240,7 @@ var helpDescsEnUS = map[string]string{
 	"txrawresult-vsize":         "The virtual size of the transaction in bytes",
 	"txrawresult-weight":        "The transaction's weight (between vsize*4-3 and vsize*4)",
 	"txrawresult-hash":          "The wtxid of the transaction",
+	"txrawresult-fee":           "The fee paid by the transaction in BTC (only for getblock when verbosity=3)",
 
 	// SearchRawTransactionsResult help.
 	"searchrawtransactionsresult-hex":           "Hex-encoded transaction",
@@ -246,7 +267,7 @@ var helpDescsEnUS = map[string]string{
 	"getblockverboseresult-versionHex":        "The block version in hexadecimal",
 	"getblockverboseresult-merkleroot":        "Root hash of the merkle tree",
 	"getblockverboseresult-tx":                "The transaction hashes (only when verbosity=1)",
-	"getblockverboseresult-rawtx":             "The transactions as JSON objects (only when verbosity=2)",
+	"getblockverboseresult-rawtx":             "The transactions as JSON objects (only when verbosity=2 or verbosity=3)",
 	"getblockverboseresult-time":              "The block time in seconds since 1 Jan 1970 GMT",
 	"getblockverboseresult-nonce":             "The block nonce",
 	"getblockverboseresult-bits":              "The bits which represent the block difficulty",
@@ -359,6 +380,15 @@ var helpDescsEnUS = map[string]string{
 	"getcfilterheader-hash":       "The hash of the block",
 	"getcfilterheader--result0":   "The block's gcs filter header",
 
+	// GetChainTipsCmd help.
+	"getchaintips--synopsis": "Returns information about the tips of all known branches of the block tree, including the best chain.",
+
+	// GetChainTipsResult help.
+	"getchaintipsresult-height":    "The height of the tip",
+	"getchaintipsresult-hash":      "The hash of the tip",
+	"getchaintipsresult-branchlen": "The number of blocks of the branch after the fork with the best chain (0 for the best chain)",
+	"getchaintipsresult-status":    "The status of the branch (active, valid-fork, valid-headers, headers-only or invalid)",
+
 	// GetConnectionCountCmd help.
 	"getconnectioncount--synopsis": "Returns the number of active connections to other peers.",
 	"getconnectioncount--result0":  "The number of connections",
@@ -367,6 +397,18 @@ var helpDescsEnUS = map[string]string{
 	"getcurrentnet--synopsis": "Get bitcoin network the server is running on.",
 	"getcurrentnet--result0":  "The network identifer",
 
+	// GetDeploymentInfoCmd help.
+	"getdeploymentinfo--synopsis": "Returns the state of each defined soft-fork deployment for a block along with the signalling for it.",
+	"getdeploymentinfo-blockhash": "The hash of the block to report the deployments for, which may be on a side chain (default: the best block)",
+
+	// GetDeploymentInfoResult help.
+	"getdeploymentinforesult-hash":               "The hash of the block the deployments are reported for",
+	"getdeploymentinforesult-height":             "The height of the block the deployments are reported for",
+	"getdeploymentinforesult-deployments":        "JSON object describing the defined deployments",
+	"getdeploymentinforesult-deployments--key":   "deployments",
+	"getdeploymentinforesult-deployments--value": "An object describing a particular deployment",
+	"getdeploymentinforesult-deployments--desc":  "The state of each defined deployment along with its signalling statistics while it is voted on",
+
 	// GetDifficultyCmd help.
 	"getdifficulty--synopsis": "Returns the proof-of-work difficulty as a multiple of the minimum difficulty.",
 	"getdifficulty--result0":  "The difficulty",
@@ -418,12 +460,61 @@ var helpDescsEnUS = map[string]string{
 	// GetInfoCmd help.
 	"getinfo--synopsis": "Returns a JSON object containing various state info.",
 
+	// GetMempoolAncestorsCmd help.
+	"getmempoolancestors--synopsis":   "Returns information about all of the in-mempool ancestors of a transaction in the memory pool.",
+	"getmempoolancestors-txid":        "The hash of the transaction in the memory pool",
+	"getmempoolancestors-verbose":     "Returns JSON object when true or an array of transaction hashes when false",
+	"getmempoolancestors--condition0": "verbose=false",
+	"getmempoolancestors--condition1": "verbose=true",
+	"getmempoolancestors--result0":    "Array of the hashes of the in-mempool ancestors",
+
+	// GetMempoolDescendantsCmd help.
+	"getmempooldescendants--synopsis":   "Returns information about all of the in-mempool descendants of a transaction in the memory pool.",
+	"getmempooldescendants-txid":        "The hash of the transaction in the memory pool",
+	"getmempooldescendants-verbose":     "Returns JSON object when true or an array of transaction hashes when false",
+	"getmempooldescendants--condition0": "verbose=false",
+	"getmempooldescendants--condition1": "verbose=true",
+	"getmempooldescendants--result0":    "Array of the hashes of the in-mempool descendants",
+
+	// GetMempoolEntryCmd help.
+	"getmempoolentry--synopsis": "Returns information about a transaction in the memory pool.",
+	"getmempoolentry-txid":      "The hash of the transaction in the memory pool",
+
+	// GetMempoolEntryResult help.
+	"getmempoolentryresult-vsize":              "The virtual size of the transaction",
+	"getmempoolentryresult-size":               "Transaction size in bytes",
+	"getmempoolentryresult-weight":             "The transaction's weight (between vsize*4-3 and vsize*4)",
+	"getmempoolentryresult-fee":                "Transaction fee in bitcoins (deprecated, use fees.base)",
+	"getmempoolentryresult-modifiedfee":        "Transaction fee in bitcoins used for mining priority (deprecated, use fees.modified)",
+	"getmempoolentryresult-time":               "Local time transaction entered pool in seconds since 1 Jan 1970 GMT",
+	"getmempoolentryresult-height":             "Block height when transaction entered the pool",
+	"getmempoolentryresult-descendantcount":    "Number of in-mempool descendant transactions, including this one",
+	"getmempoolentryresult-descendantsize":     "Virtual size of in-mempool descendants, including this one",
+	"getmempoolentryresult-descendantfees":     "Fees of in-mempool descendants in satoshi, including this one (deprecated, use fees.descendant)",
+	"getmempoolentryresult-ancestorcount":      "Number of in-mempool ancestor transactions, including this one",
+	"getmempoolentryresult-ancestorsize":       "Virtual size of in-mempool ancestors, including this one",
+	"getmempoolentryresult-ancestorfees":       "Fees of in-mempool ancestors in satoshi, including this one (deprecated, use fees.ancestor)",
+	"getmempoolentryresult-wtxid":              "The witness hash of the transaction",
+	"getmempoolentryresult-fees":               "The fees of the transaction and its ancestors and descendants in bitcoins",
+	"getmempoolentryresult-depends":            "Unconfirmed transactions used as inputs for this transaction",
+	"getmempoolentryresult-bip125-replaceable": "Whether the transaction could be replaced due to BIP 125 (replace-by-fee)",
+
+	// MempoolFees help.
+	"mempoolfees-base":       "Transaction fee in bitcoins",
+	"mempoolfees-modified":   "Transaction fee in bitcoins used for mining priority",
+	"mempoolfees-ancestor":   "Fees of in-mempool ancestors in bitcoins, including this one",
+	"mempoolfees-descendant": "Fees of in-mempool descendants in bitcoins, including this one",
+
 	// GetMempoolInfoCmd help.
 	"getmempoolinfo--synopsis": "Returns memory pool information",
 
 	// GetMempoolInfoResult help.
-	"getmempoolinforesult-bytes": "Size in bytes of the mempool",
-	"getmempoolinforesult-size":  "Number of transactions in the mempool",
+	"getmempoolinforesult-bytes":         "Size in bytes of the mempool",
+	"getmempoolinforesult-size":          "Number of transactions in the mempool",
+	"getmempoolinforesult-usage":         "Estimated memory usage in bytes of the mempool",
+	"getmempoolinforesult-maxmempool":    "Maximum memory usage in bytes of the mempool (0 when not limited)",
+	"getmempoolinforesult-mempoolminfee": "Minimum fee rate in BTC/kB for transactions to be accepted, which is raised above the minimum relay fee when transactions are evicted from a full mempool",
+	"getmempoolinforesult-minrelaytxfee": "Minimum relay fee in BTC/kB for non-free transactions",
 
 	// GetMiningInfoResult help.
 	"getmininginforesult-blocks":             "Height of the latest best block",
@@ -475,6 +566,7 @@ var helpDescsEnUS = map[string]string{
 	"getpeerinforesult-relaytxes":      "Peer has requested transactions be relayed to it",
 	"getpeerinforesult-lastsend":       "Time the last message was received in seconds since 1 Jan 1970 GMT",
 	"getpeerinforesult-lastrecv":       "Time the last message was sent in seconds since 1 Jan 1970 GMT",
+	"getpeerinforesult-lastblock":      "Time the peer last announced a new block that was accepted in seconds since 1 Jan 1970 GMT (0 if none)",
 	"getpeerinforesult-bytessent":      "Total bytes sent",
 	"getpeerinforesult-bytesrecv":      "Total bytes received",
 	"getpeerinforesult-conntime":       "Time the connection was made in seconds since 1 Jan 1970 GMT",
@@ -533,6 +625,33 @@ var helpDescsEnUS = map[string]string{
 	"gettxout-vout":           "The index of the output",
 	"gettxout-includemempool": "Include the mempool when true",
 
+	// GetTxOutSetInfoCmd help.
+	"gettxoutsetinfo--synopsis": "Returns statistics about the unspent transaction output set as of the best block.",
+
+	// GetTxOutSetInfoResult help.
+	"gettxoutsetinforesult-height":            "The height of the best block",
+	"gettxoutsetinforesult-bestblock":         "The hash of the best block",
+	"gettxoutsetinforesult-transactions":      "The number of transactions with unspent outputs",
+	"gettxoutsetinforesult-txouts":            "The number of unspent transaction outputs",
+	"gettxoutsetinforesult-bogosize":          "A database-independent metric for the size of the unspent transaction output set",
+	"gettxoutsetinforesult-hash_serialized_2": "The serialized hash of the unspent transaction output set (not maintained, always omitted)",
+	"gettxoutsetinforesult-muhash":            "The MuHash3072 of the unspent transaction output set",
+	"gettxoutsetinforesult-disk_size":         "The estimated size of the unspent transaction output set on disk (not maintained, always omitted)",
+	"gettxoutsetinforesult-total_amount":      "The total amount of all unspent transaction outputs in BTC",
+
+	// GetUtxoCacheInfoCmd help.
+	"getutxocacheinfo--synopsis": "Returns statistics about the in-memory cache of unspent transaction outputs.",
+
+	// GetUtxoCacheInfoResult help.
+	"getutxocacheinforesult-entries":        "The number of cached unspent transaction outputs",
+	"getutxocacheinforesult-size":           "The approximate size of the cache in bytes",
+	"getutxocacheinforesult-maxsize":        "The maximum size of the cache in bytes before it is flushed to the database",
+	"getutxocacheinforesult-hits":           "The number of lookups that were served by the cache",
+	"getutxocacheinforesult-misses":         "The number of lookups that had to be served by the database",
+	"getutxocacheinforesult-hitrate":        "The fraction of lookups that were served by the cache",
+	"getutxocacheinforesult-lastflushblock": "The hash of the block the unspent transaction outputs in the database are consistent with",
+	"getutxocacheinforesult-lastflushtime":  "The time of the last flush to the database in seconds since 1 Jan 1970 GMT",
+
 	// HelpCmd help.
 	"help--synopsis":   "Returns a list of all commands or help for a specified command.",
 	"help-command":     "The command to retrieve help for",
@@ -541,10 +660,38 @@ var helpDescsEnUS = map[string]string{
 	"help--result0":    "List of commands",
 	"help--result1":    "Help for specified command",
 
+	// InvalidateBlockCmd help.
+	"invalidateblock--synopsis": "Permanently marks a block as invalid, as if it violated a consensus rule.\n" +
+		"The block and all of its descendants are disconnected from the best chain when it is part of it.",
+	"invalidateblock-blockhash": "The hash of the block to mark as invalid",
+
 	// PingCmd help.
 	"ping--synopsis": "Queues a ping to be sent to each connected peer.\n" +
 		"Ping times are provided by getpeerinfo via the pingtime and pingwait fields.",
 
+	// PreciousBlockCmd help.
+	"preciousblock--synopsis": "Treats a block as if it were received before others with the same amount of work.\n" +
+		"The best chain is reorganized to the block when it has as much work as the current best chain.",
+	"preciousblock-blockhash": "The hash of the block to mark as precious",
+
+	// PruneBlockchainCmd help.
+	"pruneblockchain--synopsis": "Deletes the block data up to and including the specified height.\n" +
+		"The data for the last 288 blocks of the best chain is always kept.  Requires the node to be started with the prune option.",
+	"pruneblockchain-height":   "The height of the last block to prune",
+	"pruneblockchain--result0": "The height of the last block for which the data has been pruned",
+
+	// ReconsiderBlockCmd help.
+	"reconsiderblock--synopsis": "Removes the invalidity status of a block, its ancestors and its descendants, reconsidering them for activation.\n" +
+		"This can be used to undo the effects of invalidateblock.",
+	"reconsiderblock-blockhash": "The hash of the block to reconsider",
+
+	// SaveMempoolCmd help.
+	"savemempool--synopsis": "Writes the transactions in the memory pool to the mempool.dat file in the data directory.\n" +
+		"The file is reloaded on startup when the node is started with the persistmempool option.",
+
+	// SaveMempoolResult help.
+	"savemempoolresult-filename": "The absolute path of the written file",
+
 	// SearchRawTransactionsCmd help.
 	"searchrawtransactions--synopsis": "Returns raw data for transactions involving the passed address.\n" +
 		"Returned transactions are pulled from both the database, and transactions currently in the mempool.\n" +
@@ -595,6 +742,42 @@ var helpDescsEnUS = map[string]string{
 	"submitblock--condition1": "Block rejected",
 	"submitblock--result1":    "The reason the block was rejected",
 
+	// SubmitPackageCmd help.
+	"submitpackage--synopsis": "Submits a package of serialized, hex-encoded transactions to the memory pool and relays the accepted ones.\n" +
+		"The package consists of a child transaction, which comes last, preceded by its parents sorted so that every transaction comes after its parents.\n" +
+		"Parents paying too low a fee on their own are accepted when the package as a whole pays a sufficient fee.",
+	"submitpackage-rawtxns": "Serialized, hex-encoded signed transactions",
+
+	// SubmitPackageResult help.
+	"submitpackageresult-package_msg": "The result of processing the package, which is 'success' when it was accepted and the reason it was rejected otherwise",
+	"submitpackageresult-tx-results":  "The results for each of the transactions in the package",
+
+	// SubmitPackageTxResult help.
+	"submitpackagetxresult-txid":  "The hash of the transaction",
+	"submitpackagetxresult-wtxid": "The witness hash of the transaction",
+	"submitpackagetxresult-vsize": "The virtual size of the transaction when it is in the memory pool",
+	"submitpackagetxresult-fees":  "The fees paid by the transaction when it was accepted",
+	"submitpackagetxresult-error": "The reason the transaction is not in the memory pool",
+
+	// SubmitPackageFees help.
+	"submitpackagefees-base": "The fee paid by the transaction in BTC",
+
+	// TestMempoolAcceptCmd help.
+	"testmempoolaccept--synopsis": "Checks whether the serialized, hex-encoded transactions would be accepted into the memory pool without adding them to it or relaying them.\n" +
+		"The transactions may spend the outputs of transactions earlier in the list.",
+	"testmempoolaccept-rawtxns": "Serialized, hex-encoded signed transactions",
+
+	// TestMempoolAcceptResult help.
+	"testmempoolacceptresult-txid":          "The hash of the transaction",
+	"testmempoolacceptresult-wtxid":         "The witness hash of the transaction",
+	"testmempoolacceptresult-allowed":       "Whether the transaction would be accepted into the memory pool",
+	"testmempoolacceptresult-vsize":         "The virtual size of the transaction when it is allowed",
+	"testmempoolacceptresult-fees":          "The fees paid by the transaction when it is allowed",
+	"testmempoolacceptresult-reject-reason": "The reason the transaction would be rejected",
+
+	// TestMempoolAcceptFees help.
+	"testmempoolacceptfees-base": "The fee paid by the transaction in BTC",
+
 	// ValidateAddressResult help.
 	"validateaddresschainresult-isvalid":         "Whether or not the address is valid",
 	"validateaddresschainresult-address":         "The bitcoin address (only when isvalid is true)",
@@ -717,6 +900,7 @@ var rpcResultTypes = map[string][]interface{}{
 	"debuglevel":             {(*string)(nil), (*string)(nil)},
 	"decoderawtransaction":   {(*pinjson.TxRawDecodeResult)(nil)},
 	"decodescript":           {(*pinjson.DecodeScriptResult)(nil)},
+	"dumptxoutset":           {(*pinjson.DumpTxOutSetResult)(nil)},
 	"estimatefee":            {(*float64)(nil)},
 	"generate":               {(*[]string)(nil)},
 	"getaddednodeinfo":       {(*[]string)(nil), (*[]pinjson.GetAddedNodeInfoResult)(nil)},
@@ -730,13 +914,18 @@ var rpcResultTypes = map[string][]interface{}{
 	"getblockchaininfo":      {(*pinjson.GetBlockChainInfoResult)(nil)},
 	"getcfilter":             {(*string)(nil)},
 	"getcfilterheader":       {(*string)(nil)},
+	"getchaintips":           {(*[]pinjson.GetChainTipsResult)(nil)},
 	"getconnectioncount":     {(*int32)(nil)},
 	"getcurrentnet":          {(*uint32)(nil)},
+	"getdeploymentinfo":      {(*pinjson.GetDeploymentInfoResult)(nil)},
 	"getdifficulty":          {(*float64)(nil)},
 	"getgenerate":            {(*bool)(nil)},
 	"gethashespersec":        {(*float64)(nil)},
 	"getheaders":             {(*[]string)(nil)},
 	"getinfo":                {(*pinjson.InfoChainResult)(nil)},
+	"getmempoolancestors":    {(*[]string)(nil), (*pinjson.GetMempoolEntryResult)(nil)},
+	"getmempooldescendants":  {(*[]string)(nil), (*pinjson.GetMempoolEntryResult)(nil)},
+	"getmempoolentry":        {(*pinjson.GetMempoolEntryResult)(nil)},
 	"getmempoolinfo":         {(*pinjson.GetMempoolInfoResult)(nil)},
 	"getmininginfo":          {(*pinjson.GetMiningInfoResult)(nil)},
 	"getnettotals":           {(*pinjson.GetNetTotalsResult)(nil)},
@@ -746,15 +935,24 @@ var rpcResultTypes = map[string][]interface{}{
 	"getrawmempool":          {(*[]string)(nil), (*pinjson.GetRawMempoolVerboseResult)(nil)},
 	"getrawtransaction":      {(*string)(nil), (*pinjson.TxRawResult)(nil)},
 	"gettxout":               {(*pinjson.GetTxOutResult)(nil)},
+	"gettxoutsetinfo":        {(*pinjson.GetTxOutSetInfoResult)(nil)},
+	"getutxocacheinfo":       {(*pinjson.GetUtxoCacheInfoResult)(nil)},
 	"node":                   nil,
 	"help":                   {(*string)(nil), (*string)(nil)},
+	"invalidateblock":        nil,
 	"ping":                   nil,
+	"preciousblock":          nil,
+	"pruneblockchain":        {(*int64)(nil)},
+	"reconsiderblock":        nil,
+	"savemempool":            {(*pinjson.SaveMempoolResult)(nil)},
 	"searchrawtransactions":  {(*string)(nil), (*[]pinjson.SearchRawTransactionsResult)(nil)},
 	"sendrawtransaction":     {(*string)(nil)},
 	"setgenerate":            nil,
 	"signmessagewithprivkey": {(*string)(nil)},
 	"stop":                   {(*string)(nil)},
 	"submitblock":            {nil, (*string)(nil)},
+	"submitpackage":          {(*pinjson.SubmitPackageResult)(nil)},
+	"testmempoolaccept":      {(*[]pinjson.TestMempoolAcceptResult)(nil)},
 	"uptime":                 {(*int64)(nil)},
 	"validateaddress":        {(*pinjson.ValidateAddressChainResult)(nil)},
 	"verifychain":            {(*bool)(nil)},
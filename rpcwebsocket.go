@@ -25,6 +25,7 @@ import (
 	"github.com/nyodeco/pind/chaincfg"
 	"github.com/nyodeco/pind/chaincfg/chainhash"
 	"github.com/nyodeco/pind/database"
+	"github.com/nyodeco/pind/mempool"
 	"github.com/nyodeco/pind/txscript"
 	"github.com/nyodeco/pind/wire"
 	"github.com/nyodeco/pinutil"
@@ -226,6 +227,33 @@ func (m *wsNotificationManager) NotifyBlockDisconnected(block *pinutil.Block) {
 	}
 }
 
+// NotifyReorgRejected passes a reorganization refused for exceeding the
+// maximum reorganization depth to the notification manager for block
+// notification processing.
+func (m *wsNotificationManager) NotifyReorgRejected(rejected *blockchain.ReorgRejected) {
+	// As NotifyReorgRejected will be called by the block manager
+	// and the RPC server may no longer be running, use a select
+	// statement to unblock enqueuing the notification once the RPC
+	// server has begun shutting down.
+	select {
+	case m.queueNotification <- (*notificationReorgRejected)(rejected):
+	case <-m.quit:
+	}
+}
+
+// NotifyChainReorganized passes a reorganization of the main chain to the
+// notification manager for block notification processing.
+func (m *wsNotificationManager) NotifyChainReorganized(reorg *blockchain.ChainReorganized) {
+	// As NotifyChainReorganized will be called by the block manager
+	// and the RPC server may no longer be running, use a select
+	// statement to unblock enqueuing the notification once the RPC
+	// server has begun shutting down.
+	select {
+	case m.queueNotification <- (*notificationChainReorganized)(reorg):
+	case <-m.quit:
+	}
+}
+
 // NotifyMempoolTx passes a transaction accepted by mempool to the
 // notification manager for transaction notification processing.  If
 // isNew is true, the tx is is a new transaction, rather than one
@@ -246,6 +274,25 @@ func (m *wsNotificationManager) NotifyMempoolTx(tx *pinutil.Tx, isNew bool) {
 	}
 }
 
+// NotifyMempoolTxRemoved passes a transaction removed from the mempool without
+// being included in a block to the notification manager for transaction
+// notification processing.
+func (m *wsNotificationManager) NotifyMempoolTxRemoved(tx *pinutil.Tx, reason mempool.RemovalReason) {
+	n := &notificationTxRemovedFromMempool{
+		tx:     tx,
+		reason: reason,
+	}
+
+	// As NotifyMempoolTxRemoved will be called by mempool and the RPC
+	// server may no longer be running, use a select statement to unblock
+	// enqueuing the notification once the RPC server has begun shutting
+	// down.
+	select {
+	case m.queueNotification <- n:
+	case <-m.quit:
+	}
+}
+
 // wsClientFilter tracks relevant addresses for each websocket client for
 // the `rescanblocks` extension. It is modified by the `loadtxfilter` command.
 //
@@ -447,10 +494,16 @@ func (f *wsClientFilter) removeUnspentOutPoint(op *wire.OutPoint) {
 // Notification types
 type notificationBlockConnected pinutil.Block
 type notificationBlockDisconnected pinutil.Block
+type notificationReorgRejected blockchain.ReorgRejected
+type notificationChainReorganized blockchain.ChainReorganized
 type notificationTxAcceptedByMempool struct {
 	isNew bool
 	tx    *pinutil.Tx
 }
+type notificationTxRemovedFromMempool struct {
+	tx     *pinutil.Tx
+	reason mempool.RemovalReason
+}
 
 // Notification control requests
 type notificationRegisterClient wsClient
@@ -532,6 +585,14 @@ out:
 						block)
 				}
 
+			case *notificationReorgRejected:
+				rejected := (*blockchain.ReorgRejected)(n)
+				m.notifyReorgRejected(blockNotifications, rejected)
+
+			case *notificationChainReorganized:
+				reorg := (*blockchain.ChainReorganized)(n)
+				m.notifyChainReorganized(blockNotifications, reorg)
+
 			case *notificationTxAcceptedByMempool:
 				if n.isNew && len(txNotifications) != 0 {
 					m.notifyForNewTx(txNotifications, n.tx)
@@ -539,6 +600,9 @@ out:
 				m.notifyForTx(watchedOutPoints, watchedAddrs, n.tx, nil)
 				m.notifyRelevantTxAccepted(n.tx, clients)
 
+			case *notificationTxRemovedFromMempool:
+				m.notifyTxRemoved(txNotifications, n.tx, n.reason)
+
 			case *notificationRegisterBlocks:
 				wsc := (*wsClient)(n)
 				blockNotifications[wsc.quit] = wsc
@@ -730,6 +794,61 @@ func (*wsNotificationManager) notifyBlockDisconnected(clients map[chan struct{}]
 	}
 }
 
+// notifyReorgRejected notifies websocket clients that have registered for
+// block updates when a reorganization of the main chain was refused for
+// exceeding the maximum reorganization depth.
+func (*wsNotificationManager) notifyReorgRejected(clients map[chan struct{}]*wsClient, rejected *blockchain.ReorgRejected) {
+	// Skip notification creation if no clients have requested block
+	// notifications.
+	if len(clients) == 0 {
+		return
+	}
+
+	ntfn := pinjson.NewReorgRejectedNtfn(rejected.ForkHash.String(),
+		rejected.ForkHeight, rejected.OldTipHash.String(),
+		rejected.OldTipHeight, rejected.NewTipHash.String(),
+		rejected.NewTipHeight)
+	marshalledJSON, err := pinjson.MarshalCmd(pinjson.RpcVersion1, nil, ntfn)
+	if err != nil {
+		rpcsLog.Errorf("Failed to marshal reorg rejected notification: "+
+			"%v", err)
+		return
+	}
+	for _, wsc := range clients {
+		wsc.QueueNotification(marshalledJSON)
+	}
+}
+
+// notifyChainReorganized notifies websocket clients that have registered for
+// block updates when the main chain was reorganized.
+func (*wsNotificationManager) notifyChainReorganized(clients map[chan struct{}]*wsClient, reorg *blockchain.ChainReorganized) {
+	// Skip notification creation if no clients have requested block
+	// notifications.
+	if len(clients) == 0 {
+		return
+	}
+
+	detached := make([]string, 0, len(reorg.Detached))
+	for _, block := range reorg.Detached {
+		detached = append(detached, block.Hash().String())
+	}
+	attached := make([]string, 0, len(reorg.Attached))
+	for _, block := range reorg.Attached {
+		attached = append(attached, block.Hash().String())
+	}
+	ntfn := pinjson.NewChainReorganizedNtfn(reorg.ForkHash.String(),
+		reorg.ForkHeight, detached, attached)
+	marshalledJSON, err := pinjson.MarshalCmd(pinjson.RpcVersion1, nil, ntfn)
+	if err != nil {
+		rpcsLog.Errorf("Failed to marshal chain reorganized "+
+			"notification: %v", err)
+		return
+	}
+	for _, wsc := range clients {
+		wsc.QueueNotification(marshalledJSON)
+	}
+}
+
 // notifyFilteredBlockConnected notifies websocket clients that have registered for
 // block updates when a block is connected to the main chain.
 func (m *wsNotificationManager) notifyFilteredBlockConnected(clients map[chan struct{}]*wsClient,
@@ -868,6 +987,30 @@ func (m *wsNotificationManager) notifyForNewTx(clients map[chan struct{}]*wsClie
 	}
 }
 
+// notifyTxRemoved notifies websocket clients that have registered for updates
+// when a transaction is removed from the memory pool without being included in
+// a block.
+func (*wsNotificationManager) notifyTxRemoved(clients map[chan struct{}]*wsClient,
+	tx *pinutil.Tx, reason mempool.RemovalReason) {
+
+	// Skip notification creation if no clients have requested new
+	// transaction notifications.
+	if len(clients) == 0 {
+		return
+	}
+
+	ntfn := pinjson.NewTxRemovedNtfn(tx.Hash().String(), reason.String())
+	marshalledJSON, err := pinjson.MarshalCmd(pinjson.RpcVersion1, nil, ntfn)
+	if err != nil {
+		rpcsLog.Errorf("Failed to marshal tx removed notification: %v",
+			err)
+		return
+	}
+	for _, wsc := range clients {
+		wsc.QueueNotification(marshalledJSON)
+	}
+}
+
 // RegisterSpentRequests requests a notification when each of the passed
 // outpoints is confirmed spent (contained in a block connected to the main
 // chain) for the passed websocket client.  The request is automatically
@@ -6,6 +6,7 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"crypto/rand"
 	"crypto/tls"
@@ -14,6 +15,8 @@ import (
 	"fmt"
 	"math"
 	"net"
+	"os"
+	"path/filepath"
 	"runtime"
 	"sort"
 	"strconv"
@@ -57,6 +60,31 @@ const (
 	// retries when connecting to persistent peers.  It is adjusted by the
 	// number of retries such that there is a retry backoff.
 	connectionRetryInterval = time.Second * 5
+
+	// staleTipCheckInterval is the interval at which the server checks
+	// whether the best chain tip has stopped advancing.
+	staleTipCheckInterval = time.Minute
+
+	// staleTipFactor is the number of target block intervals the best
+	// chain tip may go without advancing before it is considered stale.
+	// With a 40 second target this is a little under 7 minutes, which is
+	// extremely unlikely to happen by chance.
+	staleTipFactor = 10
+
+	// minEvictionConnTime is the minimum amount of time an outbound peer
+	// must have been connected before it is eligible for eviction after
+	// an extra outbound peer was connected due to a stale tip.  It gives
+	// newly connected peers a chance to announce their blocks.
+	minEvictionConnTime = time.Minute * 2
+
+	// mempoolExpiryInterval is the interval at which the server removes
+	// transactions which exceeded the maximum age from the mempool in
+	// addition to doing so whenever a block is connected.
+	mempoolExpiryInterval = time.Minute * 10
+
+	// mempoolFilename is the name of the file in the data directory the
+	// transactions in the mempool are saved to.
+	mempoolFilename = "mempool.dat"
 )
 
 var (
@@ -158,6 +186,18 @@ type peerState struct {
 	persistentPeers map[int32]*serverPeer
 	banned          map[string]time.Time
 	outboundGroups  map[string]int
+
+	// lastTipHash and lastTipUpdate track the best chain tip as of the
+	// last stale tip check and the time it was last seen to advance.
+	lastTipHash   chainhash.Hash
+	lastTipUpdate time.Time
+
+	// extraOutbound is set when an additional outbound connection was
+	// requested due to a stale tip and the worst outbound peer has not
+	// been evicted yet.  extraPeer is the outbound peer which connected
+	// for that request, if any.
+	extraOutbound bool
+	extraPeer     *serverPeer
 }
 
 // Count returns the count of all known peers.
@@ -204,6 +244,14 @@ type server struct {
 	shutdown      int32
 	shutdownSched int32
 	startupTime   int64
+	tipStale      int32
+	lastTipUpdate int64
+
+	// mempoolLoaded is set once the mempool has been loaded from the
+	// mempool file, or immediately when it is not persisted.  The mempool
+	// is never saved before then so that an incomplete load does not
+	// replace the file.
+	mempoolLoaded int32
 
 	chainParams          *chaincfg.Params
 	addrManager          *addrmgr.AddrManager
@@ -229,6 +277,7 @@ type server struct {
 	db                   database.DB
 	timeSource           blockchain.MedianTimeSource
 	services             wire.ServiceFlag
+	targetOutbound       int
 
 	// The following fields are used for optional indexes.  They will be nil
 	// if the associated index is not enabled.  These fields are set during
@@ -260,7 +309,8 @@ type server struct {
 // the blockmanager.
 type serverPeer struct {
 	// The following variables must only be used atomically
-	feeFilter int64
+	feeFilter     int64
+	lastBlockTime int64
 
 	*peer.Peer
 
@@ -276,6 +326,7 @@ type serverPeer struct {
 	addressesMtx   sync.RWMutex
 	knownAddresses map[string]struct{}
 	banScore       connmgr.DynamicBanScore
+	evicted        bool
 	quit           chan struct{}
 	// The following chans are used to sync blockmanager and server.
 	txProcessed    chan struct{}
@@ -1429,6 +1480,22 @@ func (s *server) TransactionConfirmed(tx *pinutil.Tx) {
 	s.RemoveRebroadcastInventory(iv)
 }
 
+// TransactionRemoved is invoked by the mempool whenever a transaction is removed
+// from it without being included in a block, such as when it expires.  The
+// transaction is no longer rebroadcast and websocket clients are notified of
+// the removal.
+func (s *server) TransactionRemoved(tx *pinutil.Tx, reason mempool.RemovalReason) {
+	// Rebroadcasting and notifications are only necessary when the RPC
+	// server is active.
+	if s.rpcServer == nil {
+		return
+	}
+
+	iv := wire.NewInvVect(wire.InvTypeTx, tx.Hash())
+	s.RemoveRebroadcastInventory(iv)
+	s.rpcServer.NotifyTransactionRemoved(tx, reason)
+}
+
 // pushTxMsg sends a tx message for the provided transaction hash to the
 // connected peer.  An error is returned if the transaction hash is not known.
 func (s *server) pushTxMsg(sp *serverPeer, hash *chainhash.Hash, doneChan chan<- struct{},
@@ -1588,9 +1655,12 @@ func (s *server) pushMerkleBlockMsg(sp *serverPeer, hash *chainhash.Hash,
 // handleUpdatePeerHeight updates the heights of all peers who were known to
 // announce a block we recently accepted.
 func (s *server) handleUpdatePeerHeights(state *peerState, umsg updatePeerHeightsMsg) {
+	now := time.Now().Unix()
 	state.forAllPeers(func(sp *serverPeer) {
-		// The origin peer should already have the updated height.
+		// The origin peer should already have the updated height, but
+		// it is credited with announcing the block.
 		if sp.Peer == umsg.originPeer {
+			atomic.StoreInt64(&sp.lastBlockTime, now)
 			return
 		}
 
@@ -1609,10 +1679,163 @@ func (s *server) handleUpdatePeerHeights(state *peerState, umsg updatePeerHeight
 		if *latestBlkHash == *umsg.newHash {
 			sp.UpdateLastBlockHeight(umsg.newHeight)
 			sp.UpdateLastAnnouncedBlock(nil)
+			atomic.StoreInt64(&sp.lastBlockTime, now)
 		}
 	})
 }
 
+// isTipStale returns whether a best chain tip which last advanced at the
+// provided time has failed to advance for much longer than the target block
+// interval as of now.
+func isTipStale(lastTipUpdate, now time.Time, targetTimePerBlock time.Duration) bool {
+	return now.Sub(lastTipUpdate) >= targetTimePerBlock*staleTipFactor
+}
+
+// evictionCandidate houses the details of an outbound peer which are used to
+// choose the worst outbound peer to evict.
+type evictionCandidate struct {
+	id            int32
+	connTime      time.Time
+	lastBlockTime int64
+	lastBlock     int32
+}
+
+// selectEvictionCandidate returns the index of the candidate which least
+// recently announced a new block, preferring to keep candidates that are known
+// to have more work.  Ties are broken by choosing the most recently connected
+// candidate.  Candidates which have not been connected for at least
+// minEvictionConnTime are not considered.  It returns -1 when there is no
+// candidate to evict.
+func selectEvictionCandidate(candidates []evictionCandidate, now time.Time) int {
+	worst := -1
+	for i := range candidates {
+		c := &candidates[i]
+		if now.Sub(c.connTime) < minEvictionConnTime {
+			continue
+		}
+
+		if worst != -1 {
+			w := &candidates[worst]
+			if c.lastBlockTime > w.lastBlockTime {
+				continue
+			}
+			if c.lastBlockTime == w.lastBlockTime {
+				if c.lastBlock > w.lastBlock {
+					continue
+				}
+				if c.lastBlock == w.lastBlock && c.id < w.id {
+					continue
+				}
+			}
+		}
+		worst = i
+	}
+	return worst
+}
+
+// handleStaleTipCheck checks whether the best chain tip has failed to advance
+// for much longer than the target block interval, which might indicate that
+// the server is partitioned from the rest of the network.  When it has, an
+// additional outbound connection is made so that new peers have a chance to
+// provide the missing blocks.  Extra peers which do not announce more work than
+// the best chain tip are dropped in favor of trying another peer, while the
+// worst outbound peer is evicted once an extra peer that does has had time to
+// announce blocks.  It is invoked from the peerHandler goroutine.
+func (s *server) handleStaleTipCheck(state *peerState) {
+	now := time.Now()
+	best := s.chain.BestSnapshot()
+	if best.Hash != state.lastTipHash {
+		state.lastTipHash = best.Hash
+		state.lastTipUpdate = now
+		atomic.StoreInt64(&s.lastTipUpdate, now.Unix())
+	}
+
+	if extra := state.extraPeer; extra != nil {
+		switch {
+		// Drop the extra peer when it does not know of any blocks beyond
+		// the best chain tip so another peer may be tried instead.
+		case extra.LastBlock() <= best.Height:
+			srvrLog.Infof("Disconnecting extra outbound peer %s since "+
+				"it does not announce more work (height %d)", extra,
+				extra.LastBlock())
+			extra.evicted = true
+			extra.Disconnect()
+			state.extraPeer = nil
+			state.extraOutbound = false
+
+		// Evict the worst of the other outbound peers once the extra
+		// peer has had time to provide the blocks it announced.
+		case now.Sub(extra.StatsSnapshot().ConnTime) >= minEvictionConnTime:
+			if s.evictWorstOutboundPeer(state, now) {
+				state.extraPeer = nil
+				state.extraOutbound = false
+			}
+		}
+	}
+
+	if !isTipStale(state.lastTipUpdate, now, s.chainParams.TargetTimePerBlock) {
+		if atomic.SwapInt32(&s.tipStale, 0) != 0 {
+			srvrLog.Infof("Best chain tip %v (height %d) is no "+
+				"longer stale", best.Hash, best.Height)
+		}
+		return
+	}
+	atomic.StoreInt32(&s.tipStale, 1)
+
+	// Extra outbound peers are not used when only connecting to specified
+	// peers or when an extra peer is still pending eviction of another.
+	if cfg.SimNet || len(cfg.ConnectPeers) != 0 || state.extraOutbound {
+		return
+	}
+
+	srvrLog.Warnf("Potential stale tip detected: best block %v (height "+
+		"%d) has not changed in %v -- trying an extra outbound peer",
+		best.Hash, best.Height,
+		now.Sub(state.lastTipUpdate).Truncate(time.Second))
+	state.extraOutbound = true
+	go s.connManager.NewConnReq()
+}
+
+// evictWorstOutboundPeer disconnects the worst non-persistent outbound peer
+// other than the extra outbound peer as chosen by selectEvictionCandidate.  It
+// returns whether or not a peer was evicted.  It is invoked from the
+// peerHandler goroutine.
+func (s *server) evictWorstOutboundPeer(state *peerState, now time.Time) bool {
+	peers := make([]*serverPeer, 0, len(state.outboundPeers))
+	candidates := make([]evictionCandidate, 0, len(state.outboundPeers))
+	for _, sp := range state.outboundPeers {
+		if sp == state.extraPeer {
+			continue
+		}
+		peers = append(peers, sp)
+		candidates = append(candidates, evictionCandidate{
+			id:            sp.ID(),
+			connTime:      sp.StatsSnapshot().ConnTime,
+			lastBlockTime: atomic.LoadInt64(&sp.lastBlockTime),
+			lastBlock:     sp.LastBlock(),
+		})
+	}
+	idx := selectEvictionCandidate(candidates, now)
+	if idx == -1 {
+		return false
+	}
+
+	worst := peers[idx]
+	srvrLog.Infof("Evicting outbound peer %s (height %d, last block "+
+		"announcement %v) after stale tip check", worst,
+		candidates[idx].lastBlock,
+		time.Unix(candidates[idx].lastBlockTime, 0))
+	worst.evicted = true
+	disconnectPeer(state.outboundPeers, func(sp *serverPeer) bool {
+		return sp == worst
+	}, func(sp *serverPeer) {
+		if sp.VersionKnown() {
+			state.outboundGroups[addrmgr.GroupKey(sp.NA())]--
+		}
+	})
+	return true
+}
+
 // handleAddPeerMsg deals with adding new peers.  It is invoked from the
 // peerHandler goroutine.
 func (s *server) handleAddPeerMsg(state *peerState, sp *serverPeer) bool {
@@ -1674,6 +1897,12 @@ func (s *server) handleAddPeerMsg(state *peerState, sp *serverPeer) bool {
 			state.persistentPeers[sp.ID()] = sp
 		} else {
 			state.outboundPeers[sp.ID()] = sp
+
+			// The first outbound peer connected after an extra
+			// outbound connection was requested is the extra peer.
+			if state.extraOutbound && state.extraPeer == nil {
+				state.extraPeer = sp
+			}
 		}
 	}
 
@@ -1740,10 +1969,21 @@ func (s *server) handleDonePeerMsg(state *peerState, sp *serverPeer) {
 			s.connManager.Disconnect(sp.connReq.ID())
 		} else {
 			s.connManager.Remove(sp.connReq.ID())
-			go s.connManager.NewConnReq()
+
+			// Evicted peers are not replaced since they were only
+			// removed to make room for an extra outbound peer.
+			if !sp.evicted {
+				go s.connManager.NewConnReq()
+			}
 		}
 	}
 
+	// A replacement for an extra peer which disconnected on its own
+	// becomes the new extra peer.
+	if sp == state.extraPeer {
+		state.extraPeer = nil
+	}
+
 	if _, ok := list[sp.ID()]; ok {
 		if !sp.Inbound() && sp.VersionKnown() {
 			state.outboundGroups[addrmgr.GroupKey(sp.NA())]--
@@ -2146,7 +2386,11 @@ func (s *server) peerHandler() {
 		outboundPeers:   make(map[int32]*serverPeer),
 		banned:          make(map[string]time.Time),
 		outboundGroups:  make(map[string]int),
+		lastTipHash:     s.chain.BestSnapshot().Hash,
+		lastTipUpdate:   time.Now(),
 	}
+	atomic.StoreInt64(&s.lastTipUpdate, state.lastTipUpdate.Unix())
+	staleTipTicker := time.NewTicker(staleTipCheckInterval)
 
 	if !cfg.DisableDNSSeed {
 		// Add peers discovered through DNS to the address manager.
@@ -2193,6 +2437,10 @@ out:
 		case qmsg := <-s.query:
 			s.handleQuery(state, qmsg)
 
+		// Periodically check whether the best chain tip went stale.
+		case <-staleTipTicker.C:
+			s.handleStaleTipCheck(state)
+
 		case <-s.quit:
 			// Disconnect all peers on server shutdown.
 			state.forAllPeers(func(sp *serverPeer) {
@@ -2203,6 +2451,7 @@ out:
 		}
 	}
 
+	staleTipTicker.Stop()
 	s.connManager.Stop()
 	s.syncManager.Stop()
 	s.addrManager.Stop()
@@ -2287,6 +2536,14 @@ func (s *server) NetTotals() (uint64, uint64) {
 		atomic.LoadUint64(&s.bytesSent)
 }
 
+// StaleTipStatus returns whether or not the best chain tip is currently
+// considered stale along with the time it was last seen to advance.  It is
+// safe for concurrent access.
+func (s *server) StaleTipStatus() (bool, time.Time) {
+	return atomic.LoadInt32(&s.tipStale) != 0,
+		time.Unix(atomic.LoadInt64(&s.lastTipUpdate), 0)
+}
+
 // UpdatePeerHeights updates the heights of all peers who have have announced
 // the latest connected main chain block, or a recognized orphan. These height
 // updates allow us to dynamically refresh peer heights, ensuring sync peer
@@ -2355,6 +2612,99 @@ cleanup:
 	s.wg.Done()
 }
 
+// mempoolExpiryHandler periodically removes transactions which have been in the
+// mempool for longer than the maximum transaction age.  It must be run as a
+// goroutine.
+func (s *server) mempoolExpiryHandler() {
+	ticker := time.NewTicker(mempoolExpiryInterval)
+	defer ticker.Stop()
+
+out:
+	for {
+		select {
+		case <-ticker.C:
+			s.txMemPool.ExpireTransactions()
+
+		case <-s.quit:
+			break out
+		}
+	}
+
+	s.wg.Done()
+}
+
+// loadMempool loads the transactions saved to the mempool file on the last
+// shutdown back into the mempool.  It must be run as a goroutine.
+func (s *server) loadMempool() {
+	defer s.wg.Done()
+
+	path := filepath.Join(cfg.DataDir, mempoolFilename)
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		atomic.StoreInt32(&s.mempoolLoaded, 1)
+		return
+	}
+	if err != nil {
+		txmpLog.Errorf("Unable to open %s: %v", path, err)
+		atomic.StoreInt32(&s.mempoolLoaded, 1)
+		return
+	}
+	defer f.Close()
+
+	txmpLog.Infof("Loading mempool from %s", path)
+	result, err := s.txMemPool.Load(bufio.NewReader(f), s.quit)
+	select {
+	case <-s.quit:
+		return
+	default:
+	}
+	if err != nil {
+		txmpLog.Errorf("Unable to load mempool from %s: %v", path, err)
+	} else {
+		numAccepted := uint64(result.Accepted)
+		txmpLog.Infof("Loaded %d %s into the mempool (%d failed, %d "+
+			"expired)", numAccepted, pickNoun(numAccepted,
+			"transaction", "transactions"), result.Failed,
+			result.Expired)
+	}
+	atomic.StoreInt32(&s.mempoolLoaded, 1)
+}
+
+// saveMempool writes the transactions in the mempool to the mempool file in the
+// data directory and returns its path.  The previous file is only replaced
+// once all transactions have been written.
+func (s *server) saveMempool() (string, error) {
+	if atomic.LoadInt32(&s.mempoolLoaded) == 0 {
+		return "", errors.New("the mempool was not loaded yet")
+	}
+
+	path := filepath.Join(cfg.DataDir, mempoolFilename)
+	tmpPath := path + ".new"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return "", err
+	}
+	bw := bufio.NewWriter(f)
+	numTxns, err := s.txMemPool.Dump(bw)
+	if err == nil {
+		err = bw.Flush()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return "", err
+	}
+
+	txmpLog.Infof("Saved %d %s to %s", numTxns,
+		pickNoun(uint64(numTxns), "transaction", "transactions"), path)
+	return path, nil
+}
+
 // Start begins accepting connections from peers.
 func (s *server) Start() {
 	// Already started?
@@ -2377,6 +2727,20 @@ func (s *server) Start() {
 		go s.upnpUpdateThread()
 	}
 
+	if cfg.MempoolExpiryHours != 0 {
+		s.wg.Add(1)
+		go s.mempoolExpiryHandler()
+	}
+
+	// Reload the transactions saved on the last shutdown when the mempool
+	// is persisted.
+	if cfg.PersistMempool {
+		s.wg.Add(1)
+		go s.loadMempool()
+	} else {
+		atomic.StoreInt32(&s.mempoolLoaded, 1)
+	}
+
 	if !cfg.DisableRPC {
 		s.wg.Add(1)
 
@@ -2412,6 +2776,14 @@ func (s *server) Stop() error {
 		s.rpcServer.Stop()
 	}
 
+	// Save the transactions in the mempool so they are reloaded on the
+	// next startup.
+	if cfg.PersistMempool {
+		if _, err := s.saveMempool(); err != nil {
+			txmpLog.Errorf("Unable to save mempool: %v", err)
+		}
+	}
+
 	// Save fee estimator state in the database.
 	s.db.Update(func(tx database.Tx) error {
 		metadata := tx.Metadata()
@@ -2631,6 +3003,12 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 	if cfg.NoCFilters {
 		services &^= wire.SFNodeCF
 	}
+	if cfg.Prune != 0 {
+		// Pruned nodes only serve the most recent blocks, so advertise
+		// that instead of being a full node per BIP0159.
+		services &^= wire.SFNodeNetwork
+		services |= wire.SFNodeNetworkLimited
+	}
 
 	amgr := addrmgr.New(cfg.DataDir, pindLookup)
 
@@ -2723,15 +3101,30 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 
 	// Create a new block chain instance with the appropriate configuration.
 	var err error
+	// Convert the prune option to the target size in bytes.  Manual pruning
+	// uses the maximum possible target so blocks are only ever pruned on
+	// request.
+	var pruneTarget uint64
+	switch {
+	case cfg.Prune == 1:
+		pruneTarget = math.MaxUint64
+	case cfg.Prune > 1:
+		pruneTarget = cfg.Prune * 1024 * 1024
+	}
 	s.chain, err = blockchain.New(&blockchain.Config{
-		DB:           s.db,
-		Interrupt:    interrupt,
-		ChainParams:  s.chainParams,
-		Checkpoints:  checkpoints,
-		TimeSource:   s.timeSource,
-		SigCache:     s.sigCache,
-		IndexManager: indexManager,
-		HashCache:    s.hashCache,
+		DB:               s.db,
+		Interrupt:        interrupt,
+		ChainParams:      s.chainParams,
+		Checkpoints:      checkpoints,
+		TimeSource:       s.timeSource,
+		SigCache:         s.sigCache,
+		IndexManager:     indexManager,
+		HashCache:        s.hashCache,
+		PruneTarget:      pruneTarget,
+		UtxoCacheMaxSize: uint64(cfg.UtxoCacheMaxSizeMiB) * 1024 * 1024,
+		AssumeValid:      cfg.assumeValid,
+		MinimumChainWork: cfg.minimumChainWork,
+		MaxReorgDepth:    cfg.MaxReorgDepth,
 	})
 	if err != nil {
 		return nil, err
@@ -2778,6 +3171,8 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 			MinRelayTxFee:        cfg.minRelayTxFee,
 			MaxTxVersion:         2,
 			RejectReplacement:    cfg.RejectReplacement,
+			MaxPoolSize:          int64(cfg.MaxMempoolSizeMiB) * 1024 * 1024,
+			MaxTxAge:             time.Duration(cfg.MempoolExpiryHours) * time.Hour,
 		},
 		ChainParams:    chainParams,
 		FetchUtxoView:  s.chain.FetchUtxoView,
@@ -2791,6 +3186,7 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 		HashCache:          s.hashCache,
 		AddrIndex:          s.addrIndex,
 		FeeEstimator:       s.feeEstimator,
+		TxRemoved:          s.TransactionRemoved,
 	}
 	s.txMemPool = mempool.New(&txC)
 
@@ -2886,6 +3282,7 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 	if cfg.MaxPeers < targetOutbound {
 		targetOutbound = cfg.MaxPeers
 	}
+	s.targetOutbound = targetOutbound
 	cmgr, err := connmgr.New(&connmgr.Config{
 		Listeners:      listeners,
 		OnAccept:       s.inboundPeerConnected,
@@ -2938,6 +3335,7 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 			ChainParams:  chainParams,
 			DB:           db,
 			TxMemPool:    s.txMemPool,
+			SaveMempool:  s.saveMempool,
 			Generator:    blockTemplateGenerator,
 			CPUMiner:     s.cpuMiner,
 			TxIndex:      s.txIndex,
@@ -0,0 +1,117 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestIsTipStale ensures the best chain tip is only considered stale once it
+// has not advanced for the expected number of target block intervals.
+func TestIsTipStale(t *testing.T) {
+	const targetTimePerBlock = time.Minute * 10
+	now := time.Unix(1600000000, 0)
+	staleAfter := targetTimePerBlock * staleTipFactor
+
+	tests := []struct {
+		name       string
+		lastUpdate time.Time
+		stale      bool
+	}{{
+		name:       "just updated",
+		lastUpdate: now,
+		stale:      false,
+	}, {
+		name:       "several block intervals",
+		lastUpdate: now.Add(-targetTimePerBlock * 3),
+		stale:      false,
+	}, {
+		name:       "one second before stale",
+		lastUpdate: now.Add(-staleAfter + time.Second),
+		stale:      false,
+	}, {
+		name:       "exactly stale",
+		lastUpdate: now.Add(-staleAfter),
+		stale:      true,
+	}, {
+		name:       "long after stale",
+		lastUpdate: now.Add(-staleAfter * 5),
+		stale:      true,
+	}}
+
+	for _, test := range tests {
+		stale := isTipStale(test.lastUpdate, now, targetTimePerBlock)
+		if stale != test.stale {
+			t.Errorf("%s: unexpected stale result -- got %v, want %v",
+				test.name, stale, test.stale)
+		}
+	}
+}
+
+// TestSelectEvictionCandidate ensures the worst outbound peer is chosen for
+// eviction.
+func TestSelectEvictionCandidate(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	old := now.Add(-minEvictionConnTime)
+	recent := now.Add(-minEvictionConnTime + time.Second)
+
+	tests := []struct {
+		name       string
+		candidates []evictionCandidate
+		want       int
+	}{{
+		name:       "no candidates",
+		candidates: nil,
+		want:       -1,
+	}, {
+		name: "only recently connected candidates",
+		candidates: []evictionCandidate{
+			{id: 1, connTime: recent, lastBlockTime: 0, lastBlock: 5},
+			{id: 2, connTime: now, lastBlockTime: 0, lastBlock: 5},
+		},
+		want: -1,
+	}, {
+		name: "least recent block announcement",
+		candidates: []evictionCandidate{
+			{id: 1, connTime: old, lastBlockTime: 300, lastBlock: 5},
+			{id: 2, connTime: old, lastBlockTime: 100, lastBlock: 9},
+			{id: 3, connTime: old, lastBlockTime: 200, lastBlock: 1},
+		},
+		want: 1,
+	}, {
+		name: "recently connected peer is protected",
+		candidates: []evictionCandidate{
+			{id: 1, connTime: old, lastBlockTime: 300, lastBlock: 5},
+			{id: 2, connTime: recent, lastBlockTime: 0, lastBlock: 0},
+			{id: 3, connTime: old, lastBlockTime: 200, lastBlock: 5},
+		},
+		want: 2,
+	}, {
+		name: "same announcement time keeps more work",
+		candidates: []evictionCandidate{
+			{id: 1, connTime: old, lastBlockTime: 100, lastBlock: 4},
+			{id: 2, connTime: old, lastBlockTime: 100, lastBlock: 7},
+			{id: 3, connTime: old, lastBlockTime: 100, lastBlock: 6},
+		},
+		want: 0,
+	}, {
+		name: "full tie evicts most recently connected",
+		candidates: []evictionCandidate{
+			{id: 4, connTime: old, lastBlockTime: 100, lastBlock: 7},
+			{id: 9, connTime: old, lastBlockTime: 100, lastBlock: 7},
+			{id: 6, connTime: old, lastBlockTime: 100, lastBlock: 7},
+		},
+		want: 1,
+	}}
+
+	for _, test := range tests {
+		got := selectEvictionCandidate(test.candidates, now)
+		if got != test.want {
+			t.Errorf("%s: unexpected eviction candidate -- got %d, "+
+				"want %d", test.name, got, test.want)
+		}
+	}
+}